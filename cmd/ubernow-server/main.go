@@ -0,0 +1,468 @@
+// Command ubernow-server runs the uberNow web app, its HTML frontend and its JSON REST API
+// under /api/, and its gRPC API, together with the job queues, the workers and the scheduler
+// which process the requests they take.
+//
+// The jobs and the schedule are kept in files under -data-dir, so they survive a restart,
+// unless they are kept in the database of -store postgres.
+// The jobs which don't fit in the -queue-length of a job queue wait in its file, -overflow
+// says how many: any number with spill, or -queue-length with reject, block and shed.
+// A -data-dir holding job queues belongs to one server, a second one fails to start with it.
+// The users and requests are kept in a SQLite database, -sqlite-file, whose schema is
+// migrated on startup, or in memory with -store memory. With -store postgres they are kept
+// in the PostgreSQL database of -postgres-url, which also holds the job queues, the schedule
+// and the dead letters, so several servers can share it and take the jobs from each other.
+// The lease in the database elects one of them to fire the scheduled cab requests, they don't
+// use -data-dir at all. The travel times come from the
+// Google Maps Distance Matrix API with -traffic google, whose key is -google-maps-key, or
+// from the OSRM server of -osrm-url with -traffic osrm. The base travel time of a request,
+// which doesn't need live traffic, can come from another of them, -base-traffic. The etas
+// of the cabs come from the APIs of the cab services of -cabs, like -cabs uber,ola,lyft,
+// whose cab types are then valid. With -notifications email the booking times are emailed
+// through the SMTP server of -smtp-host, from the templates of -smtp-templates if it is set,
+// and with -notifications sms they are texted through the SMS gateway of -sms-url. Both
+// can be given, -notifications email,sms, each request is then notified by the type of
+// its address. The services which are not configured are fakes which make up their answers.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/app"
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/email"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/fake"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/googlemaps"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/logging"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/lyft"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/memory"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/ola"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/osrm"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/postgres"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/sms"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/sqlite"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/uber"
+	"github.com/anirbanroydas/ubernow-go/pkg/interfaces/rpc"
+	"github.com/anirbanroydas/ubernow-go/pkg/interfaces/rpc/ubernowpb"
+	"github.com/anirbanroydas/ubernow-go/pkg/interfaces/web"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+type config struct {
+	addr                 string
+	grpcAddr             string
+	dataDir              string
+	store                string
+	sqliteFile           string
+	postgresURL          string
+	postgresConns        int
+	logLevel             string
+	workers              int
+	queueLength          int
+	overflow             string
+	overflowTimeout      time.Duration
+	shedThreshold        float64
+	shutdownTimeout      time.Duration
+	leaseTTL             time.Duration
+	catchUpWindow        time.Duration
+	idempotencyRetention time.Duration
+	traffic              string
+	baseTraffic          string
+	googleMapsKey        string
+	osrmURL              string
+	osrmCongestion       string
+	cabs                 string
+	uberServerToken      string
+	uberClientID         string
+	uberClientSecret     string
+	uberProducts         string
+	olaAppToken          string
+	lyftClientID         string
+	lyftClientSecret     string
+	notifications        string
+	smtpHost             string
+	smtpPort             int
+	smtpUser             string
+	smtpPassword         string
+	smtpFrom             string
+	smtpTLS              string
+	smtpTemplates        string
+	smsURL               string
+	smsFrom              string
+	smsUser              string
+	smsPassword          string
+	timezone             string
+	averageSpeed         float64
+	cabEta               time.Duration
+}
+
+func parseFlags() config {
+	var c config
+	flag.StringVar(&c.addr, "addr", ":8080", "address the HTTP server listens on")
+	flag.StringVar(&c.grpcAddr, "grpc-addr", ":9090", "address the gRPC server listens on")
+	flag.StringVar(&c.dataDir, "data-dir", "data", "directory of the job queue, schedule and lease files")
+	flag.StringVar(&c.store, "store", "sqlite", "where the users and requests are kept: sqlite, postgres or memory")
+	flag.StringVar(&c.sqliteFile, "sqlite-file", "", "SQLite database file of -store sqlite (default <data-dir>/ubernow.db)")
+	flag.StringVar(&c.postgresURL, "postgres-url", os.Getenv("UBERNOW_POSTGRES_URL"), "PostgreSQL connection string of -store postgres (default $UBERNOW_POSTGRES_URL)")
+	flag.IntVar(&c.postgresConns, "postgres-conns", postgres.DefaultPoolConfig.MaxOpenConns, "most connections to PostgreSQL a server opens")
+	flag.StringVar(&c.logLevel, "log-level", "info", "lowest level which is logged: debug, info, warn or error")
+	flag.IntVar(&c.workers, "workers", 4, "number of workers per job queue")
+	flag.IntVar(&c.queueLength, "queue-length", 100, "length of each in-memory job queue")
+	flag.StringVar(&c.overflow, "overflow", "spill", "what a job queue in -data-dir does with a job once -queue-length jobs wait in it: spill to its file, reject, block or shed")
+	flag.DurationVar(&c.overflowTimeout, "overflow-timeout", 5*time.Second, "longest time a job waits for room with -overflow block or shed")
+	flag.Float64Var(&c.shedThreshold, "shed-threshold", 0.8, "fraction of -queue-length waiting jobs beyond which -overflow shed rejects low priority jobs")
+	flag.DurationVar(&c.shutdownTimeout, "shutdown-timeout", 30*time.Second, "time given to the jobs in progress on shutdown")
+	flag.DurationVar(&c.leaseTTL, "lease-ttl", 15*time.Second, "time after which another server takes over the scheduler of a dead one")
+	flag.DurationVar(&c.catchUpWindow, "catch-up-window", time.Hour, "scheduled cab requests overdue by more than this on startup are dropped")
+	flag.DurationVar(&c.idempotencyRetention, "idempotency-retention", 24*time.Hour, "time a request created with an idempotency key is returned for the key")
+	flag.StringVar(&c.traffic, "traffic", "fake", "where the travel times come from: google, osrm or fake")
+	flag.StringVar(&c.baseTraffic, "base-traffic", "", "where the base travel times come from: google, osrm or fake (default -traffic)")
+	flag.StringVar(&c.googleMapsKey, "google-maps-key", os.Getenv("GOOGLE_MAPS_API_KEY"), "API key of the Distance Matrix API of -traffic google (default $GOOGLE_MAPS_API_KEY)")
+	flag.StringVar(&c.osrmURL, "osrm-url", "", "URL of the OSRM server of -traffic osrm, like http://localhost:5000")
+	flag.StringVar(&c.osrmCongestion, "osrm-congestion", "", "JSON file of the congestion multipliers per hour of week of -traffic osrm")
+	flag.StringVar(&c.cabs, "cabs", "fake", "where the etas of the cabs come from: fake, or a list of uber, ola and lyft")
+	flag.StringVar(&c.uberServerToken, "uber-server-token", os.Getenv("UBER_SERVER_TOKEN"), "server token of the Uber API of -cabs uber (default $UBER_SERVER_TOKEN)")
+	flag.StringVar(&c.uberClientID, "uber-client-id", os.Getenv("UBER_CLIENT_ID"), "OAuth client id of the Uber API, without a server token (default $UBER_CLIENT_ID)")
+	flag.StringVar(&c.uberClientSecret, "uber-client-secret", os.Getenv("UBER_CLIENT_SECRET"), "OAuth client secret of the Uber API, without a server token (default $UBER_CLIENT_SECRET)")
+	flag.StringVar(&c.uberProducts, "uber-products", "", "product ids of the Uber cab types of the city, like uberGo=<id>,uberX=<id>")
+	flag.StringVar(&c.olaAppToken, "ola-app-token", os.Getenv("OLA_APP_TOKEN"), "app token of the Ola API of -cabs ola (default $OLA_APP_TOKEN)")
+	flag.StringVar(&c.lyftClientID, "lyft-client-id", os.Getenv("LYFT_CLIENT_ID"), "OAuth client id of the Lyft API of -cabs lyft (default $LYFT_CLIENT_ID)")
+	flag.StringVar(&c.lyftClientSecret, "lyft-client-secret", os.Getenv("LYFT_CLIENT_SECRET"), "OAuth client secret of the Lyft API of -cabs lyft (default $LYFT_CLIENT_SECRET)")
+	flag.StringVar(&c.notifications, "notifications", "fake", "how the booking times are notified: fake, or a list of email and sms")
+	flag.StringVar(&c.smtpHost, "smtp-host", "", "SMTP server of -notifications email")
+	flag.IntVar(&c.smtpPort, "smtp-port", email.DefaultPort, "port of the SMTP server")
+	flag.StringVar(&c.smtpUser, "smtp-user", "", "username the SMTP server is logged in with, if any")
+	flag.StringVar(&c.smtpPassword, "smtp-password", os.Getenv("SMTP_PASSWORD"), "password of -smtp-user (default $SMTP_PASSWORD)")
+	flag.StringVar(&c.smtpFrom, "smtp-from", "", "address the emails are sent from, like 'uberNow <notify@example.com>'")
+	flag.StringVar(&c.smtpTLS, "smtp-tls", string(email.StartTLS), "how the connection to the SMTP server is secured: starttls, tls or none")
+	flag.StringVar(&c.smtpTemplates, "smtp-templates", "", "directory of the templates overriding those of the emails: "+email.SubjectFile+", "+email.TextFile+" and "+email.HTMLFile)
+	flag.StringVar(&c.smsURL, "sms-url", "", "endpoint of the SMS gateway of -notifications sms, like https://api.twilio.com/2010-04-01/Accounts/<sid>/Messages.json")
+	flag.StringVar(&c.smsFrom, "sms-from", "", "phone number or sender id the messages are sent from")
+	flag.StringVar(&c.smsUser, "sms-user", os.Getenv("SMS_USER"), "username of the SMS gateway, like the Twilio account sid (default $SMS_USER)")
+	flag.StringVar(&c.smsPassword, "sms-password", os.Getenv("SMS_PASSWORD"), "password of -sms-user, like the Twilio auth token (default $SMS_PASSWORD)")
+	flag.StringVar(&c.timezone, "timezone", "UTC", "time zone of the times in the notifications, like Asia/Kolkata")
+	flag.Float64Var(&c.averageSpeed, "fake-average-speed", 25, "average speed in km/h of the fake traffic service")
+	flag.DurationVar(&c.cabEta, "fake-cab-eta", 8*time.Minute, "eta of every cab of the fake cab service")
+	flag.Parse()
+	return c
+}
+
+func main() {
+	c := parseFlags()
+	level, ok := domain.ParseLogLevel(c.logLevel)
+	logger := logging.NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), level)
+	if !ok {
+		logger.Warn("unknown log level, using info", domain.NewField("log_level", c.logLevel))
+	}
+
+	if err := run(c, logger); err != nil {
+		logger.Error("ubernow-server stopped", domain.NewField(domain.ErrorKey, err))
+		os.Exit(1)
+	}
+}
+
+func run(c config, logger domain.Logger) error {
+	ts, err := trafficService(c, c.traffic)
+	if err != nil {
+		return err
+	}
+	cs, err := cabService(c)
+	if err != nil {
+		return err
+	}
+	ns, err := notificationService(c, logger)
+	if err != nil {
+		return err
+	}
+	policy, ok := usecases.ParseOverflowPolicy(c.overflow)
+	if !ok {
+		return errors.Errorf("unknown overflow policy %q, expected spill, reject, block or shed", c.overflow)
+	}
+	var baseTS domain.TrafficService
+	if c.baseTraffic != "" && c.baseTraffic != c.traffic {
+		if baseTS, err = trafficService(c, c.baseTraffic); err != nil {
+			return err
+		}
+	}
+	ac := app.Config{
+		DataDir:              c.dataDir,
+		Workers:              c.workers,
+		QueueLength:          c.queueLength,
+		Overflow:             usecases.OverflowConfig{Policy: policy, BlockTimeout: c.overflowTimeout, ShedThreshold: c.shedThreshold},
+		LeaseTTL:             c.leaseTTL,
+		CatchUpWindow:        c.catchUpWindow,
+		IdempotencyRetention: c.idempotencyRetention,
+		TrafficService:       ts,
+		BaseTrafficService:   baseTS,
+		CabService:           cs,
+		NotificationService:  ns,
+		Logger:               logger,
+	}
+	closeStore, err := openStore(c, &ac, logger)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+	a, err := app.New(ac)
+	if err != nil {
+		return err
+	}
+	a.Start()
+	// stopApp shuts the App down when the servers fail to start or to keep serving
+	stopApp := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.shutdownTimeout)
+		defer cancel()
+		a.Shutdown(ctx)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", web.NewAPI(a.UserInteractor, a.DeadLetterInteractor, logger))
+	mux.Handle("/", web.NewUI(a.UserInteractor, logger))
+	srv := &http.Server{
+		Addr:              c.addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	rpcServer := rpc.NewServer(a.UserInteractor, logger)
+	grpcServer := grpc.NewServer()
+	ubernowpb.RegisterUberNowServer(grpcServer, rpcServer)
+	lis, err := net.Listen("tcp", c.grpcAddr)
+	if err != nil {
+		stopApp()
+		return errors.Wrap(err, "couldn't listen for gRPC")
+	}
+
+	serving := make(chan error, 2)
+	go func() {
+		logger.Info("ubernow-server listening", domain.NewField("addr", c.addr))
+		serving <- errors.Wrap(srv.ListenAndServe(), "HTTP server failed")
+	}()
+	go func() {
+		logger.Info("ubernow-server listening for gRPC", domain.NewField("addr", c.grpcAddr))
+		serving <- errors.Wrap(grpcServer.Serve(lis), "gRPC server failed")
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case sig := <-signals:
+		logger.Info("ubernow-server shutting down", domain.NewField("signal", sig.String()))
+	case err = <-serving:
+		stopApp()
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.shutdownTimeout)
+	defer cancel()
+	stopServing := func(ctx context.Context) error {
+		rpcServer.Close()
+		stopGRPC(ctx, grpcServer)
+		return errors.Wrap(srv.Shutdown(ctx), "HTTP server didn't shut down cleanly")
+	}
+	return shutdown(ctx, stopServing, a)
+}
+
+// trafficService returns the domain.TrafficService named name, of -traffic or -base-traffic.
+func trafficService(c config, name string) (domain.TrafficService, error) {
+	switch name {
+	case "fake":
+		return fake.NewTrafficService(c.averageSpeed, 10*time.Minute), nil
+	case "google":
+		if c.googleMapsKey == "" {
+			return nil, errors.New("-traffic google needs -google-maps-key")
+		}
+		return googlemaps.NewTrafficService(googlemaps.Config{APIKey: c.googleMapsKey})
+	case "osrm":
+		if c.osrmURL == "" {
+			return nil, errors.New("-traffic osrm needs -osrm-url")
+		}
+		oc := osrm.Config{BaseURL: c.osrmURL}
+		if c.osrmCongestion != "" {
+			p, err := osrm.LoadCongestionProfile(c.osrmCongestion)
+			if err != nil {
+				return nil, err
+			}
+			oc.Congestion = p
+		}
+		return osrm.NewTrafficService(oc)
+	default:
+		return nil, errors.Errorf("unknown traffic service %q, expected google, osrm or fake", name)
+	}
+}
+
+// cabService returns the domain.CabService of -cabs, the cab services of the list are
+// chosen by the cab of each request.
+func cabService(c config) (domain.CabService, error) {
+	if c.cabs == "fake" {
+		return fake.NewCabService(c.cabEta), nil
+	}
+	services := make(usecases.CabServices)
+	for _, name := range strings.Split(c.cabs, ",") {
+		var cs domain.CabService
+		var err error
+		switch name {
+		case uber.Name:
+			products, perr := uber.ParseProducts(c.uberProducts)
+			if perr != nil {
+				return nil, errors.Wrap(perr, "invalid -uber-products")
+			}
+			cs, err = uber.NewCabService(uber.Config{
+				ServerToken:  c.uberServerToken,
+				ClientID:     c.uberClientID,
+				ClientSecret: c.uberClientSecret,
+				Products:     products,
+			})
+		case ola.Name:
+			cs, err = ola.NewCabService(ola.Config{AppToken: c.olaAppToken})
+		case lyft.Name:
+			cs, err = lyft.NewCabService(lyft.Config{ClientID: c.lyftClientID, ClientSecret: c.lyftClientSecret})
+		default:
+			return nil, errors.Errorf("unknown cab service %q, expected fake, or a list of uber, ola and lyft", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		services[name] = cs
+	}
+	return services, nil
+}
+
+// notificationService returns the domain.NotificationService of -notifications, the
+// notification services of the list are chosen by the address type of each request.
+func notificationService(c config, logger domain.Logger) (domain.NotificationService, error) {
+	if c.notifications == "fake" {
+		return fake.NewNotificationService(logger), nil
+	}
+	loc, err := time.LoadLocation(c.timezone)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid -timezone")
+	}
+	services := make(usecases.NotificationServices)
+	for _, name := range strings.Split(c.notifications, ",") {
+		var ns domain.NotificationService
+		switch name {
+		case email.AddrType:
+			ec := email.Config{
+				Host:     c.smtpHost,
+				Port:     c.smtpPort,
+				Username: c.smtpUser,
+				Password: c.smtpPassword,
+				From:     c.smtpFrom,
+				TLSMode:  email.TLSMode(c.smtpTLS),
+				Location: loc,
+			}
+			if c.smtpTemplates != "" {
+				if ec.Templates, err = email.LoadTemplates(c.smtpTemplates); err != nil {
+					return nil, err
+				}
+			}
+			ns, err = email.NewSender(ec)
+		case sms.AddrType:
+			p, perr := sms.NewHTTPProvider(sms.HTTPConfig{URL: c.smsURL, From: c.smsFrom, Username: c.smsUser, Password: c.smsPassword})
+			if perr != nil {
+				return nil, perr
+			}
+			ns, err = sms.NewSender(sms.Config{Provider: p, Location: loc})
+		default:
+			return nil, errors.Errorf("unknown notification service %q, expected fake, or a list of email and sms", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		services[name] = ns
+	}
+	return services, nil
+}
+
+// openStore sets the repositories of the App, and their Transactor, to those of the -store,
+// and returns the function which closes them. The postgres store has the job queues, the
+// schedule, the lease and the dead letters too.
+func openStore(c config, ac *app.Config, logger domain.Logger) (func(), error) {
+	switch c.store {
+	case "memory":
+		ac.UserRepository = memory.NewUserRepository()
+		ac.RequestRepository = memory.NewRequestRepository()
+		ac.BookingResponses = memory.NewCabBookingResponseRepository()
+		return func() {}, nil
+	case "sqlite":
+		path := c.sqliteFile
+		if path == "" {
+			if err := os.MkdirAll(c.dataDir, 0700); err != nil {
+				return nil, errors.Wrap(err, "couldn't create data directory")
+			}
+			path = filepath.Join(c.dataDir, "ubernow.db")
+		}
+		db, err := sqlite.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("opened database", domain.NewField("sqlite_file", path))
+		ac.UserRepository = db.UserRepository()
+		ac.RequestRepository = db.RequestRepository()
+		ac.BookingResponses = db.CabBookingResponseRepository()
+		ac.Transactor = db
+		return func() { db.Close() }, nil
+	case "postgres":
+		if c.postgresURL == "" {
+			return nil, errors.New("-store postgres needs -postgres-url")
+		}
+		db, err := postgres.Open(c.postgresURL, postgres.PoolConfig{MaxOpenConns: c.postgresConns, MaxIdleConns: c.postgresConns})
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("opened database", domain.NewField("postgres_conns", c.postgresConns))
+		ac.UserRepository = db.UserRepository()
+		ac.RequestRepository = db.RequestRepository()
+		ac.BookingResponses = db.CabBookingResponseRepository()
+		ac.Transactor = db
+		ac.OpenJobQueue = func(name string, maxQueueLength int, codec *usecases.JobCodec) (app.JobQueue, error) {
+			return db.OpenQueue(name, maxQueueLength, codec, logger.With(domain.NewField("queue", name))), nil
+		}
+		ac.ScheduleStore = db.ScheduleStore()
+		ac.Lease = db.Lease("cron")
+		ac.OpenDeadLetterStore = func(codec *usecases.JobCodec) usecases.DeadLetterStore {
+			return db.DeadLetterStore(codec)
+		}
+		return func() { db.Close() }, nil
+	default:
+		return nil, errors.Errorf("unknown store %q, expected sqlite, postgres or memory", c.store)
+	}
+}
+
+// stopGRPC stops the gRPC server once the calls in progress are done, the calls which are
+// still in progress when ctx is done are cut.
+func stopGRPC(ctx context.Context, s *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.Stop()
+	}
+}
+
+// shutdown stops taking requests and then shuts the App down, it stops feeding the queues
+// and firing the schedule and lets the workers drain the queues. Whatever is left when ctx
+// is done stays in the job logs and is picked up again by the next start.
+func shutdown(ctx context.Context, stopServing func(context.Context) error, a *app.App) error {
+	failed := stopServing(ctx)
+	if err := a.Shutdown(ctx); err != nil {
+		failed = err
+	}
+	return failed
+}
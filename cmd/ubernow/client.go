@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/app"
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// request is a request as the API returns it, the Token only when it is submitted.
+type request struct {
+	ID               uint64                 `json:"id"`
+	Token            string                 `json:"token,omitempty"`
+	UserID           uint64                 `json:"user_id"`
+	Source           usecases.LocationInput `json:"source"`
+	Destination      usecases.LocationInput `json:"destination"`
+	ReachingTime     time.Time              `json:"reaching_time"`
+	Cab              string                 `json:"cab"`
+	CabType          string                 `json:"cab_type"`
+	NotificationAddr usecases.AddressInput  `json:"notification_addr"`
+	Status           string                 `json:"status"`
+	TriggerTime      *time.Time             `json:"trigger_time,omitempty"`
+	BookingTime      *time.Time             `json:"booking_time,omitempty"`
+	History          []event                `json:"history"`
+}
+
+type event struct {
+	Status string    `json:"status"`
+	At     time.Time `json:"at"`
+}
+
+// finished returns if nothing is left to be done for the request.
+func (r request) finished() bool {
+	return r.Status == string(domain.RequestNotified) || r.Status == string(domain.RequestCancelled)
+}
+
+// deadLetter is a job which failed for good, as the API returns it.
+type deadLetter struct {
+	ID        uint64    `json:"id"`
+	JobType   string    `json:"job_type"`
+	RequestID uint64    `json:"request_id"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+// client is how the commands reach the application, over the API of a server or in process.
+type client interface {
+	// Submit creates the request, key is its idempotency key if it is not empty. The
+	// returned request has the token which Status, Cancel and Wait need.
+	Submit(in usecases.UserRequestInput, key string) (request, error)
+	Status(id uint64, token string) (request, error)
+	Cancel(id uint64, token string) (request, error)
+	DeadLetters() ([]deadLetter, error)
+	// Wait calls changed with the request every time its status changes, until it is
+	// finished or ctx is done, and returns the request as it was last seen.
+	Wait(ctx context.Context, id uint64, token string, changed func(request)) (request, error)
+	Close() error
+}
+
+// apiError is an error response of the API.
+type apiError struct {
+	StatusCode int
+	Message    string `json:"error"`
+	Field      string `json:"field"`
+	Errors     []struct {
+		Field string `json:"field"`
+		Error string `json:"error"`
+	} `json:"errors"`
+}
+
+func (e *apiError) Error() string {
+	msg := fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+	if e.Field != "" {
+		msg += " (" + e.Field + ")"
+	}
+	for _, fe := range e.Errors {
+		msg += fmt.Sprintf("\n  %s: %s", fe.Field, fe.Error)
+	}
+	return msg
+}
+
+// httpClient is the client of the JSON REST API of a server. Wait polls the request every
+// poll interval.
+type httpClient struct {
+	baseURL string
+	http    *http.Client
+	poll    time.Duration
+}
+
+func (c *httpClient) Submit(in usecases.UserRequestInput, key string) (request, error) {
+	var r request
+	var header http.Header
+	if key != "" {
+		header = http.Header{"Idempotency-Key": {key}}
+	}
+	err := c.do(http.MethodPost, "/api/requests", header, in, &r)
+	return r, err
+}
+
+func (c *httpClient) Status(id uint64, token string) (request, error) {
+	var r request
+	err := c.do(http.MethodGet, "/api/requests/"+strconv.FormatUint(id, 10), bearer(token), nil, &r)
+	return r, err
+}
+
+func (c *httpClient) Cancel(id uint64, token string) (request, error) {
+	var r request
+	err := c.do(http.MethodPost, "/api/requests/"+strconv.FormatUint(id, 10)+"/cancel", bearer(token), nil, &r)
+	return r, err
+}
+
+// bearer returns the Authorization header of the token of a request.
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func (c *httpClient) DeadLetters() ([]deadLetter, error) {
+	var resp struct {
+		DeadLetters []deadLetter `json:"dead_letters"`
+	}
+	err := c.do(http.MethodGet, "/api/deadletters", nil, nil, &resp)
+	return resp.DeadLetters, err
+}
+
+func (c *httpClient) Wait(ctx context.Context, id uint64, token string, changed func(request)) (request, error) {
+	r, err := c.Status(id, token)
+	if err != nil {
+		return r, err
+	}
+	changed(r)
+	ticker := time.NewTicker(c.poll)
+	defer ticker.Stop()
+	for !r.finished() {
+		select {
+		case <-ctx.Done():
+			return r, ctx.Err()
+		case <-ticker.C:
+		}
+		latest, err := c.Status(id, token)
+		if err != nil {
+			return r, err
+		}
+		if latest.Status != r.Status {
+			changed(latest)
+		}
+		r = latest
+	}
+	return r, nil
+}
+
+func (c *httpClient) Close() error {
+	return nil
+}
+
+// do sends the request with the header and body encoded as JSON and decodes the response
+// into v. A response which is not a 2xx is returned as an *apiError.
+func (c *httpClient) do(method, path string, header http.Header, body, v interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, "couldn't encode request")
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.baseURL, "/")+path, reqBody)
+	if err != nil {
+		return errors.Wrap(err, "couldn't create request")
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "couldn't reach server")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		apiErr := apiError{StatusCode: resp.StatusCode}
+		if err = json.NewDecoder(resp.Body).Decode(&apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = "unexpected response"
+		}
+		return &apiErr
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(v), "couldn't decode response")
+}
+
+func newHTTPClient(baseURL string, timeout, poll time.Duration) *httpClient {
+	c := httpClient{
+		baseURL: baseURL,
+		http:    &http.Client{Timeout: timeout},
+		poll:    poll,
+	}
+	return &c
+}
+
+// localClient runs the application in process, with its job queues and schedule in a
+// temporary directory which is removed on Close. Nothing is kept between runs.
+type localClient struct {
+	app     *app.App
+	dataDir string
+}
+
+func (c *localClient) Submit(in usecases.UserRequestInput, key string) (request, error) {
+	dto, err := in.DTO()
+	if err == nil {
+		err = dto.SetIdempotencyKey(key)
+	}
+	if err != nil {
+		return request{}, err
+	}
+	ur, err := c.app.UserInteractor.CreateUserRequest(dto)
+	if err != nil {
+		return request{}, err
+	}
+	r := newRequest(ur.Request)
+	r.Token = ur.Request.Token
+	return r, nil
+}
+
+func (c *localClient) Status(id uint64, token string) (request, error) {
+	r, err := c.app.UserInteractor.GetUserRequest(id, token)
+	if err != nil {
+		return request{}, err
+	}
+	return newRequest(r), nil
+}
+
+func (c *localClient) Cancel(id uint64, token string) (request, error) {
+	r, err := c.app.UserInteractor.CancelUserRequest(id, token)
+	if err != nil {
+		return request{}, err
+	}
+	return newRequest(r), nil
+}
+
+func (c *localClient) DeadLetters() ([]deadLetter, error) {
+	dls, err := c.app.DeadLetterInteractor.ListDeadLetters()
+	if err != nil {
+		return nil, err
+	}
+	resp := make([]deadLetter, 0, len(dls))
+	for _, dl := range dls {
+		resp = append(resp, deadLetter{
+			ID:        dl.ID,
+			JobType:   dl.JobType,
+			RequestID: dl.RequestID,
+			Attempts:  dl.Attempts,
+			LastError: dl.LastError,
+			FailedAt:  dl.FailedAt,
+		})
+	}
+	return resp, nil
+}
+
+func (c *localClient) Wait(ctx context.Context, id uint64, token string, changed func(request)) (request, error) {
+	r, updates, stop, err := c.app.UserInteractor.WatchUserRequest(id, token)
+	if err != nil {
+		return request{}, err
+	}
+	defer stop()
+	changed(newRequest(r))
+	for !r.Finished() {
+		select {
+		case <-ctx.Done():
+			return newRequest(r), ctx.Err()
+		case u := <-updates:
+			if u.Request.Status == r.Status {
+				continue
+			}
+			r = u.Request
+			changed(newRequest(r))
+		}
+	}
+	return newRequest(r), nil
+}
+
+// Close shuts the application down, the jobs still in progress after shutdownTimeout are
+// dropped with the temporary directory.
+func (c *localClient) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := c.app.Shutdown(ctx)
+	if rmErr := os.RemoveAll(c.dataDir); rmErr != nil && err == nil {
+		err = errors.Wrap(rmErr, "couldn't remove data directory")
+	}
+	return err
+}
+
+// shutdownTimeout is the time the jobs in progress are given when a localClient is closed.
+const shutdownTimeout = 5 * time.Second
+
+func newLocalClient(c app.Config) (*localClient, error) {
+	dataDir, err := os.MkdirTemp("", "ubernow-")
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't create data directory")
+	}
+	c.DataDir = dataDir
+	a, err := app.New(c)
+	if err != nil {
+		os.RemoveAll(dataDir)
+		return nil, err
+	}
+	a.Start()
+	lc := localClient{
+		app:     a,
+		dataDir: dataDir,
+	}
+	return &lc, nil
+}
+
+func newRequest(r *domain.Request) request {
+	resp := request{
+		ID:               r.ID(),
+		UserID:           r.UserID,
+		Source:           usecases.LocationInput{Name: r.Source.Name, Latitude: r.Source.Latitude, Longitude: r.Source.Longitude},
+		Destination:      usecases.LocationInput{Name: r.Destination.Name, Latitude: r.Destination.Latitude, Longitude: r.Destination.Longitude},
+		ReachingTime:     r.ReachingTime,
+		Cab:              r.Cab,
+		CabType:          r.CabType,
+		NotificationAddr: usecases.AddressInput{Type: r.NotificationAddr.AddrType, Value: r.NotificationAddr.Value},
+		Status:           string(r.Status),
+		History:          make([]event, 0, len(r.History)),
+	}
+	for _, e := range r.History {
+		resp.History = append(resp.History, event{Status: string(e.Status), At: e.At})
+	}
+	if !r.TriggerTime.IsZero() {
+		t := r.TriggerTime
+		resp.TriggerTime = &t
+	}
+	if !r.BookingTime.IsZero() {
+		t := r.BookingTime
+		resp.BookingTime = &t
+	}
+	return resp
+}
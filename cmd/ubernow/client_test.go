@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/app"
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/fake"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/logging"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/memory"
+	"github.com/anirbanroydas/ubernow-go/pkg/interfaces/web"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+func testConfig() app.Config {
+	logger := logging.NewStdLogger(log.New(io.Discard, "", 0), domain.ErrorLevel)
+	return app.Config{
+		Workers:              2,
+		QueueLength:          10,
+		LeaseTTL:             time.Second,
+		CatchUpWindow:        time.Hour,
+		IdempotencyRetention: time.Hour,
+		UserRepository:       memory.NewUserRepository(),
+		RequestRepository:    memory.NewRequestRepository(),
+		TrafficService:       fake.NewTrafficService(25, time.Minute),
+		CabService:           fake.NewCabService(8 * time.Minute),
+		NotificationService:  fake.NewNotificationService(logger),
+		Logger:               logger,
+	}
+}
+
+// testInput is a request whose route takes longer than the time left, so it is notified
+// right away.
+func testInput() usecases.UserRequestInput {
+	return usecases.UserRequestInput{
+		Name:             "roy",
+		Source:           usecases.LocationInput{Latitude: "12.9352", Longitude: "77.6245"},
+		Destination:      usecases.LocationInput{Latitude: "13.1986", Longitude: "77.7066"},
+		ReachingTime:     time.Now().Add(10 * time.Minute).Format(time.RFC3339),
+		Cab:              "uber",
+		CabType:          "uberGo",
+		NotificationAddr: usecases.AddressInput{Type: "email", Value: "anirban.nick@gmail.com"},
+	}
+}
+
+// testHTTPClient serves the API of an App, which runs in process like with -local, and
+// returns an httpClient of it.
+func testHTTPClient(t *testing.T) *httpClient {
+	t.Helper()
+	c := testConfig()
+	lc, err := newLocalClient(c)
+	if err != nil {
+		t.Fatalf("newLocalClient() => got: %v, expected: nil", err)
+	}
+	t.Cleanup(func() { lc.Close() })
+	srv := httptest.NewServer(web.NewAPI(lc.app.UserInteractor, lc.app.DeadLetterInteractor, c.Logger))
+	t.Cleanup(srv.Close)
+	return newHTTPClient(srv.URL, time.Second, 10*time.Millisecond)
+}
+
+func TestClients(t *testing.T) {
+	lc, err := newLocalClient(testConfig())
+	if err != nil {
+		t.Fatalf("newLocalClient() => got: %v, expected: nil", err)
+	}
+	defer lc.Close()
+
+	testCases := []struct {
+		name   string
+		client client
+	}{
+		{"http client", testHTTPClient(t)},
+		{"local client", lc},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.client
+			in := testInput()
+			r, err := c.Submit(in, "key-1")
+			if err != nil || r.ID == 0 || r.UserID == 0 || r.Token == "" {
+				t.Fatalf("Submit() => got: (%+v, %v), expected a stored request with its token", r, err)
+			}
+			token := r.Token
+			retry, err := c.Submit(in, "key-1")
+			if err != nil || retry.ID != r.ID {
+				t.Errorf("Submit() retried with the key => got: (%+v, %v), expected request %d", retry, err, r.ID)
+			}
+
+			var seen []string
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			r, err = c.Wait(ctx, r.ID, token, func(r request) { seen = append(seen, r.Status) })
+			if err != nil || r.Status != string(domain.RequestNotified) || seen[len(seen)-1] != r.Status {
+				t.Errorf("Wait() => got: (%s, %v) after %v, expected the request to be notified", r.Status, err, seen)
+			}
+			if len(r.History) != 4 || r.History[0].Status != string(domain.RequestPending) {
+				t.Errorf("Wait() => got history: %v, expected 4 status changes from pending", r.History)
+			}
+
+			if _, err = c.Status(r.ID, "guessed"); err == nil {
+				t.Errorf("Status(%d) with another token => got: nil, expected an error", r.ID)
+			}
+			_, err = c.Cancel(r.ID, token)
+			if err == nil {
+				t.Errorf("Cancel(%d) of a notified request => got: nil, expected an error", r.ID)
+			}
+			dls, err := c.DeadLetters()
+			if err != nil || len(dls) != 0 {
+				t.Errorf("DeadLetters() => got: (%v, %v), expected none", dls, err)
+			}
+		})
+	}
+}
+
+func TestHTTPClientErrors(t *testing.T) {
+	c := testHTTPClient(t)
+
+	_, err := c.Status(42, "token")
+	if apiErr, ok := err.(*apiError); !ok || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Status(42) => got: %v, expected a %d", err, http.StatusNotFound)
+	}
+
+	in := testInput()
+	in.Source.Longitude = ""
+	in.Cab = ""
+	_, err = c.Submit(in, "")
+	apiErr, ok := err.(*apiError)
+	if !ok || apiErr.StatusCode != http.StatusUnprocessableEntity || len(apiErr.Errors) != 2 {
+		t.Errorf("Submit() of invalid input => got: %v, expected a %d naming 2 fields", err, http.StatusUnprocessableEntity)
+	}
+}
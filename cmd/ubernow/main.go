@@ -0,0 +1,386 @@
+// Command ubernow is the command line client of uberNow, for the on-call engineers. It
+// submits requests, shows their status and the history of their status, cancels them and
+// lists the jobs which failed for good, the dead letters.
+//
+// It talks to the JSON REST API of an ubernow-server at -server. With -local it runs the
+// application in process instead, with the fake traffic, cab and notification services of
+// the server, which is meant for local experiments: nothing is kept between runs, so only
+// submit is available, and it waits for the request to finish.
+//
+// Usage:
+//
+//	ubernow [-server URL | -local] [-json] <command> [arguments]
+//
+// The commands are:
+//
+//	submit       submit a request, -wait to follow it until it finishes
+//	status       show a request and the history of its status
+//	cancel       cancel a request
+//	deadletters  list the jobs which failed for good
+//
+// A submitted request is shown with its token, which status and cancel need with -token.
+//
+// With -json the result is written to stdout as JSON, for scripts. The progress of a
+// request which is waited for is written to stderr.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/app"
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/fake"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/logging"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/memory"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// errUsage is returned for invalid arguments, after the usage was printed.
+var errUsage = errors.New("invalid usage")
+
+type config struct {
+	server       string
+	local        bool
+	json         bool
+	timeout      time.Duration
+	poll         time.Duration
+	verbose      bool
+	averageSpeed float64
+	cabEta       time.Duration
+}
+
+const usage = `usage: ubernow [flags] <command> [arguments]
+
+commands:
+  submit [flags]        submit a request, see ubernow submit -h
+  status -token T <id>  show a request and the history of its status
+  cancel -token T <id>  cancel a request
+  deadletters           list the jobs which failed for good
+
+flags:
+`
+
+func parseFlags(args []string) (config, []string, error) {
+	var c config
+	fs := flag.NewFlagSet("ubernow", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&c.server, "server", envOr("UBERNOW_SERVER", "http://localhost:8080"), "base URL of the ubernow-server, defaults to $UBERNOW_SERVER")
+	fs.BoolVar(&c.local, "local", false, "run the application in process with fake services instead of talking to a server")
+	fs.BoolVar(&c.json, "json", false, "write the result as JSON")
+	fs.DurationVar(&c.timeout, "timeout", 10*time.Second, "timeout of each call to the server")
+	fs.DurationVar(&c.poll, "poll", 5*time.Second, "interval at which a request which is waited for is polled")
+	fs.BoolVar(&c.verbose, "v", false, "log what the application does in -local mode")
+	fs.Float64Var(&c.averageSpeed, "fake-average-speed", 25, "average speed in km/h of the fake traffic service in -local mode")
+	fs.DurationVar(&c.cabEta, "fake-cab-eta", 8*time.Minute, "eta of every cab of the fake cab service in -local mode")
+	if err := fs.Parse(args); err != nil {
+		return c, nil, errUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return c, nil, errUsage
+	}
+	return c, fs.Args(), nil
+}
+
+func envOr(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdout, os.Stderr)
+	switch {
+	case err == errUsage:
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "ubernow:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	c, args, err := parseFlags(args)
+	if err != nil {
+		return err
+	}
+	cmd, args := args[0], args[1:]
+	commands := map[string]func(context.Context, client, []string, *printer) error{
+		"submit":      submit,
+		"status":      status,
+		"cancel":      cancel,
+		"deadletters": deadLetters,
+	}
+	command, ok := commands[cmd]
+	if !ok {
+		fmt.Fprintf(stderr, "ubernow: unknown command %q\n", cmd)
+		return errUsage
+	}
+	if c.local && cmd != "submit" {
+		return errors.Errorf("%s is not available with -local, nothing is kept between runs", cmd)
+	}
+
+	var cl client
+	if c.local {
+		logOutput := io.Discard
+		if c.verbose {
+			logOutput = stderr
+		}
+		logger := logging.NewStdLogger(log.New(logOutput, "", log.LstdFlags), domain.DebugLevel)
+		cl, err = newLocalClient(app.Config{
+			Workers:              2,
+			QueueLength:          10,
+			Overflow:             usecases.OverflowConfig{Policy: usecases.SpillOnFull},
+			LeaseTTL:             15 * time.Second,
+			CatchUpWindow:        time.Hour,
+			IdempotencyRetention: time.Hour,
+			UserRepository:       memory.NewUserRepository(),
+			RequestRepository:    memory.NewRequestRepository(),
+			BookingResponses:     memory.NewCabBookingResponseRepository(),
+			TrafficService:       fake.NewTrafficService(c.averageSpeed, 10*time.Minute),
+			CabService:           fake.NewCabService(c.cabEta),
+			NotificationService:  fake.NewNotificationService(logger),
+			Logger:               logger,
+		})
+		if err != nil {
+			return err
+		}
+		// a request submitted in process is lost when the process exits
+		args = append([]string{"-wait"}, args...)
+	} else {
+		cl = newHTTPClient(c.server, c.timeout, c.poll)
+	}
+	defer cl.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	p := &printer{out: stdout, progress: stderr, json: c.json}
+	return command(ctx, cl, args, p)
+}
+
+func submit(ctx context.Context, cl client, args []string, p *printer) error {
+	var in usecases.UserRequestInput
+	var from, to, reachAt, email, key string
+	var wait bool
+	fs := flag.NewFlagSet("submit", flag.ContinueOnError)
+	fs.SetOutput(p.progress)
+	fs.StringVar(&in.Name, "name", os.Getenv("USER"), "name of the user")
+	fs.StringVar(&from, "from", "", "source as latitude,longitude")
+	fs.StringVar(&in.Source.Name, "from-name", "", "name of the source")
+	fs.StringVar(&to, "to", "", "destination as latitude,longitude")
+	fs.StringVar(&in.Destination.Name, "to-name", "", "name of the destination")
+	fs.StringVar(&reachAt, "reach-at", "", "time to reach the destination at, like 2018-03-09T10:00 or +45m from now")
+	fs.StringVar(&in.Cab, "cab", "uber", "cab to book")
+	fs.StringVar(&in.CabType, "cab-type", "uberGo", "type of the cab")
+	fs.StringVar(&email, "email", "", "email address the user is notified at")
+	fs.StringVar(&key, "idempotency-key", "", "key which makes submitting the same request again return the request submitted first")
+	fs.BoolVar(&wait, "wait", false, "wait for the request to be notified or cancelled")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	in.Source.Latitude, in.Source.Longitude = splitCoordinates(from)
+	in.Destination.Latitude, in.Destination.Longitude = splitCoordinates(to)
+	in.ReachingTime = reachingTime(reachAt, time.Now())
+	if email != "" {
+		in.NotificationAddr = usecases.AddressInput{Type: "email", Value: email}
+	}
+
+	r, err := cl.Submit(in, key)
+	if err != nil {
+		return err
+	}
+	if wait {
+		token := r.Token
+		r, err = cl.Wait(ctx, r.ID, token, p.progressOf)
+		r.Token = token
+		if err != nil && ctx.Err() != nil {
+			return errors.Errorf("stopped waiting for request %d, it is %s", r.ID, r.Status)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return p.request(r)
+}
+
+// splitCoordinates splits latitude,longitude, the coordinates are validated by the server.
+func splitCoordinates(s string) (string, string) {
+	if s == "" {
+		return "", ""
+	}
+	parts := strings.SplitN(s, ",", 2)
+	if len(parts) == 1 {
+		return strings.TrimSpace(parts[0]), ""
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+}
+
+// reachingTime turns a duration like +45m into the time that far from now, any other value
+// is a time which is parsed by the server.
+func reachingTime(s string, now time.Time) string {
+	if strings.HasPrefix(s, "+") {
+		if d, err := time.ParseDuration(s[1:]); err == nil {
+			return now.Add(d).Format(time.RFC3339)
+		}
+	}
+	return s
+}
+
+func status(ctx context.Context, cl client, args []string, p *printer) error {
+	id, token, err := requestArgs("status", args, p)
+	if err != nil {
+		return err
+	}
+	r, err := cl.Status(id, token)
+	if err != nil {
+		return err
+	}
+	return p.request(r)
+}
+
+func cancel(ctx context.Context, cl client, args []string, p *printer) error {
+	id, token, err := requestArgs("cancel", args, p)
+	if err != nil {
+		return err
+	}
+	r, err := cl.Cancel(id, token)
+	if err != nil {
+		return err
+	}
+	return p.request(r)
+}
+
+func deadLetters(ctx context.Context, cl client, args []string, p *printer) error {
+	if len(args) != 0 {
+		fmt.Fprintln(p.progress, "usage: ubernow deadletters")
+		return errUsage
+	}
+	dls, err := cl.DeadLetters()
+	if err != nil {
+		return err
+	}
+	return p.deadLetters(dls)
+}
+
+// requestArgs returns the id of the request the command is about and its -token.
+func requestArgs(cmd string, args []string, p *printer) (uint64, string, error) {
+	var token string
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(p.progress)
+	fs.StringVar(&token, "token", "", "token of the request, shown when it was submitted")
+	if err := fs.Parse(args); err != nil {
+		return 0, "", errUsage
+	}
+	if token == "" {
+		fmt.Fprintf(p.progress, "usage: ubernow %s -token <token> <id>\n", cmd)
+		return 0, "", errUsage
+	}
+	id, err := idArg(cmd, fs.Args(), p)
+	return id, token, err
+}
+
+// idArg returns the only argument of the command, an id.
+func idArg(cmd string, args []string, p *printer) (uint64, error) {
+	if len(args) != 1 {
+		fmt.Fprintf(p.progress, "usage: ubernow %s <id>\n", cmd)
+		return 0, errUsage
+	}
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil || id == 0 {
+		fmt.Fprintf(p.progress, "ubernow %s: %q is not an id\n", cmd, args[0])
+		return 0, errUsage
+	}
+	return id, nil
+}
+
+// printer writes the results of the commands to out, as text or as JSON, and the progress
+// of a request which is waited for to progress.
+type printer struct {
+	out      io.Writer
+	progress io.Writer
+	json     bool
+}
+
+const timeLayout = "2006-01-02 15:04:05 MST"
+
+func (p *printer) progressOf(r request) {
+	fmt.Fprintf(p.progress, "%s request %d is %s\n", time.Now().Format(timeLayout), r.ID, r.Status)
+}
+
+func (p *printer) writeJSON(v interface{}) error {
+	enc := json.NewEncoder(p.out)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(v), "couldn't write result")
+}
+
+func (p *printer) request(r request) error {
+	if p.json {
+		return p.writeJSON(r)
+	}
+	w := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "request\t%d\n", r.ID)
+	if r.Token != "" {
+		fmt.Fprintf(w, "token\t%s\n", r.Token)
+	}
+	fmt.Fprintf(w, "user\t%d\n", r.UserID)
+	fmt.Fprintf(w, "status\t%s\n", r.Status)
+	fmt.Fprintf(w, "from\t%s\n", place(r.Source))
+	fmt.Fprintf(w, "to\t%s\n", place(r.Destination))
+	fmt.Fprintf(w, "reach at\t%s\n", r.ReachingTime.Local().Format(timeLayout))
+	fmt.Fprintf(w, "cab\t%s %s\n", r.Cab, r.CabType)
+	fmt.Fprintf(w, "notify\t%s %s\n", r.NotificationAddr.Type, r.NotificationAddr.Value)
+	if r.TriggerTime != nil {
+		fmt.Fprintf(w, "cabs checked at\t%s\n", r.TriggerTime.Local().Format(timeLayout))
+	}
+	if r.BookingTime != nil {
+		fmt.Fprintf(w, "book at\t%s\n", r.BookingTime.Local().Format(timeLayout))
+	}
+	fmt.Fprintf(w, "history\t\n")
+	for _, e := range r.History {
+		fmt.Fprintf(w, "  %s\t%s\n", e.At.Local().Format(timeLayout), e.Status)
+	}
+	return errors.Wrap(w.Flush(), "couldn't write result")
+}
+
+func (p *printer) deadLetters(dls []deadLetter) error {
+	if p.json {
+		return p.writeJSON(dls)
+	}
+	w := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tJOB\tREQUEST\tATTEMPTS\tFAILED AT\tLAST ERROR")
+	for _, dl := range dls {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\t%s\n", dl.ID, dl.JobType, dl.RequestID, dl.Attempts, dl.FailedAt.Local().Format(timeLayout), dl.LastError)
+	}
+	return errors.Wrap(w.Flush(), "couldn't write result")
+}
+
+// place returns the name of the location with its coordinates, or only the coordinates.
+func place(l usecases.LocationInput) string {
+	if l.Name == "" {
+		return l.Latitude + "," + l.Longitude
+	}
+	return fmt.Sprintf("%s (%s,%s)", l.Name, l.Latitude, l.Longitude)
+}
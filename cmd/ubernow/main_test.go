@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReachingTime(t *testing.T) {
+	now := time.Date(2018, time.March, 9, 9, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name     string
+		s        string
+		expected string
+	}{
+		{"relative time", "+45m", "2018-03-09T09:45:00Z"},
+		{"absolute time", "2018-03-09T10:00", "2018-03-09T10:00"},
+		{"invalid relative time", "+soon", "+soon"},
+		{"empty", "", ""},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			if result := reachingTime(tc.s, now); result != tc.expected {
+				t.Errorf("reachingTime(%q) => got: %q, expected: %q", tc.s, result, tc.expected)
+			}
+		})
+	}
+}
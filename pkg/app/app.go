@@ -0,0 +1,288 @@
+// package app puts the application together: the use cases, the durable job queues and the
+// workers which consume them, the scheduler and the election of the server which fires it,
+// and the repositories and services given to it. The commands which run the application,
+// the server and the local mode of the CLI, share it.
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/deadletter"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/flock"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/idempotency"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/jobstore"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/lease"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/scheduler"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// jobTypes are the job queues of the App, upstream queues first as their jobs add jobs to
+// the queues downstream.
+var jobTypes = []string{usecases.UserRequestJobType, usecases.CabRequestJobType, usecases.NotificationJobType}
+
+// Config is what the App is made of. The jobs and the schedule are kept in files under
+// DataDir, so they survive a restart. The job queue files belong to a single App, which
+// locks DataDir, so another App with the same DataDir fails to start. With OpenJobQueue set,
+// DataDir only holds the schedule and the lease, and servers sharing it elect one of them to
+// fire the scheduled cab requests. ScheduleStore and Lease, if they are set, keep the
+// schedule and the lease somewhere else, DataDir isn't used once they and OpenJobQueue are
+// set. The dead letters are kept in memory, unless OpenDeadLetterStore opens a store of
+// them. Overflow says what the job queues in files do with a job once QueueLength jobs wait
+// in them for room. The idempotency keys of the requests are kept for
+// IdempotencyRetention, in memory unless the Transactor keeps them. The Transactor of the
+// repositories is optional, with it a request and its user are stored only if the request
+// is queued. OpenJobQueue is optional too, it
+// opens the job queue of a job type somewhere else than in a file under DataDir. Every
+// computed booking response is kept in BookingResponses, if it is set. The base travel
+// times come from BaseTrafficService, if it is set, instead of the TrafficService. The codes
+// which confirm the addresses of the users are sent by the NotificationService, if it is a
+// domain.ConfirmationSender. The requests are validated against the Catalog of the
+// CabService, if it is a usecases.CabCataloger, and against the default cabs otherwise.
+type Config struct {
+	DataDir              string
+	Workers              int
+	QueueLength          int
+	Overflow             usecases.OverflowConfig
+	LeaseTTL             time.Duration
+	CatchUpWindow        time.Duration
+	IdempotencyRetention time.Duration
+
+	UserRepository      domain.UserRepository
+	RequestRepository   domain.RequestRepository
+	BookingResponses    domain.CabBookingResponseRepository
+	Transactor          usecases.Transactor
+	OpenJobQueue        func(name string, maxQueueLength int, codec *usecases.JobCodec) (JobQueue, error)
+	ScheduleStore       usecases.ScheduleStore
+	Lease               usecases.Lease
+	OpenDeadLetterStore func(codec *usecases.JobCodec) usecases.DeadLetterStore
+	TrafficService      domain.TrafficService
+	BaseTrafficService  domain.TrafficService
+	CabService          domain.CabService
+	NotificationService domain.NotificationService
+	Logger              domain.Logger
+}
+
+// JobQueue is a durable job queue, like a jobstore.FileQueue. Run feeds its jobs to the
+// channel returned by Jobs until its context is done, and Close is called once the
+// Dispatcher consuming them is shut down.
+type JobQueue interface {
+	usecases.AppEngine
+	usecases.JobCheckpointer
+	Jobs() chan usecases.Job
+	Run(context.Context) error
+	Close() error
+}
+
+// queue is a durable job queue and the Dispatcher whose workers consume it.
+type queue struct {
+	JobQueue
+	dispatcher *usecases.Dispatcher
+}
+
+// App is the application with its interactors, which the delivery mechanisms serve. Its
+// jobs are processed between Start and Shutdown.
+type App struct {
+	UserInteractor       *usecases.UserInteractor
+	DeadLetterInteractor *usecases.DeadLetterInteractor
+
+	config        Config
+	dataLock      *os.File
+	queues        map[string]*queue
+	scheduleStore *jobstore.FileScheduleStore
+	scheduler     *scheduler.Scheduler
+	elector       *scheduler.Elector
+	stopWork      context.CancelFunc
+	stopFeeding   context.CancelFunc
+	feeding       chan struct{}
+	electing      chan struct{}
+}
+
+// Start starts the workers of the job queues, feeds them the jobs left in the job logs and
+// runs for the election of the server which fires the schedule.
+func (a *App) Start() {
+	logger := a.config.Logger
+	// the workers outlive the feeders and the scheduler, so that they can drain the queues
+	workCtx, stopWork := context.WithCancel(context.Background())
+	feedCtx, stopFeeding := context.WithCancel(context.Background())
+	a.stopWork, a.stopFeeding = stopWork, stopFeeding
+	for name, q := range a.queues {
+		q.dispatcher.Run(workCtx, a.config.Workers)
+		go func(name string, q *queue) {
+			defer func() { a.feeding <- struct{}{} }()
+			if err := q.Run(feedCtx); err != nil {
+				logger.Error("job queue stopped", domain.NewField("queue", name), domain.NewField(domain.ErrorKey, err))
+			}
+		}(name, q)
+	}
+	go func() {
+		defer close(a.electing)
+		a.elector.Run(feedCtx, a.scheduler.Run)
+	}()
+}
+
+// Shutdown stops feeding the queues and firing the schedule, and then lets the workers drain
+// the queues. Whatever is left when ctx is done stays in the job logs and is picked up again
+// by the next start. The App can't be started again.
+func (a *App) Shutdown(ctx context.Context) error {
+	var failed error
+	if a.stopFeeding != nil {
+		a.stopFeeding()
+		<-a.electing
+		for range a.queues {
+			<-a.feeding
+		}
+		for _, name := range jobTypes {
+			if err := a.queues[name].dispatcher.Shutdown(ctx); err != nil {
+				a.config.Logger.Error("job queue didn't shut down cleanly", domain.NewField("queue", name), domain.NewField(domain.ErrorKey, err))
+				failed = err
+			}
+		}
+		a.stopWork()
+	}
+	a.close()
+	return failed
+}
+
+// close closes the job queues and the file of the schedule, and unlocks DataDir.
+func (a *App) close() {
+	for _, q := range a.queues {
+		q.Close()
+	}
+	if a.scheduleStore != nil {
+		a.scheduleStore.Close()
+	}
+	if a.dataLock != nil {
+		a.dataLock.Close()
+	}
+}
+
+// lockDataDir takes the lock of DataDir, which the App holds until it is closed.
+func (a *App) lockDataDir() error {
+	path := filepath.Join(a.config.DataDir, "lock")
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrap(err, "couldn't open data directory lock file")
+	}
+	ok, err := flock.TryLock(f)
+	if err != nil || !ok {
+		f.Close()
+		if err == nil {
+			err = errors.Errorf("data directory %s is used by another server", a.config.DataDir)
+		}
+		return errors.Wrap(err, "couldn't lock data directory")
+	}
+	a.dataLock = f
+	return nil
+}
+
+// New is a constructor which takes the Config, opens the job queues and the schedule under
+// its DataDir, which it locks for the job queues, and returns a pointer to a new App, which
+// is not started yet.
+func New(c Config) (*App, error) {
+	if c.OpenJobQueue == nil || c.ScheduleStore == nil || c.Lease == nil {
+		if err := os.MkdirAll(c.DataDir, 0700); err != nil {
+			return nil, errors.Wrap(err, "couldn't create data directory")
+		}
+	}
+	logger := c.Logger
+	a := App{
+		config:   c,
+		queues:   make(map[string]*queue),
+		feeding:  make(chan struct{}, len(jobTypes)),
+		electing: make(chan struct{}),
+	}
+
+	// the JobCodec is filled in once the interactors exist, the queues need it to decode
+	// the jobs, and the interactors need the queues to add jobs to
+	codec := usecases.NewJobCodec(nil, nil, nil, nil, nil, nil)
+	openJobQueue := c.OpenJobQueue
+	if openJobQueue == nil {
+		if err := a.lockDataDir(); err != nil {
+			return nil, err
+		}
+		openJobQueue = func(name string, maxQueueLength int, codec *usecases.JobCodec) (JobQueue, error) {
+			return jobstore.OpenFileQueue(filepath.Join(c.DataDir, name+".log"), name, maxQueueLength, c.Overflow, codec, logger)
+		}
+	}
+	for _, name := range jobTypes {
+		jq, err := openJobQueue(name, c.QueueLength, codec)
+		if err != nil {
+			a.close()
+			return nil, err
+		}
+		a.queues[name] = &queue{JobQueue: jq}
+	}
+	engines := map[string]usecases.AppEngine{}
+	for name, q := range a.queues {
+		engines[name] = q
+	}
+
+	// the schedule of the Config is closed by whoever opened it, the App only closes the
+	// file it opens
+	schedule := c.ScheduleStore
+	if schedule == nil {
+		fs, err := jobstore.OpenFileScheduleStore(filepath.Join(c.DataDir, "schedule.log"))
+		if err != nil {
+			a.close()
+			return nil, err
+		}
+		a.scheduleStore, schedule = fs, fs
+	}
+	catchUp := usecases.CatchUpPolicy{Mode: usecases.CatchUpWithinWindow, Window: c.CatchUpWindow}
+	var err error
+	a.scheduler, err = scheduler.NewScheduler(schedule, codec, engines, catchUp, logger)
+	if err != nil {
+		a.close()
+		return nil, err
+	}
+
+	watcher := usecases.NewRequestWatcher()
+	status := usecases.NewRequestStatusInteractor(c.RequestRepository, watcher)
+	trI := usecases.NewTrafficInteractor(c.TrafficService)
+	trI.BaseTrafficService = c.BaseTrafficService
+	cabI := usecases.NewCabInteractor(c.CabService, &usecases.HeuristicBestTimeStrategy{})
+	cabI.BookingResponses = c.BookingResponses
+	cabEngI := usecases.NewCabEngineInteractor(a.queues[usecases.CabRequestJobType], logger, status)
+	nI := usecases.NewNotificationInteractor(a.queues[usecases.NotificationJobType], status)
+	nsI := usecases.NewNotificationServiceInteractor(c.NotificationService, status)
+	codec.TrafficInteractor = trI
+	codec.CabInteractor = cabI
+	codec.CabEngineInteractor = cabEngI
+	codec.NotificationInteractor = nI
+	codec.NotificationServiceInteractor = nsI
+	codec.CronEngine = a.scheduler
+
+	rc := usecases.NewRequestCanceller()
+	a.UserInteractor = usecases.NewUserInteractor(c.UserRepository, c.RequestRepository, a.scheduler, a.queues[usecases.UserRequestJobType], trI, cabI, cabEngI, nI, nsI, rc, watcher)
+	a.UserInteractor.IdempotencyKeys = usecases.NewIdempotencyKeys(idempotency.NewMemoryStore(), c.IdempotencyRetention)
+	a.UserInteractor.Transactor = c.Transactor
+	if cs, ok := c.NotificationService.(domain.ConfirmationSender); ok {
+		a.UserInteractor.ConfirmationSender = cs
+	}
+	if cc, ok := c.CabService.(usecases.CabCataloger); ok {
+		a.UserInteractor.Cabs = cc.Catalog()
+	}
+
+	var dls usecases.DeadLetterStore = deadletter.NewMemoryStore()
+	if c.OpenDeadLetterStore != nil {
+		dls = c.OpenDeadLetterStore(codec)
+	}
+	a.DeadLetterInteractor = usecases.NewDeadLetterInteractor(dls, engines)
+	for name, q := range a.queues {
+		q.dispatcher = usecases.NewDispatcher(q.Jobs(), logger.With(domain.NewField("queue", name)), rc, dls)
+		q.dispatcher.Checkpointer = q
+	}
+
+	l := c.Lease
+	if l == nil {
+		l = lease.NewFileLease(filepath.Join(c.DataDir, "cron.lease"))
+	}
+	a.elector = scheduler.NewElector(l, scheduler.DefaultHolder(), c.LeaseTTL, logger)
+	return &a, nil
+}
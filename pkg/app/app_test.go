@@ -0,0 +1,213 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/deadletter"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/fake"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/jobstore"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/lease"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/memory"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// MockLogger implements the domain.Logger interface and drops every line.
+type MockLogger struct{}
+
+func (l *MockLogger) Debug(m string, fields ...domain.Field)    {}
+func (l *MockLogger) Info(m string, fields ...domain.Field)     {}
+func (l *MockLogger) Warn(m string, fields ...domain.Field)     {}
+func (l *MockLogger) Error(m string, fields ...domain.Field)    {}
+func (l *MockLogger) With(fields ...domain.Field) domain.Logger { return l }
+
+func testConfig(t *testing.T) Config {
+	logger := &MockLogger{}
+	return Config{
+		DataDir:              t.TempDir(),
+		Workers:              2,
+		QueueLength:          10,
+		LeaseTTL:             time.Second,
+		CatchUpWindow:        time.Hour,
+		IdempotencyRetention: time.Hour,
+		UserRepository:       memory.NewUserRepository(),
+		RequestRepository:    memory.NewRequestRepository(),
+		TrafficService:       fake.NewTrafficService(25, time.Minute),
+		CabService:           fake.NewCabService(8 * time.Minute),
+		NotificationService:  fake.NewNotificationService(logger),
+		Logger:               logger,
+	}
+}
+
+func TestAppNotifiesRequest(t *testing.T) {
+	a, err := New(testConfig(t))
+	if err != nil {
+		t.Fatalf("New() => got: %v, expected: nil", err)
+	}
+	a.Start()
+
+	// the route takes longer than the time left, so the cab request is due right away
+	dto, err := usecases.NewUserRequestDTO("roy",
+		domain.Location{Latitude: "12.9352", Longitude: "77.6245"},
+		domain.Location{Latitude: "13.1986", Longitude: "77.7066"},
+		time.Now().Add(10*time.Minute), "uber", "uberGo",
+		domain.UserAddress{AddrType: "email", Value: "anirban.nick@gmail.com"},
+	)
+	if err != nil {
+		t.Fatalf("NewUserRequestDTO() => got: %v, expected: nil", err)
+	}
+	dto.SetIdempotencyKey("key-1")
+	ur, err := a.UserInteractor.CreateUserRequest(dto)
+	if err != nil {
+		t.Fatalf("CreateUserRequest() => got: %v, expected: nil", err)
+	}
+	retry, err := a.UserInteractor.CreateUserRequest(dto)
+	if err != nil || retry.Request.ID() != ur.Request.ID() {
+		t.Errorf("CreateUserRequest() retried with the key => got: (%v, %v), expected request %d", retry, err, ur.Request.ID())
+	}
+	r, updates, stop, err := a.UserInteractor.WatchUserRequest(ur.Request.ID(), ur.Request.Token)
+	if err != nil {
+		t.Fatalf("WatchUserRequest() => got: %v, expected: nil", err)
+	}
+	defer stop()
+
+	timeout := time.After(10 * time.Second)
+	for !r.Finished() {
+		select {
+		case u := <-updates:
+			r = u.Request
+		case <-timeout:
+			t.Fatalf("request => got status: %s, expected it to be notified", r.Status)
+		}
+	}
+	if r.Status != domain.RequestNotified || len(r.History) != 4 {
+		t.Errorf("request => got: (%s, %v), expected it notified after 4 status changes", r.Status, r.History)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = a.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() => got: %v, expected: nil", err)
+	}
+	dls, err := a.DeadLetterInteractor.ListDeadLetters()
+	if err != nil || len(dls) != 0 {
+		t.Errorf("ListDeadLetters() => got: (%v, %v), expected no dead letters", dls, err)
+	}
+}
+
+func TestAppValidatesCabsOfCabServices(t *testing.T) {
+	c := testConfig(t)
+	c.CabService = usecases.CabServices{"ola": fake.NewCabService(8 * time.Minute)}
+	a, err := New(c)
+	if err != nil {
+		t.Fatalf("New() => got: %v, expected: nil", err)
+	}
+
+	// the fake cab service of ola doesn't list cab types, so no cab type of ola is valid,
+	// and the default uber cabs aren't configured
+	for _, cab := range []string{"uber", "ola"} {
+		if a.UserInteractor.CabCatalog().Offers(cab, "uberGo") {
+			t.Errorf("CabCatalog() of the ola cab service => got: %+v, expected no uberGo of %s", a.UserInteractor.CabCatalog(), cab)
+		}
+	}
+	if cabs := a.UserInteractor.CabCatalog(); len(cabs) != 1 || cabs[0].Name != "ola" {
+		t.Errorf("CabCatalog() of the ola cab service => got: %+v, expected ola", cabs)
+	}
+}
+
+func TestAppShutdownWithoutStart(t *testing.T) {
+	a, err := New(testConfig(t))
+	if err != nil {
+		t.Fatalf("New() => got: %v, expected: nil", err)
+	}
+	if err = a.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() => got: %v, expected: nil", err)
+	}
+}
+
+func TestAppOpenJobQueue(t *testing.T) {
+	c := testConfig(t)
+	queueDir := t.TempDir()
+	var opened []string
+	c.OpenJobQueue = func(name string, maxQueueLength int, codec *usecases.JobCodec) (JobQueue, error) {
+		opened = append(opened, name)
+		return jobstore.OpenFileQueue(filepath.Join(queueDir, name+".log"), name, maxQueueLength, c.Overflow, codec, c.Logger)
+	}
+	a, err := New(c)
+	if err != nil {
+		t.Fatalf("New() => got: %v, expected: nil", err)
+	}
+	defer a.Shutdown(context.Background())
+	if !reflect.DeepEqual(opened, jobTypes) {
+		t.Errorf("New() => got job queues opened: %v, expected: %v", opened, jobTypes)
+	}
+	if _, err = os.Stat(filepath.Join(c.DataDir, usecases.UserRequestJobType+".log")); !os.IsNotExist(err) {
+		t.Errorf("New() => got a job log under the DataDir (%v), expected the job queues of OpenJobQueue only", err)
+	}
+}
+
+func TestAppStoresOutsideDataDir(t *testing.T) {
+	c := testConfig(t)
+	c.DataDir = filepath.Join(t.TempDir(), "unused")
+	dir := t.TempDir()
+	c.OpenJobQueue = func(name string, maxQueueLength int, codec *usecases.JobCodec) (JobQueue, error) {
+		return jobstore.OpenFileQueue(filepath.Join(dir, name+".log"), name, maxQueueLength, c.Overflow, codec, c.Logger)
+	}
+	schedule, err := jobstore.OpenFileScheduleStore(filepath.Join(dir, "schedule.log"))
+	if err != nil {
+		t.Fatalf("OpenFileScheduleStore() => got: %v, expected: nil", err)
+	}
+	defer schedule.Close()
+	c.ScheduleStore = schedule
+	c.Lease = lease.NewFileLease(filepath.Join(dir, "cron.lease"))
+	dls := deadletter.NewMemoryStore()
+	c.OpenDeadLetterStore = func(codec *usecases.JobCodec) usecases.DeadLetterStore {
+		return dls
+	}
+
+	a, err := New(c)
+	if err != nil {
+		t.Fatalf("New() => got: %v, expected: nil", err)
+	}
+	defer a.Shutdown(context.Background())
+	if _, err = os.Stat(c.DataDir); !os.IsNotExist(err) {
+		t.Errorf("New() => got a DataDir (%v), expected none with the stores of the Config", err)
+	}
+	if a.DeadLetterInteractor.DeadLetterStore != dls {
+		t.Errorf("New() => got DeadLetterStore: %v, expected the store of OpenDeadLetterStore", a.DeadLetterInteractor.DeadLetterStore)
+	}
+}
+
+func TestAppLocksDataDir(t *testing.T) {
+	c := testConfig(t)
+	a, err := New(c)
+	if err != nil {
+		t.Fatalf("New() => got: %v, expected: nil", err)
+	}
+	if _, err = New(c); err == nil {
+		t.Errorf("New() with the DataDir of another App => got: nil, expected an error")
+	}
+	a.Shutdown(context.Background())
+
+	// the job queues of OpenJobQueue leave the DataDir to be shared
+	queueDir := t.TempDir()
+	c.OpenJobQueue = func(name string, maxQueueLength int, codec *usecases.JobCodec) (JobQueue, error) {
+		return jobstore.OpenFileQueue(filepath.Join(queueDir, name+".log"), name, maxQueueLength, c.Overflow, codec, c.Logger)
+	}
+	shared := c
+	shared.OpenJobQueue = func(name string, maxQueueLength int, codec *usecases.JobCodec) (JobQueue, error) {
+		return jobstore.OpenFileQueue(filepath.Join(queueDir, "shared-"+name+".log"), name, maxQueueLength, c.Overflow, codec, c.Logger)
+	}
+	for _, cfg := range []Config{c, shared} {
+		a, err = New(cfg)
+		if err != nil {
+			t.Fatalf("New() with OpenJobQueue => got: %v, expected: nil", err)
+		}
+		defer a.Shutdown(context.Background())
+	}
+}
@@ -1,44 +1,93 @@
 package domain
 
 import (
+	"context"
 	"time"
 )
 
-var (
-	// ALLOWED_CABS has information about different cabs and their associated cab types that
-	// application right now caters to.
-	ALLOWED_CABS = []struct {
-		Name  string
-		Types []string
-	}{
-		{
-			Name: "uber",
-			Types: []string{
-				"uberGo",
-				"uberBlack",
-				"uberShare",
-				"uberX",
-			},
+// Cab is a cab service the application caters to and the cab types it offers.
+type Cab struct {
+	Name  string
+	Types []string
+}
+
+// CabCatalog has the cabs the application caters to and the cab types they offer, those of
+// the cab services it is configured with. The requests are validated against it.
+type CabCatalog []Cab
+
+// Offers returns if the cab of the name is in the CabCatalog and offers the cab type.
+func (c CabCatalog) Offers(cab, cabType string) bool {
+	for i := range c {
+		if c[i].Name == cab && c[i].offers(cabType) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedCabs has information about different cabs and their associated cab types that
+// application caters to by default, when it isn't given the CabCatalog of its cab services.
+var allowedCabs = CabCatalog{
+	{
+		Name: "uber",
+		Types: []string{
+			"uberGo",
+			"uberBlack",
+			"uberShare",
+			"uberX",
 		},
+	},
+}
+
+// DefaultCabCatalog returns a copy of the cabs the application caters to by default.
+func DefaultCabCatalog() CabCatalog {
+	cabs := make(CabCatalog, len(allowedCabs))
+	for i, c := range allowedCabs {
+		cabs[i] = Cab{Name: c.Name, Types: append([]string(nil), c.Types...)}
 	}
-)
+	return cabs
+}
+
+func (c *Cab) offers(cabType string) bool {
+	for _, t := range c.Types {
+		if t == cabType {
+			return true
+		}
+	}
+	return false
+}
 
-// CabService is a serive which is an interface which exposes the method EtaNow which takes a pointer
-// to a CbRequest as input and return a time.Duration and error as output.
+// CabService is a serive which is an interface which exposes the method EtaNow which takes a context and
+// a pointer to a CbRequest as input and return a time.Duration and error as output. The call must be
+// abandoned when the context is done.
 // This tells you what is the eta for the request to that particular cab service.
 // Any cab service (be it ola, uber, lyft) can implement the EtaNow method.
 type CabService interface {
-	EtaNow(*CabRequest) (time.Duration, error)
+	EtaNow(context.Context, *CabRequest) (time.Duration, error)
 }
 
 // CabBookingResponse is the final response the is generated of the application which is
 // sent to the user as notification at the user's notificatio address,
 // CabBookingResponse encapsulated information like the UserRequest and the best booking time
 // to request/book a cab.
+//
+// It also keeps how the best booking time was found, the Strategy which found it at
+// ComputedAt and the BookingInputs it was found from.
 type CabBookingResponse struct {
 	BookingID uint64
 	*UserRequest
 	BestBookingTime time.Time
+	Strategy        string
+	ComputedAt      time.Time
+	Inputs          BookingInputs
+}
+
+// BookingInputs are what a strategy finds the best booking time from, the travel times of
+// the traffic responses and the best and worst case times to start the journey at.
+type BookingInputs struct {
+	TravelTime []time.Duration
+	BestCase   []time.Time
+	WorstCase  []time.Time
 }
 
 // CabRequest is a composition of the attricutes which make a valid request
@@ -52,26 +101,60 @@ type CabRequest struct {
 }
 
 // CabBookingResponseRepository exposes the interface to store and find the cab booking responses
-// from a repository.
+// from a repository. FindByID returns ErrNotFound if there is no booking response with the
+// id, FindByUserID and FindByRequestID return the booking responses of a user and of a
+// request and List returns those selected by the CabBookingResponseFilter. The booking
+// responses are returned in the order of their ids.
 type CabBookingResponseRepository interface {
-	FindById(uint64) *CabBookingResponse
+	FindByID(uint64) (*CabBookingResponse, error)
+	FindByUserID(uint64) ([]*CabBookingResponse, error)
+	FindByRequestID(uint64) ([]*CabBookingResponse, error)
+	List(CabBookingResponseFilter) ([]*CabBookingResponse, error)
 	Store(*CabBookingResponse) (uint64, error)
 }
 
+// CabBookingResponseFilter selects the booking responses listed by a
+// CabBookingResponseRepository, a field which is not set selects the responses with any
+// value of it. UserID and RequestID select the responses of a user and of a request, and
+// ComputedAfter and ComputedBefore the responses whose ComputedAt is in [ComputedAfter,
+// ComputedBefore). At most Limit responses are listed, if it is set.
+type CabBookingResponseFilter struct {
+	UserID         uint64
+	RequestID      uint64
+	ComputedAfter  time.Time
+	ComputedBefore time.Time
+	Limit          int
+}
+
+// Match returns if the CabBookingResponseFilter selects the booking response, regardless
+// of its Limit.
+func (f CabBookingResponseFilter) Match(c *CabBookingResponse) bool {
+	var userID, requestID uint64
+	if c.UserRequest != nil && c.User != nil {
+		userID = c.User.UserID
+	}
+	if c.UserRequest != nil && c.Request != nil {
+		requestID = c.Request.ID()
+	}
+	if f.UserID != 0 && userID != f.UserID {
+		return false
+	}
+	if f.RequestID != 0 && requestID != f.RequestID {
+		return false
+	}
+	if !f.ComputedAfter.IsZero() && c.ComputedAt.Before(f.ComputedAfter) {
+		return false
+	}
+	if !f.ComputedBefore.IsZero() && !c.ComputedAt.Before(f.ComputedBefore) {
+		return false
+	}
+	return true
+}
+
 // validateCab if a function which takes cab and cabType, both of type string as inputs and returns
 // if the cab, cabType combination is valid and allowed by the applicaion or not. It returns a bool.
 func validateCab(cab, cabType string) bool {
-	for _, c := range ALLOWED_CABS {
-		if cab == c.Name {
-			for _, ct := range c.Types {
-				if cabType == ct {
-					return true
-				}
-			}
-		}
-	}
-
-	return false
+	return allowedCabs.Offers(cab, cabType)
 }
 
 // NewCabRequest is a constructor that takes in many attributes which form the CabRequest object and
@@ -4,6 +4,7 @@ import (
 	// "fmt"
 	// "reflect"
 	"testing"
+	"time"
 )
 
 func TestValidateCab(t *testing.T) {
@@ -44,3 +45,74 @@ func TestValidateCab(t *testing.T) {
 		})
 	}
 }
+
+func TestCabCatalogOffers(t *testing.T) {
+	cabs := CabCatalog{
+		{Name: "ola", Types: []string{"olaMini", "olaPrime"}},
+		{Name: "lyft", Types: []string{"lyft"}},
+	}
+	testCases := []struct {
+		cab, cabType string
+		expected     bool
+	}{
+		{"ola", "olaMini", true},
+		{"lyft", "lyft", true},
+		{"ola", "lyft", false},
+		// the default cabs are not in a catalog which doesn't have them
+		{"uber", "uberGo", false},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		if got := cabs.Offers(tc.cab, tc.cabType); got != tc.expected {
+			t.Errorf("case %d: Offers(%s, %s) => got: %v, expected: %v", i, tc.cab, tc.cabType, got, tc.expected)
+		}
+	}
+}
+
+func TestDefaultCabCatalog(t *testing.T) {
+	cabs := DefaultCabCatalog()
+	if !cabs.Offers("uber", "uberGo") {
+		t.Errorf("DefaultCabCatalog() => got: %+v, expected uber with uberGo", cabs)
+	}
+	// the copy is not the default catalog
+	cabs[0].Types[0] = "changed"
+	if !validateCab("uber", "uberGo") {
+		t.Errorf("validateCab() after changing the copy of DefaultCabCatalog() => got: false, expected: true")
+	}
+}
+
+func TestCabBookingResponseFilterMatch(t *testing.T) {
+	computedAt := time.Date(2018, time.March, 9, 9, 0, 0, 0, time.UTC)
+	r := &Request{UserID: 7}
+	r.SetID(11)
+	c := &CabBookingResponse{UserRequest: NewUserRequest(&User{UserID: 7}, r), ComputedAt: computedAt}
+
+	testCases := []struct {
+		name     string
+		filter   CabBookingResponseFilter
+		expected bool
+	}{
+		{"zero filter selects every response", CabBookingResponseFilter{}, true},
+		{"same user", CabBookingResponseFilter{UserID: 7}, true},
+		{"another user", CabBookingResponseFilter{UserID: 8}, false},
+		{"same request", CabBookingResponseFilter{UserID: 7, RequestID: 11}, true},
+		{"another request", CabBookingResponseFilter{RequestID: 12}, false},
+		{"computed at the start of the range", CabBookingResponseFilter{ComputedAfter: computedAt, ComputedBefore: computedAt.Add(time.Hour)}, true},
+		{"computed at the end of the range", CabBookingResponseFilter{ComputedAfter: computedAt.Add(-time.Hour), ComputedBefore: computedAt}, false},
+		{"computed before the range", CabBookingResponseFilter{ComputedAfter: computedAt.Add(time.Minute)}, false},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.filter.Match(c); got != tc.expected {
+				t.Errorf("%s: Match() => Got: %t, expected: %t", tc.name, got, tc.expected)
+			}
+		})
+	}
+
+	if (CabBookingResponseFilter{UserID: 7}).Match(&CabBookingResponse{}) {
+		t.Errorf("Match() of a response without a UserRequest => Got: true, expected: false")
+	}
+}
@@ -0,0 +1,147 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotFound is returned by the repositories when there is nothing stored under an id.
+	ErrNotFound = errors.New("not found")
+	// ErrRequestFinished is returned when a Request which was already notified or
+	// cancelled is changed.
+	ErrRequestFinished = errors.New("request is already finished")
+	// ErrAddressTaken is returned by the UserRepository when a user is stored with an
+	// address which belongs to another user.
+	ErrAddressTaken = errors.New("address belongs to another user")
+	// ErrConflict is returned by the RequestRepository when a request is updated which was
+	// changed by someone else since it was read.
+	ErrConflict = errors.New("changed since it was read")
+)
+
+// causer is implemented by the errors which wrap another error.
+type causer interface {
+	Cause() error
+}
+
+// permanentError marks an error which will not go away by trying again, like a rejected
+// address or an unknown cab type, as opposed to a timeout or an unavailable service.
+type permanentError struct {
+	err error
+}
+
+func (p *permanentError) Error() string {
+	return p.err.Error()
+}
+
+// Cause returns the wrapped error, so errors.Cause still finds the original error.
+func (p *permanentError) Cause() error {
+	return p.err
+}
+
+func (p *permanentError) Permanent() bool {
+	return true
+}
+
+// NewPermanentError wraps err to mark it as permanent. Services return permanent errors for
+// failures which will fail the same way on every retry, so the caller doesn't retry them.
+// It returns nil if err is nil.
+func NewPermanentError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent returns if err, or any error it wraps, was marked as permanent.
+// Errors which are not marked are considered to be retryable.
+func IsPermanent(err error) bool {
+	type permanent interface {
+		Permanent() bool
+	}
+	for err != nil {
+		if p, ok := err.(permanent); ok && p.Permanent() {
+			return true
+		}
+		c, ok := err.(causer)
+		if !ok {
+			return false
+		}
+		err = c.Cause()
+	}
+	return false
+}
+
+// ValidationError is returned for input which is not valid, Field names the invalid input.
+// A ValidationError is the caller's fault, retrying the same input fails the same way.
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+func (v *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", v.Field, v.Reason)
+}
+
+func (v *ValidationError) Permanent() bool {
+	return true
+}
+
+// NewValidationError returns a ValidationError for the field, the reason is formatted
+// with fmt.Sprintf.
+func NewValidationError(field, format string, args ...interface{}) error {
+	return &ValidationError{
+		Field:  field,
+		Reason: fmt.Sprintf(format, args...),
+	}
+}
+
+// ValidationErrors collects the ValidationErrors of several fields of the same input, so
+// that all of them are reported together instead of one at a time.
+type ValidationErrors []*ValidationError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(v))
+	for _, e := range v {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (v ValidationErrors) Permanent() bool {
+	return true
+}
+
+// Add appends a ValidationError for the field, the reason is formatted with fmt.Sprintf.
+func (v *ValidationErrors) Add(field, format string, args ...interface{}) {
+	*v = append(*v, &ValidationError{
+		Field:  field,
+		Reason: fmt.Sprintf(format, args...),
+	})
+}
+
+// Err returns the ValidationErrors as an error, or nil if there are none.
+func (v ValidationErrors) Err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
+
+// IsValidation returns if err, or any error it wraps, is a ValidationError or ValidationErrors.
+func IsValidation(err error) bool {
+	for err != nil {
+		switch err.(type) {
+		case *ValidationError, ValidationErrors:
+			return true
+		}
+		c, ok := err.(causer)
+		if !ok {
+			return false
+		}
+		err = c.Cause()
+	}
+	return false
+}
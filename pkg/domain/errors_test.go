@@ -0,0 +1,100 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestIsPermanent(t *testing.T) {
+	someError := errors.New("some error")
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{
+			name:     "nil error",
+			err:      nil,
+			expected: false,
+		},
+		{
+			name:     "plain error is retryable",
+			err:      someError,
+			expected: false,
+		},
+		{
+			name:     "permanent error",
+			err:      NewPermanentError(someError),
+			expected: true,
+		},
+		{
+			name:     "wrapped permanent error",
+			err:      errors.Wrap(NewPermanentError(someError), "wrapped twice"),
+			expected: true,
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			result := IsPermanent(tc.err)
+			if result != tc.expected {
+				t.Errorf("%s: IsPermanent(%v) => Got: %v, expected: %v", tc.name, tc.err, result, tc.expected)
+			}
+		})
+	}
+
+	if NewPermanentError(nil) != nil {
+		t.Errorf("NewPermanentError(nil) => Got: non nil, expected: nil")
+	}
+	if errors.Cause(errors.Wrap(NewPermanentError(someError), "wrapped")) != someError {
+		t.Errorf("errors.Cause of permanent error => expected the original error")
+	}
+}
+
+func TestIsValidation(t *testing.T) {
+	v := NewValidationError("source", "location %v is not valid", Location{})
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil error", nil, false},
+		{"plain error", errors.New("some error"), false},
+		{"validation error", v, true},
+		{"wrapped validation error", errors.Wrap(v, "NewRequest failed"), true},
+		{"validation errors", errors.Wrap(ValidationErrors{v.(*ValidationError)}, "NewUserRequestDTO failed"), true},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			result := IsValidation(tc.err)
+			if result != tc.expected {
+				t.Errorf("%s: IsValidation(%v) => Got: %v, expected: %v", tc.name, tc.err, result, tc.expected)
+			}
+		})
+	}
+
+	if !IsPermanent(v) {
+		t.Errorf("IsPermanent(%v) => Got: false, expected: true", v)
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	var v ValidationErrors
+	if err := v.Err(); err != nil {
+		t.Errorf("Err() of no ValidationErrors => Got: %v, expected: nil", err)
+	}
+
+	v.Add("name", "is required")
+	v.Add("cab", "%s is not available", "ola")
+	err := v.Err()
+	if err == nil || err.Error() != "name: is required; cab: ola is not available" {
+		t.Errorf("Err() => Got: %v, expected: name: is required; cab: ola is not available", err)
+	}
+	if !IsPermanent(err) {
+		t.Errorf("IsPermanent(%v) => Got: false, expected: true", err)
+	}
+}
@@ -0,0 +1,86 @@
+package domain
+
+import (
+	"strings"
+)
+
+// LogLevel is the severity of a log line. Loggers drop lines whose level is below
+// the level they were configured with.
+type LogLevel int
+
+const (
+	DebugLevel LogLevel = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+// Common field keys, so that every part of the application tags its log lines
+// with the same names.
+const (
+	RequestIDKey = "request_id"
+	JobTypeKey   = "job_type"
+	WorkerIDKey  = "worker_id"
+	ErrorKey     = "error"
+)
+
+// String returns the lower case name of the LogLevel, like "info" or "error".
+func (l LogLevel) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseLogLevel takes the name of a level (case insensitive) and returns the matching LogLevel.
+// It returns InfoLevel and false if the name is not known.
+func ParseLogLevel(name string) (LogLevel, bool) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return DebugLevel, true
+	case "info":
+		return InfoLevel, true
+	case "warn", "warning":
+		return WarnLevel, true
+	case "error":
+		return ErrorLevel, true
+	default:
+		return InfoLevel, false
+	}
+}
+
+// Field is a key/value pair attached to a log line, like request_id=42.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// NewField is a constructor which takes a key and a value and returns a Field.
+func NewField(key string, value interface{}) Field {
+	return Field{
+		Key:   key,
+		Value: value,
+	}
+}
+
+// Logger is an interface for structured, leveled logging. Every method takes a message
+// and an optional list of Fields which are written along with the message.
+//
+// With returns a child Logger which attaches the given Fields to every line it writes,
+// this is how per-request context like the request id and the job type are carried
+// around without every call site having to repeat them.
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+	With(fields ...Field) Logger
+}
@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	testCases := []struct {
+		name          string
+		levelName     string
+		expectedLevel LogLevel
+		expectedOk    bool
+	}{
+		{
+			name:          "lower case level",
+			levelName:     "debug",
+			expectedLevel: DebugLevel,
+			expectedOk:    true,
+		},
+		{
+			name:          "upper case level",
+			levelName:     "ERROR",
+			expectedLevel: ErrorLevel,
+			expectedOk:    true,
+		},
+		{
+			name:          "warning alias",
+			levelName:     "warning",
+			expectedLevel: WarnLevel,
+			expectedOk:    true,
+		},
+		{
+			name:          "unknown level falls back to info",
+			levelName:     "verbose",
+			expectedLevel: InfoLevel,
+			expectedOk:    false,
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			level, ok := ParseLogLevel(tc.levelName)
+			if level != tc.expectedLevel || ok != tc.expectedOk {
+				t.Errorf("%s: ParseLogLevel(%s) => Got: (%v, %v), expected: (%v, %v)", tc.name, tc.levelName, level, ok, tc.expectedLevel, tc.expectedOk)
+			}
+		})
+	}
+}
@@ -1,9 +1,21 @@
 package domain
 
+import (
+	"context"
+)
+
 // NotificationService is serive which is an interface which exposee the a method Send, which
-// takes a pointer to a CabBookingResponse as input and returns an error.
+// takes a context and a pointer to a CabBookingResponse as input and returns an error.
+// The context carries the deadline of the notification job, the send is abandoned when it is done.
 // It means any type of notification servie can implement this interface, like email,
 // sms, web notificaiton, etc..
 type NotificationService interface {
-	Send(*CabBookingResponse) error
+	Send(context.Context, *CabBookingResponse) error
+}
+
+// ConfirmationSender sends the code a PendingAddress of a User is confirmed with to the
+// address, so that only who can read what is sent to the address can confirm it. The
+// NotificationServices implement it for the addresses they send to.
+type ConfirmationSender interface {
+	SendConfirmation(ctx context.Context, a UserAddress, code string) error
 }
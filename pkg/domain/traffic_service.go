@@ -1,15 +1,16 @@
 package domain
 
 import (
+	"context"
 	"time"
 )
 
 // TrafficService is a service which is an interface which exposed the method TravelTime which takes in
-// a pointer to TrafficRequest object as the input and returns a pointer to TrafficResponse object along
-// with an error.
+// a context and a pointer to TrafficRequest object as the input and returns a pointer to TrafficResponse
+// object along with an error. Implementations must give up on the call when the context is done.
 // And traffie Serive like googlemaps, mapbox, etc. can be used to implement this service.
 type TrafficService interface {
-	TravelTime(*TrafficRequest) (*TrafficResponse, error)
+	TravelTime(context.Context, *TrafficRequest) (*TrafficResponse, error)
 }
 
 // TrafficRequest is the encapsulation of the data needed to create a valid request
@@ -44,9 +44,13 @@
 package domain
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -61,9 +65,25 @@ var (
 )
 
 // User is an  entity which encapsulate information aobut a user.
+//
+// A user is known by their Addresses, the addresses they confirmed to be theirs, no two
+// users have the same address. Pending are the addresses they gave which they are yet to
+// confirm. Places are the locations the user saved, like home or office.
 type User struct {
-	UserID uint64
-	Name   string
+	UserID    uint64
+	Name      string
+	Addresses []UserAddress
+	Pending   []PendingAddress
+	Places    []Location
+}
+
+// PendingAddress is an address a User gave which is not confirmed yet. The User is not
+// found by it, and it belongs to no one, until it is confirmed with the Code which was sent
+// to it, before ExpiresAt.
+type PendingAddress struct {
+	Address   UserAddress
+	Code      string
+	ExpiresAt time.Time
 }
 
 // Location encapsulates any kind of location like source, destination used
@@ -83,17 +103,53 @@ type UserAddress struct {
 	Value    string
 }
 
+// RequestStatus is the stage of its lifecycle a Request is in.
+type RequestStatus string
+
+const (
+	// RequestPending is a Request whose travel time is still being found.
+	RequestPending RequestStatus = "pending"
+	// RequestScheduled is a Request whose cab request is scheduled at its TriggerTime.
+	RequestScheduled RequestStatus = "scheduled"
+	// RequestBookingTimeFound is a Request whose BookingTime was found and whose
+	// notification is being sent.
+	RequestBookingTimeFound RequestStatus = "booking_time_found"
+	// RequestNotified is a Request whose user was notified of the BookingTime.
+	RequestNotified RequestStatus = "notified"
+	// RequestCancelled is a Request which the user cancelled.
+	RequestCancelled RequestStatus = "cancelled"
+)
+
+// RequestEvent is a change of the status of a Request and the time it happened at.
+type RequestEvent struct {
+	Status RequestStatus
+	At     time.Time
+}
+
 // Request is the root of the aggregrae which encapsulate information like source,
 // destination, reaching time of the user, cab and cab type preferred, notification address
 // of user where the user needs the notification regrading when to book the cab is to be sent.
+//
+// It also keeps track of the user who made the request and of how far it got, the time its
+// cab request was triggered at, the booking time found for it and the History of its status.
+//
+// Token is the secret the user who made the request is given with it, only who knows it
+// can read or cancel the Request, see Authorize.
 type Request struct {
 	reqID            uint64
+	version          uint64
+	Token            string
+	UserID           uint64
 	Source           Location
 	Destination      Location
 	ReachingTime     time.Time
 	Cab              string
 	CabType          string
 	NotificationAddr UserAddress
+	Status           RequestStatus
+	TriggerTime      time.Time
+	BookingTime      time.Time
+	History          []RequestEvent
 }
 
 // UserRequest associates a request with a particular user
@@ -103,15 +159,65 @@ type UserRequest struct {
 }
 
 // UserRepository exposes the interface to store and find user from a repository.
+// FindByID and FindByAddress return ErrNotFound if there is no such user and Update stores
+// the changes to a user which was stored before. An address belongs to one user at most,
+// Store and Update return ErrAddressTaken for a user with an address of another user.
 type UserRepository interface {
 	FindByID(uint64) (*User, error)
+	FindByAddress(UserAddress) (*User, error)
 	Store(*User) (uint64, error)
+	Update(*User) error
 }
 
 // RequestRepository exposes the interface to store and find requests from a repository.
+// FindByID returns ErrNotFound if there is no request with the id, Update stores the changes
+// to a request which was stored before and FindByUserID returns the requests of a user.
+// Update returns ErrConflict if the stored request was updated since the request was read,
+// otherwise it records the new Version of the stored request on the request.
+// List returns the requests selected by the RequestFilter. The requests are returned in the
+// order of their ids.
 type RequestRepository interface {
 	FindByID(uint64) (*Request, error)
+	FindByUserID(uint64) ([]*Request, error)
+	List(RequestFilter) ([]*Request, error)
 	Store(*Request) (uint64, error)
+	Update(*Request) error
+}
+
+// RequestFilter selects the requests listed by a RequestRepository, a field which is not
+// set selects the requests with any value of it. UserID selects the requests of a user,
+// Statuses the requests in one of the statuses, and ReachingAfter and ReachingBefore the
+// requests whose ReachingTime is in [ReachingAfter, ReachingBefore). At most Limit
+// requests are listed, if it is set.
+type RequestFilter struct {
+	UserID         uint64
+	Statuses       []RequestStatus
+	ReachingAfter  time.Time
+	ReachingBefore time.Time
+	Limit          int
+}
+
+// Match returns if the RequestFilter selects the request, regardless of its Limit.
+func (f RequestFilter) Match(r *Request) bool {
+	if f.UserID != 0 && r.UserID != f.UserID {
+		return false
+	}
+	if len(f.Statuses) > 0 {
+		found := false
+		for _, s := range f.Statuses {
+			found = found || r.Status == s
+		}
+		if !found {
+			return false
+		}
+	}
+	if !f.ReachingAfter.IsZero() && r.ReachingTime.Before(f.ReachingAfter) {
+		return false
+	}
+	if !f.ReachingBefore.IsZero() && !r.ReachingTime.Before(f.ReachingBefore) {
+		return false
+	}
+	return true
 }
 
 // UserAddressValidator is an interface having the method Validate which takes in
@@ -133,13 +239,6 @@ type UserAddressValidator interface {
 	Validate(UserAddress) error
 }
 
-// Logger is an interface which exposes two methods LogError and LogInfo both of which takes
-// a string input and logs the to anykind of writer.
-type Logger interface {
-	LogError(string)
-	LogInfo(string)
-}
-
 // init will initialize the reaching_time_threshold_in_minute by reading from
 // environment variable. If environment variable is not set, just use the default
 // reaching time.
@@ -160,32 +259,42 @@ func init() {
 
 // NewRequest takes different arguments as input and validates each argument
 // and then if all arguments are validated, it creates a new Request object and
-// returns a pointer to the Object.
-func NewRequest(source, destination Location, reachingTime time.Time, cab, cabType string, notificationAddr UserAddress, uav UserAddressValidator) (*Request, error) {
+// returns a pointer to the Object. The cab and cab type are validated against cabs, the
+// catalog of the configured cab services, or against the default cabs if it is nil.
+func NewRequest(source, destination Location, reachingTime time.Time, cab, cabType string, cabs CabCatalog, notificationAddr UserAddress, uav UserAddressValidator) (*Request, error) {
 	var r *Request
 	ok := validateLocation(source)
 	if !ok {
-		return r, errors.New(fmt.Sprintf("source location: %v is not valid", source))
+		return r, NewValidationError("source", "source location: %v is not valid", source)
 	}
 	ok = validateLocation(destination)
 	if !ok {
-		return r, errors.New(fmt.Sprintf("destination location: %v is not valid", destination))
+		return r, NewValidationError("destination", "destination location: %v is not valid", destination)
 	}
 	err := validateReachingTime(reachingTime)
 	if err != nil {
-		return r, errors.Wrap(err, "NewRequest failed for timeValidator error")
+		return r, errors.Wrap(NewValidationError("reaching_time", "%s", err), "NewRequest failed for timeValidator error")
+	}
+	if cabs != nil {
+		ok = cabs.Offers(cab, cabType)
+	} else {
+		ok = validateCab(cab, cabType)
 	}
-	ok = validateCab(cab, cabType)
 	if !ok {
-		return r, errors.New(fmt.Sprintf("requested cab: %s or cabtype: %s not avaialable", cab, cabType))
+		return r, NewValidationError("cab", "requested cab: %s or cabtype: %s not avaialable", cab, cabType)
 	}
 
 	err = uav.Validate(notificationAddr)
 	if err != nil {
-		return r, errors.Wrap(err, "NewRequest couldn't validate notification address")
+		return r, errors.Wrap(NewValidationError("notification_addr", "%s", err), "NewRequest couldn't validate notification address")
 	}
 
+	token, err := newSecret()
+	if err != nil {
+		return r, errors.Wrap(err, "NewRequest couldn't create token")
+	}
 	r = &Request{
+		Token:            token,
 		Source:           source,
 		Destination:      destination,
 		ReachingTime:     reachingTime,
@@ -193,10 +302,77 @@ func NewRequest(source, destination Location, reachingTime time.Time, cab, cabTy
 		CabType:          cabType,
 		NotificationAddr: notificationAddr,
 	}
+	r.SetStatus(RequestPending, time.Now())
 
 	return r, nil
 }
 
+// ID returns the identifier which the RequestRepository assigned to the Request when
+// it was stored. It is zero for a Request which has not been stored yet.
+func (r *Request) ID() uint64 {
+	return r.reqID
+}
+
+// SetID records the identifier returned by the RequestRepository's Store method on the Request.
+func (r *Request) SetID(id uint64) {
+	r.reqID = id
+}
+
+// Version returns how many times the stored Request had been updated when it was read, the
+// RequestRepository's Update uses it to find out if it was updated by someone else since.
+func (r *Request) Version() uint64 {
+	return r.version
+}
+
+// SetVersion records the version of the stored Request on the Request, it is called by the
+// RequestRepository when the Request is read or updated.
+func (r *Request) SetVersion(v uint64) {
+	r.version = v
+}
+
+// Authorize returns ErrNotFound unless token is the Token of the Request, so a Request is
+// the same as missing to who doesn't know its Token. A Request without a Token, which was
+// stored before Requests had one, can't be authorized.
+func (r *Request) Authorize(token string) error {
+	if r.Token == "" || subtle.ConstantTimeCompare([]byte(r.Token), []byte(token)) != 1 {
+		return errors.Wrapf(ErrNotFound, "request %d with the given token", r.reqID)
+	}
+	return nil
+}
+
+// newSecret returns a random, unguessable secret, like the token of a Request or the code
+// a PendingAddress is confirmed with.
+func newSecret() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Finished returns if nothing is left to be done for the Request, it was either notified
+// or cancelled.
+func (r *Request) Finished() bool {
+	return r.Status == RequestNotified || r.Status == RequestCancelled
+}
+
+// Cancel marks the Request as cancelled, it returns ErrRequestFinished if the Request was
+// already notified or cancelled.
+func (r *Request) Cancel() error {
+	if r.Finished() {
+		return errors.Wrapf(ErrRequestFinished, "request %d is %s", r.reqID, r.Status)
+	}
+	r.SetStatus(RequestCancelled, time.Now())
+	return nil
+}
+
+// SetStatus moves the Request to the status and records the change in its History.
+func (r *Request) SetStatus(s RequestStatus, at time.Time) {
+	r.Status = s
+	// the History is copied on append, so that copies of the Request don't share it
+	r.History = append(r.History[:len(r.History):len(r.History)], RequestEvent{Status: s, At: at})
+}
+
 // NewUser is another constructor which take name of type string as input and returns a pointer to
 // a newly created a User object.
 func NewUser(name string) *User {
@@ -206,6 +382,114 @@ func NewUser(name string) *User {
 	return &u
 }
 
+// HasAddress returns if the address is one of the Addresses of the User.
+func (u *User) HasAddress(a UserAddress) bool {
+	for _, addr := range u.Addresses {
+		if addr == a {
+			return true
+		}
+	}
+	return false
+}
+
+// AddAddress adds the address to the Addresses of the User, unless it is one of them
+// already. It returns if the address was added.
+func (u *User) AddAddress(a UserAddress) bool {
+	if u.HasAddress(a) {
+		return false
+	}
+	// the Addresses are copied on append, so that copies of the User don't share them
+	u.Addresses = append(u.Addresses[:len(u.Addresses):len(u.Addresses)], a)
+	return true
+}
+
+// AddPendingAddress adds the address to the Pending addresses of the User with a new
+// confirmation code which expires at expiresAt, it replaces the code of the address given
+// before. It returns the code, or an empty code for one of the Addresses of the User.
+func (u *User) AddPendingAddress(a UserAddress, expiresAt time.Time) (string, error) {
+	if u.HasAddress(a) {
+		return "", nil
+	}
+	code, err := newSecret()
+	if err != nil {
+		return "", errors.Wrap(err, "AddPendingAddress couldn't make a confirmation code")
+	}
+	pending := make([]PendingAddress, 0, len(u.Pending)+1)
+	for _, p := range u.Pending {
+		if p.Address != a {
+			pending = append(pending, p)
+		}
+	}
+	u.Pending = append(pending, PendingAddress{Address: a, Code: code, ExpiresAt: expiresAt})
+	return code, nil
+}
+
+// ConfirmAddress moves the pending address to the Addresses of the User, if code is the
+// code sent to it and it hasn't expired at now. A ValidationError of the code is returned
+// otherwise.
+func (u *User) ConfirmAddress(a UserAddress, code string, now time.Time) error {
+	for i, p := range u.Pending {
+		if p.Address != a {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(p.Code), []byte(code)) != 1 || !now.Before(p.ExpiresAt) {
+			break
+		}
+		// the Pending addresses are copied, so that copies of the User don't share them
+		var pending []PendingAddress
+		u.Pending = append(append(pending, u.Pending[:i]...), u.Pending[i+1:]...)
+		u.AddAddress(a)
+		return nil
+	}
+	return NewValidationError("code", "is not the code sent to the %s address %s, or it expired", a.AddrType, a.Value)
+}
+
+// SavePlace saves the place in the Places of the User, it replaces the place saved before
+// with the same name. A place needs a name and its coordinates, a ValidationError is
+// returned otherwise.
+func (u *User) SavePlace(p Location) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return NewValidationError("place.name", "is required")
+	}
+	if !validateLocation(p) {
+		return NewValidationError("place", "place location: %v is not valid", p)
+	}
+	places := make([]Location, 0, len(u.Places)+1)
+	for _, saved := range u.Places {
+		if !strings.EqualFold(saved.Name, p.Name) {
+			places = append(places, saved)
+		}
+	}
+	u.Places = append(places, p)
+	return nil
+}
+
+// NormalizeAddress returns the address the way it is stored and looked up, without the
+// surrounding spaces and with its type, and the value of an email address, in lower case.
+// The phone number of an sms address loses its spaces, dashes, dots and parentheses, and
+// its international prefix 00 becomes a +, so that it is in E.164 format if it has its
+// country code. The same address written differently finds the same user.
+func NormalizeAddress(a UserAddress) UserAddress {
+	a.AddrType = strings.ToLower(strings.TrimSpace(a.AddrType))
+	a.Value = strings.TrimSpace(a.Value)
+	switch a.AddrType {
+	case "email":
+		a.Value = strings.ToLower(a.Value)
+	case "sms":
+		a.Value = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(" -.()", r) {
+				return -1
+			}
+			return r
+		}, a.Value)
+		if strings.HasPrefix(a.Value, "00") {
+			a.Value = "+" + a.Value[2:]
+		}
+	}
+	return a
+}
+
 // NewUserRequest is a constructor function which takes pointers to User and Request objects, constructs
 // a new UserRequest object and returns the pointer to that object.
 func NewUserRequest(u *User, r *Request) *UserRequest {
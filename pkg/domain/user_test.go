@@ -2,7 +2,7 @@ package domain
 
 import (
 	"fmt"
-	// "reflect"
+	"reflect"
 	"testing"
 	"time"
 
@@ -132,3 +132,249 @@ func TestValidateReachingTime(t *testing.T) {
 		})
 	}
 }
+
+func TestRequestCancel(t *testing.T) {
+	testCases := []struct {
+		name           string
+		status         RequestStatus
+		expectedStatus RequestStatus
+		expectedError  error
+	}{
+		{"pending request", RequestPending, RequestCancelled, nil},
+		{"scheduled request", RequestScheduled, RequestCancelled, nil},
+		{"booking time found", RequestBookingTimeFound, RequestCancelled, nil},
+		{"notified request", RequestNotified, RequestNotified, ErrRequestFinished},
+		{"cancelled request", RequestCancelled, RequestCancelled, ErrRequestFinished},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Request{Status: tc.status}
+			err := r.Cancel()
+			if r.Status != tc.expectedStatus || errors.Cause(err) != tc.expectedError {
+				t.Errorf("%s: Cancel() => Got: (%s, %v), expected: (%s, %v)", tc.name, r.Status, err, tc.expectedStatus, tc.expectedError)
+			}
+			if cancelled := err == nil; cancelled != (len(r.History) == 1) {
+				t.Errorf("%s: Cancel() => Got history: %v, expected the cancellation to be recorded: %t", tc.name, r.History, cancelled)
+			}
+		})
+	}
+}
+
+func TestRequestAuthorize(t *testing.T) {
+	testCases := []struct {
+		name          string
+		token         string
+		given         string
+		expectedError error
+	}{
+		{name: "token of the request", token: "6b1f0c", given: "6b1f0c", expectedError: nil},
+		{name: "another token", token: "6b1f0c", given: "6b1f0d", expectedError: ErrNotFound},
+		{name: "no token given", token: "6b1f0c", given: "", expectedError: ErrNotFound},
+		{name: "request without a token", token: "", given: "", expectedError: ErrNotFound},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		r := &Request{Token: tc.token}
+		if err := r.Authorize(tc.given); errors.Cause(err) != tc.expectedError {
+			t.Errorf("%s: Authorize(%q) => Got: %v, expected: %v", tc.name, tc.given, err, tc.expectedError)
+		}
+	}
+}
+
+func TestRequestSetStatus(t *testing.T) {
+	created := time.Date(2018, time.March, 9, 9, 0, 0, 0, time.UTC)
+	scheduled := created.Add(time.Minute)
+	r := &Request{}
+	r.SetStatus(RequestPending, created)
+	c := *r
+	r.SetStatus(RequestScheduled, scheduled)
+	c.SetStatus(RequestCancelled, scheduled)
+
+	expected := []RequestEvent{{RequestPending, created}, {RequestScheduled, scheduled}}
+	if r.Status != RequestScheduled || !reflect.DeepEqual(r.History, expected) {
+		t.Errorf("SetStatus() => Got: (%s, %v), expected: (%s, %v)", r.Status, r.History, RequestScheduled, expected)
+	}
+	if c.History[1].Status != RequestCancelled {
+		t.Errorf("SetStatus() of a copy => Got history: %v, expected it not to be shared with the original", c.History)
+	}
+}
+
+func TestUserAddAddress(t *testing.T) {
+	email := UserAddress{AddrType: "email", Value: "roy@example.com"}
+	u := NewUser("roy")
+	if !u.AddAddress(email) || u.AddAddress(email) {
+		t.Errorf("AddAddress() twice => Got addresses: %v, expected the address added once", u.Addresses)
+	}
+	c := *u
+	u.AddAddress(UserAddress{AddrType: "email", Value: "work@example.com"})
+	c.AddAddress(UserAddress{AddrType: "email", Value: "home@example.com"})
+	if !u.HasAddress(email) || len(u.Addresses) != 2 || u.Addresses[1].Value != "work@example.com" {
+		t.Errorf("AddAddress() => Got addresses: %v, expected them not to be shared with a copy", u.Addresses)
+	}
+}
+
+func TestUserConfirmAddress(t *testing.T) {
+	now := time.Date(2018, time.March, 9, 8, 0, 0, 0, time.UTC)
+	email := UserAddress{AddrType: "email", Value: "roy@example.com"}
+	u := NewUser("roy")
+	first, err := u.AddPendingAddress(email, now.Add(time.Hour))
+	if err != nil || first == "" {
+		t.Fatalf("AddPendingAddress() => Got: (%q, %v), expected a code", first, err)
+	}
+	code, _ := u.AddPendingAddress(email, now.Add(time.Hour))
+	if len(u.Pending) != 1 || code == first || u.HasAddress(email) {
+		t.Errorf("AddPendingAddress() again => Got pending: %v, expected the address pending once with a new code", u.Pending)
+	}
+
+	testCases := []struct {
+		name      string
+		addr      UserAddress
+		code      string
+		now       time.Time
+		confirmed bool
+	}{
+		{name: "code sent before", addr: email, code: first, now: now},
+		{name: "code of another address", addr: UserAddress{AddrType: "email", Value: "nick@example.com"}, code: code, now: now},
+		{name: "expired code", addr: email, code: code, now: now.Add(time.Hour)},
+		{name: "code sent to the address", addr: email, code: code, now: now, confirmed: true},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err := u.ConfirmAddress(tc.addr, tc.code, tc.now)
+			if (err == nil) != tc.confirmed || (err != nil && !IsValidation(err)) || u.HasAddress(email) != tc.confirmed {
+				t.Errorf("%s: ConfirmAddress() => Got: (%v, addresses %v), expected confirmed: %t", tc.name, err, u.Addresses, tc.confirmed)
+			}
+		})
+	}
+	if len(u.Pending) != 0 {
+		t.Errorf("ConfirmAddress() => Got pending: %v, expected the confirmed address not to be pending", u.Pending)
+	}
+	if code, err := u.AddPendingAddress(email, now.Add(time.Hour)); err != nil || code != "" || len(u.Pending) != 0 {
+		t.Errorf("AddPendingAddress() of a confirmed address => Got: (%q, %v), expected no code", code, err)
+	}
+}
+
+func TestUserSavePlace(t *testing.T) {
+	home := Location{Name: "home", Latitude: "12.9352", Longitude: "77.6245"}
+	office := Location{Name: "office", Latitude: "12.9716", Longitude: "77.5946"}
+	moved := Location{Name: " Home ", Latitude: "13.0358", Longitude: "77.5970"}
+
+	testCases := []struct {
+		name           string
+		place          Location
+		expectedPlaces []Location
+		valid          bool
+	}{
+		{
+			name:           "new place is saved",
+			place:          home,
+			expectedPlaces: []Location{home},
+			valid:          true,
+		},
+		{
+			name:           "another place is saved too",
+			place:          office,
+			expectedPlaces: []Location{home, office},
+			valid:          true,
+		},
+		{
+			name:           "place with a saved name replaces it",
+			place:          moved,
+			expectedPlaces: []Location{office, {Name: "Home", Latitude: "13.0358", Longitude: "77.5970"}},
+			valid:          true,
+		},
+		{
+			name:           "place without a name",
+			place:          Location{Latitude: "12.9352", Longitude: "77.6245"},
+			expectedPlaces: []Location{office, {Name: "Home", Latitude: "13.0358", Longitude: "77.5970"}},
+		},
+		{
+			name:           "place without coordinates",
+			place:          Location{Name: "gym"},
+			expectedPlaces: []Location{office, {Name: "Home", Latitude: "13.0358", Longitude: "77.5970"}},
+		},
+	}
+
+	u := NewUser("roy")
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err := u.SavePlace(tc.place)
+			if (err == nil) != tc.valid || (err != nil && !IsValidation(err)) || !reflect.DeepEqual(u.Places, tc.expectedPlaces) {
+				t.Errorf("%s: SavePlace(%v) => Got: (%v, %v), expected: (%v, valid %t)", tc.name, tc.place, u.Places, err, tc.expectedPlaces, tc.valid)
+			}
+		})
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	testCases := []struct {
+		name     string
+		addr     UserAddress
+		expected UserAddress
+	}{
+		{
+			name:     "email is trimmed and lower cased",
+			addr:     UserAddress{AddrType: " Email", Value: " Anirban.Nick@Gmail.com "},
+			expected: UserAddress{AddrType: "email", Value: "anirban.nick@gmail.com"},
+		},
+		{
+			name:     "phone number loses its formatting",
+			addr:     UserAddress{AddrType: "SMS", Value: " +91 (98765) 432-10 "},
+			expected: UserAddress{AddrType: "sms", Value: "+919876543210"},
+		},
+		{
+			name:     "international prefix of phone number becomes a plus",
+			addr:     UserAddress{AddrType: "sms", Value: "0044 20.7946.0958"},
+			expected: UserAddress{AddrType: "sms", Value: "+442079460958"},
+		},
+		{
+			name:     "value of other types keeps its case",
+			addr:     UserAddress{AddrType: "web", Value: " https://example.com/Hook"},
+			expected: UserAddress{AddrType: "web", Value: "https://example.com/Hook"},
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			if got := NormalizeAddress(tc.addr); got != tc.expected {
+				t.Errorf("%s: NormalizeAddress(%v) => Got: %v, expected: %v", tc.name, tc.addr, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRequestFilterMatch(t *testing.T) {
+	reachAt := time.Date(2018, time.March, 9, 10, 0, 0, 0, time.UTC)
+	r := &Request{UserID: 7, Status: RequestScheduled, ReachingTime: reachAt}
+
+	testCases := []struct {
+		name     string
+		filter   RequestFilter
+		expected bool
+	}{
+		{"zero filter selects every request", RequestFilter{}, true},
+		{"same user", RequestFilter{UserID: 7}, true},
+		{"another user", RequestFilter{UserID: 8}, false},
+		{"one of the statuses", RequestFilter{Statuses: []RequestStatus{RequestPending, RequestScheduled}}, true},
+		{"none of the statuses", RequestFilter{Statuses: []RequestStatus{RequestNotified}}, false},
+		{"reaching time at the start of the range", RequestFilter{ReachingAfter: reachAt, ReachingBefore: reachAt.Add(time.Hour)}, true},
+		{"reaching time at the end of the range", RequestFilter{ReachingAfter: reachAt.Add(-time.Hour), ReachingBefore: reachAt}, false},
+		{"reaching time before the range", RequestFilter{ReachingAfter: reachAt.Add(time.Minute)}, false},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.filter.Match(r); got != tc.expected {
+				t.Errorf("%s: Match() => Got: %t, expected: %t", tc.name, got, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+// package cabtest has what the tests of the cab services share, a local stand-in of the API
+// of a cab service and the requests the tests make of them:
+//
+//	api := &cabtest.API{Handler: func(w http.ResponseWriter, r *http.Request) {
+//		fmt.Fprint(w, `{"eta": 240}`)
+//	}}
+//	srv := api.Serve(t)
+//	cs, err := NewCabService(Config{BaseURL: srv.URL, Client: srv.Client()})
+//	...
+//	eta, err := cs.EtaNow(ctx, cabtest.Request(Name, "mini"))
+package cabtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+var (
+	// Koramangala is the source of the Requests.
+	Koramangala = domain.Location{Latitude: "12.927880", Longitude: "77.627600"}
+	// Hebbal is the destination of the Requests.
+	Hebbal = domain.Location{Latitude: "13.035542", Longitude: "77.597100"}
+)
+
+// Request returns a request for a cab of the cab type from Koramangala to Hebbal right now.
+func Request(cab, cabType string) *domain.CabRequest {
+	return domain.NewCabRequest(Koramangala, Hebbal, time.Now(), cab, cabType)
+}
+
+// API is a local stand-in of the API of a cab service. It records the queries and the
+// Authorization headers of the requests, answers those which are not Authorized with 401
+// Unauthorized and the others with Status, if it is set, or with Handler.
+//
+// The POSTs to TokenPath are the token requests of the OAuth client credentials grant, of a
+// form or of basic auth with the grant as JSON. The client "client" with the secret "secret"
+// gets the access tokens token-1, token-2 and so on, which live for ExpiresIn seconds, or a
+// day if it is 0, and the last of which is accepted until Expire is set.
+type API struct {
+	// Authorized returns if a request is authorized, without it a request needs the last
+	// access token.
+	Authorized func(*http.Request) bool
+	// Unauthorized is the body of the 401 Unauthorized responses.
+	Unauthorized string
+	Handler      http.HandlerFunc
+	TokenPath    string
+	ExpiresIn    int
+
+	mu      sync.Mutex
+	Queries []url.Values
+	Auths   []string
+	Tokens  int
+	Expire  bool
+	Status  int
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.TokenPath != "" && r.URL.Path == a.TokenPath {
+		a.token(w, r)
+		return
+	}
+
+	a.Queries = append(a.Queries, r.URL.Query())
+	a.Auths = append(a.Auths, r.Header.Get("Authorization"))
+	authorized := a.HasToken
+	if a.Authorized != nil {
+		authorized = a.Authorized
+	}
+	if !authorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, a.Unauthorized)
+		return
+	}
+	if a.Status != 0 {
+		w.WriteHeader(a.Status)
+		return
+	}
+	a.Handler(w, r)
+}
+
+// HasToken returns if the request has the last access token, which hasn't expired.
+func (a *API) HasToken(r *http.Request) bool {
+	return a.Tokens > 0 && !a.Expire && r.Header.Get("Authorization") == fmt.Sprintf("Bearer token-%d", a.Tokens)
+}
+
+// token answers a token request, a.mu is held.
+func (a *API) token(w http.ResponseWriter, r *http.Request) {
+	var grant struct {
+		GrantType string `json:"grant_type"`
+	}
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		json.NewDecoder(r.Body).Decode(&grant)
+	} else {
+		r.ParseForm()
+		id, secret, grant.GrantType = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"), r.PostForm.Get("grant_type")
+	}
+	if id != "client" || secret != "secret" || grant.GrantType != "client_credentials" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error": "invalid_client"}`)
+		return
+	}
+	a.Tokens++
+	a.Expire = false
+	expiresIn := a.ExpiresIn
+	if expiresIn == 0 {
+		expiresIn = 86400
+	}
+	fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "Bearer", "expires_in": %d}`, a.Tokens, expiresIn)
+}
+
+// Serve starts a server of the API, which is closed when the test is done.
+func (a *API) Serve(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(a)
+	t.Cleanup(srv.Close)
+	return srv
+}
@@ -0,0 +1,71 @@
+// package deadletter has implementations of the usecases.DeadLetterStore interface.
+package deadletter
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// MemoryStore implements the usecases.DeadLetterStore interface by keeping the dead letters
+// in a map. It is safe for concurrent use, the dead letters are lost on restart.
+type MemoryStore struct {
+	mu          sync.Mutex
+	lastID      uint64
+	deadLetters map[uint64]usecases.DeadLetter
+}
+
+// Add stores the dead letter under a new id and returns the id.
+func (m *MemoryStore) Add(dl usecases.DeadLetter) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	dl.ID = m.lastID
+	m.deadLetters[dl.ID] = dl
+	return dl.ID, nil
+}
+
+func (m *MemoryStore) FindByID(id uint64) (usecases.DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dl, ok := m.deadLetters[id]
+	if !ok {
+		return dl, errors.Errorf("dead letter %d not found", id)
+	}
+	return dl, nil
+}
+
+// List returns all the dead letters ordered by id, i.e. oldest first.
+func (m *MemoryStore) List() ([]usecases.DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dls := make([]usecases.DeadLetter, 0, len(m.deadLetters))
+	for _, dl := range m.deadLetters {
+		dls = append(dls, dl)
+	}
+	sort.Slice(dls, func(i, j int) bool {
+		return dls[i].ID < dls[j].ID
+	})
+	return dls, nil
+}
+
+func (m *MemoryStore) Remove(id uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.deadLetters[id]; !ok {
+		return errors.Errorf("dead letter %d not found", id)
+	}
+	delete(m.deadLetters, id)
+	return nil
+}
+
+// NewMemoryStore is a constructor which returns a pointer to an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	m := MemoryStore{
+		deadLetters: make(map[uint64]usecases.DeadLetter),
+	}
+	return &m
+}
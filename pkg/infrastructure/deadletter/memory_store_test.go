@@ -0,0 +1,39 @@
+package deadletter
+
+import (
+	"testing"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+func TestMemoryStore(t *testing.T) {
+	m := NewMemoryStore()
+	first, _ := m.Add(usecases.DeadLetter{JobType: "notification", RequestID: 1})
+	second, _ := m.Add(usecases.DeadLetter{JobType: "cab_request", RequestID: 2})
+	if first == second {
+		t.Fatalf("Add() => got the same id %d twice, expected unique ids", first)
+	}
+
+	dls, err := m.List()
+	if err != nil || len(dls) != 2 || dls[0].ID != first || dls[1].ID != second {
+		t.Errorf("List() => got: (%v, %v), expected both dead letters oldest first", dls, err)
+	}
+
+	dl, err := m.FindByID(second)
+	if err != nil || dl.RequestID != 2 {
+		t.Errorf("FindByID(%d) => got: (%v, %v), expected dead letter of request 2", second, dl, err)
+	}
+
+	err = m.Remove(first)
+	if err != nil {
+		t.Errorf("Remove(%d) => got: %v, expected: nil", first, err)
+	}
+	_, err = m.FindByID(first)
+	if err == nil {
+		t.Errorf("FindByID(%d) after Remove => got: nil, expected: not found error", first)
+	}
+	err = m.Remove(first)
+	if err == nil {
+		t.Errorf("Remove(%d) twice => got: nil, expected: not found error", first)
+	}
+}
@@ -0,0 +1,288 @@
+// package email has an implementation of the domain.NotificationService interface which
+// emails the booking time of a request to its notification address through an SMTP server.
+//
+// The emails are multipart, a plain text and an HTML body rendered from Templates, which can
+// be overridden by files. The connection to the server is upgraded with STARTTLS unless it
+// is configured otherwise, and the Sender logs in if it has a username.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// AddrType is the type of the notification addresses the Sender sends to.
+const AddrType = "email"
+
+// TLSMode is how the connection to the SMTP server is secured.
+type TLSMode string
+
+const (
+	// StartTLS upgrades the connection with the STARTTLS command, the server must offer it.
+	StartTLS TLSMode = "starttls"
+	// ImplicitTLS connects with TLS from the start, like to port 465.
+	ImplicitTLS TLSMode = "tls"
+	// NoTLS doesn't secure the connection, for a relay on the same host.
+	NoTLS TLSMode = "none"
+)
+
+const (
+	// DefaultPort is the submission port of SMTP servers.
+	DefaultPort = 587
+	// DefaultTimeout bounds a whole SMTP session, from dialing the server to its answer to
+	// the DATA of the email.
+	DefaultTimeout = 30 * time.Second
+)
+
+// Config holds the SMTP server a Sender relays through and how its emails look. Host and
+// From, the address the emails are sent from, must be set, and the Sender logs in with
+// Username and Password when the server wants a login. Port and TLSMode default to the
+// submission port with STARTTLS, TLSConfig verifies the certificate of Host unless it is
+// set. The emails are rendered from Templates, the DefaultTemplates if it is nil, with
+// their times in Location, UTC if it is nil. Timeout replaces DefaultTimeout.
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+
+	TLSMode   TLSMode
+	TLSConfig *tls.Config
+	Templates *Templates
+	Location  *time.Location
+	Timeout   time.Duration
+}
+
+// Sender implements the domain.NotificationService interface by emailing the booking
+// responses through an SMTP server.
+type Sender struct {
+	addr      string
+	host      string
+	username  string
+	password  string
+	from      *mail.Address
+	tlsMode   TLSMode
+	tlsConfig *tls.Config
+	templates *Templates
+	location  *time.Location
+	timeout   time.Duration
+}
+
+// Send emails the booking time of the booking response to its notification address.
+func (s *Sender) Send(ctx context.Context, c *domain.CabBookingResponse) error {
+	if c.NotificationAddr.AddrType != AddrType {
+		return domain.NewPermanentError(errors.Errorf("email sender can't send to address type %q", c.NotificationAddr.AddrType))
+	}
+	to := &mail.Address{Name: c.User.Name, Address: c.NotificationAddr.Value}
+	msg, err := s.compose(to, newMessage(c, s.location))
+	if err != nil {
+		return domain.NewPermanentError(err)
+	}
+	return s.deliver(ctx, to.Address, msg)
+}
+
+// compose returns the email of the Message, with its headers and its plain text and HTML
+// bodies as the parts of a multipart/alternative body.
+func (s *Sender) compose(to *mail.Address, m Message) ([]byte, error) {
+	var subject, text, html bytes.Buffer
+	if err := s.templates.Subject.Execute(&subject, m); err != nil {
+		return nil, errors.Wrap(err, "couldn't render subject")
+	}
+	if err := s.templates.Text.Execute(&text, m); err != nil {
+		return nil, errors.Wrap(err, "couldn't render text body")
+	}
+	if err := s.templates.HTML.Execute(&html, m); err != nil {
+		return nil, errors.Wrap(err, "couldn't render html body")
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", html.Bytes()},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't write email part")
+		}
+		qw := quotedprintable.NewWriter(pw)
+		qw.Write(part.content)
+		qw.Close()
+	}
+	mw.Close()
+	return s.envelope(to, subject.String(), "multipart/alternative; boundary="+mw.Boundary(), body.Bytes()), nil
+}
+
+// envelope returns the email of the body with its headers, from the Sender to the address.
+func (s *Sender) envelope(to *mail.Address, subject, contentType string, body []byte) []byte {
+	var msg bytes.Buffer
+	header := func(k, v string) { msg.WriteString(k + ": " + v + "\r\n") }
+	header("From", s.from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", messageID(s.host))
+	header("MIME-Version", "1.0")
+	header("Content-Type", contentType)
+	msg.WriteString("\r\n")
+	msg.Write(body)
+	return msg.Bytes()
+}
+
+// SendConfirmation emails the code which confirms the address to it, as plain text.
+func (s *Sender) SendConfirmation(ctx context.Context, a domain.UserAddress, code string) error {
+	if a.AddrType != AddrType {
+		return domain.NewPermanentError(errors.Errorf("email sender can't send to address type %q", a.AddrType))
+	}
+	to := &mail.Address{Address: a.Value}
+	body := "Your uberNow confirmation code is " + code + "\r\n\r\n" +
+		"Enter it to confirm this address. If you didn't give it to uberNow, ignore this email.\r\n"
+	msg := s.envelope(to, "Your uberNow confirmation code", "text/plain; charset=utf-8", []byte(body))
+	return s.deliver(ctx, to.Address, msg)
+}
+
+// deliver sends the email to the address through the SMTP server. The connection is closed
+// when ctx is done, which fails the command in progress.
+func (s *Sender) deliver(ctx context.Context, to string, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return errors.Wrap(err, "couldn't connect to smtp server")
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	if s.tlsMode == ImplicitTLS {
+		conn = tls.Client(conn, s.tlsConfig)
+	}
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return smtpError(ctx, err, "greeting")
+	}
+	defer client.Close()
+
+	if s.tlsMode == StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return domain.NewPermanentError(errors.New("smtp server doesn't offer STARTTLS"))
+		}
+		if err = client.StartTLS(s.tlsConfig); err != nil {
+			return smtpError(ctx, err, "STARTTLS")
+		}
+	}
+	if s.username != "" {
+		if err = client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return smtpError(ctx, err, "AUTH")
+		}
+	}
+	if err = client.Mail(s.from.Address); err != nil {
+		return smtpError(ctx, err, "MAIL")
+	}
+	if err = client.Rcpt(to); err != nil {
+		return smtpError(ctx, err, "RCPT")
+	}
+	w, err := client.Data()
+	if err != nil {
+		return smtpError(ctx, err, "DATA")
+	}
+	if _, err = w.Write(msg); err != nil {
+		return smtpError(ctx, err, "DATA")
+	}
+	if err = w.Close(); err != nil {
+		return smtpError(ctx, err, "DATA")
+	}
+	// the email is accepted, a failure to say goodbye doesn't matter
+	client.Quit()
+	return nil
+}
+
+// smtpError wraps the error of the command. The rejections of the server, whose codes are
+// 5xx, are permanent errors, like a wrong password or an unknown recipient.
+func smtpError(ctx context.Context, err error, command string) error {
+	if ctx.Err() != nil {
+		return errors.Wrapf(ctx.Err(), "smtp %s gave up", command)
+	}
+	err = errors.Wrapf(err, "smtp %s failed", command)
+	if e, ok := errors.Cause(err).(*textproto.Error); ok && e.Code >= 500 {
+		return domain.NewPermanentError(err)
+	}
+	return err
+}
+
+// messageID returns a new unique Message-ID of the host.
+func messageID(host string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "<" + hex.EncodeToString(b) + "@" + host + ">"
+}
+
+// NewSender is a constructor which takes the Config of the Sender and returns a pointer to
+// a new Sender, or an error if the Config has no Host or no valid From.
+func NewSender(c Config) (*Sender, error) {
+	if c.Host == "" {
+		return nil, errors.New("email sender needs the host of the smtp server")
+	}
+	from, err := mail.ParseAddress(c.From)
+	if err != nil {
+		return nil, errors.Wrap(err, "email sender needs a valid from address")
+	}
+	if c.Port == 0 {
+		c.Port = DefaultPort
+	}
+	switch c.TLSMode {
+	case "":
+		c.TLSMode = StartTLS
+	case StartTLS, ImplicitTLS, NoTLS:
+	default:
+		return nil, errors.Errorf("unknown tls mode %q, expected starttls, tls or none", c.TLSMode)
+	}
+	if c.TLSConfig == nil {
+		c.TLSConfig = &tls.Config{ServerName: c.Host}
+	}
+	if c.Templates == nil {
+		c.Templates = DefaultTemplates()
+	}
+	if c.Location == nil {
+		c.Location = time.UTC
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultTimeout
+	}
+	s := Sender{
+		addr:      net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+		host:      c.Host,
+		username:  c.Username,
+		password:  c.Password,
+		from:      from,
+		tlsMode:   c.TLSMode,
+		tlsConfig: c.TLSConfig,
+		templates: c.Templates,
+		location:  c.Location,
+		timeout:   c.Timeout,
+	}
+	return &s, nil
+}
@@ -0,0 +1,362 @@
+package email
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// sunk is an email the sink accepted.
+type sunk struct {
+	from, to string
+	data     []byte
+	tls      bool
+}
+
+// sink is a local SMTP server which keeps the emails it accepts. It offers STARTTLS if it
+// has a tlsConfig, and takes the login of username and password.
+type sink struct {
+	ln        net.Listener
+	tlsConfig *tls.Config
+	username  string
+	password  string
+	// rejectRcpt are the recipients which don't exist
+	rejectRcpt string
+
+	mu     sync.Mutex
+	emails []sunk
+}
+
+func (s *sink) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.session(conn)
+	}
+}
+
+func (s *sink) session(conn net.Conn) {
+	defer func() { conn.Close() }()
+	tc := textproto.NewConn(conn)
+	tc.PrintfLine("220 sink ESMTP")
+	var e sunk
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			lines := []string{"sink"}
+			if s.tlsConfig != nil && !e.tls {
+				lines = append(lines, "STARTTLS")
+			}
+			lines = append(lines, "AUTH PLAIN", "8BITMIME")
+			for i, l := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				tc.PrintfLine("250%s%s", sep, l)
+			}
+		case "STARTTLS":
+			tc.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn, tc, e.tls = tlsConn, textproto.NewConn(tlsConn), true
+		case "AUTH":
+			b, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			if string(b) != "\x00"+s.username+"\x00"+s.password {
+				tc.PrintfLine("535 5.7.8 authentication failed")
+				continue
+			}
+			tc.PrintfLine("235 2.7.0 authentication succeeded")
+		case "MAIL":
+			from, _, _ := strings.Cut(strings.TrimPrefix(arg, "FROM:"), " ")
+			e.from = strings.Trim(from, "<>")
+			tc.PrintfLine("250 2.1.0 ok")
+		case "RCPT":
+			e.to = strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if e.to == s.rejectRcpt {
+				tc.PrintfLine("550 5.1.1 no such user")
+				continue
+			}
+			tc.PrintfLine("250 2.1.5 ok")
+		case "DATA":
+			tc.PrintfLine("354 go ahead")
+			if e.data, err = tc.ReadDotBytes(); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.emails = append(s.emails, e)
+			s.mu.Unlock()
+			tc.PrintfLine("250 2.0.0 queued")
+		case "QUIT":
+			tc.PrintfLine("221 2.0.0 bye")
+			return
+		default:
+			tc.PrintfLine("502 5.5.2 unknown command")
+		}
+	}
+}
+
+func (s *sink) sunk() []sunk {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sunk(nil), s.emails...)
+}
+
+// testCertificate returns a self-signed certificate of 127.0.0.1 and a pool which trusts it.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() => got: %v, expected: nil", err)
+	}
+	tmpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sink"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() => got: %v, expected: nil", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// testSink starts a sink with STARTTLS and returns it with the Config of a Sender which
+// trusts it.
+func testSink(t *testing.T) (*sink, Config) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() => got: %v, expected: nil", err)
+	}
+	cert, pool := testCertificate(t)
+	s := &sink{ln: ln, tlsConfig: &tls.Config{Certificates: []tls.Certificate{cert}}, username: "ubernow", password: "secret"}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	c := Config{
+		Host:      "127.0.0.1",
+		Port:      port,
+		Username:  "ubernow",
+		Password:  "secret",
+		From:      "uberNow <notify@ubernow.example>",
+		TLSConfig: &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"},
+		Location:  time.FixedZone("IST", 5*60*60+30*60),
+	}
+	return s, c
+}
+
+func testBookingResponse(addrType, value string) *domain.CabBookingResponse {
+	r := &domain.Request{
+		Source:           domain.Location{Name: "Koramangala", Latitude: "12.927880", Longitude: "77.627600"},
+		Destination:      domain.Location{Name: "Hebbal", Latitude: "13.035542", Longitude: "77.597100"},
+		ReachingTime:     time.Date(2018, time.March, 9, 14, 30, 0, 0, time.UTC),
+		Cab:              "uber",
+		CabType:          "uberGo",
+		NotificationAddr: domain.UserAddress{AddrType: addrType, Value: value},
+	}
+	r.SetID(1)
+	ur := domain.NewUserRequest(domain.NewUser("Anirban Roy"), r)
+	return domain.NewCabBookingResponse(ur, time.Date(2018, time.March, 9, 13, 13, 0, 0, time.UTC))
+}
+
+// parts returns the subject and the parts of the email by their content type.
+func parts(t *testing.T, data []byte) (string, map[string]string) {
+	t.Helper()
+	m, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatalf("ReadMessage() => got: %v, expected: nil", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("DecodeHeader() => got: %v, expected: nil", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type => got: %s, %v, expected: multipart/alternative", mediaType, err)
+	}
+	found := make(map[string]string)
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart() => got: %v, expected: nil", err)
+		}
+		b, _ := io.ReadAll(p)
+		ct, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		found[ct] = string(b)
+	}
+	return subject, found
+}
+
+func TestSenderSend(t *testing.T) {
+	s, c := testSink(t)
+	sender, err := NewSender(c)
+	if err != nil {
+		t.Fatalf("NewSender() => got: %v, expected: nil", err)
+	}
+	if err = sender.Send(context.Background(), testBookingResponse("email", "anirban.nick@gmail.com")); err != nil {
+		t.Fatalf("Send() => got: %v, expected: nil", err)
+	}
+
+	emails := s.sunk()
+	if len(emails) != 1 {
+		t.Fatalf("Send() => got: %d emails, expected: 1", len(emails))
+	}
+	e := emails[0]
+	if !e.tls || e.from != "notify@ubernow.example" || e.to != "anirban.nick@gmail.com" {
+		t.Errorf("Send() => got: from %s to %s with tls %v, expected: from notify@ubernow.example to anirban.nick@gmail.com with tls", e.from, e.to, e.tls)
+	}
+	subject, found := parts(t, e.data)
+	if subject != "Time to book your uberGo to Hebbal (13.035542, 77.597100)" {
+		t.Errorf("Send() => got: subject %q, expected the cab type and destination", subject)
+	}
+	// the times are in the time zone of the Sender
+	expected := []string{"Koramangala (12.927880, 77.627600)", "Hebbal (13.035542, 77.597100)", "Fri, 9 Mar 2018 8:00 PM IST", "Fri, 9 Mar 2018 6:43 PM IST", "uberGo"}
+	for _, ct := range []string{"text/plain", "text/html"} {
+		body, ok := found[ct]
+		if !ok {
+			t.Errorf("Send() => got: parts %v, expected a %s part", found, ct)
+			continue
+		}
+		for _, v := range expected {
+			if !strings.Contains(body, v) {
+				t.Errorf("Send() => got: %s part %q, expected it to contain %q", ct, body, v)
+			}
+		}
+	}
+}
+
+func TestSenderSendConfirmation(t *testing.T) {
+	s, c := testSink(t)
+	sender, err := NewSender(c)
+	if err != nil {
+		t.Fatalf("NewSender() => got: %v, expected: nil", err)
+	}
+	addr := domain.UserAddress{AddrType: "email", Value: "anirban.nick@gmail.com"}
+	if err = sender.SendConfirmation(context.Background(), addr, "0123abcd"); err != nil {
+		t.Fatalf("SendConfirmation() => got: %v, expected: nil", err)
+	}
+	emails := s.sunk()
+	if len(emails) != 1 || emails[0].to != "anirban.nick@gmail.com" {
+		t.Fatalf("SendConfirmation() => got: %+v, expected one email to anirban.nick@gmail.com", emails)
+	}
+	m, err := mail.ReadMessage(strings.NewReader(string(emails[0].data)))
+	if err != nil {
+		t.Fatalf("ReadMessage() => got: %v, expected: nil", err)
+	}
+	body, _ := io.ReadAll(m.Body)
+	if ct := m.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") || !strings.Contains(string(body), "0123abcd") {
+		t.Errorf("SendConfirmation() => got: %s body %q, expected a text/plain body with the code", ct, body)
+	}
+
+	addr.AddrType = "sms"
+	if err = sender.SendConfirmation(context.Background(), addr, "0123abcd"); !domain.IsPermanent(err) {
+		t.Errorf("SendConfirmation() to an sms address => got: %v, expected a permanent error", err)
+	}
+}
+
+func TestSenderSendErrors(t *testing.T) {
+	testCases := []struct {
+		name      string
+		change    func(s *sink, c *Config)
+		addrType  string
+		permanent bool
+	}{
+		{"wrong password", func(s *sink, c *Config) { c.Password = "wrong" }, "email", true},
+		{"unknown recipient", func(s *sink, c *Config) { s.rejectRcpt = "anirban.nick@gmail.com" }, "email", true},
+		{"no STARTTLS", func(s *sink, c *Config) { s.tlsConfig = nil }, "email", true},
+		{"untrusted certificate", func(s *sink, c *Config) { c.TLSConfig = &tls.Config{ServerName: "127.0.0.1"} }, "email", false},
+		{"sms address", func(s *sink, c *Config) {}, "sms", true},
+		{"server gone", func(s *sink, c *Config) { s.ln.Close() }, "email", false},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			s, c := testSink(t)
+			tc.change(s, &c)
+			sender, err := NewSender(c)
+			if err != nil {
+				t.Fatalf("NewSender() => got: %v, expected: nil", err)
+			}
+			err = sender.Send(context.Background(), testBookingResponse(tc.addrType, "anirban.nick@gmail.com"))
+			if err == nil {
+				t.Fatalf("Send() => got: nil, expected an error")
+			}
+			if domain.IsPermanent(err) != tc.permanent {
+				t.Errorf("IsPermanent(%v) => got: %v, expected: %v", err, !tc.permanent, tc.permanent)
+			}
+			if n := len(s.sunk()); n != 0 {
+				t.Errorf("Send() => got: %d emails, expected: none", n)
+			}
+		})
+	}
+}
+
+func TestSenderSendWithoutTLS(t *testing.T) {
+	s, c := testSink(t)
+	s.tlsConfig = nil
+	c.TLSMode, c.Username = NoTLS, ""
+	sender, err := NewSender(c)
+	if err != nil {
+		t.Fatalf("NewSender() => got: %v, expected: nil", err)
+	}
+	if err = sender.Send(context.Background(), testBookingResponse("email", "anirban.nick@gmail.com")); err != nil {
+		t.Fatalf("Send() => got: %v, expected: nil", err)
+	}
+	if emails := s.sunk(); len(emails) != 1 || emails[0].tls {
+		t.Errorf("Send() without tls => got: %+v, expected one email without tls", emails)
+	}
+}
+
+func TestNewSender(t *testing.T) {
+	testCases := []Config{
+		{From: "notify@ubernow.example"},
+		{Host: "smtp.example", From: "not an address"},
+		{Host: "smtp.example", From: "notify@ubernow.example", TLSMode: "ssl"},
+	}
+	for i, _ := range testCases {
+		if _, err := NewSender(testCases[i]); err == nil {
+			t.Errorf("case %d: NewSender(%+v) => got: nil, expected an error", i, testCases[i])
+		}
+	}
+}
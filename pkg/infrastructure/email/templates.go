@@ -0,0 +1,147 @@
+package email
+
+import (
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// The names of the files of the templates in the directory of LoadTemplates.
+const (
+	SubjectFile = "subject.tmpl"
+	TextFile    = "body.txt.tmpl"
+	HTMLFile    = "body.html.tmpl"
+)
+
+const defaultSubject = `Time to book your {{.CabType}} to {{.Destination}}`
+
+const defaultText = `Hi {{.Name}},
+
+Book your {{.Cab}} {{.CabType}} at {{.BookingTime}} to reach {{.Destination}} by {{.ReachingTime}}.
+
+From: {{.Source}}
+To:   {{.Destination}}
+
+uberNow
+`
+
+const defaultHTML = `<!DOCTYPE html>
+<html>
+<body>
+<p>Hi {{.Name}},</p>
+<p>Book your {{.Cab}} <strong>{{.CabType}}</strong> at <strong>{{.BookingTime}}</strong> to reach {{.Destination}} by {{.ReachingTime}}.</p>
+<table>
+<tr><td>From</td><td>{{.Source}}</td></tr>
+<tr><td>To</td><td>{{.Destination}}</td></tr>
+<tr><td>Reach by</td><td>{{.ReachingTime}}</td></tr>
+<tr><td>Book at</td><td>{{.BookingTime}}</td></tr>
+</table>
+<p>uberNow</p>
+</body>
+</html>
+`
+
+// Templates render the subject and the plain text and HTML bodies of the email of a
+// CabBookingResponse from a Message.
+type Templates struct {
+	Subject *texttemplate.Template
+	Text    *texttemplate.Template
+	HTML    *htmltemplate.Template
+}
+
+// Message is what the Templates are executed with. The times are formatted in the time zone
+// of the Sender, Response is the CabBookingResponse for the templates which need more.
+type Message struct {
+	Name         string
+	Source       string
+	Destination  string
+	ReachingTime string
+	BookingTime  string
+	Cab          string
+	CabType      string
+	Response     *domain.CabBookingResponse
+}
+
+// timeLayout is the layout of the times of a Message.
+const timeLayout = "Mon, 2 Jan 2006 3:04 PM MST"
+
+// newMessage returns the Message of the booking response with the times in loc.
+func newMessage(c *domain.CabBookingResponse, loc *time.Location) Message {
+	return Message{
+		Name:         c.User.Name,
+		Source:       place(c.Request.Source),
+		Destination:  place(c.Request.Destination),
+		ReachingTime: c.Request.ReachingTime.In(loc).Format(timeLayout),
+		BookingTime:  c.BestBookingTime.In(loc).Format(timeLayout),
+		Cab:          c.Request.Cab,
+		CabType:      c.Request.CabType,
+		Response:     c,
+	}
+}
+
+// place is the name of the location with its coordinates, or its coordinates if it has
+// no name.
+func place(l domain.Location) string {
+	if l.Name == "" {
+		return l.Latitude + ", " + l.Longitude
+	}
+	return l.Name + " (" + l.Latitude + ", " + l.Longitude + ")"
+}
+
+// DefaultTemplates returns the Templates which are used unless they are overridden.
+func DefaultTemplates() *Templates {
+	return &Templates{
+		Subject: texttemplate.Must(texttemplate.New(SubjectFile).Parse(defaultSubject)),
+		Text:    texttemplate.Must(texttemplate.New(TextFile).Parse(defaultText)),
+		HTML:    htmltemplate.Must(htmltemplate.New(HTMLFile).Parse(defaultHTML)),
+	}
+}
+
+// LoadTemplates returns the DefaultTemplates overridden by the files SubjectFile, TextFile
+// and HTMLFile of the directory dir, those which are missing are not overridden.
+func LoadTemplates(dir string) (*Templates, error) {
+	t := DefaultTemplates()
+	read := func(name string) (string, bool, error) {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, errors.Wrapf(err, "couldn't read template %s", name)
+		}
+		return string(b), true, nil
+	}
+
+	s, ok, err := read(SubjectFile)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if t.Subject, err = texttemplate.New(SubjectFile).Parse(s); err != nil {
+			return nil, errors.Wrapf(err, "couldn't parse template %s", SubjectFile)
+		}
+	}
+	if s, ok, err = read(TextFile); err != nil {
+		return nil, err
+	}
+	if ok {
+		if t.Text, err = texttemplate.New(TextFile).Parse(s); err != nil {
+			return nil, errors.Wrapf(err, "couldn't parse template %s", TextFile)
+		}
+	}
+	if s, ok, err = read(HTMLFile); err != nil {
+		return nil, err
+	}
+	if ok {
+		if t.HTML, err = htmltemplate.New(HTMLFile).Parse(s); err != nil {
+			return nil, errors.Wrapf(err, "couldn't parse template %s", HTMLFile)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,50 @@
+package email
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadTemplates(t *testing.T) {
+	dir := t.TempDir()
+	// only the subject and the html body are overridden
+	os.WriteFile(filepath.Join(dir, SubjectFile), []byte(`Leave at {{.BookingTime}}`), 0644)
+	os.WriteFile(filepath.Join(dir, HTMLFile), []byte(`<p>{{.Name}} to {{.Destination}}</p>`), 0644)
+
+	tmpl, err := LoadTemplates(dir)
+	if err != nil {
+		t.Fatalf("LoadTemplates() => got: %v, expected: nil", err)
+	}
+	c := testBookingResponse("email", "anirban.nick@gmail.com")
+	c.User.Name = "<Anirban>"
+	m := newMessage(c, time.UTC)
+
+	testCases := []struct {
+		execute  func(*bytes.Buffer) error
+		expected string
+	}{
+		{func(b *bytes.Buffer) error { return tmpl.Subject.Execute(b, m) }, "Leave at Fri, 9 Mar 2018 1:13 PM UTC"},
+		// the html is escaped
+		{func(b *bytes.Buffer) error { return tmpl.HTML.Execute(b, m) }, "<p>&lt;Anirban&gt; to Hebbal (13.035542, 77.597100)</p>"},
+		// the text body keeps its default
+		{func(b *bytes.Buffer) error { return tmpl.Text.Execute(b, m) }, "Book your uber uberGo at Fri, 9 Mar 2018 1:13 PM UTC"},
+	}
+	for i, _ := range testCases {
+		var b bytes.Buffer
+		if err = testCases[i].execute(&b); err != nil {
+			t.Fatalf("case %d: Execute() => got: %v, expected: nil", i, err)
+		}
+		if !strings.Contains(b.String(), testCases[i].expected) {
+			t.Errorf("case %d: Execute() => got: %q, expected: %q", i, b.String(), testCases[i].expected)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, TextFile), []byte(`{{.Name`), 0644)
+	if _, err = LoadTemplates(dir); err == nil {
+		t.Errorf("LoadTemplates() of a broken template => got: nil, expected an error")
+	}
+}
@@ -0,0 +1,131 @@
+// package fake has stand-ins for the external services of the application, so that it can be
+// run and tried out without any API keys. The answers are made up, but deterministic.
+package fake
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+const earthRadiusKm = 6371.0
+
+// TrafficService implements the domain.TrafficService interface by driving the straight line
+// between source and destination at AverageSpeed, plus Slack for the best and worst case.
+type TrafficService struct {
+	AverageSpeed float64 // km/h
+	Slack        time.Duration
+}
+
+func (t *TrafficService) TravelTime(ctx context.Context, tr *domain.TrafficRequest) (*domain.TrafficResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrap(err, "fake TrafficService gave up")
+	}
+	km, err := distanceKm(tr.Source, tr.Destination)
+	if err != nil {
+		return nil, domain.NewPermanentError(errors.Wrap(err, "fake TrafficService got an invalid location"))
+	}
+	travelTime := time.Duration(km / t.AverageSpeed * float64(time.Hour)).Round(time.Second)
+	resp := domain.TrafficResponse{
+		TrafficRequest: tr,
+		TravelTime:     travelTime,
+		BestCase:       tr.TimeOfDay.Add(travelTime - t.Slack),
+		WorstCase:      tr.TimeOfDay.Add(travelTime + t.Slack),
+	}
+	return &resp, nil
+}
+
+// CabService implements the domain.CabService interface, a cab is always Eta away.
+type CabService struct {
+	Eta time.Duration
+}
+
+func (c *CabService) EtaNow(ctx context.Context, cr *domain.CabRequest) (time.Duration, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, errors.Wrap(err, "fake CabService gave up")
+	}
+	return c.Eta, nil
+}
+
+// Catalog returns the default cabs of the domain, the fake CabService stands in for them.
+func (c *CabService) Catalog() domain.CabCatalog {
+	return domain.DefaultCabCatalog()
+}
+
+// NotificationService implements the domain.NotificationService interface by logging the
+// notification instead of sending it.
+type NotificationService struct {
+	Logger domain.Logger
+}
+
+func (n *NotificationService) Send(ctx context.Context, c *domain.CabBookingResponse) error {
+	n.Logger.Info("time to book a cab",
+		domain.NewField(domain.RequestIDKey, c.Request.ID()),
+		domain.NewField("to", c.NotificationAddr.Value),
+		domain.NewField("cab", c.Cab),
+		domain.NewField("cab_type", c.CabType),
+		domain.NewField("booking_time", c.BestBookingTime),
+	)
+	return nil
+}
+
+// SendConfirmation logs the code which confirms the address instead of sending it.
+func (n *NotificationService) SendConfirmation(ctx context.Context, a domain.UserAddress, code string) error {
+	n.Logger.Info("confirm the address",
+		domain.NewField("to", a.Value),
+		domain.NewField("code", code),
+	)
+	return nil
+}
+
+// distanceKm returns the great circle distance between two locations.
+func distanceKm(a, b domain.Location) (float64, error) {
+	lat1, lon1, err := coordinates(a)
+	if err != nil {
+		return 0, err
+	}
+	lat2, lon2, err := coordinates(b)
+	if err != nil {
+		return 0, err
+	}
+	dLat := lat2 - lat1
+	dLon := lon2 - lon1
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h)), nil
+}
+
+// coordinates returns the latitude and longitude of the location in radians.
+func coordinates(l domain.Location) (float64, float64, error) {
+	lat, err := strconv.ParseFloat(l.Latitude, 64)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "latitude %q", l.Latitude)
+	}
+	lon, err := strconv.ParseFloat(l.Longitude, 64)
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "longitude %q", l.Longitude)
+	}
+	return lat * math.Pi / 180, lon * math.Pi / 180, nil
+}
+
+// NewTrafficService is a constructor which takes the average speed in km/h and the slack
+// and returns a pointer to a new TrafficService.
+func NewTrafficService(averageSpeed float64, slack time.Duration) *TrafficService {
+	return &TrafficService{AverageSpeed: averageSpeed, Slack: slack}
+}
+
+// NewCabService is a constructor which takes the eta of every cab and returns a pointer to
+// a new CabService.
+func NewCabService(eta time.Duration) *CabService {
+	return &CabService{Eta: eta}
+}
+
+// NewNotificationService is a constructor which takes the Logger the notifications are
+// written to and returns a pointer to a new NotificationService.
+func NewNotificationService(l domain.Logger) *NotificationService {
+	return &NotificationService{Logger: l}
+}
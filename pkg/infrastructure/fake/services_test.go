@@ -0,0 +1,39 @@
+package fake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+func TestTrafficServiceTravelTime(t *testing.T) {
+	ts := NewTrafficService(30, 10*time.Minute)
+	start := time.Date(2018, time.March, 9, 18, 0, 0, 0, time.UTC)
+	// Koramangala to Hebbal, about 12.3 km in a straight line
+	koramangala := domain.Location{Latitude: "12.927880", Longitude: "77.627600"}
+	hebbal := domain.Location{Latitude: "13.035542", Longitude: "77.597100"}
+
+	resp, err := ts.TravelTime(context.Background(), domain.NewTrafficRequest(koramangala, hebbal, start))
+	if err != nil {
+		t.Fatalf("TravelTime() => got: %v, expected: nil", err)
+	}
+	if resp.TravelTime < 24*time.Minute || resp.TravelTime > 25*time.Minute {
+		t.Errorf("TravelTime() => got: %v, expected about 24.6 minutes", resp.TravelTime)
+	}
+	if resp.WorstCase.Sub(resp.BestCase) != 20*time.Minute {
+		t.Errorf("TravelTime() => got best case %v and worst case %v, expected them 20 minutes apart", resp.BestCase, resp.WorstCase)
+	}
+
+	_, err = ts.TravelTime(context.Background(), domain.NewTrafficRequest(domain.Location{Latitude: "north", Longitude: "1"}, hebbal, start))
+	if !domain.IsPermanent(err) {
+		t.Errorf("TravelTime() with invalid location => got: %v, expected a permanent error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = ts.TravelTime(ctx, domain.NewTrafficRequest(koramangala, hebbal, start)); err == nil {
+		t.Errorf("TravelTime() with cancelled context => got: nil, expected an error")
+	}
+}
@@ -0,0 +1,30 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+// package flock has exclusive advisory locks on files, they keep out the other processes
+// of the host, and the other open files of the same process, which lock the same file.
+package flock
+
+import (
+	"os"
+	"syscall"
+)
+
+// Lock takes the exclusive lock of the file, waiting until it is free.
+func Lock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+// TryLock takes the exclusive lock of the file if it is free, and reports whether it did.
+func TryLock(f *os.File) (bool, error) {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Unlock releases the lock of the file.
+func Unlock(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,53 @@
+package googlemaps
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+var (
+	// ErrInvalidRequest is returned for a query the API rejects, like one with an invalid
+	// location or a route which is too long.
+	ErrInvalidRequest = errors.New("invalid distance matrix request")
+	// ErrRequestDenied is returned when the API key is invalid or not allowed to use the
+	// Distance Matrix API.
+	ErrRequestDenied = errors.New("distance matrix request denied")
+	// ErrOverQueryLimit is returned when the API key made too many queries, in a second or
+	// in a day.
+	ErrOverQueryLimit = errors.New("distance matrix query limit exceeded")
+	// ErrNoRoute is returned when the source or the destination can't be found, or there is
+	// no way to drive from one to the other.
+	ErrNoRoute = errors.New("no route between source and destination")
+	// ErrUnknown is returned for a failure of the API, or a status which isn't known.
+	ErrUnknown = errors.New("distance matrix request failed")
+)
+
+// statusError returns the error of a status of a response of the Distance Matrix API, or
+// of one of its elements, which isn't OK. The statuses which fail the same way on every
+// retry are permanent errors.
+func statusError(status, message string) error {
+	var err error
+	permanent := true
+	switch status {
+	case "INVALID_REQUEST", "MAX_ELEMENTS_EXCEEDED", "MAX_DIMENSIONS_EXCEEDED", "MAX_ROUTE_LENGTH_EXCEEDED":
+		err = ErrInvalidRequest
+	case "REQUEST_DENIED":
+		err = ErrRequestDenied
+	case "OVER_QUERY_LIMIT", "OVER_DAILY_LIMIT":
+		err, permanent = ErrOverQueryLimit, false
+	case "NOT_FOUND", "ZERO_RESULTS":
+		err = ErrNoRoute
+	default:
+		err, permanent = ErrUnknown, false
+	}
+	if message != "" {
+		err = errors.Wrapf(err, "status %s: %s", status, message)
+	} else {
+		err = errors.Wrapf(err, "status %s", status)
+	}
+	if permanent {
+		return domain.NewPermanentError(err)
+	}
+	return err
+}
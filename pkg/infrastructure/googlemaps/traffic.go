@@ -0,0 +1,181 @@
+// package googlemaps has an implementation of the domain.TrafficService interface with the
+// Distance Matrix API of Google Maps, which predicts the travel time of a journey starting
+// at a departure time from the traffic of the past and of the moment.
+//
+// Every TrafficRequest is a query for each of the traffic models: the best guess gives the
+// travel time, the optimistic and the pessimistic model give the best and the worst case.
+package googlemaps
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+const (
+	// DefaultBaseURL is the endpoint of the Distance Matrix API.
+	DefaultBaseURL = "https://maps.googleapis.com/maps/api/distancematrix/json"
+	// DefaultTimeout bounds a Distance Matrix query, a single origin and destination pair
+	// normally comes back in well under a second.
+	DefaultTimeout = 10 * time.Second
+)
+
+// The traffic models of the Distance Matrix API.
+const (
+	BestGuess   = "best_guess"
+	Optimistic  = "optimistic"
+	Pessimistic = "pessimistic"
+)
+
+// Config holds the API key a TrafficService queries the Distance Matrix API with. Google
+// bills the queries to the Cloud project of APIKey, which must be set, and which needs the
+// Distance Matrix API enabled. BaseURL points the queries at a proxy or a stand-in of the
+// API instead of DefaultBaseURL, Timeout replaces DefaultTimeout and Client, if it is set,
+// replaces http.DefaultClient.
+type Config struct {
+	APIKey  string
+	BaseURL string
+	Timeout time.Duration
+	Client  *http.Client
+}
+
+// TrafficService implements the domain.TrafficService interface with the Distance Matrix API.
+type TrafficService struct {
+	apiKey  string
+	baseURL string
+	timeout time.Duration
+	client  *http.Client
+	// now is the current time, departure times which have passed are sent as now
+	now func() time.Time
+}
+
+// matrixResponse is the part of the response of the Distance Matrix API which is read.
+type matrixResponse struct {
+	Status       string `json:"status"`
+	ErrorMessage string `json:"error_message"`
+	Rows         []struct {
+		Elements []struct {
+			Status   string `json:"status"`
+			Duration struct {
+				Value int64 `json:"value"`
+			} `json:"duration"`
+			DurationInTraffic *struct {
+				Value int64 `json:"value"`
+			} `json:"duration_in_traffic"`
+		} `json:"elements"`
+	} `json:"rows"`
+}
+
+// TravelTime queries the travel time of the request in each traffic model. A request whose
+// time of day has passed departs now.
+func (t *TrafficService) TravelTime(ctx context.Context, tr *domain.TrafficRequest) (*domain.TrafficResponse, error) {
+	departure := tr.TimeOfDay
+	if now := t.now(); departure.Before(now) {
+		departure = now
+	}
+	travelTime, err := t.query(ctx, tr, departure, BestGuess)
+	if err != nil {
+		return nil, err
+	}
+	best, err := t.query(ctx, tr, departure, Optimistic)
+	if err != nil {
+		return nil, err
+	}
+	worst, err := t.query(ctx, tr, departure, Pessimistic)
+	if err != nil {
+		return nil, err
+	}
+	resp := domain.TrafficResponse{
+		TrafficRequest: tr,
+		TravelTime:     travelTime,
+		BestCase:       departure.Add(best),
+		WorstCase:      departure.Add(worst),
+	}
+	return &resp, nil
+}
+
+// query returns the duration in traffic of the journey of the request departing at the
+// departure time in the traffic model, or its duration without traffic if the API doesn't
+// know the traffic of the route.
+func (t *TrafficService) query(ctx context.Context, tr *domain.TrafficRequest, departure time.Time, model string) (time.Duration, error) {
+	q := url.Values{}
+	q.Set("origins", tr.Source.Latitude+","+tr.Source.Longitude)
+	q.Set("destinations", tr.Destination.Latitude+","+tr.Destination.Longitude)
+	q.Set("departure_time", strconv.FormatInt(departure.Unix(), 10))
+	q.Set("traffic_model", model)
+	q.Set("key", t.apiKey)
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.baseURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return 0, domain.NewPermanentError(errors.Wrap(err, "couldn't make distance matrix request"))
+	}
+	res, err := t.client.Do(req)
+	if err != nil {
+		// the error of the client has the url, which has the key
+		if uerr, ok := err.(*url.Error); ok {
+			err = uerr.Err
+		}
+		return 0, errors.Wrapf(err, "distance matrix request (%s) failed", model)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		err = errors.Errorf("distance matrix request (%s) failed with HTTP status %d", model, res.StatusCode)
+		if res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+			return 0, domain.NewPermanentError(err)
+		}
+		return 0, err
+	}
+
+	var m matrixResponse
+	if err = json.NewDecoder(res.Body).Decode(&m); err != nil {
+		return 0, errors.Wrapf(err, "couldn't decode distance matrix response (%s)", model)
+	}
+	if m.Status != "OK" {
+		return 0, statusError(m.Status, m.ErrorMessage)
+	}
+	if len(m.Rows) != 1 || len(m.Rows[0].Elements) != 1 {
+		return 0, errors.Errorf("distance matrix response (%s) has %d rows, expected one with one element", model, len(m.Rows))
+	}
+	e := m.Rows[0].Elements[0]
+	if e.Status != "OK" {
+		return 0, statusError(e.Status, "")
+	}
+	if e.DurationInTraffic != nil {
+		return time.Duration(e.DurationInTraffic.Value) * time.Second, nil
+	}
+	return time.Duration(e.Duration.Value) * time.Second, nil
+}
+
+// NewTrafficService is a constructor which takes the Config of the TrafficService and
+// returns a pointer to a new TrafficService, or an error if the Config has no APIKey.
+func NewTrafficService(c Config) (*TrafficService, error) {
+	if c.APIKey == "" {
+		return nil, errors.New("google maps traffic service needs an api key")
+	}
+	t := TrafficService{
+		apiKey:  c.APIKey,
+		baseURL: c.BaseURL,
+		timeout: c.Timeout,
+		client:  c.Client,
+		now:     time.Now,
+	}
+	if t.baseURL == "" {
+		t.baseURL = DefaultBaseURL
+	}
+	if t.timeout == 0 {
+		t.timeout = DefaultTimeout
+	}
+	if t.client == nil {
+		t.client = http.DefaultClient
+	}
+	return &t, nil
+}
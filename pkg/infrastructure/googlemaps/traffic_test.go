@@ -0,0 +1,193 @@
+package googlemaps
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// fakeAPI is a local stand-in of the Distance Matrix API which answers every query with a
+// recorded response of testdata, the one named after its traffic model unless response is
+// set, and keeps the queries it got.
+type fakeAPI struct {
+	mu       sync.Mutex
+	queries  []url.Values
+	response string
+	status   int
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.queries = append(f.queries, r.URL.Query())
+	name, status := f.response, f.status
+	f.mu.Unlock()
+
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+	if name == "" {
+		name = r.URL.Query().Get("traffic_model")
+	}
+	b, err := os.ReadFile(filepath.Join("testdata", name+".json"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Write(b)
+}
+
+func testTrafficService(t *testing.T, f *fakeAPI, now time.Time) *TrafficService {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	ts, err := NewTrafficService(Config{APIKey: "test-key", BaseURL: srv.URL, Client: srv.Client()})
+	if err != nil {
+		t.Fatalf("NewTrafficService() => got: %v, expected: nil", err)
+	}
+	ts.now = func() time.Time { return now }
+	return ts
+}
+
+// Koramangala to Hebbal, the example of the README
+var (
+	koramangala = domain.Location{Latitude: "12.927880", Longitude: "77.627600"}
+	hebbal      = domain.Location{Latitude: "13.035542", Longitude: "77.597100"}
+)
+
+func TestTrafficServiceTravelTime(t *testing.T) {
+	now := time.Date(2018, time.March, 9, 12, 0, 0, 0, time.UTC)
+	departure := time.Date(2018, time.March, 9, 18, 43, 0, 0, time.UTC)
+	f := &fakeAPI{}
+	ts := testTrafficService(t, f, now)
+
+	resp, err := ts.TravelTime(context.Background(), domain.NewTrafficRequest(koramangala, hebbal, departure))
+	if err != nil {
+		t.Fatalf("TravelTime() => got: %v, expected: nil", err)
+	}
+	if resp.TravelTime != 68*time.Minute {
+		t.Errorf("TravelTime() => got: travel time %v, expected: the best guess duration in traffic 1h8m", resp.TravelTime)
+	}
+	if !resp.BestCase.Equal(departure.Add(55*time.Minute)) || !resp.WorstCase.Equal(departure.Add(87*time.Minute)) {
+		t.Errorf("TravelTime() => got: best case %v and worst case %v, expected: %v and %v", resp.BestCase, resp.WorstCase, departure.Add(55*time.Minute), departure.Add(87*time.Minute))
+	}
+
+	testCases := []struct {
+		param    string
+		expected string
+	}{
+		{"origins", "12.927880,77.627600"},
+		{"destinations", "13.035542,77.597100"},
+		{"departure_time", strconv.FormatInt(departure.Unix(), 10)},
+		{"key", "test-key"},
+	}
+	if len(f.queries) != 3 {
+		t.Fatalf("TravelTime() => got: %d queries, expected: 3", len(f.queries))
+	}
+	for i, _ := range testCases {
+		for _, q := range f.queries {
+			if got := q.Get(testCases[i].param); got != testCases[i].expected {
+				t.Errorf("case %d: query %s => got: %q, expected: %q", i, testCases[i].param, got, testCases[i].expected)
+			}
+		}
+	}
+	models := map[string]bool{}
+	for _, q := range f.queries {
+		models[q.Get("traffic_model")] = true
+	}
+	if !models[BestGuess] || !models[Optimistic] || !models[Pessimistic] {
+		t.Errorf("TravelTime() => got: traffic models %v, expected one query of each", models)
+	}
+}
+
+func TestTrafficServiceTravelTimeDepartsNow(t *testing.T) {
+	now := time.Date(2018, time.March, 9, 19, 0, 0, 0, time.UTC)
+	f := &fakeAPI{response: "no_traffic"}
+	ts := testTrafficService(t, f, now)
+
+	resp, err := ts.TravelTime(context.Background(), domain.NewTrafficRequest(koramangala, hebbal, now.Add(-time.Hour)))
+	if err != nil {
+		t.Fatalf("TravelTime() => got: %v, expected: nil", err)
+	}
+	if got := f.queries[0].Get("departure_time"); got != strconv.FormatInt(now.Unix(), 10) {
+		t.Errorf("TravelTime() of a passed time => got: departure_time %s, expected: now %d", got, now.Unix())
+	}
+	// without duration_in_traffic the duration is used
+	if resp.TravelTime != 41*time.Minute || !resp.BestCase.Equal(now.Add(41*time.Minute)) {
+		t.Errorf("TravelTime() without traffic => got: %v and best case %v, expected: 41m0s from now", resp.TravelTime, resp.BestCase)
+	}
+}
+
+func TestTrafficServiceErrors(t *testing.T) {
+	now := time.Date(2018, time.March, 9, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		response  string
+		status    int
+		expected  error
+		permanent bool
+	}{
+		{"request_denied", 0, ErrRequestDenied, true},
+		{"over_query_limit", 0, ErrOverQueryLimit, false},
+		{"zero_results", 0, ErrNoRoute, true},
+		{"", http.StatusBadGateway, nil, false},
+		{"", http.StatusForbidden, nil, true},
+	}
+
+	for i, _ := range testCases {
+		f := &fakeAPI{response: testCases[i].response, status: testCases[i].status}
+		ts := testTrafficService(t, f, now)
+		_, err := ts.TravelTime(context.Background(), domain.NewTrafficRequest(koramangala, hebbal, now.Add(time.Hour)))
+		if err == nil {
+			t.Errorf("case %d: TravelTime() => got: nil, expected an error", i)
+			continue
+		}
+		if testCases[i].expected != nil && errors.Cause(err) != testCases[i].expected {
+			t.Errorf("case %d: TravelTime() => got: %v, expected: %v", i, err, testCases[i].expected)
+		}
+		if domain.IsPermanent(err) != testCases[i].permanent {
+			t.Errorf("case %d: IsPermanent(%v) => got: %v, expected: %v", i, err, !testCases[i].permanent, testCases[i].permanent)
+		}
+	}
+}
+
+func TestTrafficServiceGivesUp(t *testing.T) {
+	ts := testTrafficService(t, &fakeAPI{}, time.Now())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ts.TravelTime(ctx, domain.NewTrafficRequest(koramangala, hebbal, time.Now())); err == nil {
+		t.Errorf("TravelTime() with cancelled context => got: nil, expected an error")
+	}
+
+	// the key isn't in the error, which ends up in the logs
+	ts.baseURL = "http://127.0.0.1:1"
+	_, err := ts.TravelTime(context.Background(), domain.NewTrafficRequest(koramangala, hebbal, time.Now()))
+	if err == nil || strings.Contains(err.Error(), "test-key") {
+		t.Errorf("TravelTime() with unreachable API => got: %v, expected an error without the key", err)
+	}
+}
+
+func TestNewTrafficService(t *testing.T) {
+	if _, err := NewTrafficService(Config{}); err == nil {
+		t.Errorf("NewTrafficService() without api key => got: nil, expected an error")
+	}
+	ts, err := NewTrafficService(Config{APIKey: "key"})
+	if err != nil {
+		t.Fatalf("NewTrafficService() => got: %v, expected: nil", err)
+	}
+	if ts.baseURL != DefaultBaseURL || ts.timeout != DefaultTimeout || ts.client != http.DefaultClient {
+		t.Errorf("NewTrafficService() => got: %s, %v, %v, expected the defaults", ts.baseURL, ts.timeout, ts.client)
+	}
+}
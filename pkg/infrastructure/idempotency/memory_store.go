@@ -0,0 +1,87 @@
+// package idempotency has implementations of the usecases.IdempotencyStore interface.
+package idempotency
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// sweepInterval is how often at most the expired keys are removed from a MemoryStore.
+const sweepInterval = time.Minute
+
+// scopedKey is the key of a record of a MemoryStore, an idempotency key is unique in its
+// scope only.
+type scopedKey struct {
+	scope string
+	key   string
+}
+
+// MemoryStore implements the usecases.IdempotencyStore interface by keeping the keys in a
+// map. It is safe for concurrent use, the keys are lost on restart. The expired keys are
+// removed as keys are claimed.
+type MemoryStore struct {
+	mu        sync.Mutex
+	records   map[scopedKey]usecases.IdempotencyRecord
+	nextSweep time.Time
+}
+
+func (m *MemoryStore) Claim(rec usecases.IdempotencyRecord, now time.Time) (usecases.IdempotencyRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep(now)
+	k := scopedKey{scope: rec.Scope, key: rec.Key}
+	if stored, ok := m.records[k]; ok && stored.ExpiresAt.After(now) {
+		return stored, false, nil
+	}
+	m.records[k] = rec
+	return rec, true, nil
+}
+
+func (m *MemoryStore) Complete(scope, key string, requestID uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := scopedKey{scope: scope, key: key}
+	rec, ok := m.records[k]
+	if !ok {
+		return errors.Errorf("idempotency key %q of %s not found", key, scope)
+	}
+	rec.RequestID = requestID
+	m.records[k] = rec
+	return nil
+}
+
+func (m *MemoryStore) Release(scope, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := scopedKey{scope: scope, key: key}
+	if _, ok := m.records[k]; !ok {
+		return errors.Errorf("idempotency key %q of %s not found", key, scope)
+	}
+	delete(m.records, k)
+	return nil
+}
+
+// sweep removes the keys which expired by now, at most once per sweepInterval.
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Before(m.nextSweep) {
+		return
+	}
+	for key, rec := range m.records {
+		if !rec.ExpiresAt.After(now) {
+			delete(m.records, key)
+		}
+	}
+	m.nextSweep = now.Add(sweepInterval)
+}
+
+// NewMemoryStore is a constructor which returns a pointer to an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	m := MemoryStore{
+		records: make(map[scopedKey]usecases.IdempotencyRecord),
+	}
+	return &m
+}
@@ -0,0 +1,27 @@
+package idempotency
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/repotest"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+func TestMemoryStoreConformance(t *testing.T) {
+	repotest.IdempotencyStore(t, func(t *testing.T) usecases.IdempotencyStore {
+		return NewMemoryStore()
+	})
+}
+
+func TestMemoryStoreSweepsExpiredKeys(t *testing.T) {
+	now := time.Date(2018, time.March, 9, 9, 0, 0, 0, time.UTC)
+	m := NewMemoryStore()
+	m.Claim(usecases.IdempotencyRecord{Key: "k1", ExpiresAt: now.Add(time.Minute)}, now)
+	m.Claim(usecases.IdempotencyRecord{Key: "k2", ExpiresAt: now.Add(time.Hour)}, now)
+
+	m.Claim(usecases.IdempotencyRecord{Key: "k3", ExpiresAt: now.Add(time.Hour)}, now.Add(2*sweepInterval))
+	if _, ok := m.records[scopedKey{key: "k1"}]; ok || len(m.records) != 2 {
+		t.Errorf("Claim() after k1 expired => got keys: %v, expected k1 to be removed", m.records)
+	}
+}
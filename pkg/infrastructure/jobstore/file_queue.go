@@ -0,0 +1,291 @@
+package jobstore
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// FileQueue implements the usecases.AppEngine interface on top of a job log file, so the
+// pending jobs survive a restart. It also implements usecases.JobCheckpointer, so it can be
+// the Checkpointer of the Dispatcher which consumes its JobQueue.
+//
+// AddJob only returns once the job is synced to disk. Run feeds the jobs, oldest first, to
+// the JobQueue and every job handed out acknowledges itself once a Worker is done with it.
+// The jobs which don't fit in the JobQueue wait in the job log, the FileQueue is full once as
+// many wait there as fit in the JobQueue. What AddJob does then is decided by its
+// usecases.OverflowConfig, with SpillOnFull the job log takes any number of jobs and the
+// Spiller of the OverflowConfig isn't used.
+// The jobs which were never acknowledged are delivered again by the next Run after a
+// restart, so the delivery is at least once and the jobs must be safe to do twice.
+type FileQueue struct {
+	JobQueue chan usecases.Job
+
+	name     string
+	overflow usecases.OverflowConfig
+	codec    *usecases.JobCodec
+	logger   domain.Logger
+
+	mu      sync.Mutex
+	log     *jobLog
+	backlog []uint64
+	notify  chan struct{}
+	room    chan struct{}
+
+	accepted uint64
+	rejected uint64
+	timedOut uint64
+	shed     uint64
+}
+
+// queuedJob is a job handed out by a FileQueue, it knows its id in the job log.
+type queuedJob struct {
+	usecases.Job
+	id    uint64
+	queue *FileQueue
+	acked int32
+}
+
+func (j *queuedJob) Unwrap() usecases.Job {
+	return j.Job
+}
+
+// Ack marks the job as done in the job log, only the first call has any effect.
+func (j *queuedJob) Ack() error {
+	if !atomic.CompareAndSwapInt32(&j.acked, 0, 1) {
+		return nil
+	}
+	return j.queue.ack(j.id)
+}
+
+// AddJob writes the job to the job log and queues it to be fed to the JobQueue. When the
+// FileQueue is full the job is rejected with usecases.ErrQueueFull, waited with or added
+// anyway, as decided by the OverflowConfig.
+func (q *FileQueue) AddJob(j usecases.Job) error {
+	d, err := q.codec.Encode(j)
+	if err != nil {
+		atomic.AddUint64(&q.rejected, 1)
+		return errors.Wrapf(err, "%s couldn't add job", q.name)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err = q.makeRoom(j); err != nil {
+		atomic.AddUint64(&q.rejected, 1)
+		return err
+	}
+	id, err := q.log.add(d)
+	if err != nil {
+		atomic.AddUint64(&q.rejected, 1)
+		return errors.Wrapf(err, "%s couldn't add job", q.name)
+	}
+	q.backlog = append(q.backlog, id)
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	atomic.AddUint64(&q.accepted, 1)
+	return nil
+}
+
+// makeRoom applies the OverflowConfig to the job, it returns once there is room for it in the
+// job log or with an error if the job is rejected. It must be called with q.mu held, which it
+// releases while it waits.
+func (q *FileQueue) makeRoom(j usecases.Job) error {
+	capacity := cap(q.JobQueue)
+	if q.overflow.Sheds(j, len(q.backlog), capacity) {
+		atomic.AddUint64(&q.shed, 1)
+		return errors.Wrapf(usecases.ErrQueueFull, "%s shed low priority job, %d jobs are waiting", q.name, len(q.backlog))
+	}
+	if q.overflow.Policy == usecases.SpillOnFull || len(q.backlog) < capacity {
+		return nil
+	}
+	if q.overflow.Policy != usecases.BlockOnFull && q.overflow.Policy != usecases.ShedOnFull {
+		return errors.Wrapf(usecases.ErrQueueFull, "%s has %d jobs waiting", q.name, len(q.backlog))
+	}
+
+	timer := time.NewTimer(q.overflow.BlockTimeout)
+	defer timer.Stop()
+	for len(q.backlog) >= capacity {
+		room := q.room
+		q.mu.Unlock()
+		select {
+		case <-room:
+			q.mu.Lock()
+		case <-timer.C:
+			q.mu.Lock()
+			atomic.AddUint64(&q.timedOut, 1)
+			return errors.Wrapf(usecases.ErrQueueFull, "%s timed out after %v waiting for room", q.name, q.overflow.BlockTimeout)
+		}
+	}
+	return nil
+}
+
+// persist writes the job to the job log without queueing it to be fed to the JobQueue.
+func (q *FileQueue) persist(j usecases.Job) (uint64, error) {
+	d, err := q.codec.Encode(j)
+	if err != nil {
+		return 0, err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.log.add(d)
+}
+
+func (q *FileQueue) ack(id uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	err := q.log.ack(id)
+	return errors.Wrapf(err, "%s couldn't ack job %d", q.name, id)
+}
+
+// Run feeds the pending jobs to the JobQueue, oldest first, until ctx is done. On startup
+// the pending jobs include the jobs which were not acknowledged before the last shutdown.
+// A job which can't be decoded any more is logged and dropped.
+func (q *FileQueue) Run(ctx context.Context) error {
+	for {
+		q.mu.Lock()
+		if len(q.backlog) == 0 {
+			q.mu.Unlock()
+			select {
+			case <-q.notify:
+				continue
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		id := q.backlog[0]
+		d, ok := q.log.pending[id]
+		q.mu.Unlock()
+		if !ok {
+			q.popBacklog(id)
+			continue
+		}
+
+		job, err := q.codec.Decode(d)
+		if err != nil {
+			q.logger.Error("FileQueue dropped job which can't be decoded",
+				domain.NewField(domain.JobTypeKey, d.Type),
+				domain.NewField(domain.RequestIDKey, d.RequestID),
+				domain.NewField(domain.ErrorKey, err),
+			)
+			q.popBacklog(id)
+			if err = q.ack(id); err != nil {
+				return err
+			}
+			continue
+		}
+
+		select {
+		case q.JobQueue <- q.wrap(job, id):
+			q.popBacklog(id)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// wrap makes the job acknowledge itself, keeping the RetriedJob wrapping outermost so the
+// Worker still sees the attempts made.
+func (q *FileQueue) wrap(job usecases.Job, id uint64) usecases.Job {
+	if r, ok := job.(*usecases.RetriedJob); ok {
+		return &usecases.RetriedJob{Job: &queuedJob{Job: r.Job, id: id, queue: q}, Attempts: r.Attempts}
+	}
+	return &queuedJob{Job: job, id: id, queue: q}
+}
+
+func (q *FileQueue) popBacklog(id uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.backlog) > 0 && q.backlog[0] == id {
+		q.backlog = q.backlog[1:]
+		// wake up the AddJob calls waiting for room
+		close(q.room)
+		q.room = make(chan struct{})
+	}
+}
+
+// Checkpoint writes the jobs which a Dispatcher couldn't finish during shutdown to the job
+// log. The jobs which came from this FileQueue are in the log already and are left as they
+// are, they are delivered again after the restart because they were never acknowledged.
+func (q *FileQueue) Checkpoint(jobs []usecases.Job) error {
+	for _, j := range jobs {
+		if q.owns(j) {
+			continue
+		}
+		_, err := q.persist(j)
+		if err != nil {
+			return errors.Wrapf(err, "%s couldn't checkpoint job", q.name)
+		}
+	}
+	return nil
+}
+
+func (q *FileQueue) owns(j usecases.Job) bool {
+	if r, ok := j.(*usecases.RetriedJob); ok {
+		j = r.Job
+	}
+	qj, ok := j.(*queuedJob)
+	return ok && qj.queue == q
+}
+
+// Stats returns the counters of the FileQueue, the depth is the number of jobs which are
+// pending in the job log.
+func (q *FileQueue) Stats() usecases.QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := usecases.QueueStats{
+		Name:     q.name,
+		Depth:    len(q.log.pending),
+		Capacity: cap(q.JobQueue),
+		Spilled:  len(q.backlog),
+		Accepted: atomic.LoadUint64(&q.accepted),
+		Rejected: atomic.LoadUint64(&q.rejected),
+		TimedOut: atomic.LoadUint64(&q.timedOut),
+		Shed:     atomic.LoadUint64(&q.shed),
+	}
+	return s
+}
+
+// Jobs returns the JobQueue which Run feeds.
+func (q *FileQueue) Jobs() chan usecases.Job {
+	return q.JobQueue
+}
+
+// Close closes the job log file, it must only be called once Run has returned and the
+// Dispatcher consuming the JobQueue is shut down.
+func (q *FileQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.log.close()
+}
+
+// OpenFileQueue is a constructor which takes the path of the job log file, the name used in
+// errors and stats, the length of the JobQueue, the OverflowConfig, the JobCodec and a logger
+// and returns a pointer to a new FileQueue holding the pending jobs found in the job log.
+func OpenFileQueue(path, name string, maxQueueLength int, oc usecases.OverflowConfig, codec *usecases.JobCodec, logger domain.Logger) (*FileQueue, error) {
+	l, err := openJobLog(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s couldn't open job log", name)
+	}
+	q := FileQueue{
+		JobQueue: make(chan usecases.Job, maxQueueLength),
+		name:     name,
+		overflow: oc,
+		codec:    codec,
+		logger:   logger,
+		log:      l,
+		backlog:  l.pendingIDs(),
+		notify:   make(chan struct{}, 1),
+		room:     make(chan struct{}),
+	}
+	if len(q.backlog) > 0 {
+		logger.Info("FileQueue found pending jobs to deliver again", domain.NewField("queue", name), domain.NewField("jobs", len(q.backlog)))
+	}
+	return &q, nil
+}
@@ -0,0 +1,217 @@
+package jobstore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// MockLogger implements the domain.Logger interface and drops every line.
+type MockLogger struct{}
+
+func (l *MockLogger) Debug(m string, fields ...domain.Field)    {}
+func (l *MockLogger) Info(m string, fields ...domain.Field)     {}
+func (l *MockLogger) Warn(m string, fields ...domain.Field)     {}
+func (l *MockLogger) Error(m string, fields ...domain.Field)    {}
+func (l *MockLogger) With(fields ...domain.Field) domain.Logger { return l }
+
+func testNotificationJob(t *testing.T, reqID uint64) *usecases.NotificationJob {
+	t.Helper()
+
+	r := &domain.Request{
+		Source:           domain.Location{Latitude: "77.134134", Longitude: "45.1341324"},
+		Destination:      domain.Location{Latitude: "77.234134", Longitude: "45.5641324"},
+		ReachingTime:     time.Date(2018, time.March, 9, 10, 0, 0, 0, time.UTC),
+		Cab:              "uber",
+		CabType:          "uberGo",
+		NotificationAddr: domain.UserAddress{AddrType: "email", Value: "anirban.nick@gmail.com"},
+	}
+	r.SetID(reqID)
+	ur := domain.NewUserRequest(domain.NewUser("roy"), r)
+	cbr := domain.NewCabBookingResponse(ur, time.Date(2018, time.March, 9, 9, 10, 0, 0, time.UTC))
+	return usecases.NewNotificationJob(cbr, nil)
+}
+
+func testFileQueue(t *testing.T, path string) *FileQueue {
+	t.Helper()
+
+	q, err := OpenFileQueue(path, "TestFileQueue", 10, usecases.OverflowConfig{Policy: usecases.SpillOnFull}, &usecases.JobCodec{}, &MockLogger{})
+	if err != nil {
+		t.Fatalf("OpenFileQueue(%s) => got: %v, expected: nil", path, err)
+	}
+	return q
+}
+
+// receive runs the queue until n jobs are on the JobQueue and returns them.
+func receive(t *testing.T, q *FileQueue, n int) []usecases.Job {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	var jobs []usecases.Job
+	for len(jobs) < n {
+		select {
+		case j := <-q.JobQueue:
+			jobs = append(jobs, j)
+		case <-time.After(time.Second):
+			t.Fatalf("Run() => got %d jobs, expected: %d", len(jobs), n)
+		}
+	}
+	cancel()
+	<-done
+	return jobs
+}
+
+func ack(t *testing.T, j usecases.Job) {
+	t.Helper()
+
+	if r, ok := j.(*usecases.RetriedJob); ok {
+		j = r.Job
+	}
+	if err := j.(usecases.Acknowledger).Ack(); err != nil {
+		t.Fatalf("Ack() => got: %v, expected: nil", err)
+	}
+}
+
+func TestFileQueueRedeliversUnackedJobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.log")
+	q := testFileQueue(t, path)
+	for i := uint64(1); i <= 3; i++ {
+		if err := q.AddJob(testNotificationJob(t, i)); err != nil {
+			t.Fatalf("AddJob() => got: %v, expected: nil", err)
+		}
+	}
+	jobs := receive(t, q, 3)
+	for i, j := range jobs {
+		if j.RequestID() != uint64(i+1) {
+			t.Errorf("Run() => got job of request %d at %d, expected jobs in the order they were added", j.RequestID(), i)
+		}
+	}
+	// only the first job is done before the restart
+	ack(t, jobs[0])
+	q.Close()
+
+	q = testFileQueue(t, path)
+	defer q.Close()
+	if stats := q.Stats(); stats.Depth != 2 {
+		t.Fatalf("Stats() after restart => got: %+v, expected 2 pending jobs", stats)
+	}
+	jobs = receive(t, q, 2)
+	if jobs[0].RequestID() != 2 || jobs[1].RequestID() != 3 {
+		t.Errorf("Run() after restart => got jobs of requests %d and %d, expected 2 and 3", jobs[0].RequestID(), jobs[1].RequestID())
+	}
+	decoded := jobs[0].(usecases.JobWrapper).Unwrap().(*usecases.NotificationJob)
+	if decoded.CabBookingResponse.NotificationAddr.Value != "anirban.nick@gmail.com" {
+		t.Errorf("Run() after restart => got: %+v, expected the job's data to be restored", decoded.CabBookingResponse.UserRequest.Request)
+	}
+}
+
+func TestFileQueueCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.log")
+	q := testFileQueue(t, path)
+	q.AddJob(testNotificationJob(t, 1))
+	jobs := receive(t, q, 1)
+
+	// a job of this queue which is already in the log and a retried job from elsewhere
+	err := q.Checkpoint([]usecases.Job{
+		jobs[0],
+		&usecases.RetriedJob{Job: testNotificationJob(t, 2), Attempts: 2},
+	})
+	if err != nil {
+		t.Fatalf("Checkpoint() => got: %v, expected: nil", err)
+	}
+	q.Close()
+
+	q = testFileQueue(t, path)
+	defer q.Close()
+	jobs = receive(t, q, 2)
+	r, ok := jobs[1].(*usecases.RetriedJob)
+	if jobs[0].RequestID() != 1 || !ok || r.Attempts != 2 || r.RequestID() != 2 {
+		t.Errorf("Run() after Checkpoint => got: %v, expected job 1 and job 2 after 2 attempts", jobs)
+	}
+}
+
+func TestFileQueueCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.log")
+	q := testFileQueue(t, path)
+	q.log.compactAfter = 2
+	for i := uint64(1); i <= 3; i++ {
+		q.AddJob(testNotificationJob(t, i))
+	}
+	jobs := receive(t, q, 3)
+	ack(t, jobs[0])
+	ack(t, jobs[1])
+	if q.log.acked != 0 {
+		t.Errorf("Ack() => got %d acked since compaction, expected the log to be compacted", q.log.acked)
+	}
+	// the new log keeps working
+	q.AddJob(testNotificationJob(t, 4))
+	q.Close()
+
+	q = testFileQueue(t, path)
+	defer q.Close()
+	jobs = receive(t, q, 2)
+	if jobs[0].RequestID() != 3 || jobs[1].RequestID() != 4 {
+		t.Errorf("Run() after compaction => got jobs of requests %d and %d, expected 3 and 4", jobs[0].RequestID(), jobs[1].RequestID())
+	}
+}
+
+func TestFileQueueOverflow(t *testing.T) {
+	testCases := []struct {
+		name          string
+		overflow      usecases.OverflowConfig
+		run           bool
+		expectedError error
+	}{
+		{name: "spill", overflow: usecases.OverflowConfig{Policy: usecases.SpillOnFull}},
+		{name: "reject", overflow: usecases.OverflowConfig{Policy: usecases.RejectOnFull}, expectedError: usecases.ErrQueueFull},
+		{name: "block until the job is fed", overflow: usecases.OverflowConfig{Policy: usecases.BlockOnFull, BlockTimeout: time.Second}, run: true},
+		{name: "block and time out", overflow: usecases.OverflowConfig{Policy: usecases.BlockOnFull, BlockTimeout: 20 * time.Millisecond}, expectedError: usecases.ErrQueueFull},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		path := filepath.Join(t.TempDir(), "jobs.log")
+		q, err := OpenFileQueue(path, "TestFileQueue", 1, tc.overflow, &usecases.JobCodec{}, &MockLogger{})
+		if err != nil {
+			t.Fatalf("%s: OpenFileQueue(%s) => got: %v, expected: nil", tc.name, path, err)
+		}
+		// the first job waits in the job log until it is fed to the JobQueue
+		if err = q.AddJob(testNotificationJob(t, 1)); err != nil {
+			t.Fatalf("%s: AddJob() => got: %v, expected: nil", tc.name, err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			if tc.run {
+				q.Run(ctx)
+			}
+			close(done)
+		}()
+
+		err = q.AddJob(testNotificationJob(t, 2))
+		if errors.Cause(err) != tc.expectedError {
+			t.Errorf("%s: AddJob() to a full FileQueue => got: %v, expected: %v", tc.name, err, tc.expectedError)
+		}
+		var expectedRejected uint64
+		if tc.expectedError != nil {
+			expectedRejected = 1
+		}
+		if stats := q.Stats(); stats.Rejected != expectedRejected {
+			t.Errorf("%s: Stats() => got: %+v, expected %d rejected", tc.name, stats, expectedRejected)
+		}
+		cancel()
+		<-done
+		q.Close()
+	}
+}
@@ -0,0 +1,84 @@
+package jobstore
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// FileSpiller implements the usecases.JobSpiller interface on top of a job log file, it is
+// the disk a usecases.QueueEngine with the SpillOnFull policy spills to. The spilled jobs
+// survive a restart.
+type FileSpiller struct {
+	codec *usecases.JobCodec
+
+	mu  sync.Mutex
+	log *jobLog
+}
+
+// Spill writes the job to the job log.
+func (s *FileSpiller) Spill(j usecases.Job) error {
+	d, err := s.codec.Encode(j)
+	if err != nil {
+		return errors.Wrap(err, "FileSpiller couldn't encode job")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.log.add(d)
+	return err
+}
+
+// Peek returns the oldest spilled job without removing it.
+func (s *FileSpiller) Peek() (usecases.Job, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := s.log.pendingIDs()
+	if len(ids) == 0 {
+		return nil, false, nil
+	}
+	j, err := s.codec.Decode(s.log.pending[ids[0]])
+	if err != nil {
+		return nil, false, errors.Wrap(err, "FileSpiller couldn't decode spilled job")
+	}
+	return j, true, nil
+}
+
+// Pop removes the oldest spilled job.
+func (s *FileSpiller) Pop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := s.log.pendingIDs()
+	if len(ids) == 0 {
+		return errors.New("FileSpiller has no spilled jobs")
+	}
+	return s.log.ack(ids[0])
+}
+
+func (s *FileSpiller) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.log.pending)
+}
+
+// Close closes the job log file.
+func (s *FileSpiller) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.log.close()
+}
+
+// OpenFileSpiller is a constructor which takes the path of the job log file and the JobCodec
+// and returns a pointer to a new FileSpiller holding the jobs spilled before a restart.
+func OpenFileSpiller(path string, codec *usecases.JobCodec) (*FileSpiller, error) {
+	l, err := openJobLog(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "FileSpiller couldn't open job log")
+	}
+	s := FileSpiller{
+		codec: codec,
+		log:   l,
+	}
+	return &s, nil
+}
@@ -0,0 +1,296 @@
+// package jobstore has durable, file backed implementations of the job queue related
+// interfaces of the usecases package.
+//
+// The jobs are kept in an append only log file of JSON lines. Adding a job appends an "add"
+// record with the job's JobDescriptor, finishing a job appends an "ack" record. Every append
+// is synced to disk before it returns, so a job which was added is never lost, and the jobs
+// which were added but never acked are the pending jobs after a restart. Once enough jobs are
+// acked the log is compacted by rewriting it with only the pending jobs. The same log also
+// backs the FileScheduleStore, whose "add" records carry the time the job is due at.
+package jobstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+const (
+	opAdd = "add"
+	opAck = "ack"
+
+	// defaultCompactAfter is the number of acked jobs after which the log is compacted,
+	// if there are fewer pending jobs than that.
+	defaultCompactAfter = 1024
+)
+
+// errCorruptLog is the cause of the error returned when a record in the middle of the job log
+// can't be read. Only the last record can be partly written, by a crash during an append, so
+// a bad record before it means the log was damaged and the jobs after it can't be trusted.
+var errCorruptLog = errors.New("job log is corrupt")
+
+// logRecord is a single line of the job log.
+type logRecord struct {
+	Op  string                  `json:"op"`
+	ID  uint64                  `json:"id"`
+	Job *usecases.JobDescriptor `json:"job,omitempty"`
+	At  *time.Time              `json:"at,omitempty"`
+}
+
+// jobLog is the append only log file of jobs, it is not safe for concurrent use.
+type jobLog struct {
+	path         string
+	f            *os.File
+	lastID       uint64
+	pending      map[uint64]usecases.JobDescriptor
+	due          map[uint64]time.Time
+	acked        int
+	compactAfter int
+}
+
+// openJobLog opens the log file at path, creating it if needed, and reads the pending jobs
+// from it. A partly written last line, left by a crash during an append, is cut off, any
+// other line which can't be read is reported with errCorruptLog.
+func openJobLog(path string) (*jobLog, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't open job log %s", path)
+	}
+	l := jobLog{
+		path:         path,
+		f:            f,
+		pending:      make(map[uint64]usecases.JobDescriptor),
+		due:          make(map[uint64]time.Time),
+		compactAfter: defaultCompactAfter,
+	}
+	err = l.replay()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &l, nil
+}
+
+// replay applies the records from the current offset of the file to the end.
+func (l *jobLog) replay() error {
+	offset, err := l.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't seek job log %s", l.path)
+	}
+	r := bufio.NewReader(l.f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				// the last append didn't complete, drop it
+				return l.truncate(offset)
+			}
+			break
+		}
+		if err != nil {
+			return errors.Wrapf(err, "couldn't read job log %s", l.path)
+		}
+		var rec logRecord
+		if jsonErr := json.Unmarshal(line, &rec); jsonErr != nil {
+			if _, peekErr := r.Peek(1); peekErr == io.EOF {
+				// the last append didn't complete, drop it
+				return l.truncate(offset)
+			}
+			return errors.Wrapf(errCorruptLog, "%s has a bad record at offset %d: %v", l.path, offset, jsonErr)
+		}
+		offset += int64(len(line))
+		l.apply(rec)
+	}
+	_, err = l.f.Seek(offset, io.SeekStart)
+	return errors.Wrapf(err, "couldn't seek to end of job log %s", l.path)
+}
+
+// refresh applies the records other processes appended to the log since it was last read.
+// When another process compacted the log, the new log is opened and read from the start.
+// It must be called with the log locked against the other processes.
+func (l *jobLog) refresh() error {
+	fi, err := os.Stat(l.path)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't stat job log %s", l.path)
+	}
+	cur, err := l.f.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "couldn't stat job log %s", l.path)
+	}
+	if !os.SameFile(fi, cur) {
+		f, err := os.OpenFile(l.path, os.O_RDWR, 0600)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't reopen compacted job log %s", l.path)
+		}
+		l.f.Close()
+		l.f = f
+		l.pending = make(map[uint64]usecases.JobDescriptor)
+		l.due = make(map[uint64]time.Time)
+		l.acked = 0
+	}
+	return l.replay()
+}
+
+func (l *jobLog) truncate(offset int64) error {
+	err := l.f.Truncate(offset)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't cut partial record off job log %s", l.path)
+	}
+	_, err = l.f.Seek(offset, io.SeekStart)
+	return errors.Wrapf(err, "couldn't seek job log %s", l.path)
+}
+
+func (l *jobLog) apply(rec logRecord) {
+	if rec.ID > l.lastID {
+		l.lastID = rec.ID
+	}
+	switch rec.Op {
+	case opAdd:
+		if rec.Job != nil {
+			l.pending[rec.ID] = *rec.Job
+			if rec.At != nil {
+				l.due[rec.ID] = *rec.At
+			}
+		}
+	case opAck:
+		delete(l.pending, rec.ID)
+		delete(l.due, rec.ID)
+	}
+}
+
+func (l *jobLog) append(rec logRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "couldn't marshal job log record")
+	}
+	b = append(b, '\n')
+	_, err = l.f.Write(b)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't write to job log %s", l.path)
+	}
+	err = l.f.Sync()
+	return errors.Wrapf(err, "couldn't sync job log %s", l.path)
+}
+
+// add writes the job to the log and returns its id.
+func (l *jobLog) add(d usecases.JobDescriptor) (uint64, error) {
+	return l.addAt(d, time.Time{})
+}
+
+// addAt writes the job, which is due at the given time, to the log and returns its id.
+// A zero time means the job is not scheduled.
+func (l *jobLog) addAt(d usecases.JobDescriptor, at time.Time) (uint64, error) {
+	id := l.lastID + 1
+	err := l.append(l.addRecord(id, d, at))
+	if err != nil {
+		return 0, err
+	}
+	l.lastID = id
+	l.pending[id] = d
+	if !at.IsZero() {
+		l.due[id] = at
+	}
+	return id, nil
+}
+
+func (l *jobLog) addRecord(id uint64, d usecases.JobDescriptor, at time.Time) logRecord {
+	rec := logRecord{Op: opAdd, ID: id, Job: &d}
+	if !at.IsZero() {
+		rec.At = &at
+	}
+	return rec
+}
+
+// ack marks the job as done, acking a job which is not pending does nothing.
+func (l *jobLog) ack(id uint64) error {
+	if _, ok := l.pending[id]; !ok {
+		return nil
+	}
+	err := l.append(logRecord{Op: opAck, ID: id})
+	if err != nil {
+		return err
+	}
+	delete(l.pending, id)
+	delete(l.due, id)
+	l.acked++
+	if l.acked >= l.compactAfter && l.acked > len(l.pending) {
+		return l.compact()
+	}
+	return nil
+}
+
+// pendingIDs returns the ids of the pending jobs, oldest first.
+func (l *jobLog) pendingIDs() []uint64 {
+	ids := make([]uint64, 0, len(l.pending))
+	for id := range l.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// compact rewrites the log with only the pending jobs. The new log is written next to the
+// old one and renamed over it, so a crash leaves either the old or the new log behind.
+func (l *jobLog) compact() error {
+	tmpPath := l.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't create compacted job log %s", tmpPath)
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	if _, ok := l.pending[l.lastID]; !ok && l.lastID > 0 {
+		// keeps the last id, so the ids of acked jobs are not handed out again
+		err = enc.Encode(logRecord{Op: opAck, ID: l.lastID})
+	}
+	for _, id := range l.pendingIDs() {
+		if err != nil {
+			break
+		}
+		err = enc.Encode(l.addRecord(id, l.pending[id], l.due[id]))
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "couldn't write compacted job log")
+	}
+	if err = os.Rename(tmpPath, l.path); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "couldn't replace job log with compacted log")
+	}
+	l.f.Close()
+	l.f = tmp
+	l.acked = 0
+	// the rename is only durable once the directory is synced
+	return syncDir(filepath.Dir(l.path))
+}
+
+// syncDir syncs the directory, so the files created or renamed in it survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't open directory %s", dir)
+	}
+	defer d.Close()
+	err = d.Sync()
+	return errors.Wrapf(err, "couldn't sync directory %s", dir)
+}
+
+func (l *jobLog) close() error {
+	return l.f.Close()
+}
@@ -0,0 +1,104 @@
+package jobstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+func TestJobLogCutsPartialRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.log")
+	l, err := openJobLog(path)
+	if err != nil {
+		t.Fatalf("openJobLog() => got: %v, expected: nil", err)
+	}
+	l.add(usecases.JobDescriptor{Type: "notification", RequestID: 1, Payload: []byte("{}")})
+	l.close()
+
+	// a crash in the middle of the next append
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString(`{"op":"add","id":2,"jo`)
+	f.Close()
+
+	l, err = openJobLog(path)
+	if err != nil {
+		t.Fatalf("openJobLog() with partial record => got: %v, expected: nil", err)
+	}
+	if len(l.pending) != 1 {
+		t.Errorf("openJobLog() with partial record => got %d pending jobs, expected: 1", len(l.pending))
+	}
+	id, _ := l.add(usecases.JobDescriptor{Type: "notification", RequestID: 2, Payload: []byte("{}")})
+	l.close()
+
+	l, _ = openJobLog(path)
+	defer l.close()
+	if _, ok := l.pending[id]; !ok || len(l.pending) != 2 {
+		t.Errorf("openJobLog() after appending past the cut => got: %v, expected 2 pending jobs", l.pending)
+	}
+}
+
+func TestJobLogReportsCorruptRecord(t *testing.T) {
+	testCases := []struct {
+		name          string
+		tail          string
+		expectedError error
+		expectedJobs  int
+	}{
+		{name: "bad last line", tail: "garbage\n", expectedJobs: 2},
+		{name: "bad line before the last", tail: "garbage\n" + `{"op":"ack","id":1}` + "\n", expectedError: errCorruptLog},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		path := filepath.Join(t.TempDir(), "jobs.log")
+		l, _ := openJobLog(path)
+		l.add(usecases.JobDescriptor{Type: "notification", RequestID: 1, Payload: []byte("{}")})
+		l.add(usecases.JobDescriptor{Type: "notification", RequestID: 2, Payload: []byte("{}")})
+		l.close()
+		f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+		f.WriteString(tc.tail)
+		f.Close()
+
+		l, err := openJobLog(path)
+		if errors.Cause(err) != tc.expectedError {
+			t.Errorf("%s: openJobLog() => got: %v, expected: %v", tc.name, err, tc.expectedError)
+			continue
+		}
+		if err == nil {
+			if len(l.pending) != tc.expectedJobs {
+				t.Errorf("%s: openJobLog() => got %d pending jobs, expected: %d", tc.name, len(l.pending), tc.expectedJobs)
+			}
+			l.close()
+		}
+	}
+}
+
+func TestFileSpiller(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spill.log")
+	s, err := OpenFileSpiller(path, &usecases.JobCodec{})
+	if err != nil {
+		t.Fatalf("OpenFileSpiller() => got: %v, expected: nil", err)
+	}
+	s.Spill(testNotificationJob(t, 1))
+	s.Spill(testNotificationJob(t, 2))
+	s.Close()
+
+	s, _ = OpenFileSpiller(path, &usecases.JobCodec{})
+	defer s.Close()
+	if s.Len() != 2 {
+		t.Fatalf("Len() after restart => got: %d, expected: 2", s.Len())
+	}
+	j, ok, err := s.Peek()
+	if !ok || err != nil || j.RequestID() != 1 {
+		t.Errorf("Peek() => got: (%v, %v, %v), expected the oldest job", j, ok, err)
+	}
+	s.Pop()
+	j, _, _ = s.Peek()
+	if j.RequestID() != 2 || s.Len() != 1 {
+		t.Errorf("Peek() after Pop() => got job of request %d and %d left, expected request 2 and 1 left", j.RequestID(), s.Len())
+	}
+}
@@ -0,0 +1,104 @@
+package jobstore
+
+import (
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/flock"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// FileScheduleStore implements the usecases.ScheduleStore interface on top of a job log
+// file, so the CronJobs of a CronEngine survive a restart.
+//
+// Several processes can open a FileScheduleStore on the same path. Every call takes an
+// exclusive lock of a lock file next to the job log, and first reads what the other processes
+// appended to the log, or the log they compacted, so they all see the same CronJobs and never
+// hand out the same id.
+type FileScheduleStore struct {
+	mu   sync.Mutex
+	lock *os.File
+	log  *jobLog
+}
+
+// Add writes the CronJob to the job log and returns the id it was stored with.
+func (s *FileScheduleStore) Add(cj usecases.CronJob) (uint64, error) {
+	if cj.At.IsZero() {
+		return 0, errors.New("FileScheduleStore can't store a CronJob without a time")
+	}
+	var id uint64
+	err := s.locked(func() (err error) {
+		id, err = s.log.addAt(cj.Job, cj.At)
+		return err
+	})
+	return id, err
+}
+
+// Remove deletes the CronJob with the given id, removing an unknown id does nothing.
+func (s *FileScheduleStore) Remove(id uint64) error {
+	return s.locked(func() error {
+		return s.log.ack(id)
+	})
+}
+
+// List returns all the stored CronJobs, in the order they were added.
+func (s *FileScheduleStore) List() ([]usecases.CronJob, error) {
+	var cjs []usecases.CronJob
+	err := s.locked(func() error {
+		ids := s.log.pendingIDs()
+		cjs = make([]usecases.CronJob, 0, len(ids))
+		for _, id := range ids {
+			cjs = append(cjs, usecases.CronJob{
+				ID:  id,
+				At:  s.log.due[id],
+				Job: s.log.pending[id],
+			})
+		}
+		return nil
+	})
+	return cjs, err
+}
+
+// locked calls f with the lock file locked and the job log brought up to date.
+func (s *FileScheduleStore) locked(f func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := flock.Lock(s.lock); err != nil {
+		return errors.Wrap(err, "FileScheduleStore couldn't lock job log")
+	}
+	defer flock.Unlock(s.lock)
+	if err := s.log.refresh(); err != nil {
+		return errors.Wrap(err, "FileScheduleStore couldn't read job log")
+	}
+	return f()
+}
+
+// Close closes the job log and lock files.
+func (s *FileScheduleStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lock.Close()
+	return s.log.close()
+}
+
+// OpenFileScheduleStore is a constructor which takes the path of the job log file and
+// returns a pointer to a new FileScheduleStore holding the CronJobs stored before a restart.
+func OpenFileScheduleStore(path string) (*FileScheduleStore, error) {
+	lock, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "FileScheduleStore couldn't open lock file")
+	}
+	if err = flock.Lock(lock); err != nil {
+		lock.Close()
+		return nil, errors.Wrap(err, "FileScheduleStore couldn't lock job log")
+	}
+	defer flock.Unlock(lock)
+	l, err := openJobLog(path)
+	if err != nil {
+		lock.Close()
+		return nil, errors.Wrap(err, "FileScheduleStore couldn't open job log")
+	}
+	return &FileScheduleStore{lock: lock, log: l}, nil
+}
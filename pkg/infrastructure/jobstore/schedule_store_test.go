@@ -0,0 +1,93 @@
+package jobstore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+func TestFileScheduleStoreSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.log")
+	s, err := OpenFileScheduleStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileScheduleStore() => got: %v, expected: nil", err)
+	}
+	at := time.Date(2030, 1, 2, 8, 30, 0, 0, time.UTC)
+	first, _ := s.Add(usecases.CronJob{At: at, Job: usecases.JobDescriptor{Type: "cab_request", RequestID: 1, Payload: []byte("{}")}})
+	second, _ := s.Add(usecases.CronJob{At: at.Add(time.Hour), Job: usecases.JobDescriptor{Type: "cab_request", RequestID: 2, Payload: []byte("{}")}})
+	if err = s.Remove(first); err != nil {
+		t.Fatalf("Remove() => got: %v, expected: nil", err)
+	}
+	if _, err = s.Add(usecases.CronJob{Job: usecases.JobDescriptor{Type: "cab_request"}}); err == nil {
+		t.Errorf("Add() without a time => got: nil, expected an error")
+	}
+	s.Close()
+
+	s, err = OpenFileScheduleStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileScheduleStore() after restart => got: %v, expected: nil", err)
+	}
+	defer s.Close()
+	cjs, _ := s.List()
+	if len(cjs) != 1 || cjs[0].ID != second || !cjs[0].At.Equal(at.Add(time.Hour)) || cjs[0].Job.RequestID != 2 {
+		t.Errorf("List() after restart => got: %+v, expected only the second CronJob", cjs)
+	}
+}
+
+func TestFileScheduleStoreCompactionKeepsDueTimes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.log")
+	s, _ := OpenFileScheduleStore(path)
+	s.log.compactAfter = 2
+	at := time.Date(2030, 1, 2, 8, 30, 0, 0, time.UTC)
+	var ids []uint64
+	for i := 0; i < 3; i++ {
+		id, _ := s.Add(usecases.CronJob{At: at.Add(time.Duration(i) * time.Minute), Job: usecases.JobDescriptor{Type: "cab_request", RequestID: uint64(i)}})
+		ids = append(ids, id)
+	}
+	s.Remove(ids[0])
+	s.Remove(ids[1])
+	s.Close()
+
+	s, _ = OpenFileScheduleStore(path)
+	defer s.Close()
+	cjs, _ := s.List()
+	if len(cjs) != 1 || !cjs[0].At.Equal(at.Add(2*time.Minute)) {
+		t.Errorf("List() after compaction => got: %+v, expected the last CronJob with its due time", cjs)
+	}
+}
+
+func TestFileScheduleStoreSharedBetweenProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.log")
+	a, _ := OpenFileScheduleStore(path)
+	defer a.Close()
+	b, _ := OpenFileScheduleStore(path)
+	defer b.Close()
+	a.log.compactAfter = 1
+	at := time.Date(2030, 1, 2, 8, 30, 0, 0, time.UTC)
+	cj := func(reqID uint64) usecases.CronJob {
+		return usecases.CronJob{At: at, Job: usecases.JobDescriptor{Type: "cab_request", RequestID: reqID, Payload: []byte("{}")}}
+	}
+
+	first, _ := a.Add(cj(1))
+	second, _ := b.Add(cj(2))
+	if first == second {
+		t.Errorf("Add() on both stores => got ids: %d and %d, expected different ids", first, second)
+	}
+	// compacts the log under b
+	if err := a.Remove(first); err != nil {
+		t.Fatalf("Remove() => got: %v, expected: nil", err)
+	}
+	third, _ := b.Add(cj(3))
+	if third == first || third == second {
+		t.Errorf("Add() after compaction => got id: %d, expected a new id", third)
+	}
+
+	for _, s := range []*FileScheduleStore{a, b} {
+		cjs, err := s.List()
+		if err != nil || len(cjs) != 2 || cjs[0].ID != second || cjs[1].ID != third {
+			t.Errorf("List() => got: %+v, %v, expected the CronJobs %d and %d", cjs, err, second, third)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// package lease has implementations of the usecases.Lease interface.
+package lease
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/flock"
+)
+
+// leaseRecord is the content of the lease file.
+type leaseRecord struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// FileLease implements the usecases.Lease interface with a lease file, so the instances of the
+// server running on one host, or sharing a file system with working file locks, elect one
+// leader. The file holds the current holder and when its lease expires, it is read and written
+// under an exclusive file lock.
+type FileLease struct {
+	path string
+	now  func() time.Time
+
+	mu sync.Mutex
+}
+
+// Acquire takes the lease for the holder if it is free or has expired, or renews it if the
+// holder has it already.
+func (l *FileLease) Acquire(holder string, ttl time.Duration) (bool, error) {
+	if holder == "" {
+		return false, errors.New("FileLease can't be acquired without a holder")
+	}
+	var ok bool
+	err := l.update(func(rec *leaseRecord) bool {
+		now := l.now()
+		if rec.Holder != "" && rec.Holder != holder && now.Before(rec.Expires) {
+			return false
+		}
+		rec.Holder = holder
+		rec.Expires = now.Add(ttl)
+		ok = true
+		return true
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "FileLease couldn't be acquired")
+	}
+	return ok, nil
+}
+
+// Release gives the lease up if the holder has it.
+func (l *FileLease) Release(holder string) error {
+	err := l.update(func(rec *leaseRecord) bool {
+		if rec.Holder != holder {
+			return false
+		}
+		*rec = leaseRecord{}
+		return true
+	})
+	return errors.Wrap(err, "FileLease couldn't be released")
+}
+
+// update reads the lease record and writes it back if change returns true, all under an
+// exclusive lock of the lease file.
+func (l *FileLease) update(change func(*leaseRecord) bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't open lease file %s", l.path)
+	}
+	defer f.Close()
+	if err = flock.Lock(f); err != nil {
+		return errors.Wrapf(err, "couldn't lock lease file %s", l.path)
+	}
+	defer flock.Unlock(f)
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return errors.Wrapf(err, "couldn't read lease file %s", l.path)
+	}
+	var rec leaseRecord
+	if len(b) > 0 {
+		if err = json.Unmarshal(b, &rec); err != nil {
+			// a torn write, nobody has the lease
+			rec = leaseRecord{}
+		}
+	}
+	if !change(&rec) {
+		return nil
+	}
+
+	b, err = json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "couldn't marshal lease record")
+	}
+	if err = f.Truncate(0); err == nil {
+		_, err = f.WriteAt(b, 0)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	return errors.Wrapf(err, "couldn't write lease file %s", l.path)
+}
+
+// NewFileLease is a constructor which takes the path of the lease file and returns a pointer
+// to a new FileLease.
+func NewFileLease(path string) *FileLease {
+	l := FileLease{
+		path: path,
+		now:  time.Now,
+	}
+	return &l
+}
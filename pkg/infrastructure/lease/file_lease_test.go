@@ -0,0 +1,56 @@
+package lease
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileLease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cron.lease")
+	now := time.Date(2018, time.March, 9, 9, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	// two instances of the server sharing the lease file
+	a, b := NewFileLease(path), NewFileLease(path)
+	a.now, b.now = clock, clock
+
+	steps := []struct {
+		name     string
+		lease    *FileLease
+		holder   string
+		advance  time.Duration
+		expected bool
+	}{
+		{"first holder takes the free lease", a, "a", 0, true},
+		{"second holder can't take a held lease", b, "b", 0, false},
+		{"holder renews its lease", a, "a", 20 * time.Second, true},
+		{"lease is still held after the first ttl", b, "b", 15 * time.Second, false},
+		{"lease expires without renewal", b, "b", 16 * time.Second, true},
+		{"old holder lost the lease", a, "a", 0, false},
+	}
+
+	for _, s := range steps {
+		now = now.Add(s.advance)
+		got, err := s.lease.Acquire(s.holder, 30*time.Second)
+		if err != nil {
+			t.Fatalf("%s: Acquire() => got: %v, expected: nil", s.name, err)
+		}
+		if got != s.expected {
+			t.Errorf("%s: Acquire(%s) => got: %v, expected: %v", s.name, s.holder, got, s.expected)
+		}
+	}
+
+	// releasing a lease someone else holds does nothing
+	a.Release("a")
+	if ok, _ := a.Acquire("a", 30*time.Second); ok {
+		t.Errorf("Acquire() after releasing a lease held by another holder => got: true, expected: false")
+	}
+	b.Release("b")
+	if ok, _ := a.Acquire("a", 30*time.Second); !ok {
+		t.Errorf("Acquire() after the holder released the lease => got: false, expected: true")
+	}
+
+	if _, err := a.Acquire("", time.Second); err == nil {
+		t.Errorf("Acquire() without a holder => got: nil, expected an error")
+	}
+}
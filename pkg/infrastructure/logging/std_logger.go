@@ -0,0 +1,98 @@
+// package logging has the adapters which implement the domain.Logger interface
+// on top of concrete logging libraries.
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// StdLogger implements the domain.Logger interface using the standard library's log.Logger.
+// Every line is written in a logfmt like format, e.g.
+//
+//	2018/03/09 15:18:10 level=error msg="job failed" job_type=user_request request_id=42 error="..."
+//
+// Lines whose level is below the configured level are dropped.
+type StdLogger struct {
+	logger *log.Logger
+	level  domain.LogLevel
+	fields []domain.Field
+}
+
+func (s *StdLogger) Debug(msg string, fields ...domain.Field) {
+	s.log(domain.DebugLevel, msg, fields)
+}
+
+func (s *StdLogger) Info(msg string, fields ...domain.Field) {
+	s.log(domain.InfoLevel, msg, fields)
+}
+
+func (s *StdLogger) Warn(msg string, fields ...domain.Field) {
+	s.log(domain.WarnLevel, msg, fields)
+}
+
+func (s *StdLogger) Error(msg string, fields ...domain.Field) {
+	s.log(domain.ErrorLevel, msg, fields)
+}
+
+// With returns a new StdLogger which writes to the same log.Logger but also attaches
+// the given fields to every line, after the fields already attached to s.
+func (s *StdLogger) With(fields ...domain.Field) domain.Logger {
+	all := make([]domain.Field, 0, len(s.fields)+len(fields))
+	all = append(all, s.fields...)
+	all = append(all, fields...)
+	l := StdLogger{
+		logger: s.logger,
+		level:  s.level,
+		fields: all,
+	}
+	return &l
+}
+
+func (s *StdLogger) log(level domain.LogLevel, msg string, fields []domain.Field) {
+	if level < s.level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString("level=")
+	b.WriteString(level.String())
+	b.WriteString(" msg=")
+	b.WriteString(formatValue(msg))
+	for _, f := range s.fields {
+		writeField(&b, f)
+	}
+	for _, f := range fields {
+		writeField(&b, f)
+	}
+	s.logger.Output(3, b.String())
+}
+
+func writeField(b *strings.Builder, f domain.Field) {
+	b.WriteByte(' ')
+	b.WriteString(f.Key)
+	b.WriteByte('=')
+	b.WriteString(formatValue(fmt.Sprint(f.Value)))
+}
+
+// formatValue quotes a value if it is empty or contains characters which would make
+// the line ambiguous to parse.
+func formatValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " =\"\t\n") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// NewStdLogger is a constructor which takes a *log.Logger and the minimum level to log
+// and returns a pointer to a new StdLogger.
+func NewStdLogger(l *log.Logger, level domain.LogLevel) *StdLogger {
+	s := StdLogger{
+		logger: l,
+		level:  level,
+	}
+	return &s
+}
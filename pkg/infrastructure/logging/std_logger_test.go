@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+func TestStdLogger(t *testing.T) {
+	testCases := []struct {
+		name     string
+		level    domain.LogLevel
+		logFunc  func(l domain.Logger)
+		expected string
+	}{
+		{
+			name:  "info line with fields",
+			level: domain.InfoLevel,
+			logFunc: func(l domain.Logger) {
+				l.Info("job done", domain.NewField("request_id", 42))
+			},
+			expected: "level=info msg=\"job done\" request_id=42\n",
+		},
+		{
+			name:  "debug line below configured level is dropped",
+			level: domain.InfoLevel,
+			logFunc: func(l domain.Logger) {
+				l.Debug("polling")
+			},
+			expected: "",
+		},
+		{
+			name:  "child logger attaches its fields before the line's fields",
+			level: domain.DebugLevel,
+			logFunc: func(l domain.Logger) {
+				l.With(domain.NewField(domain.JobTypeKey, "cab_request")).Warn("slow", domain.NewField("eta", "7m0s"))
+			},
+			expected: "level=warn msg=slow job_type=cab_request eta=7m0s\n",
+		},
+		{
+			name:  "error values with spaces and empty values are quoted",
+			level: domain.InfoLevel,
+			logFunc: func(l domain.Logger) {
+				l.Error("failed", domain.NewField(domain.ErrorKey, errors.New("no route found")), domain.NewField("name", ""))
+			},
+			expected: "level=error msg=failed error=\"no route found\" name=\"\"\n",
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := NewStdLogger(log.New(&buf, "", 0), tc.level)
+			tc.logFunc(l)
+			if buf.String() != tc.expected {
+				t.Errorf("%s: => got: %q, expected: %q", tc.name, buf.String(), tc.expected)
+			}
+		})
+	}
+}
+
+func TestStdLoggerWithDoesNotLeakFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0), domain.InfoLevel)
+	_ = l.With(domain.NewField(domain.RequestIDKey, 1))
+	l.Info("parent")
+	expected := "level=info msg=parent\n"
+	if buf.String() != expected {
+		t.Errorf("With modified parent logger => got: %q, expected: %q", buf.String(), expected)
+	}
+}
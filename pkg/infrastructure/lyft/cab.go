@@ -0,0 +1,199 @@
+// package lyft has an implementation of the domain.CabService interface with the eta
+// endpoint of the Lyft API, how long a cab of a ride type takes to reach a location.
+//
+// The requests are authorized with an access token of the OAuth client credentials grant,
+// which is fetched when it is first needed and again when it expires or is rejected. The
+// cab types of the CabService, like lyftXL, are those of the cab lyft in the catalog of the
+// cabs the requests are validated against.
+package lyft
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/oauth"
+)
+
+const (
+	// Name is the name of the cab of the requests for Lyft cabs.
+	Name = "lyft"
+	// DefaultBaseURL is the endpoint of the Lyft API.
+	DefaultBaseURL = "https://api.lyft.com/v1"
+	// DefaultTokenURL is the token endpoint of the OAuth client credentials grant.
+	DefaultTokenURL = "https://api.lyft.com/oauth/token"
+	// DefaultTimeout bounds each call to the Lyft API, an eta and a token fetch get it each.
+	DefaultTimeout = 10 * time.Second
+	// scope is the scope of the access tokens of the client credentials grant, the eta
+	// endpoint is public.
+	scope = "public"
+)
+
+// DefaultProducts maps the cab types to the ride types of the Lyft API.
+var DefaultProducts = map[string]string{
+	"lyft":       "lyft",
+	"lyftShared": "lyft_line",
+	"lyftXL":     "lyft_plus",
+	"lyftLux":    "lyft_lux",
+}
+
+var (
+	// ErrUnauthorized is returned when the API rejects the client id and secret.
+	ErrUnauthorized = errors.New("lyft api request unauthorized")
+	// ErrRateLimited is returned when the client made too many requests.
+	ErrRateLimited = errors.New("lyft api rate limit exceeded")
+	// ErrUnknownCabType is returned for a cab type which has no ride type.
+	ErrUnknownCabType = errors.New("unknown lyft cab type")
+	// ErrNoCabs is returned when no cab of the ride type is around the source right now.
+	ErrNoCabs = errors.New("no lyft cabs available")
+)
+
+// Config holds the client id and secret of a Lyft developer application, which the
+// CabService trades for access tokens, both must be set. Products maps the cab types to the
+// Lyft ride types, like lyftShared to lyft_line, in place of DefaultProducts. BaseURL and
+// TokenURL point the calls at the sandbox or a stand-in of the API, Timeout replaces
+// DefaultTimeout and Client, if it is set, replaces http.DefaultClient.
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	Products     map[string]string
+
+	BaseURL  string
+	TokenURL string
+	Timeout  time.Duration
+	Client   *http.Client
+}
+
+// CabService implements the domain.CabService interface with the eta endpoint of the Lyft
+// API.
+type CabService struct {
+	products map[string]string
+	baseURL  string
+	timeout  time.Duration
+	client   *http.Client
+	tokens   *oauth.TokenSource
+}
+
+// etaResponse is the part of the response of the eta endpoint which is read.
+type etaResponse struct {
+	ETAEstimates []struct {
+		RideType        string `json:"ride_type"`
+		ETASeconds      *int64 `json:"eta_seconds"`
+		IsValidEstimate bool   `json:"is_valid_estimate"`
+	} `json:"eta_estimates"`
+}
+
+// EtaNow returns how long a cab of the cab type of the request takes to reach its source.
+func (c *CabService) EtaNow(ctx context.Context, cr *domain.CabRequest) (time.Duration, error) {
+	rideType, ok := c.products[cr.CabType]
+	if !ok {
+		return 0, domain.NewPermanentError(errors.Wrapf(ErrUnknownCabType, "cab type %s", cr.CabType))
+	}
+	q := url.Values{}
+	q.Set("lat", cr.Source.Latitude)
+	q.Set("lng", cr.Source.Longitude)
+	q.Set("ride_type", rideType)
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	var res *http.Response
+	// an access token which was rejected is fetched again once
+	for attempt := 0; ; attempt++ {
+		token, err := c.tokens.Token(ctx)
+		if err != nil {
+			return 0, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/eta?"+q.Encode(), nil)
+		if err != nil {
+			return 0, domain.NewPermanentError(errors.Wrap(err, "couldn't make eta request"))
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		if res, err = c.client.Do(req); err != nil {
+			return 0, errors.Wrap(err, "eta request failed")
+		}
+		if res.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			res.Body.Close()
+			c.tokens.Reject(token)
+			continue
+		}
+		break
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized:
+		return 0, domain.NewPermanentError(errors.Wrap(ErrUnauthorized, "eta request failed"))
+	case res.StatusCode == http.StatusTooManyRequests:
+		return 0, errors.Wrap(ErrRateLimited, "eta request failed")
+	case res.StatusCode >= 500:
+		return 0, errors.Errorf("eta request failed with HTTP status %d", res.StatusCode)
+	case res.StatusCode != http.StatusOK:
+		return 0, domain.NewPermanentError(errors.Errorf("eta request failed with HTTP status %d", res.StatusCode))
+	}
+	var e etaResponse
+	if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
+		return 0, errors.Wrap(err, "couldn't decode eta response")
+	}
+	for _, est := range e.ETAEstimates {
+		if est.RideType == rideType && est.IsValidEstimate && est.ETASeconds != nil {
+			return time.Duration(*est.ETASeconds) * time.Second, nil
+		}
+	}
+	return 0, errors.Wrapf(ErrNoCabs, "ride type %s", rideType)
+}
+
+// CabTypes returns the cab types of the CabService in alphabetical order.
+func (c *CabService) CabTypes() []string {
+	types := make([]string, 0, len(c.products))
+	for t := range c.products {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// NewCabService is a constructor which takes the Config of the CabService and returns a
+// pointer to a new CabService, or an error if the Config has no client id and secret.
+func NewCabService(c Config) (*CabService, error) {
+	if c.ClientID == "" || c.ClientSecret == "" {
+		return nil, errors.New("lyft cab service needs a client id and secret")
+	}
+	if c.Products == nil {
+		c.Products = DefaultProducts
+	}
+	if c.BaseURL == "" {
+		c.BaseURL = DefaultBaseURL
+	}
+	if c.TokenURL == "" {
+		c.TokenURL = DefaultTokenURL
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	s := CabService{
+		products: c.Products,
+		baseURL:  strings.TrimRight(c.BaseURL, "/"),
+		timeout:  c.Timeout,
+		client:   c.Client,
+		tokens: oauth.NewTokenSource(oauth.Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			TokenURL:     c.TokenURL,
+			Scope:        scope,
+			Style:        oauth.JSONStyle,
+			Unauthorized: ErrUnauthorized,
+			Client:       c.Client,
+		}),
+	}
+	return &s, nil
+}
@@ -0,0 +1,108 @@
+package lyft
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/cabtest"
+)
+
+// newStubAPI returns a local stand-in of the Lyft API with its eta and token endpoints. It
+// accepts the access tokens of its cabtest.API and has lyft cabs around but no lyft_lux cabs.
+func newStubAPI() *cabtest.API {
+	return &cabtest.API{
+		TokenPath:    "/oauth/token",
+		Unauthorized: `{"error": "invalid_token", "error_description": "The access token is invalid"}`,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("ride_type") == "lyft_lux" {
+				fmt.Fprint(w, `{"eta_estimates": [{"display_name": "Lux", "ride_type": "lyft_lux", "eta_seconds": null, "is_valid_estimate": false}]}`)
+				return
+			}
+			fmt.Fprint(w, `{"eta_estimates": [{"display_name": "Lyft", "ride_type": "lyft", "eta_seconds": 180, "is_valid_estimate": true}]}`)
+		},
+	}
+}
+
+func testCabService(t *testing.T, s *cabtest.API, secret string) *CabService {
+	t.Helper()
+	srv := s.Serve(t)
+	cs, err := NewCabService(Config{
+		ClientID:     "client",
+		ClientSecret: secret,
+		BaseURL:      srv.URL + "/v1",
+		TokenURL:     srv.URL + "/oauth/token",
+		Client:       srv.Client(),
+	})
+	if err != nil {
+		t.Fatalf("NewCabService() => got: %v, expected: nil", err)
+	}
+	return cs
+}
+
+func TestCabServiceEtaNow(t *testing.T) {
+	s := newStubAPI()
+	cs := testCabService(t, s, "secret")
+
+	for i := 0; i < 2; i++ {
+		eta, err := cs.EtaNow(context.Background(), cabtest.Request(Name, "lyft"))
+		if err != nil || eta != 3*time.Minute {
+			t.Fatalf("EtaNow() => got: %v, %v, expected: 3m0s, nil", eta, err)
+		}
+	}
+	if q := s.Queries[0]; q.Get("ride_type") != "lyft" || q.Get("lat") != "12.927880" || q.Get("lng") != "77.627600" {
+		t.Errorf("EtaNow() => got: query %v, expected the source and ride type lyft", q)
+	}
+	if s.Tokens != 1 {
+		t.Errorf("EtaNow() twice => got: %d tokens fetched, expected: 1", s.Tokens)
+	}
+
+	// a rejected token is fetched again
+	s.Expire = true
+	if _, err := cs.EtaNow(context.Background(), cabtest.Request(Name, "lyft")); err != nil || s.Tokens != 2 {
+		t.Errorf("EtaNow() with an expired token => got: %v after %d tokens, expected: nil after 2", err, s.Tokens)
+	}
+
+	testCases := []struct {
+		cabType   string
+		status    int
+		expected  error
+		permanent bool
+	}{
+		{"lyftLux", 0, ErrNoCabs, false},
+		{"lyftPink", 0, ErrUnknownCabType, true},
+		{"lyft", http.StatusTooManyRequests, ErrRateLimited, false},
+	}
+	for i, _ := range testCases {
+		s.Status = testCases[i].status
+		_, err := cs.EtaNow(context.Background(), cabtest.Request(Name, testCases[i].cabType))
+		if errors.Cause(err) != testCases[i].expected || domain.IsPermanent(err) != testCases[i].permanent {
+			t.Errorf("case %d: EtaNow() => got: %v, expected: %v, permanent %v", i, err, testCases[i].expected, testCases[i].permanent)
+		}
+	}
+
+	cs = testCabService(t, newStubAPI(), "wrong")
+	if _, err := cs.EtaNow(context.Background(), cabtest.Request(Name, "lyft")); errors.Cause(err) != ErrUnauthorized || !domain.IsPermanent(err) {
+		t.Errorf("EtaNow() with a wrong secret => got: %v, expected: permanent %v", err, ErrUnauthorized)
+	}
+}
+
+func TestCabServiceCabTypes(t *testing.T) {
+	if _, err := NewCabService(Config{ClientID: "client"}); err == nil {
+		t.Errorf("NewCabService() without client secret => got: nil, expected an error")
+	}
+	cs, err := NewCabService(Config{ClientID: "client", ClientSecret: "secret"})
+	if err != nil {
+		t.Fatalf("NewCabService() => got: %v, expected: nil", err)
+	}
+	expected := []string{"lyft", "lyftLux", "lyftShared", "lyftXL"}
+	if types := cs.CabTypes(); !reflect.DeepEqual(types, expected) {
+		t.Errorf("CabTypes() of the DefaultProducts => got: %v, expected: %v", types, expected)
+	}
+}
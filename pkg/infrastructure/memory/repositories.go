@@ -0,0 +1,265 @@
+// package memory has implementations of the domain repositories which keep what they store
+// in memory. They are used until a database is configured, and by local experiments.
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// UserRepository implements the domain.UserRepository interface with a map. It is safe for
+// concurrent use, the users are lost on restart.
+type UserRepository struct {
+	mu        sync.Mutex
+	lastID    uint64
+	users     map[uint64]domain.User
+	byAddress map[domain.UserAddress]uint64
+}
+
+func (m *UserRepository) FindByID(id uint64) (*domain.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok {
+		return nil, errors.Wrapf(domain.ErrNotFound, "user %d", id)
+	}
+	return copyUser(u), nil
+}
+
+func (m *UserRepository) FindByAddress(a domain.UserAddress) (*domain.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.byAddress[a]
+	if !ok {
+		return nil, errors.Wrapf(domain.ErrNotFound, "user of %s address %s", a.AddrType, a.Value)
+	}
+	return copyUser(m.users[id]), nil
+}
+
+// Store stores a copy of the user under a new id and returns the id.
+func (m *UserRepository) Store(u *domain.User) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.checkAddresses(u.Addresses, 0); err != nil {
+		return 0, err
+	}
+	m.lastID++
+	stored := *copyUser(*u)
+	stored.UserID = m.lastID
+	m.users[stored.UserID] = stored
+	for _, a := range stored.Addresses {
+		m.byAddress[a] = stored.UserID
+	}
+	return stored.UserID, nil
+}
+
+// Update replaces the stored user, it returns ErrNotFound if the user wasn't stored.
+func (m *UserRepository) Update(u *domain.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.users[u.UserID]
+	if !ok {
+		return errors.Wrapf(domain.ErrNotFound, "user %d", u.UserID)
+	}
+	if err := m.checkAddresses(u.Addresses, u.UserID); err != nil {
+		return err
+	}
+	for _, a := range old.Addresses {
+		delete(m.byAddress, a)
+	}
+	m.users[u.UserID] = *copyUser(*u)
+	for _, a := range u.Addresses {
+		m.byAddress[a] = u.UserID
+	}
+	return nil
+}
+
+// checkAddresses returns ErrAddressTaken if one of the addresses belongs to a user other
+// than the one with the id.
+func (m *UserRepository) checkAddresses(addrs []domain.UserAddress, id uint64) error {
+	for _, a := range addrs {
+		if owner, ok := m.byAddress[a]; ok && owner != id {
+			return errors.Wrapf(domain.ErrAddressTaken, "%s address %s", a.AddrType, a.Value)
+		}
+	}
+	return nil
+}
+
+// copyUser returns a copy of the user which shares neither its addresses nor its places.
+func copyUser(u domain.User) *domain.User {
+	u.Addresses = append([]domain.UserAddress(nil), u.Addresses...)
+	u.Pending = append([]domain.PendingAddress(nil), u.Pending...)
+	u.Places = append([]domain.Location(nil), u.Places...)
+	return &u
+}
+
+// RequestRepository implements the domain.RequestRepository interface with a map. It is
+// safe for concurrent use, the requests are lost on restart.
+type RequestRepository struct {
+	mu       sync.Mutex
+	lastID   uint64
+	requests map[uint64]domain.Request
+}
+
+func (m *RequestRepository) FindByID(id uint64) (*domain.Request, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.requests[id]
+	if !ok {
+		return nil, errors.Wrapf(domain.ErrNotFound, "request %d", id)
+	}
+	return &r, nil
+}
+
+// FindByUserID returns the requests of the user ordered by id.
+func (m *RequestRepository) FindByUserID(userID uint64) ([]*domain.Request, error) {
+	return m.List(domain.RequestFilter{UserID: userID})
+}
+
+// List returns the requests selected by the filter ordered by id.
+func (m *RequestRepository) List(f domain.RequestFilter) ([]*domain.Request, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rs []*domain.Request
+	for _, r := range m.requests {
+		if f.Match(&r) {
+			r := r
+			rs = append(rs, &r)
+		}
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].ID() < rs[j].ID() })
+	if f.Limit > 0 && len(rs) > f.Limit {
+		rs = rs[:f.Limit]
+	}
+	return rs, nil
+}
+
+// Store stores a copy of the request under a new id and returns the id.
+func (m *RequestRepository) Store(r *domain.Request) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	stored := *r
+	stored.SetID(m.lastID)
+	m.requests[m.lastID] = stored
+	return m.lastID, nil
+}
+
+// Update replaces the stored request, it returns ErrNotFound if the request wasn't stored
+// and ErrConflict if it was updated since the request was read.
+func (m *RequestRepository) Update(r *domain.Request) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.requests[r.ID()]
+	if !ok {
+		return errors.Wrapf(domain.ErrNotFound, "request %d", r.ID())
+	}
+	if stored.Version() != r.Version() {
+		return errors.Wrapf(domain.ErrConflict, "request %d is at version %d, not %d", r.ID(), stored.Version(), r.Version())
+	}
+	r.SetVersion(r.Version() + 1)
+	m.requests[r.ID()] = *r
+	return nil
+}
+
+// CabBookingResponseRepository implements the domain.CabBookingResponseRepository interface
+// with a map. It is safe for concurrent use, the booking responses are lost on restart.
+type CabBookingResponseRepository struct {
+	mu        sync.Mutex
+	lastID    uint64
+	responses map[uint64]domain.CabBookingResponse
+}
+
+func (m *CabBookingResponseRepository) FindByID(id uint64) (*domain.CabBookingResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.responses[id]
+	if !ok {
+		return nil, errors.Wrapf(domain.ErrNotFound, "booking response %d", id)
+	}
+	return copyBookingResponse(c), nil
+}
+
+// FindByUserID returns the booking responses of the user ordered by id.
+func (m *CabBookingResponseRepository) FindByUserID(userID uint64) ([]*domain.CabBookingResponse, error) {
+	return m.List(domain.CabBookingResponseFilter{UserID: userID})
+}
+
+// FindByRequestID returns the booking responses of the request ordered by id.
+func (m *CabBookingResponseRepository) FindByRequestID(reqID uint64) ([]*domain.CabBookingResponse, error) {
+	return m.List(domain.CabBookingResponseFilter{RequestID: reqID})
+}
+
+// List returns the booking responses selected by the filter ordered by id.
+func (m *CabBookingResponseRepository) List(f domain.CabBookingResponseFilter) ([]*domain.CabBookingResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var cs []*domain.CabBookingResponse
+	for _, c := range m.responses {
+		if f.Match(&c) {
+			cs = append(cs, copyBookingResponse(c))
+		}
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].BookingID < cs[j].BookingID })
+	if f.Limit > 0 && len(cs) > f.Limit {
+		cs = cs[:f.Limit]
+	}
+	return cs, nil
+}
+
+// Store stores a copy of the booking response under a new id and returns the id.
+func (m *CabBookingResponseRepository) Store(c *domain.CabBookingResponse) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	stored := *copyBookingResponse(*c)
+	stored.BookingID = m.lastID
+	m.responses[m.lastID] = stored
+	return m.lastID, nil
+}
+
+// copyBookingResponse returns a copy of the booking response which shares neither its user,
+// its request nor its inputs.
+func copyBookingResponse(c domain.CabBookingResponse) *domain.CabBookingResponse {
+	c.Inputs = domain.BookingInputs{
+		TravelTime: append([]time.Duration(nil), c.Inputs.TravelTime...),
+		BestCase:   append([]time.Time(nil), c.Inputs.BestCase...),
+		WorstCase:  append([]time.Time(nil), c.Inputs.WorstCase...),
+	}
+	if c.UserRequest != nil {
+		ur := *c.UserRequest
+		if ur.User != nil {
+			ur.User = copyUser(*ur.User)
+		}
+		if ur.Request != nil {
+			r := *ur.Request
+			ur.Request = &r
+		}
+		c.UserRequest = &ur
+	}
+	return &c
+}
+
+// NewUserRepository is a constructor which returns a pointer to an empty UserRepository.
+func NewUserRepository() *UserRepository {
+	return &UserRepository{
+		users:     make(map[uint64]domain.User),
+		byAddress: make(map[domain.UserAddress]uint64),
+	}
+}
+
+// NewRequestRepository is a constructor which returns a pointer to an empty RequestRepository.
+func NewRequestRepository() *RequestRepository {
+	return &RequestRepository{requests: make(map[uint64]domain.Request)}
+}
+
+// NewCabBookingResponseRepository is a constructor which returns a pointer to an empty
+// CabBookingResponseRepository.
+func NewCabBookingResponseRepository() *CabBookingResponseRepository {
+	return &CabBookingResponseRepository{responses: make(map[uint64]domain.CabBookingResponse)}
+}
@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/repotest"
+)
+
+var testTime = time.Date(2018, time.March, 9, 8, 0, 0, 0, time.UTC)
+
+func TestUserRepository(t *testing.T) {
+	m := NewUserRepository()
+	id, err := m.Store(domain.NewUser("roy"))
+	if err != nil || id == 0 {
+		t.Fatalf("Store() => got: (%d, %v), expected a new id", id, err)
+	}
+
+	u, err := m.FindByID(id)
+	if err != nil || u.UserID != id || u.Name != "roy" {
+		t.Errorf("FindByID(%d) => got: (%v, %v), expected user roy", id, u, err)
+	}
+	_, err = m.FindByID(id + 1)
+	if errors.Cause(err) != domain.ErrNotFound {
+		t.Errorf("FindByID(%d) => got: %v, expected: %v", id+1, err, domain.ErrNotFound)
+	}
+}
+
+func TestRequestRepository(t *testing.T) {
+	m := NewRequestRepository()
+	r := &domain.Request{UserID: 7}
+	r.SetStatus(domain.RequestPending, testTime)
+	first, _ := m.Store(r)
+	second, _ := m.Store(&domain.Request{UserID: 7})
+	m.Store(&domain.Request{UserID: 8})
+	if first == second {
+		t.Fatalf("Store() => got the same id %d twice, expected unique ids", first)
+	}
+
+	rs, err := m.FindByUserID(7)
+	if err != nil || len(rs) != 2 || rs[0].ID() != first || rs[1].ID() != second {
+		t.Errorf("FindByUserID(7) => got: (%v, %v), expected requests %d and %d", rs, err, first, second)
+	}
+
+	stored, _ := m.FindByID(first)
+	stored.SetStatus(domain.RequestScheduled, testTime)
+	if err = m.Update(stored); err != nil {
+		t.Errorf("Update() => got: %v, expected: nil", err)
+	}
+	found, err := m.FindByID(first)
+	if err != nil || found.Status != domain.RequestScheduled || len(found.History) != 2 {
+		t.Errorf("FindByID(%d) after Update => got: (%v, %v), expected the scheduled request", first, found, err)
+	}
+	if len(r.History) != 1 {
+		t.Errorf("Update() => got history of the original: %v, expected it not to change", r.History)
+	}
+
+	err = m.Update(&domain.Request{})
+	if errors.Cause(err) != domain.ErrNotFound {
+		t.Errorf("Update() of an unstored request => got: %v, expected: %v", err, domain.ErrNotFound)
+	}
+}
+
+func TestUserRepositoryConformance(t *testing.T) {
+	repotest.UserRepository(t, func(t *testing.T) domain.UserRepository {
+		return NewUserRepository()
+	})
+}
+
+func TestRequestRepositoryConformance(t *testing.T) {
+	repotest.RequestRepository(t, func(t *testing.T) domain.RequestRepository {
+		return NewRequestRepository()
+	})
+}
+
+func TestCabBookingResponseRepositoryConformance(t *testing.T) {
+	repotest.CabBookingResponseRepository(t, func(t *testing.T) (domain.CabBookingResponseRepository, domain.UserRepository, domain.RequestRepository) {
+		return NewCabBookingResponseRepository(), nil, nil
+	})
+}
+
+func TestCabBookingResponseRepositoryCopies(t *testing.T) {
+	m := NewCabBookingResponseRepository()
+	u := domain.NewUser("roy")
+	r := &domain.Request{UserID: 7}
+	r.SetID(1)
+	cbr := domain.NewCabBookingResponse(domain.NewUserRequest(u, r), testTime)
+	cbr.Inputs.TravelTime = []time.Duration{time.Hour}
+	id, _ := m.Store(cbr)
+	u.Name = "changed"
+	r.Status = domain.RequestCancelled
+	cbr.Inputs.TravelTime[0] = time.Minute
+
+	found, _ := m.FindByID(id)
+	if found.User.Name != "roy" || found.Request.Status != "" || found.Inputs.TravelTime[0] != time.Hour {
+		t.Errorf("FindByID(%d) => got: (%+v, %+v, %+v), expected the user, request and inputs as they were stored", id, found.User, found.Request, found.Inputs)
+	}
+}
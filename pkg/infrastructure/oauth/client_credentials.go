@@ -0,0 +1,179 @@
+// package oauth has a source of the access tokens of the OAuth 2.0 client credentials grant,
+// which the adapters of the APIs which want them, like those of Uber and Lyft, share.
+//
+// An access token is fetched when it is first needed, and kept until shortly before it
+// expires or until the API rejects it.
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// tokenExpiryMargin is how long before it expires an access token is replaced, so that it
+// doesn't expire on the way to the API. A token which lives less than ten times as long is
+// replaced a tenth of its life early instead, see expiryMargin.
+const tokenExpiryMargin = time.Minute
+
+// ErrUnauthorized is returned when the token endpoint rejects the client id and secret,
+// unless the Config has an error of its own for it.
+var ErrUnauthorized = errors.New("oauth client unauthorized")
+
+// Style is how a token request carries the client id and secret and the grant.
+type Style int
+
+const (
+	// FormStyle posts the client id and secret with the grant in a form, which is what the
+	// token endpoint of Uber wants.
+	FormStyle Style = iota
+	// JSONStyle authorizes with the basic auth of the client id and secret and posts the
+	// grant as JSON, which is what the token endpoint of Lyft wants.
+	JSONStyle
+)
+
+// Config holds the client id and secret a TokenSource fetches access tokens of the scope
+// with, from the token endpoint of TokenURL in the Style it wants. Unauthorized, if it is
+// set, is the error of the API returned in place of ErrUnauthorized. Client, if it is set,
+// replaces http.DefaultClient.
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	TokenURL     string
+	Scope        string
+	Style        Style
+	Unauthorized error
+	Client       *http.Client
+}
+
+// TokenSource gives out the access token of the client credentials grant of a client, it
+// is safe for concurrent use.
+type TokenSource struct {
+	config Config
+	now    func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// tokenResponse is the response of the token endpoint.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Error       string `json:"error"`
+}
+
+// Token returns the access token, which is fetched if there is none or it expired.
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && s.now().Before(s.expiresAt) {
+		return s.token, nil
+	}
+	if err := s.fetch(ctx); err != nil {
+		return "", err
+	}
+	return s.token, nil
+}
+
+// Reject drops the access token the API rejected, unless another request has fetched a new
+// one already, the next request fetches a new one.
+func (s *TokenSource) Reject(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+// fetch fetches an access token from the token endpoint, s.mu is held.
+func (s *TokenSource) fetch(ctx context.Context) error {
+	req, err := s.tokenRequest(ctx)
+	if err != nil {
+		return domain.NewPermanentError(errors.Wrap(err, "couldn't make token request"))
+	}
+	res, err := s.config.Client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "token request failed")
+	}
+	defer res.Body.Close()
+
+	var t tokenResponse
+	decodeErr := json.NewDecoder(res.Body).Decode(&t)
+	switch {
+	case res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusUnauthorized:
+		// invalid_client or unauthorized_client, the client id or secret is wrong
+		return domain.NewPermanentError(errors.Wrapf(s.config.Unauthorized, "token request failed with %q", t.Error))
+	case res.StatusCode != http.StatusOK:
+		return errors.Errorf("token request failed with HTTP status %d", res.StatusCode)
+	case decodeErr != nil:
+		return errors.Wrap(decodeErr, "couldn't decode token response")
+	case t.AccessToken == "":
+		return errors.New("token response has no access token")
+	}
+	s.token = t.AccessToken
+	expiresIn := time.Duration(t.ExpiresIn) * time.Second
+	s.expiresAt = s.now().Add(expiresIn - expiryMargin(expiresIn))
+	return nil
+}
+
+// tokenRequest returns the token request of the Style of the Config.
+func (s *TokenSource) tokenRequest(ctx context.Context) (*http.Request, error) {
+	if s.config.Style == JSONStyle {
+		body, err := json.Marshal(map[string]string{"grant_type": "client_credentials", "scope": s.config.Scope})
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.TokenURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.SetBasicAuth(s.config.ClientID, s.config.ClientSecret)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}
+
+	form := url.Values{}
+	form.Set("client_id", s.config.ClientID)
+	form.Set("client_secret", s.config.ClientSecret)
+	form.Set("grant_type", "client_credentials")
+	form.Set("scope", s.config.Scope)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// expiryMargin returns how long before it expires a token which lives for expiresIn is
+// replaced, tokenExpiryMargin but at most a tenth of expiresIn, so that a short lived token
+// is not taken for expired as soon as it is fetched.
+func expiryMargin(expiresIn time.Duration) time.Duration {
+	if margin := expiresIn / 10; margin < tokenExpiryMargin {
+		return margin
+	}
+	return tokenExpiryMargin
+}
+
+// NewTokenSource is a constructor which takes the Config of the TokenSource and returns a
+// pointer to a new TokenSource, which fetches no token until one is asked for.
+func NewTokenSource(c Config) *TokenSource {
+	if c.Unauthorized == nil {
+		c.Unauthorized = ErrUnauthorized
+	}
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	return &TokenSource{config: c, now: time.Now}
+}
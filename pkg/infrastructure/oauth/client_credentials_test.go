@@ -0,0 +1,167 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// stubTokenEndpoint is a local stand-in of a token endpoint, it gives the access tokens
+// token-1, token-2 and so on, which live for expiresIn seconds, to the client "client" with
+// the secret "secret", in a form or in basic auth with the grant as JSON.
+type stubTokenEndpoint struct {
+	mu        sync.Mutex
+	tokens    int
+	expiresIn int
+}
+
+func (s *stubTokenEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var grant struct {
+		GrantType string `json:"grant_type"`
+		Scope     string `json:"scope"`
+	}
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		json.NewDecoder(r.Body).Decode(&grant)
+	} else {
+		r.ParseForm()
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		grant.GrantType, grant.Scope = r.PostForm.Get("grant_type"), r.PostForm.Get("scope")
+	}
+	if id != "client" || secret != "secret" || grant.GrantType != "client_credentials" || grant.Scope != "eta" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error": "invalid_client"}`)
+		return
+	}
+	s.tokens++
+	fmt.Fprintf(w, `{"access_token": "token-%d", "token_type": "Bearer", "expires_in": %d, "scope": "eta"}`, s.tokens, s.expiresIn)
+}
+
+func testTokenSource(t *testing.T, s *stubTokenEndpoint, c Config) *TokenSource {
+	t.Helper()
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	c.TokenURL, c.Scope, c.Client = srv.URL+"/oauth/token", "eta", srv.Client()
+	return NewTokenSource(c)
+}
+
+func TestTokenSourceToken(t *testing.T) {
+	testCases := []struct {
+		name  string
+		style Style
+	}{
+		{"form", FormStyle},
+		{"basic auth and JSON", JSONStyle},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			s := &stubTokenEndpoint{expiresIn: 86400}
+			ts := testTokenSource(t, s, Config{ClientID: "client", ClientSecret: "secret", Style: tc.style})
+			for j := 0; j < 2; j++ {
+				token, err := ts.Token(context.Background())
+				if err != nil || token != "token-1" {
+					t.Fatalf("%s: Token() => got: %q, %v, expected: token-1, nil", tc.name, token, err)
+				}
+			}
+			if s.tokens != 1 {
+				t.Errorf("%s: Token() twice => got: %d tokens fetched, expected: 1", tc.name, s.tokens)
+			}
+		})
+	}
+}
+
+func TestTokenSourceReject(t *testing.T) {
+	s := &stubTokenEndpoint{expiresIn: 86400}
+	ts := testTokenSource(t, s, Config{ClientID: "client", ClientSecret: "secret"})
+	if _, err := ts.Token(context.Background()); err != nil {
+		t.Fatalf("Token() => got: %v, expected: nil", err)
+	}
+
+	ts.Reject("token-1")
+	token, err := ts.Token(context.Background())
+	if err != nil || token != "token-2" {
+		t.Fatalf("Token() after Reject() => got: %q, %v, expected: token-2, nil", token, err)
+	}
+	// a request which was rejected with the old token doesn't drop the new one
+	ts.Reject("token-1")
+	if token, err = ts.Token(context.Background()); err != nil || token != "token-2" {
+		t.Errorf("Token() after Reject() of an old token => got: %q, %v, expected: token-2, nil", token, err)
+	}
+}
+
+func TestTokenSourceShortLivedTokens(t *testing.T) {
+	now := time.Date(2018, time.March, 9, 18, 0, 0, 0, time.UTC)
+	s := &stubTokenEndpoint{expiresIn: 30}
+	ts := testTokenSource(t, s, Config{ClientID: "client", ClientSecret: "secret"})
+	ts.now = func() time.Time { return now }
+
+	// a token of 30 seconds is kept for 27 of them, not taken for expired right away
+	for i := 0; i < 2; i++ {
+		if _, err := ts.Token(context.Background()); err != nil {
+			t.Fatalf("Token() => got: %v, expected: nil", err)
+		}
+	}
+	if s.tokens != 1 {
+		t.Errorf("Token() twice => got: %d tokens fetched, expected: 1", s.tokens)
+	}
+	now = now.Add(27 * time.Second)
+	if token, err := ts.Token(context.Background()); err != nil || token != "token-2" {
+		t.Errorf("Token() near the expiry of the token => got: %q, %v, expected: token-2, nil", token, err)
+	}
+}
+
+func TestTokenSourceUnauthorized(t *testing.T) {
+	errAPI := errors.New("api request unauthorized")
+	testCases := []struct {
+		name         string
+		unauthorized error
+		expected     error
+	}{
+		{"error of the config", errAPI, errAPI},
+		{"default error", nil, ErrUnauthorized},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			ts := testTokenSource(t, &stubTokenEndpoint{}, Config{ClientID: "client", ClientSecret: "wrong", Unauthorized: tc.unauthorized})
+			if _, err := ts.Token(context.Background()); errors.Cause(err) != tc.expected || !domain.IsPermanent(err) {
+				t.Errorf("%s: Token() with a wrong secret => got: %v, expected: permanent %v", tc.name, err, tc.expected)
+			}
+		})
+	}
+}
+
+func TestExpiryMargin(t *testing.T) {
+	testCases := []struct {
+		expiresIn time.Duration
+		expected  time.Duration
+	}{
+		{30 * 24 * time.Hour, tokenExpiryMargin},
+		{10 * time.Minute, tokenExpiryMargin},
+		{5 * time.Minute, 30 * time.Second},
+		{30 * time.Second, 3 * time.Second},
+		{0, 0},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		if margin := expiryMargin(tc.expiresIn); margin != tc.expected {
+			t.Errorf("case %d: expiryMargin(%v) => got: %v, expected: %v", i, tc.expiresIn, margin, tc.expected)
+		}
+	}
+}
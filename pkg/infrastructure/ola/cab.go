@@ -0,0 +1,167 @@
+// package ola has an implementation of the domain.CabService interface with the products
+// endpoint of the Ola API, which has the eta of the cabs of every category around a pickup
+// location.
+//
+// The requests are authorized with the app token of the application, the X-APP-TOKEN
+// header. The cab types of the CabService, like olaMini, are those of the cab ola in the
+// catalog of the cabs the requests are validated against.
+package ola
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+const (
+	// Name is the name of the cab of the requests for Ola cabs.
+	Name = "ola"
+	// DefaultBaseURL is the endpoint of the Ola API.
+	DefaultBaseURL = "https://devapi.olacabs.com/v1"
+	// DefaultTimeout bounds a call to the products endpoint of the Ola API.
+	DefaultTimeout = 10 * time.Second
+)
+
+// DefaultProducts maps the cab types to the categories of the Ola API.
+var DefaultProducts = map[string]string{
+	"olaMicro": "micro",
+	"olaMini":  "mini",
+	"olaPrime": "prime",
+	"olaAuto":  "auto",
+}
+
+var (
+	// ErrUnauthorized is returned when the API rejects the app token.
+	ErrUnauthorized = errors.New("ola api request unauthorized")
+	// ErrRateLimited is returned when the app token made too many requests.
+	ErrRateLimited = errors.New("ola api rate limit exceeded")
+	// ErrUnknownCabType is returned for a cab type which has no category.
+	ErrUnknownCabType = errors.New("unknown ola cab type")
+	// ErrNoCabs is returned when no cab of the category is around the source right now.
+	ErrNoCabs = errors.New("no ola cabs available")
+)
+
+// Config holds the X-APP-TOKEN an Ola developer application calls the API with, AppToken
+// must be set. Products maps the cab types to the Ola categories, like olaMini to mini, a
+// city with other categories replaces DefaultProducts with it. BaseURL points the calls at
+// the sandbox or a stand-in of the API, Timeout replaces DefaultTimeout and Client, if it is
+// set, replaces http.DefaultClient.
+type Config struct {
+	AppToken string
+	Products map[string]string
+
+	BaseURL string
+	Timeout time.Duration
+	Client  *http.Client
+}
+
+// CabService implements the domain.CabService interface with the products endpoint of the
+// Ola API.
+type CabService struct {
+	appToken string
+	products map[string]string
+	baseURL  string
+	timeout  time.Duration
+	client   *http.Client
+}
+
+// productsResponse is the part of the response of the products endpoint which is read. The
+// eta is in minutes, it is -1 when no cab of the category is around.
+type productsResponse struct {
+	Categories []struct {
+		ID  string `json:"id"`
+		ETA int64  `json:"eta"`
+	} `json:"categories"`
+}
+
+// EtaNow returns how long a cab of the cab type of the request takes to reach its source.
+func (c *CabService) EtaNow(ctx context.Context, cr *domain.CabRequest) (time.Duration, error) {
+	category, ok := c.products[cr.CabType]
+	if !ok {
+		return 0, domain.NewPermanentError(errors.Wrapf(ErrUnknownCabType, "cab type %s", cr.CabType))
+	}
+	q := url.Values{}
+	q.Set("pickup_lat", cr.Source.Latitude)
+	q.Set("pickup_lng", cr.Source.Longitude)
+	q.Set("category", category)
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/products?"+q.Encode(), nil)
+	if err != nil {
+		return 0, domain.NewPermanentError(errors.Wrap(err, "couldn't make products request"))
+	}
+	req.Header.Set("X-APP-TOKEN", c.appToken)
+	res, err := c.client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "products request failed")
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return 0, domain.NewPermanentError(errors.Wrap(ErrUnauthorized, "products request failed"))
+	case res.StatusCode == http.StatusTooManyRequests:
+		return 0, errors.Wrap(ErrRateLimited, "products request failed")
+	case res.StatusCode >= 500:
+		return 0, errors.Errorf("products request failed with HTTP status %d", res.StatusCode)
+	case res.StatusCode != http.StatusOK:
+		return 0, domain.NewPermanentError(errors.Errorf("products request failed with HTTP status %d", res.StatusCode))
+	}
+	var p productsResponse
+	if err = json.NewDecoder(res.Body).Decode(&p); err != nil {
+		return 0, errors.Wrap(err, "couldn't decode products response")
+	}
+	for _, cat := range p.Categories {
+		if cat.ID == category && cat.ETA >= 0 {
+			return time.Duration(cat.ETA) * time.Minute, nil
+		}
+	}
+	return 0, errors.Wrapf(ErrNoCabs, "category %s", category)
+}
+
+// CabTypes returns the cab types of the CabService in alphabetical order.
+func (c *CabService) CabTypes() []string {
+	types := make([]string, 0, len(c.products))
+	for t := range c.products {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// NewCabService is a constructor which takes the Config of the CabService and returns a
+// pointer to a new CabService, or an error if the Config has no app token.
+func NewCabService(c Config) (*CabService, error) {
+	if c.AppToken == "" {
+		return nil, errors.New("ola cab service needs an app token")
+	}
+	if c.Products == nil {
+		c.Products = DefaultProducts
+	}
+	if c.BaseURL == "" {
+		c.BaseURL = DefaultBaseURL
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	s := CabService{
+		appToken: c.AppToken,
+		products: c.Products,
+		baseURL:  strings.TrimRight(c.BaseURL, "/"),
+		timeout:  c.Timeout,
+		client:   c.Client,
+	}
+	return &s, nil
+}
@@ -0,0 +1,93 @@
+package ola
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/cabtest"
+)
+
+// newStubAPI returns a local stand-in of the products endpoint of the Ola API, it accepts
+// the app token "app-token" and has mini cabs around but no prime cabs.
+func newStubAPI() *cabtest.API {
+	return &cabtest.API{
+		Authorized: func(r *http.Request) bool {
+			return r.Header.Get("X-APP-TOKEN") == "app-token"
+		},
+		Unauthorized: `{"code": "INVALID_APP_TOKEN", "message": "Invalid app token"}`,
+		Handler: func(w http.ResponseWriter, r *http.Request) {
+			eta := 4
+			if r.URL.Query().Get("category") == "prime" {
+				eta = -1
+			}
+			fmt.Fprintf(w, `{"categories": [{"id": %q, "display_name": "Mini", "currency": "INR", "distance_unit": "kilometre", "time_unit": "minute", "eta": %d, "distance": "0.6"}]}`,
+				r.URL.Query().Get("category"), eta)
+		},
+	}
+}
+
+func testCabService(t *testing.T, s *cabtest.API, token string) *CabService {
+	t.Helper()
+	srv := s.Serve(t)
+	cs, err := NewCabService(Config{AppToken: token, BaseURL: srv.URL + "/v1", Client: srv.Client()})
+	if err != nil {
+		t.Fatalf("NewCabService() => got: %v, expected: nil", err)
+	}
+	return cs
+}
+
+func TestCabServiceEtaNow(t *testing.T) {
+	s := newStubAPI()
+	cs := testCabService(t, s, "app-token")
+
+	eta, err := cs.EtaNow(context.Background(), cabtest.Request(Name, "olaMini"))
+	if err != nil || eta != 4*time.Minute {
+		t.Errorf("EtaNow() => got: %v, %v, expected: 4m0s, nil", eta, err)
+	}
+	if q := s.Queries[0]; q.Get("category") != "mini" || q.Get("pickup_lat") != "12.927880" || q.Get("pickup_lng") != "77.627600" {
+		t.Errorf("EtaNow() => got: query %v, expected the source and category mini", q)
+	}
+
+	testCases := []struct {
+		cabType   string
+		status    int
+		expected  error
+		permanent bool
+	}{
+		{"olaPrime", 0, ErrNoCabs, false},
+		{"olaLux", 0, ErrUnknownCabType, true},
+		{"olaMini", http.StatusTooManyRequests, ErrRateLimited, false},
+	}
+	for i, _ := range testCases {
+		s.Status = testCases[i].status
+		_, err = cs.EtaNow(context.Background(), cabtest.Request(Name, testCases[i].cabType))
+		if errors.Cause(err) != testCases[i].expected || domain.IsPermanent(err) != testCases[i].permanent {
+			t.Errorf("case %d: EtaNow() => got: %v, expected: %v, permanent %v", i, err, testCases[i].expected, testCases[i].permanent)
+		}
+	}
+
+	cs = testCabService(t, newStubAPI(), "wrong")
+	if _, err = cs.EtaNow(context.Background(), cabtest.Request(Name, "olaMini")); errors.Cause(err) != ErrUnauthorized || !domain.IsPermanent(err) {
+		t.Errorf("EtaNow() with a wrong app token => got: %v, expected: permanent %v", err, ErrUnauthorized)
+	}
+}
+
+func TestCabServiceCabTypes(t *testing.T) {
+	if _, err := NewCabService(Config{}); err == nil {
+		t.Errorf("NewCabService() without app token => got: nil, expected an error")
+	}
+	cs, err := NewCabService(Config{AppToken: "app-token", Products: map[string]string{"olaSedan": "sedan", "olaMini": "mini"}})
+	if err != nil {
+		t.Fatalf("NewCabService() => got: %v, expected: nil", err)
+	}
+	if types := cs.CabTypes(); !reflect.DeepEqual(types, []string{"olaMini", "olaSedan"}) {
+		t.Errorf("CabTypes() => got: %v, expected: [olaMini olaSedan]", types)
+	}
+}
@@ -0,0 +1,112 @@
+package osrm
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HoursPerWeek is the number of multipliers of a CongestionProfile.
+const HoursPerWeek = 7 * 24
+
+// CongestionProfile has the multiplier of the travel time on empty roads for every hour of
+// the week, in the time zone of Location. Hour 0 is Sunday from midnight to 1 AM, like
+// time.Sunday is the first day of time.Weekday.
+type CongestionProfile struct {
+	Multipliers [HoursPerWeek]float64
+	Location    *time.Location
+}
+
+// Multiplier returns the multiplier of the hour of the week of t.
+func (p *CongestionProfile) Multiplier(t time.Time) float64 {
+	t = t.In(p.Location)
+	return p.Multipliers[int(t.Weekday())*24+t.Hour()]
+}
+
+// congestionFile is the serializable form of a CongestionProfile. Every rule sets the
+// multiplier of the hours From to To, To excluded, of its days, a rule overrides the rules
+// before it and the hours without a rule have the multiplier 1.
+//
+//	{
+//	  "timezone": "Asia/Kolkata",
+//	  "rules": [
+//	    {"days": ["mon", "tue", "wed", "thu", "fri"], "from": 8, "to": 11, "multiplier": 1.6},
+//	    {"days": ["mon", "tue", "wed", "thu", "fri"], "from": 17, "to": 21, "multiplier": 1.8}
+//	  ]
+//	}
+type congestionFile struct {
+	Timezone string `json:"timezone"`
+	Rules    []struct {
+		Days       []string `json:"days"`
+		From       int      `json:"from"`
+		To         int      `json:"to"`
+		Multiplier float64  `json:"multiplier"`
+	} `json:"rules"`
+}
+
+// days are the names of the days of the rules of a congestionFile, in the order of
+// time.Weekday.
+var days = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseCongestionProfile reads the JSON of a CongestionProfile from r. The time zone is
+// UTC if it isn't set.
+func ParseCongestionProfile(r io.Reader) (*CongestionProfile, error) {
+	var f congestionFile
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&f); err != nil {
+		return nil, errors.Wrap(err, "couldn't decode congestion profile")
+	}
+	p := CongestionProfile{Location: time.UTC}
+	if f.Timezone != "" {
+		loc, err := time.LoadLocation(f.Timezone)
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't load time zone of congestion profile")
+		}
+		p.Location = loc
+	}
+	for i := range p.Multipliers {
+		p.Multipliers[i] = 1
+	}
+	for i, rule := range f.Rules {
+		if rule.From < 0 || rule.To > 24 || rule.From >= rule.To {
+			return nil, errors.Errorf("rule %d of congestion profile has hours %d to %d, expected 0 <= from < to <= 24", i, rule.From, rule.To)
+		}
+		if rule.Multiplier <= 0 {
+			return nil, errors.Errorf("rule %d of congestion profile has multiplier %v, expected more than 0", i, rule.Multiplier)
+		}
+		for _, day := range rule.Days {
+			wd := indexOf(days, strings.ToLower(day))
+			if wd < 0 {
+				return nil, errors.Errorf("rule %d of congestion profile has day %q, expected one of %s", i, day, strings.Join(days, ", "))
+			}
+			for h := rule.From; h < rule.To; h++ {
+				p.Multipliers[wd*24+h] = rule.Multiplier
+			}
+		}
+	}
+	return &p, nil
+}
+
+// LoadCongestionProfile reads the JSON of a CongestionProfile from the file of path.
+func LoadCongestionProfile(path string) (*CongestionProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't open congestion profile")
+	}
+	defer f.Close()
+	return ParseCongestionProfile(f)
+}
+
+func indexOf(s []string, v string) int {
+	for i := range s {
+		if s[i] == v {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,56 @@
+package osrm
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCongestionProfile(t *testing.T) {
+	p, err := ParseCongestionProfile(strings.NewReader(`{
+		"timezone": "Asia/Kolkata",
+		"rules": [
+			{"days": ["mon", "tue", "wed", "thu", "fri"], "from": 17, "to": 21, "multiplier": 1.8},
+			{"days": ["Fri"], "from": 18, "to": 19, "multiplier": 2.2}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("ParseCongestionProfile() => got: %v, expected: nil", err)
+	}
+	testCases := []struct {
+		at       time.Time
+		expected float64
+	}{
+		// Friday 6:30 PM in Bengaluru, the later rule wins
+		{time.Date(2018, time.March, 9, 13, 0, 0, 0, time.UTC), 2.2},
+		// Thursday 5 PM in Bengaluru
+		{time.Date(2018, time.March, 8, 11, 30, 0, 0, time.UTC), 1.8},
+		// Thursday 9 PM in Bengaluru, the end of a rule is excluded
+		{time.Date(2018, time.March, 8, 15, 30, 0, 0, time.UTC), 1},
+		// Saturday 6 PM in Bengaluru
+		{time.Date(2018, time.March, 10, 12, 30, 0, 0, time.UTC), 1},
+	}
+
+	for i, _ := range testCases {
+		if got := p.Multiplier(testCases[i].at); got != testCases[i].expected {
+			t.Errorf("case %d: Multiplier(%v) => got: %v, expected: %v", i, testCases[i].at, got, testCases[i].expected)
+		}
+	}
+}
+
+func TestParseCongestionProfileErrors(t *testing.T) {
+	testCases := []string{
+		`{"timezone": "Mars/Olympus"}`,
+		`{"rules": [{"days": ["someday"], "from": 1, "to": 2, "multiplier": 1.5}]}`,
+		`{"rules": [{"days": ["mon"], "from": 9, "to": 9, "multiplier": 1.5}]}`,
+		`{"rules": [{"days": ["mon"], "from": 20, "to": 25, "multiplier": 1.5}]}`,
+		`{"rules": [{"days": ["mon"], "from": 8, "to": 9, "multiplier": 0}]}`,
+		`{"rules": [{"day": ["mon"], "from": 8, "to": 9, "multiplier": 2}]}`,
+	}
+
+	for i, _ := range testCases {
+		if _, err := ParseCongestionProfile(strings.NewReader(testCases[i])); err == nil {
+			t.Errorf("case %d: ParseCongestionProfile(%s) => got: nil, expected an error", i, testCases[i])
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// package osrm has an implementation of the domain.TrafficService interface with the route
+// service of an OSRM server, or of any routing server with the same HTTP API, which can be
+// hosted without paying for every query.
+//
+// OSRM knows the roads but not their traffic, its travel time is the one of empty roads. A
+// CongestionProfile scales it by a multiplier for the hour of the week the journey starts.
+package osrm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+const (
+	// DefaultProfile is the routing profile of cars of an OSRM server.
+	DefaultProfile = "driving"
+	// DefaultTimeout bounds a route query. An OSRM server next to the app answers in
+	// milliseconds, so it only cuts off a server which hangs.
+	DefaultTimeout = 5 * time.Second
+)
+
+var (
+	// ErrNoRoute is returned when there is no way to drive from the source to the
+	// destination, or one of them is too far from any road.
+	ErrNoRoute = errors.New("no route between source and destination")
+	// ErrInvalidRequest is returned for a query the server rejects, like one with an
+	// invalid location.
+	ErrInvalidRequest = errors.New("invalid route request")
+)
+
+// Config points a TrafficService at the OSRM server of BaseURL, like http://localhost:5000,
+// which must be set. Profile names the profile the server's graph was built with, the car
+// profile DefaultProfile if it is empty. OSRM knows nothing of traffic, without a Congestion
+// the free flow travel times are used as they are. Timeout replaces DefaultTimeout and
+// Client, if it is set, replaces http.DefaultClient.
+type Config struct {
+	BaseURL    string
+	Profile    string
+	Timeout    time.Duration
+	Client     *http.Client
+	Congestion *CongestionProfile
+}
+
+// TrafficService implements the domain.TrafficService interface with the route service of
+// an OSRM server. The best case of a journey is to drive it on empty roads, its travel time
+// and worst case are scaled by the CongestionProfile.
+type TrafficService struct {
+	baseURL    string
+	profile    string
+	timeout    time.Duration
+	client     *http.Client
+	congestion *CongestionProfile
+}
+
+// routeResponse is the part of the response of the route service which is read.
+type routeResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Routes  []struct {
+		Duration float64 `json:"duration"`
+	} `json:"routes"`
+}
+
+func (t *TrafficService) TravelTime(ctx context.Context, tr *domain.TrafficRequest) (*domain.TrafficResponse, error) {
+	freeFlow, err := t.route(ctx, tr.Source, tr.Destination)
+	if err != nil {
+		return nil, err
+	}
+	travelTime := freeFlow
+	if t.congestion != nil {
+		travelTime = time.Duration(float64(freeFlow) * t.congestion.Multiplier(tr.TimeOfDay)).Round(time.Second)
+	}
+	resp := domain.TrafficResponse{
+		TrafficRequest: tr,
+		TravelTime:     travelTime,
+		BestCase:       tr.TimeOfDay.Add(freeFlow),
+		WorstCase:      tr.TimeOfDay.Add(travelTime),
+	}
+	return &resp, nil
+}
+
+// route returns the duration of the fastest route from source to destination on empty roads.
+func (t *TrafficService) route(ctx context.Context, source, destination domain.Location) (time.Duration, error) {
+	for _, l := range []domain.Location{source, destination} {
+		if strings.ContainsAny(l.Latitude+l.Longitude, ",;/?") {
+			return 0, domain.NewPermanentError(errors.Wrapf(ErrInvalidRequest, "location %s,%s", l.Latitude, l.Longitude))
+		}
+	}
+	// the coordinates of OSRM are longitude first
+	u := t.baseURL + "/route/v1/" + url.PathEscape(t.profile) + "/" +
+		source.Longitude + "," + source.Latitude + ";" + destination.Longitude + "," + destination.Latitude +
+		"?overview=false&alternatives=false&steps=false"
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, domain.NewPermanentError(errors.Wrap(err, "couldn't make route request"))
+	}
+	res, err := t.client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "route request failed")
+	}
+	defer res.Body.Close()
+
+	// the errors of the route service are JSON too, along with a 4xx status
+	var r routeResponse
+	if err = json.NewDecoder(res.Body).Decode(&r); err != nil {
+		if res.StatusCode != http.StatusOK {
+			err = errors.Errorf("route request failed with HTTP status %d", res.StatusCode)
+			if res.StatusCode < 500 && res.StatusCode != http.StatusTooManyRequests {
+				return 0, domain.NewPermanentError(err)
+			}
+			return 0, err
+		}
+		return 0, errors.Wrap(err, "couldn't decode route response")
+	}
+	switch r.Code {
+	case "Ok":
+	case "NoRoute", "NoSegment":
+		return 0, domain.NewPermanentError(errors.Wrapf(ErrNoRoute, "code %s: %s", r.Code, r.Message))
+	case "InvalidUrl", "InvalidService", "InvalidVersion", "InvalidOptions", "InvalidQuery", "InvalidValue", "TooBig", "NotImplemented":
+		return 0, domain.NewPermanentError(errors.Wrapf(ErrInvalidRequest, "code %s: %s", r.Code, r.Message))
+	default:
+		return 0, errors.Errorf("route request failed with code %q: %s", r.Code, r.Message)
+	}
+	if len(r.Routes) == 0 {
+		return 0, domain.NewPermanentError(errors.Wrap(ErrNoRoute, "no routes in response"))
+	}
+	return time.Duration(r.Routes[0].Duration * float64(time.Second)).Round(time.Second), nil
+}
+
+// NewTrafficService is a constructor which takes the Config of the TrafficService and
+// returns a pointer to a new TrafficService, or an error if the Config has no BaseURL.
+func NewTrafficService(c Config) (*TrafficService, error) {
+	if c.BaseURL == "" {
+		return nil, errors.New("osrm traffic service needs the url of the server")
+	}
+	t := TrafficService{
+		baseURL:    strings.TrimRight(c.BaseURL, "/"),
+		profile:    c.Profile,
+		timeout:    c.Timeout,
+		client:     c.Client,
+		congestion: c.Congestion,
+	}
+	if t.profile == "" {
+		t.profile = DefaultProfile
+	}
+	if t.timeout == 0 {
+		t.timeout = DefaultTimeout
+	}
+	if t.client == nil {
+		t.client = http.DefaultClient
+	}
+	return &t, nil
+}
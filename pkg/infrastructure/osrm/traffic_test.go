@@ -0,0 +1,150 @@
+package osrm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// fakeServer is a local stand-in of an OSRM server which answers every query with the
+// recorded response of testdata named response, with the HTTP status status, and keeps
+// the paths it got.
+type fakeServer struct {
+	mu       sync.Mutex
+	paths    []string
+	response string
+	status   int
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.paths = append(f.paths, r.URL.Path)
+	name, status := f.response, f.status
+	f.mu.Unlock()
+
+	b, err := os.ReadFile(filepath.Join("testdata", name+".json"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if status != 0 {
+		w.WriteHeader(status)
+	}
+	w.Write(b)
+}
+
+func testTrafficService(t *testing.T, f *fakeServer, p *CongestionProfile) *TrafficService {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	ts, err := NewTrafficService(Config{BaseURL: srv.URL + "/", Client: srv.Client(), Congestion: p})
+	if err != nil {
+		t.Fatalf("NewTrafficService() => got: %v, expected: nil", err)
+	}
+	return ts
+}
+
+// Koramangala to Hebbal, the example of the README
+var (
+	koramangala = domain.Location{Latitude: "12.927880", Longitude: "77.627600"}
+	hebbal      = domain.Location{Latitude: "13.035542", Longitude: "77.597100"}
+)
+
+func TestTrafficServiceTravelTime(t *testing.T) {
+	p := &CongestionProfile{Location: time.UTC}
+	for i := range p.Multipliers {
+		p.Multipliers[i] = 1
+	}
+	// Friday 6 PM
+	p.Multipliers[5*24+18] = 1.5
+	friday := time.Date(2018, time.March, 9, 18, 30, 0, 0, time.UTC)
+	testCases := []struct {
+		congestion *CongestionProfile
+		start      time.Time
+		expected   time.Duration
+	}{
+		// 2460.3 seconds on empty roads
+		{nil, friday, 41 * time.Minute},
+		{p, friday, 61*time.Minute + 30*time.Second},
+		{p, friday.Add(time.Hour), 41 * time.Minute},
+	}
+
+	for i, _ := range testCases {
+		f := &fakeServer{response: "route"}
+		ts := testTrafficService(t, f, testCases[i].congestion)
+		resp, err := ts.TravelTime(context.Background(), domain.NewTrafficRequest(koramangala, hebbal, testCases[i].start))
+		if err != nil {
+			t.Fatalf("case %d: TravelTime() => got: %v, expected: nil", i, err)
+		}
+		if resp.TravelTime != testCases[i].expected {
+			t.Errorf("case %d: TravelTime() => got: %v, expected: %v", i, resp.TravelTime, testCases[i].expected)
+		}
+		if !resp.BestCase.Equal(testCases[i].start.Add(41*time.Minute)) || !resp.WorstCase.Equal(testCases[i].start.Add(testCases[i].expected)) {
+			t.Errorf("case %d: TravelTime() => got: best case %v and worst case %v, expected empty roads and congestion", i, resp.BestCase, resp.WorstCase)
+		}
+		if expected := "/route/v1/driving/77.627600,12.927880;77.597100,13.035542"; f.paths[0] != expected {
+			t.Errorf("case %d: TravelTime() => got: path %s, expected: %s", i, f.paths[0], expected)
+		}
+	}
+}
+
+func TestTrafficServiceErrors(t *testing.T) {
+	testCases := []struct {
+		response  string
+		status    int
+		location  domain.Location
+		expected  error
+		permanent bool
+	}{
+		{"no_route", 0, hebbal, ErrNoRoute, true},
+		{"invalid_query", http.StatusBadRequest, hebbal, ErrInvalidRequest, true},
+		{"route", 0, domain.Location{Latitude: "13.03;1", Longitude: "77.59"}, ErrInvalidRequest, true},
+		{"missing", http.StatusServiceUnavailable, hebbal, nil, false},
+	}
+
+	for i, _ := range testCases {
+		f := &fakeServer{response: testCases[i].response, status: testCases[i].status}
+		ts := testTrafficService(t, f, nil)
+		_, err := ts.TravelTime(context.Background(), domain.NewTrafficRequest(koramangala, testCases[i].location, time.Now()))
+		if err == nil {
+			t.Errorf("case %d: TravelTime() => got: nil, expected an error", i)
+			continue
+		}
+		if testCases[i].expected != nil && errors.Cause(err) != testCases[i].expected {
+			t.Errorf("case %d: TravelTime() => got: %v, expected: %v", i, err, testCases[i].expected)
+		}
+		if domain.IsPermanent(err) != testCases[i].permanent {
+			t.Errorf("case %d: IsPermanent(%v) => got: %v, expected: %v", i, err, !testCases[i].permanent, testCases[i].permanent)
+		}
+	}
+
+	ts := testTrafficService(t, &fakeServer{response: "route"}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ts.TravelTime(ctx, domain.NewTrafficRequest(koramangala, hebbal, time.Now())); err == nil {
+		t.Errorf("TravelTime() with cancelled context => got: nil, expected an error")
+	}
+}
+
+func TestNewTrafficService(t *testing.T) {
+	if _, err := NewTrafficService(Config{}); err == nil {
+		t.Errorf("NewTrafficService() without url => got: nil, expected an error")
+	}
+	ts, err := NewTrafficService(Config{BaseURL: "http://localhost:5000/"})
+	if err != nil {
+		t.Fatalf("NewTrafficService() => got: %v, expected: nil", err)
+	}
+	if ts.baseURL != "http://localhost:5000" || ts.profile != DefaultProfile || ts.timeout != DefaultTimeout {
+		t.Errorf("NewTrafficService() => got: %s, %s, %v, expected the defaults", ts.baseURL, ts.profile, ts.timeout)
+	}
+}
@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// bookingResponseColumns are the columns of the table booking_responses which
+// scanBookingResponse reads, in its order.
+const bookingResponseColumns = "id, user_id, request_id, best_booking_time, strategy, computed_at, inputs"
+
+// CabBookingResponseRepository implements the domain.CabBookingResponseRepository interface
+// with the table booking_responses. The user and the request of a booking response are
+// read from the UserRepository and the RequestRepository of the same DB.
+type CabBookingResponseRepository struct {
+	conn conn
+}
+
+// inputsRecord is the serializable form of the domain.BookingInputs of a booking response,
+// which are kept in the column inputs.
+type inputsRecord struct {
+	TravelTime []time.Duration `json:"travel_time,omitempty"`
+	BestCase   []time.Time     `json:"best_case,omitempty"`
+	WorstCase  []time.Time     `json:"worst_case,omitempty"`
+}
+
+// bookingResponseRow is a row of the table booking_responses, whose user and request are
+// yet to be read.
+type bookingResponseRow struct {
+	response  domain.CabBookingResponse
+	userID    uint64
+	requestID uint64
+}
+
+func (m *CabBookingResponseRepository) FindByID(id uint64) (*domain.CabBookingResponse, error) {
+	cs, err := m.list("SELECT "+bookingResponseColumns+" FROM booking_responses WHERE id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(cs) == 0 {
+		return nil, errors.Wrapf(domain.ErrNotFound, "booking response %d", id)
+	}
+	return cs[0], nil
+}
+
+// FindByUserID returns the booking responses of the user ordered by id.
+func (m *CabBookingResponseRepository) FindByUserID(userID uint64) ([]*domain.CabBookingResponse, error) {
+	return m.List(domain.CabBookingResponseFilter{UserID: userID})
+}
+
+// FindByRequestID returns the booking responses of the request ordered by id.
+func (m *CabBookingResponseRepository) FindByRequestID(reqID uint64) ([]*domain.CabBookingResponse, error) {
+	return m.List(domain.CabBookingResponseFilter{RequestID: reqID})
+}
+
+// List returns the booking responses selected by the filter ordered by id.
+func (m *CabBookingResponseRepository) List(f domain.CabBookingResponseFilter) ([]*domain.CabBookingResponse, error) {
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if f.UserID != 0 {
+		where = append(where, "user_id = "+arg(f.UserID))
+	}
+	if f.RequestID != 0 {
+		where = append(where, "request_id = "+arg(f.RequestID))
+	}
+	if !f.ComputedAfter.IsZero() {
+		where = append(where, "computed_at >= "+arg(timeValue(f.ComputedAfter)))
+	}
+	if !f.ComputedBefore.IsZero() {
+		where = append(where, "computed_at < "+arg(timeValue(f.ComputedBefore)))
+	}
+	query := "SELECT " + bookingResponseColumns + " FROM booking_responses"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id"
+	if f.Limit > 0 {
+		query += " LIMIT " + arg(f.Limit)
+	}
+	return m.list(query, args...)
+}
+
+// list returns the booking responses of the query with their users and requests.
+func (m *CabBookingResponseRepository) list(query string, args ...interface{}) ([]*domain.CabBookingResponse, error) {
+	q := m.conn.queryer()
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't list booking responses")
+	}
+	var found []bookingResponseRow
+	for rows.Next() {
+		row, err := scanBookingResponse(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		found = append(found, row)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "couldn't list booking responses")
+	}
+
+	// the users and requests are read once the rows are closed, the connection of a
+	// transaction is busy with them until then, and only once for all of their responses
+	users := make(map[uint64]*domain.User)
+	requests := make(map[uint64]*domain.Request)
+	cs := make([]*domain.CabBookingResponse, 0, len(found))
+	for _, row := range found {
+		u, ok := users[row.userID]
+		if !ok {
+			if u, err = findUser(q, row.userID); err != nil {
+				return nil, errors.Wrapf(err, "couldn't find user of booking response %d", row.response.BookingID)
+			}
+			users[row.userID] = u
+		}
+		r, ok := requests[row.requestID]
+		if !ok {
+			if r, err = findRequest(q, row.requestID); err != nil {
+				return nil, errors.Wrapf(err, "couldn't find request of booking response %d", row.response.BookingID)
+			}
+			requests[row.requestID] = r
+		}
+		c := row.response
+		c.UserRequest = domain.NewUserRequest(u, r)
+		cs = append(cs, &c)
+	}
+	return cs, nil
+}
+
+// Store stores the booking response under a new id and returns the id, its user and its
+// request are stored by their own repositories.
+func (m *CabBookingResponseRepository) Store(c *domain.CabBookingResponse) (uint64, error) {
+	inputs, err := json.Marshal(inputsRecord{
+		TravelTime: c.Inputs.TravelTime,
+		BestCase:   c.Inputs.BestCase,
+		WorstCase:  c.Inputs.WorstCase,
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "couldn't encode inputs of booking response")
+	}
+	var id uint64
+	err = m.conn.queryer().QueryRow(`INSERT INTO booking_responses (user_id, request_id, best_booking_time, strategy, computed_at, inputs)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		c.User.UserID, c.Request.ID(), timeValue(c.BestBookingTime), c.Strategy, timeValue(c.ComputedAt), string(inputs)).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "couldn't insert booking response")
+	}
+	return id, nil
+}
+
+// scanBookingResponse reads the bookingResponseColumns of a row.
+func scanBookingResponse(row interface{ Scan(...interface{}) error }) (bookingResponseRow, error) {
+	var b bookingResponseRow
+	var bestBookingTime, computedAt sql.NullInt64
+	var inputs []byte
+	err := row.Scan(&b.response.BookingID, &b.userID, &b.requestID, &bestBookingTime, &b.response.Strategy, &computedAt, &inputs)
+	if err != nil {
+		return b, errors.Wrap(err, "couldn't read booking response")
+	}
+	var rec inputsRecord
+	if err = json.Unmarshal(inputs, &rec); err != nil {
+		return b, errors.Wrapf(err, "couldn't decode inputs of booking response %d", b.response.BookingID)
+	}
+	b.response.BestBookingTime, b.response.ComputedAt = timeOf(bestBookingTime), timeOf(computedAt)
+	b.response.Inputs = domain.BookingInputs{TravelTime: rec.TravelTime, BestCase: rec.BestCase, WorstCase: rec.WorstCase}
+	return b, nil
+}
@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// DeadLetterStore implements the usecases.DeadLetterStore interface with the table
+// dead_letters, so the dead letters of every server sharing the DB can be listed and
+// replayed by any of them. The jobs are kept as the JobDescriptors of the JobCodec.
+type DeadLetterStore struct {
+	conn  conn
+	codec *usecases.JobCodec
+}
+
+// Add stores the dead letter under a new id and returns the id.
+func (s *DeadLetterStore) Add(dl usecases.DeadLetter) (uint64, error) {
+	if dl.Job == nil {
+		return 0, errors.New("DeadLetterStore can't store a dead letter without a job")
+	}
+	d, err := s.codec.Encode(dl.Job)
+	if err != nil {
+		return 0, errors.Wrap(err, "DeadLetterStore couldn't encode job")
+	}
+	// the job is replayed with a fresh set of attempts
+	d.Attempts = 0
+	b, err := json.Marshal(d)
+	if err != nil {
+		return 0, errors.Wrap(err, "DeadLetterStore couldn't encode job descriptor")
+	}
+	var id int64
+	err = s.conn.queryer().QueryRow(`INSERT INTO dead_letters (job_type, request_id, attempts, last_error, failed_at, descriptor)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		dl.JobType, dl.RequestID, dl.Attempts, dl.LastError, timeValue(dl.FailedAt), string(b)).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "DeadLetterStore couldn't insert dead letter")
+	}
+	return uint64(id), nil
+}
+
+func (s *DeadLetterStore) FindByID(id uint64) (usecases.DeadLetter, error) {
+	row := s.conn.queryer().QueryRow(`SELECT id, job_type, request_id, attempts, last_error, failed_at, descriptor
+		FROM dead_letters WHERE id = $1`, id)
+	dl, err := s.scan(row)
+	if err == sql.ErrNoRows {
+		return dl, errors.Errorf("dead letter %d not found", id)
+	}
+	return dl, err
+}
+
+// List returns all the dead letters ordered by id, i.e. oldest first.
+func (s *DeadLetterStore) List() ([]usecases.DeadLetter, error) {
+	rows, err := s.conn.queryer().Query(`SELECT id, job_type, request_id, attempts, last_error, failed_at, descriptor
+		FROM dead_letters ORDER BY id`)
+	if err != nil {
+		return nil, errors.Wrap(err, "DeadLetterStore couldn't list dead letters")
+	}
+	defer rows.Close()
+	dls := []usecases.DeadLetter{}
+	for rows.Next() {
+		dl, err := s.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		dls = append(dls, dl)
+	}
+	return dls, errors.Wrap(rows.Err(), "DeadLetterStore couldn't list dead letters")
+}
+
+func (s *DeadLetterStore) Remove(id uint64) error {
+	res, err := s.conn.queryer().Exec("DELETE FROM dead_letters WHERE id = $1", id)
+	if err != nil {
+		return errors.Wrapf(err, "DeadLetterStore couldn't delete dead letter %d", id)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return errors.Errorf("dead letter %d not found", id)
+	}
+	return nil
+}
+
+// scan reads a dead letter from a row of dead_letters and decodes its job.
+func (s *DeadLetterStore) scan(row interface{ Scan(...interface{}) error }) (usecases.DeadLetter, error) {
+	var dl usecases.DeadLetter
+	var failedAt sql.NullInt64
+	var b []byte
+	err := row.Scan(&dl.ID, &dl.JobType, &dl.RequestID, &dl.Attempts, &dl.LastError, &failedAt, &b)
+	if err == sql.ErrNoRows {
+		return dl, err
+	}
+	if err != nil {
+		return dl, errors.Wrap(err, "DeadLetterStore couldn't read dead letter")
+	}
+	dl.FailedAt = timeOf(failedAt)
+	var d usecases.JobDescriptor
+	if err = json.Unmarshal(b, &d); err != nil {
+		return dl, errors.Wrapf(err, "DeadLetterStore couldn't decode job descriptor of dead letter %d", dl.ID)
+	}
+	if dl.Job, err = s.codec.Decode(d); err != nil {
+		return dl, errors.Wrapf(err, "DeadLetterStore couldn't decode job of dead letter %d", dl.ID)
+	}
+	return dl, nil
+}
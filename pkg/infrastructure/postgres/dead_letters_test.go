@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+func TestDeadLetterStore(t *testing.T) {
+	s := testDB(t).DeadLetterStore(&usecases.JobCodec{})
+	failed := usecases.NewDeadLetter(&usecases.RetriedJob{Job: testNotificationJob(t, 1), Attempts: 3}, 3, errors.New("smtp server gone"))
+	first, err := s.Add(failed)
+	if err != nil {
+		t.Fatalf("Add() => got: %v, expected: nil", err)
+	}
+	second, _ := s.Add(usecases.NewDeadLetter(testNotificationJob(t, 2), 1, nil))
+	if first == second {
+		t.Fatalf("Add() => got the same id %d twice, expected unique ids", first)
+	}
+	if _, err = s.Add(usecases.DeadLetter{JobType: "notification", RequestID: 3}); err == nil {
+		t.Errorf("Add() without a job => got: nil, expected an error")
+	}
+
+	dls, err := s.List()
+	if err != nil || len(dls) != 2 || dls[0].ID != first || dls[1].ID != second {
+		t.Fatalf("List() => got: (%v, %v), expected both dead letters oldest first", dls, err)
+	}
+
+	dl, err := s.FindByID(first)
+	if err != nil {
+		t.Fatalf("FindByID(%d) => got: %v, expected: nil", first, err)
+	}
+	// the job is replayed with a fresh set of attempts
+	job, ok := dl.Job.(*usecases.NotificationJob)
+	if !ok || job.RequestID() != 1 || dl.JobType != usecases.NotificationJobType || dl.Attempts != 3 ||
+		dl.LastError != "smtp server gone" || !dl.FailedAt.Equal(failed.FailedAt) {
+		t.Errorf("FindByID(%d) => got: %+v, expected the dead letter of request 1", first, dl)
+	}
+	if !job.CabBookingResponse.BestBookingTime.Equal(time.Date(2018, time.March, 9, 9, 10, 0, 0, time.UTC)) {
+		t.Errorf("FindByID(%d) => got booking time: %v, expected the booking time of the job", first, job.CabBookingResponse.BestBookingTime)
+	}
+
+	if err = s.Remove(first); err != nil {
+		t.Errorf("Remove(%d) => got: %v, expected: nil", first, err)
+	}
+	if _, err = s.FindByID(first); err == nil {
+		t.Errorf("FindByID(%d) after Remove => got: nil, expected: not found error", first)
+	}
+	if err = s.Remove(first); err == nil {
+		t.Errorf("Remove(%d) twice => got: nil, expected: not found error", first)
+	}
+}
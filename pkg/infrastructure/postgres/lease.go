@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// acquireLease takes the lease for the holder if nobody has it or it ran out, or renews it
+// if the holder has it. Nothing is changed if another holder has it.
+const acquireLease = `INSERT INTO leases (name, holder, expires_at) VALUES ($1, $2, now() + make_interval(secs => $3))
+	ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+	WHERE leases.holder = EXCLUDED.holder OR leases.expires_at <= now()`
+
+// Lease implements the usecases.Lease interface with a row of the table leases, so the
+// servers sharing the DB elect one leader, wherever they run. The leases run out by the
+// clock of the database, the clocks of the servers don't need to agree.
+type Lease struct {
+	conn conn
+	name string
+}
+
+// Acquire takes the lease for the holder if it is free or has expired, or renews it if the
+// holder has it already.
+func (l *Lease) Acquire(holder string, ttl time.Duration) (bool, error) {
+	if holder == "" {
+		return false, errors.New("Lease can't be acquired without a holder")
+	}
+	res, err := l.conn.queryer().Exec(acquireLease, l.name, holder, ttl.Seconds())
+	if err != nil {
+		return false, errors.Wrapf(err, "Lease %s couldn't be acquired", l.name)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "Lease %s couldn't be acquired", l.name)
+	}
+	return n == 1, nil
+}
+
+// Release gives the lease up if the holder has it.
+func (l *Lease) Release(holder string) error {
+	_, err := l.conn.queryer().Exec("DELETE FROM leases WHERE name = $1 AND holder = $2", l.name, holder)
+	return errors.Wrapf(err, "Lease %s couldn't be released", l.name)
+}
@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLease(t *testing.T) {
+	dsn := testDatabase(t)
+	// two servers sharing the database
+	a, b := testDBOf(t, dsn).Lease("cron"), testDBOf(t, dsn).Lease("cron")
+
+	steps := []struct {
+		name     string
+		lease    *Lease
+		holder   string
+		ttl      time.Duration
+		wait     time.Duration
+		expected bool
+	}{
+		{"first holder takes the free lease", a, "a", time.Minute, 0, true},
+		{"second holder can't take a held lease", b, "b", time.Minute, 0, false},
+		{"holder renews its lease", a, "a", 100 * time.Millisecond, 0, true},
+		{"lease expires without renewal", b, "b", time.Minute, 200 * time.Millisecond, true},
+		{"old holder lost the lease", a, "a", time.Minute, 0, false},
+	}
+
+	for _, s := range steps {
+		time.Sleep(s.wait)
+		got, err := s.lease.Acquire(s.holder, s.ttl)
+		if err != nil {
+			t.Fatalf("%s: Acquire() => got: %v, expected: nil", s.name, err)
+		}
+		if got != s.expected {
+			t.Errorf("%s: Acquire(%s) => got: %v, expected: %v", s.name, s.holder, got, s.expected)
+		}
+	}
+
+	// releasing a lease someone else holds does nothing
+	a.Release("a")
+	if ok, _ := a.Acquire("a", time.Minute); ok {
+		t.Errorf("Acquire() after releasing a lease held by another holder => got: true, expected: false")
+	}
+	b.Release("b")
+	if ok, _ := a.Acquire("a", time.Minute); !ok {
+		t.Errorf("Acquire() after the holder released the lease => got: false, expected: true")
+	}
+	// leases of other names are held apart
+	if ok, _ := testDBOf(t, dsn).Lease("other").Acquire("b", time.Minute); !ok {
+		t.Errorf("Acquire() of another lease => got: false, expected: true")
+	}
+
+	if _, err := a.Acquire("", time.Second); err == nil {
+		t.Errorf("Acquire() without a holder => got: nil, expected an error")
+	}
+}
@@ -0,0 +1,179 @@
+package postgres
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// migrationLock is the key of the advisory lock which the servers starting together take
+// to migrate the schema one at a time.
+const migrationLock = 7311
+
+// migrations are the statements which take the schema from one version to the next, the
+// schema of version n is made by the first n migrations. A migration which was released is
+// never changed, a change of the schema is a new migration at the end.
+var migrations = []string{
+	// 1: users, their addresses and places, requests and their history, booking responses
+	// and the jobs of the queues
+	`CREATE TABLE users (
+		id   BIGSERIAL PRIMARY KEY,
+		name TEXT NOT NULL
+	);
+	CREATE TABLE user_addresses (
+		user_id   BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		position  INTEGER NOT NULL,
+		addr_type TEXT NOT NULL,
+		value     TEXT NOT NULL,
+		PRIMARY KEY (addr_type, value)
+	);
+	CREATE INDEX user_addresses_user_id ON user_addresses (user_id);
+	CREATE TABLE user_places (
+		user_id   BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		position  INTEGER NOT NULL,
+		name      TEXT NOT NULL,
+		latitude  TEXT NOT NULL,
+		longitude TEXT NOT NULL,
+		PRIMARY KEY (user_id, position)
+	);
+	CREATE TABLE requests (
+		id                    BIGSERIAL PRIMARY KEY,
+		user_id               BIGINT NOT NULL,
+		source_name           TEXT NOT NULL,
+		source_latitude       TEXT NOT NULL,
+		source_longitude      TEXT NOT NULL,
+		destination_name      TEXT NOT NULL,
+		destination_latitude  TEXT NOT NULL,
+		destination_longitude TEXT NOT NULL,
+		reaching_time         BIGINT,
+		cab                   TEXT NOT NULL,
+		cab_type              TEXT NOT NULL,
+		notification_type     TEXT NOT NULL,
+		notification_value    TEXT NOT NULL,
+		status                TEXT NOT NULL,
+		trigger_time          BIGINT,
+		booking_time          BIGINT,
+		version               BIGINT NOT NULL DEFAULT 0
+	);
+	CREATE INDEX requests_user_id ON requests (user_id);
+	CREATE INDEX requests_reaching_time ON requests (reaching_time);
+	CREATE TABLE request_events (
+		request_id BIGINT NOT NULL REFERENCES requests (id) ON DELETE CASCADE,
+		position   INTEGER NOT NULL,
+		status     TEXT NOT NULL,
+		at         BIGINT,
+		PRIMARY KEY (request_id, position)
+	);
+	CREATE TABLE booking_responses (
+		id                BIGSERIAL PRIMARY KEY,
+		request_id        BIGINT NOT NULL,
+		user_id           BIGINT NOT NULL,
+		best_booking_time BIGINT
+	);
+	CREATE TABLE jobs (
+		id            BIGSERIAL PRIMARY KEY,
+		queue         TEXT NOT NULL,
+		job_type      TEXT NOT NULL,
+		request_id    BIGINT NOT NULL,
+		descriptor    JSONB NOT NULL,
+		claimed_until TIMESTAMPTZ
+	);
+	CREATE INDEX jobs_queue_id ON jobs (queue, id);`,
+	// 2: how the best booking time of a booking response was found, and the indexes of the
+	// queries of the booking responses
+	`ALTER TABLE booking_responses ADD COLUMN strategy TEXT NOT NULL DEFAULT '';
+	ALTER TABLE booking_responses ADD COLUMN computed_at BIGINT;
+	ALTER TABLE booking_responses ADD COLUMN inputs JSONB NOT NULL DEFAULT '{}';
+	CREATE INDEX booking_responses_user_id ON booking_responses (user_id);
+	CREATE INDEX booking_responses_request_id ON booking_responses (request_id);
+	CREATE INDEX booking_responses_computed_at ON booking_responses (computed_at);`,
+	// 3: the token a request is read and cancelled with, the requests stored before it have
+	// none and can't be read through the API any more
+	`ALTER TABLE requests ADD COLUMN token TEXT NOT NULL DEFAULT '';`,
+	// 4: the idempotency keys of the requests, which are claimed in the transaction which
+	// stores the request
+	`CREATE TABLE idempotency_keys (
+		scope           TEXT NOT NULL,
+		idempotency_key TEXT NOT NULL,
+		payload_hash    TEXT NOT NULL,
+		request_id      BIGINT,
+		expires_at      BIGINT NOT NULL,
+		PRIMARY KEY (scope, idempotency_key)
+	);`,
+	// 5: the addresses users gave which they are yet to confirm, the addresses stored before
+	// it are confirmed
+	`CREATE TABLE pending_addresses (
+		user_id    BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		position   INTEGER NOT NULL,
+		addr_type  TEXT NOT NULL,
+		value      TEXT NOT NULL,
+		code       TEXT NOT NULL,
+		expires_at BIGINT NOT NULL,
+		PRIMARY KEY (user_id, position)
+	);`,
+	// 6: the schedule of the cron jobs, the leases of the servers and the dead letters, which
+	// the servers sharing the database share too
+	`CREATE TABLE cron_jobs (
+		id         BIGSERIAL PRIMARY KEY,
+		at         BIGINT NOT NULL,
+		descriptor JSONB NOT NULL
+	);
+	CREATE TABLE leases (
+		name       TEXT PRIMARY KEY,
+		holder     TEXT NOT NULL,
+		expires_at TIMESTAMPTZ NOT NULL
+	);
+	CREATE TABLE dead_letters (
+		id         BIGSERIAL PRIMARY KEY,
+		job_type   TEXT NOT NULL,
+		request_id BIGINT NOT NULL,
+		attempts   INTEGER NOT NULL,
+		last_error TEXT NOT NULL,
+		failed_at  BIGINT,
+		descriptor JSONB NOT NULL
+	);`,
+}
+
+// migrate applies the migrations the database doesn't have yet, each in a transaction of
+// its own, and records their versions in schema_migrations. Every transaction holds the
+// migration lock, so a server starting at the same time waits and then finds the migration
+// applied. It fails for a database whose schema is newer than the migrations, which was
+// migrated by a newer server.
+func migrate(db *sql.DB, migrations []string) error {
+	for {
+		var version int
+		err := transact(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLock); err != nil {
+				return errors.Wrap(err, "couldn't lock schema")
+			}
+			_, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+				version    INTEGER PRIMARY KEY,
+				applied_at BIGINT NOT NULL
+			)`)
+			if err != nil {
+				return errors.Wrap(err, "couldn't create schema_migrations")
+			}
+			if err = tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+				return errors.Wrap(err, "couldn't read schema version")
+			}
+			if version > len(migrations) {
+				return errors.Errorf("schema version %d is newer than the latest known version %d", version, len(migrations))
+			}
+			if version == len(migrations) {
+				return nil
+			}
+			if _, err = tx.Exec(migrations[version]); err != nil {
+				return errors.Wrapf(err, "couldn't apply migration %d", version+1)
+			}
+			_, err = tx.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES ($1, $2)", version+1, time.Now().UnixNano())
+			return errors.Wrapf(err, "couldn't apply migration %d", version+1)
+		})
+		if err != nil {
+			return err
+		}
+		if version == len(migrations) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+const (
+	// claimTimeout is how long a job claimed by a server is left to it, a job whose server
+	// went away without acknowledging it is claimed again by another server after that.
+	claimTimeout = 5 * time.Minute
+	// pollInterval is how often a Queue looks for the jobs added by the other servers.
+	pollInterval = time.Second
+)
+
+// claimJob claims the oldest job of a queue which isn't claimed by another server, or whose
+// claim ran out. SKIP LOCKED passes over the jobs which another server is claiming at the
+// same time, instead of waiting for it.
+const claimJob = `UPDATE jobs SET claimed_until = now() + make_interval(secs => $2)
+	WHERE id = (
+		SELECT id FROM jobs
+		WHERE queue = $1 AND (claimed_until IS NULL OR claimed_until < now())
+		ORDER BY id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, descriptor`
+
+// Queue implements the usecases.AppEngine interface with the table jobs of a DB, which is
+// shared by the servers using the DB. It also implements usecases.JobCheckpointer, so it can
+// be the Checkpointer of the Dispatcher which consumes its JobQueue.
+//
+// AddJob only returns once the job is stored. Run claims the jobs, oldest first, whenever
+// the JobQueue has room for one and every job handed out acknowledges itself once a Worker is
+// done with it, which deletes it. A server renews the claims of its jobs while it runs, the
+// jobs of a server which stopped without acknowledging them are claimed again once their
+// claims run out. So the delivery is at least once and the jobs must be safe to do twice.
+type Queue struct {
+	JobQueue chan usecases.Job
+
+	db     *DB
+	name   string
+	codec  *usecases.JobCodec
+	logger domain.Logger
+
+	claimTimeout time.Duration
+	pollInterval time.Duration
+
+	mu      sync.Mutex
+	claimed map[int64]bool
+	notify  chan struct{}
+
+	accepted uint64
+	rejected uint64
+}
+
+// queuedJob is a job handed out by a Queue, it knows its id in the table jobs.
+type queuedJob struct {
+	usecases.Job
+	id    int64
+	queue *Queue
+	acked int32
+}
+
+func (j *queuedJob) Unwrap() usecases.Job {
+	return j.Job
+}
+
+// Ack deletes the job from the table jobs, only the first call has any effect.
+func (j *queuedJob) Ack() error {
+	if !atomic.CompareAndSwapInt32(&j.acked, 0, 1) {
+		return nil
+	}
+	return j.queue.ack(j.id)
+}
+
+// AddJob stores the job in the table jobs, from where the Run of any server claims it.
+func (q *Queue) AddJob(j usecases.Job) error {
+	err := q.insert(q.db.db, j)
+	if err != nil {
+		atomic.AddUint64(&q.rejected, 1)
+		return errors.Wrapf(err, "%s couldn't add job", q.name)
+	}
+	q.added(1)
+	return nil
+}
+
+func (q *Queue) insert(qr queryer, j usecases.Job) error {
+	d, err := q.codec.Encode(j)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return errors.Wrap(err, "couldn't encode job descriptor")
+	}
+	_, err = qr.Exec("INSERT INTO jobs (queue, job_type, request_id, descriptor) VALUES ($1, $2, $3, $4)",
+		q.name, d.Type, d.RequestID, string(b))
+	return errors.Wrap(err, "couldn't insert job")
+}
+
+// added counts the jobs added to the Queue and wakes up its Run.
+func (q *Queue) added(n int) {
+	atomic.AddUint64(&q.accepted, uint64(n))
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue) ack(id int64) error {
+	_, err := q.db.db.Exec("DELETE FROM jobs WHERE id = $1", id)
+	if err != nil {
+		return errors.Wrapf(err, "%s couldn't ack job %d", q.name, id)
+	}
+	q.mu.Lock()
+	delete(q.claimed, id)
+	q.mu.Unlock()
+	return nil
+}
+
+// release gives up the claim of the job, so that it is claimed again right away.
+func (q *Queue) release(id int64) error {
+	_, err := q.db.db.Exec("UPDATE jobs SET claimed_until = NULL WHERE id = $1", id)
+	if err != nil {
+		return errors.Wrapf(err, "%s couldn't release job %d", q.name, id)
+	}
+	q.mu.Lock()
+	delete(q.claimed, id)
+	q.mu.Unlock()
+	return nil
+}
+
+// Run claims the jobs of the Queue and feeds them to the JobQueue, oldest first, until ctx is
+// done. It looks for new jobs when a job is added by this server and every pollInterval for
+// the jobs added by the others. A job which can't be decoded any more is logged and dropped.
+// The database being unavailable is logged and the claiming goes on once it is back.
+func (q *Queue) Run(ctx context.Context) error {
+	poll := time.NewTicker(q.pollInterval)
+	defer poll.Stop()
+	renew := time.NewTicker(q.claimTimeout / 3)
+	defer renew.Stop()
+	for {
+		if len(q.JobQueue) < cap(q.JobQueue) || cap(q.JobQueue) == 0 {
+			fed, err := q.feedNext(ctx)
+			if err != nil {
+				q.logger.Error("Queue couldn't claim a job", domain.NewField("queue", q.name), domain.NewField(domain.ErrorKey, err))
+			}
+			if fed {
+				continue
+			}
+		}
+		select {
+		case <-q.notify:
+		case <-poll.C:
+		case <-renew.C:
+			if err := q.renewClaims(); err != nil {
+				q.logger.Error("Queue couldn't renew the claims of its jobs", domain.NewField("queue", q.name), domain.NewField(domain.ErrorKey, err))
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// feedNext claims the next job and feeds it to the JobQueue, it returns false if there was
+// no job to claim. A job which is claimed when ctx is done is released.
+func (q *Queue) feedNext(ctx context.Context) (bool, error) {
+	var id int64
+	var b []byte
+	err := q.db.db.QueryRow(claimJob, q.name, q.claimTimeout.Seconds()).Scan(&id, &b)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "%s couldn't claim job", q.name)
+	}
+	q.mu.Lock()
+	q.claimed[id] = true
+	q.mu.Unlock()
+
+	var d usecases.JobDescriptor
+	job, err := q.decode(b, &d)
+	if err != nil {
+		q.logger.Error("Queue dropped job which can't be decoded",
+			domain.NewField("queue", q.name),
+			domain.NewField(domain.JobTypeKey, d.Type),
+			domain.NewField(domain.RequestIDKey, d.RequestID),
+			domain.NewField(domain.ErrorKey, err),
+		)
+		return true, q.ack(id)
+	}
+
+	select {
+	case q.JobQueue <- q.wrap(job, id):
+		return true, nil
+	case <-ctx.Done():
+		return false, q.release(id)
+	}
+}
+
+func (q *Queue) decode(b []byte, d *usecases.JobDescriptor) (usecases.Job, error) {
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, errors.Wrap(err, "couldn't decode job descriptor")
+	}
+	return q.codec.Decode(*d)
+}
+
+// wrap makes the job acknowledge itself, keeping the RetriedJob wrapping outermost so the
+// Worker still sees the attempts made.
+func (q *Queue) wrap(job usecases.Job, id int64) usecases.Job {
+	if r, ok := job.(*usecases.RetriedJob); ok {
+		return &usecases.RetriedJob{Job: &queuedJob{Job: r.Job, id: id, queue: q}, Attempts: r.Attempts}
+	}
+	return &queuedJob{Job: job, id: id, queue: q}
+}
+
+// renewClaims extends the claims of the jobs which this server claimed and didn't
+// acknowledge yet, the jobs are still being worked on or waiting for a Worker.
+func (q *Queue) renewClaims() error {
+	q.mu.Lock()
+	ids := make([]int64, 0, len(q.claimed))
+	for id := range q.claimed {
+		ids = append(ids, id)
+	}
+	q.mu.Unlock()
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := q.db.db.Exec("UPDATE jobs SET claimed_until = now() + make_interval(secs => $1) WHERE id = ANY($2)",
+		q.claimTimeout.Seconds(), pq.Array(ids))
+	return errors.Wrapf(err, "%s couldn't renew claims", q.name)
+}
+
+// Checkpoint stores the jobs which a Dispatcher couldn't finish during shutdown. The jobs
+// which came from this Queue are stored already, their claims are released so that another
+// server takes them over right away.
+func (q *Queue) Checkpoint(jobs []usecases.Job) error {
+	for _, j := range jobs {
+		if qj := q.owned(j); qj != nil {
+			if err := q.release(qj.id); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := q.insert(q.db.db, j); err != nil {
+			return errors.Wrapf(err, "%s couldn't checkpoint job", q.name)
+		}
+	}
+	return nil
+}
+
+func (q *Queue) owned(j usecases.Job) *queuedJob {
+	if r, ok := j.(*usecases.RetriedJob); ok {
+		j = r.Job
+	}
+	qj, ok := j.(*queuedJob)
+	if !ok || qj.queue != q {
+		return nil
+	}
+	return qj
+}
+
+// Stats returns the counters of the Queue, the depth is the number of jobs of the Queue in
+// the table jobs, of all of the servers, and the spilled ones are those which are not
+// claimed by any server.
+func (q *Queue) Stats() usecases.QueueStats {
+	s := usecases.QueueStats{
+		Name:     q.name,
+		Capacity: cap(q.JobQueue),
+		Accepted: atomic.LoadUint64(&q.accepted),
+		Rejected: atomic.LoadUint64(&q.rejected),
+	}
+	err := q.db.db.QueryRow(`SELECT COUNT(*), COUNT(*) FILTER (WHERE claimed_until IS NULL OR claimed_until < now())
+		FROM jobs WHERE queue = $1`, q.name).Scan(&s.Depth, &s.Spilled)
+	if err != nil {
+		q.logger.Error("Queue couldn't count its jobs", domain.NewField("queue", q.name), domain.NewField(domain.ErrorKey, err))
+	}
+	return s
+}
+
+// Jobs returns the JobQueue which Run feeds.
+func (q *Queue) Jobs() chan usecases.Job {
+	return q.JobQueue
+}
+
+// Close releases the claims of the jobs which were not acknowledged, it must only be called
+// once Run has returned and the Dispatcher consuming the JobQueue is shut down.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	ids := make([]int64, 0, len(q.claimed))
+	for id := range q.claimed {
+		ids = append(ids, id)
+	}
+	q.claimed = make(map[int64]bool)
+	q.mu.Unlock()
+	q.db.mu.Lock()
+	delete(q.db.queues, q.name)
+	q.db.mu.Unlock()
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := q.db.db.Exec("UPDATE jobs SET claimed_until = NULL WHERE id = ANY($1)", pq.Array(ids))
+	return errors.Wrapf(err, "%s couldn't release claims", q.name)
+}
+
+// txJobs implements the usecases.AppEngine interface for a transaction of a DB, it adds a
+// job to the Queue named after the job's type in the transaction.
+type txJobs struct {
+	conn  conn
+	db    *DB
+	added map[*Queue]int
+}
+
+func (t *txJobs) AddJob(j usecases.Job) error {
+	q := t.db.queue(j.Type())
+	if q == nil {
+		return errors.Errorf("no queue for job type %s", j.Type())
+	}
+	if err := q.insert(t.conn.queryer(), j); err != nil {
+		return errors.Wrapf(err, "%s couldn't add job", q.name)
+	}
+	if t.added == nil {
+		t.added = make(map[*Queue]int)
+	}
+	t.added[q]++
+	return nil
+}
+
+// committed counts the jobs added in the transaction, which was committed, to their Queues.
+func (t *txJobs) committed() {
+	for q, n := range t.added {
+		q.added(n)
+	}
+}
+
+// OpenQueue is a constructor which takes the name of the queue, which is the type of the
+// jobs added to it in a transaction, the length of the JobQueue, the JobCodec and a logger
+// and returns a pointer to a new Queue of the DB.
+func (d *DB) OpenQueue(name string, maxQueueLength int, codec *usecases.JobCodec, logger domain.Logger) *Queue {
+	q := Queue{
+		JobQueue:     make(chan usecases.Job, maxQueueLength),
+		db:           d,
+		name:         name,
+		codec:        codec,
+		logger:       logger,
+		claimTimeout: claimTimeout,
+		pollInterval: pollInterval,
+		claimed:      make(map[int64]bool),
+		notify:       make(chan struct{}, 1),
+	}
+	d.mu.Lock()
+	d.queues[name] = &q
+	d.mu.Unlock()
+	return &q
+}
@@ -0,0 +1,237 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// MockLogger implements the domain.Logger interface and drops every line.
+type MockLogger struct{}
+
+func (l *MockLogger) Debug(m string, fields ...domain.Field)    {}
+func (l *MockLogger) Info(m string, fields ...domain.Field)     {}
+func (l *MockLogger) Warn(m string, fields ...domain.Field)     {}
+func (l *MockLogger) Error(m string, fields ...domain.Field)    {}
+func (l *MockLogger) With(fields ...domain.Field) domain.Logger { return l }
+
+func testNotificationJob(t *testing.T, reqID uint64) *usecases.NotificationJob {
+	t.Helper()
+
+	r := &domain.Request{
+		Source:           domain.Location{Latitude: "77.134134", Longitude: "45.1341324"},
+		Destination:      domain.Location{Latitude: "77.234134", Longitude: "45.5641324"},
+		ReachingTime:     time.Date(2018, time.March, 9, 10, 0, 0, 0, time.UTC),
+		Cab:              "uber",
+		CabType:          "uberGo",
+		NotificationAddr: domain.UserAddress{AddrType: "email", Value: "anirban.nick@gmail.com"},
+	}
+	r.SetID(reqID)
+	ur := domain.NewUserRequest(domain.NewUser("roy"), r)
+	cbr := domain.NewCabBookingResponse(ur, time.Date(2018, time.March, 9, 9, 10, 0, 0, time.UTC))
+	return usecases.NewNotificationJob(cbr, nil)
+}
+
+// testQueue opens a Queue of the jobs of usecases.NotificationJobType on a DB of its own,
+// as a server would, which polls often so the tests don't wait for it.
+func testQueue(t *testing.T, dsn string) *Queue {
+	t.Helper()
+	d, err := Open(dsn, PoolConfig{})
+	if err != nil {
+		t.Fatalf("Open() => got: %v, expected: nil", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	q := d.OpenQueue(usecases.NotificationJobType, 10, &usecases.JobCodec{}, &MockLogger{})
+	q.pollInterval = 10 * time.Millisecond
+	return q
+}
+
+// run runs the queue until the returned function is called.
+func run(q *Queue) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// receive waits for n jobs on the JobQueue of one of the queues and returns them.
+func receive(t *testing.T, n int, queues ...*Queue) []usecases.Job {
+	t.Helper()
+	var jobs []usecases.Job
+	timeout := time.After(5 * time.Second)
+	for len(jobs) < n {
+		select {
+		case j := <-queues[0].JobQueue:
+			jobs = append(jobs, j)
+		case j := <-queues[len(queues)-1].JobQueue:
+			jobs = append(jobs, j)
+		case <-timeout:
+			t.Fatalf("Run() => got %d jobs, expected: %d", len(jobs), n)
+		}
+	}
+	return jobs
+}
+
+func ack(t *testing.T, j usecases.Job) {
+	t.Helper()
+
+	if r, ok := j.(*usecases.RetriedJob); ok {
+		j = r.Job
+	}
+	if err := j.(usecases.Acknowledger).Ack(); err != nil {
+		t.Fatalf("Ack() => got: %v, expected: nil", err)
+	}
+}
+
+func TestQueueSharedByServers(t *testing.T) {
+	dsn := testDatabase(t)
+	first, second := testQueue(t, dsn), testQueue(t, dsn)
+	const jobs = 20
+	for i := uint64(1); i <= jobs; i++ {
+		if err := first.AddJob(testNotificationJob(t, i)); err != nil {
+			t.Fatalf("AddJob() => got: %v, expected: nil", err)
+		}
+	}
+	stopFirst, stopSecond := run(first), run(second)
+	received := receive(t, jobs, first, second)
+	stopFirst()
+	stopSecond()
+
+	// every job is handed to one of the servers only
+	seen := make(map[uint64]bool)
+	for _, j := range received {
+		if seen[j.RequestID()] {
+			t.Errorf("Run() of two servers => got the job of request %d twice, expected it once", j.RequestID())
+		}
+		seen[j.RequestID()] = true
+		ack(t, j)
+	}
+	select {
+	case j := <-first.JobQueue:
+		t.Errorf("Run() => got an extra job of request %d, expected: %d jobs", j.RequestID(), jobs)
+	case j := <-second.JobQueue:
+		t.Errorf("Run() => got an extra job of request %d, expected: %d jobs", j.RequestID(), jobs)
+	default:
+	}
+	if stats := first.Stats(); stats.Depth != 0 || stats.Accepted != jobs {
+		t.Errorf("Stats() after acking every job => got: %+v, expected no jobs left and %d accepted", stats, jobs)
+	}
+}
+
+func TestQueueClaimsJobsOfStoppedServer(t *testing.T) {
+	dsn := testDatabase(t)
+	gone, other := testQueue(t, dsn), testQueue(t, dsn)
+	gone.claimTimeout = time.Second
+	gone.AddJob(testNotificationJob(t, 1))
+	stop := run(gone)
+	receive(t, 1, gone)
+	// the server goes away without acking or releasing the job
+	stop()
+
+	if stats := other.Stats(); stats.Depth != 1 || stats.Spilled != 0 {
+		t.Errorf("Stats() of a claimed job => got: %+v, expected one job which is claimed", stats)
+	}
+	stop = run(other)
+	defer stop()
+	jobs := receive(t, 1, other)
+	if jobs[0].RequestID() != 1 {
+		t.Errorf("Run() after the claim ran out => got the job of request %d, expected: 1", jobs[0].RequestID())
+	}
+	decoded := jobs[0].(usecases.JobWrapper).Unwrap().(*usecases.NotificationJob)
+	if decoded.CabBookingResponse.NotificationAddr.Value != "anirban.nick@gmail.com" {
+		t.Errorf("Run() => got: %+v, expected the job's data to be restored", decoded.CabBookingResponse.UserRequest.Request)
+	}
+}
+
+func TestQueueCheckpoint(t *testing.T) {
+	dsn := testDatabase(t)
+	q, other := testQueue(t, dsn), testQueue(t, dsn)
+	q.AddJob(testNotificationJob(t, 1))
+	stop := run(q)
+	jobs := receive(t, 1, q)
+	stop()
+
+	// the job of the queue is released, the one which came from elsewhere is stored
+	retried := &usecases.RetriedJob{Job: jobs[0], Attempts: 1}
+	if err := q.Checkpoint([]usecases.Job{retried, testNotificationJob(t, 2)}); err != nil {
+		t.Fatalf("Checkpoint() => got: %v, expected: nil", err)
+	}
+	if stats := other.Stats(); stats.Depth != 2 || stats.Spilled != 2 {
+		t.Errorf("Stats() after Checkpoint() => got: %+v, expected two jobs which are not claimed", stats)
+	}
+	stop = run(other)
+	defer stop()
+	jobs = receive(t, 2, other)
+	if jobs[0].RequestID() != 1 || jobs[1].RequestID() != 2 {
+		t.Errorf("Run() after Checkpoint() => got jobs of requests %d and %d, expected 1 and 2", jobs[0].RequestID(), jobs[1].RequestID())
+	}
+}
+
+func TestQueueRenewsClaims(t *testing.T) {
+	dsn := testDatabase(t)
+	q, other := testQueue(t, dsn), testQueue(t, dsn)
+	q.claimTimeout = 900 * time.Millisecond
+	q.AddJob(testNotificationJob(t, 1))
+	stop := run(q)
+	receive(t, 1, q)
+
+	// the job is still worked on well after its first claim ran out
+	time.Sleep(2 * time.Second)
+	stopOther := run(other)
+	select {
+	case j := <-other.JobQueue:
+		t.Errorf("Run() of another server => got the job of request %d, expected it to stay claimed", j.RequestID())
+	case <-time.After(500 * time.Millisecond):
+	}
+	stopOther()
+	stop()
+}
+
+func TestTransactAddsJobs(t *testing.T) {
+	dsn := testDatabase(t)
+	q := testQueue(t, dsn)
+	d := q.db
+
+	err := d.Transact(func(repos usecases.Repositories) error {
+		if err := repos.Jobs.AddJob(testNotificationJob(t, 1)); err != nil {
+			return err
+		}
+		return errors.New("queue is full")
+	})
+	if err == nil {
+		t.Fatalf("Transact() => got: nil, expected the error of the function")
+	}
+	if stats := q.Stats(); stats.Depth != 0 || stats.Accepted != 0 {
+		t.Errorf("Stats() after a rollback => got: %+v, expected no jobs", stats)
+	}
+
+	err = d.Transact(func(repos usecases.Repositories) error {
+		return repos.Jobs.AddJob(testNotificationJob(t, 2))
+	})
+	if err != nil {
+		t.Fatalf("Transact() => got: %v, expected: nil", err)
+	}
+	stop := run(q)
+	defer stop()
+	if jobs := receive(t, 1, q); jobs[0].RequestID() != 2 {
+		t.Errorf("Run() after a commit => got the job of request %d, expected: 2", jobs[0].RequestID())
+	}
+
+	err = d.Transact(func(repos usecases.Repositories) error {
+		return repos.Jobs.AddJob(&usecases.UserRequestJob{})
+	})
+	if err == nil {
+		t.Errorf("Transact() adding a job without a queue => got: nil, expected an error")
+	}
+}
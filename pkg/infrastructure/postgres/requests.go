@@ -0,0 +1,221 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// requestColumns are the columns of the requests table which scanRequest reads, in its order.
+const requestColumns = `id, user_id, source_name, source_latitude, source_longitude,
+	destination_name, destination_latitude, destination_longitude, reaching_time, cab, cab_type,
+	notification_type, notification_value, status, trigger_time, booking_time, version, token`
+
+// RequestRepository implements the domain.RequestRepository interface with the tables
+// requests and request_events.
+type RequestRepository struct {
+	conn conn
+}
+
+func (m *RequestRepository) FindByID(id uint64) (*domain.Request, error) {
+	return findRequest(m.conn.queryer(), id)
+}
+
+// FindByUserID returns the requests of the user ordered by id.
+func (m *RequestRepository) FindByUserID(userID uint64) ([]*domain.Request, error) {
+	return m.List(domain.RequestFilter{UserID: userID})
+}
+
+// List returns the requests selected by the filter ordered by id.
+func (m *RequestRepository) List(f domain.RequestFilter) ([]*domain.Request, error) {
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if f.UserID != 0 {
+		where = append(where, "user_id = "+arg(f.UserID))
+	}
+	if len(f.Statuses) > 0 {
+		statuses := make([]string, 0, len(f.Statuses))
+		for _, s := range f.Statuses {
+			statuses = append(statuses, string(s))
+		}
+		where = append(where, "status = ANY("+arg(pq.Array(statuses))+")")
+	}
+	if !f.ReachingAfter.IsZero() {
+		where = append(where, "reaching_time >= "+arg(timeValue(f.ReachingAfter)))
+	}
+	if !f.ReachingBefore.IsZero() {
+		where = append(where, "reaching_time < "+arg(timeValue(f.ReachingBefore)))
+	}
+	query := "SELECT " + requestColumns + " FROM requests"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id"
+	if f.Limit > 0 {
+		query += " LIMIT " + arg(f.Limit)
+	}
+
+	q := m.conn.queryer()
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't list requests")
+	}
+	var rs []*domain.Request
+	for rows.Next() {
+		r, err := scanRequest(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "couldn't list requests")
+	}
+	// the history is read once the rows are closed, the connection of a transaction is busy
+	// with them until then
+	for _, r := range rs {
+		if r.History, err = findHistory(q, r.ID()); err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+// Store stores the request under a new id and returns the id.
+func (m *RequestRepository) Store(r *domain.Request) (uint64, error) {
+	var id uint64
+	err := m.conn.atomic(func(q queryer) error {
+		err := q.QueryRow(`INSERT INTO requests (user_id, source_name, source_latitude, source_longitude,
+			destination_name, destination_latitude, destination_longitude, reaching_time, cab, cab_type,
+			notification_type, notification_value, status, trigger_time, booking_time, token)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) RETURNING id`,
+			r.UserID, r.Source.Name, r.Source.Latitude, r.Source.Longitude,
+			r.Destination.Name, r.Destination.Latitude, r.Destination.Longitude, timeValue(r.ReachingTime), r.Cab, r.CabType,
+			r.NotificationAddr.AddrType, r.NotificationAddr.Value, string(r.Status), timeValue(r.TriggerTime), timeValue(r.BookingTime), r.Token).Scan(&id)
+		if err != nil {
+			return errors.Wrap(err, "couldn't insert request")
+		}
+		return insertHistory(q, id, r.History)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Update replaces the stored request, it returns ErrNotFound if the request wasn't stored
+// and ErrConflict if it was updated since the request was read.
+func (m *RequestRepository) Update(r *domain.Request) error {
+	err := m.conn.atomic(func(q queryer) error {
+		res, err := q.Exec(`UPDATE requests SET user_id = $1, source_name = $2, source_latitude = $3, source_longitude = $4,
+			destination_name = $5, destination_latitude = $6, destination_longitude = $7, reaching_time = $8, cab = $9, cab_type = $10,
+			notification_type = $11, notification_value = $12, status = $13, trigger_time = $14, booking_time = $15, version = version + 1
+			WHERE id = $16 AND version = $17`,
+			r.UserID, r.Source.Name, r.Source.Latitude, r.Source.Longitude,
+			r.Destination.Name, r.Destination.Latitude, r.Destination.Longitude, timeValue(r.ReachingTime), r.Cab, r.CabType,
+			r.NotificationAddr.AddrType, r.NotificationAddr.Value, string(r.Status), timeValue(r.TriggerTime), timeValue(r.BookingTime),
+			r.ID(), r.Version())
+		if err != nil {
+			return errors.Wrapf(err, "couldn't update request %d", r.ID())
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return updateMissed(q, r)
+		}
+		if _, err = q.Exec("DELETE FROM request_events WHERE request_id = $1", r.ID()); err != nil {
+			return errors.Wrapf(err, "couldn't delete history of request %d", r.ID())
+		}
+		return insertHistory(q, r.ID(), r.History)
+	})
+	if err != nil {
+		return err
+	}
+	r.SetVersion(r.Version() + 1)
+	return nil
+}
+
+// updateMissed returns the error of an update of the request which changed no row, the
+// request is either not stored or at another version.
+func updateMissed(q queryer, r *domain.Request) error {
+	var version uint64
+	err := q.QueryRow("SELECT version FROM requests WHERE id = $1", r.ID()).Scan(&version)
+	if err == sql.ErrNoRows {
+		return errors.Wrapf(domain.ErrNotFound, "request %d", r.ID())
+	}
+	if err != nil {
+		return errors.Wrapf(err, "couldn't find version of request %d", r.ID())
+	}
+	return errors.Wrapf(domain.ErrConflict, "request %d is at version %d, not %d", r.ID(), version, r.Version())
+}
+
+// findRequest reads the request with the id and its history.
+func findRequest(q queryer, id uint64) (*domain.Request, error) {
+	r, err := scanRequest(q.QueryRow("SELECT "+requestColumns+" FROM requests WHERE id = $1", id))
+	if errors.Cause(err) == sql.ErrNoRows {
+		return nil, errors.Wrapf(domain.ErrNotFound, "request %d", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.History, err = findHistory(q, id); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// scanRequest reads the requestColumns of a row into a request, without its history.
+func scanRequest(row interface{ Scan(...interface{}) error }) (*domain.Request, error) {
+	var r domain.Request
+	var id, version uint64
+	var status string
+	var reachingTime, triggerTime, bookingTime sql.NullInt64
+	err := row.Scan(&id, &r.UserID, &r.Source.Name, &r.Source.Latitude, &r.Source.Longitude,
+		&r.Destination.Name, &r.Destination.Latitude, &r.Destination.Longitude, &reachingTime, &r.Cab, &r.CabType,
+		&r.NotificationAddr.AddrType, &r.NotificationAddr.Value, &status, &triggerTime, &bookingTime, &version, &r.Token)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read request")
+	}
+	r.SetID(id)
+	r.SetVersion(version)
+	r.Status = domain.RequestStatus(status)
+	r.ReachingTime, r.TriggerTime, r.BookingTime = timeOf(reachingTime), timeOf(triggerTime), timeOf(bookingTime)
+	return &r, nil
+}
+
+func insertHistory(q queryer, id uint64, history []domain.RequestEvent) error {
+	for i, e := range history {
+		_, err := q.Exec("INSERT INTO request_events (request_id, position, status, at) VALUES ($1, $2, $3, $4)", id, i, string(e.Status), timeValue(e.At))
+		if err != nil {
+			return errors.Wrapf(err, "couldn't insert history of request %d", id)
+		}
+	}
+	return nil
+}
+
+func findHistory(q queryer, id uint64) ([]domain.RequestEvent, error) {
+	rows, err := q.Query("SELECT status, at FROM request_events WHERE request_id = $1 ORDER BY position", id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't find history of request %d", id)
+	}
+	defer rows.Close()
+	var history []domain.RequestEvent
+	for rows.Next() {
+		var status string
+		var at sql.NullInt64
+		if err = rows.Scan(&status, &at); err != nil {
+			return nil, errors.Wrapf(err, "couldn't read history of request %d", id)
+		}
+		history = append(history, domain.RequestEvent{Status: domain.RequestStatus(status), At: timeOf(at)})
+	}
+	return history, errors.Wrapf(rows.Err(), "couldn't read history of request %d", id)
+}
@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// ScheduleStore implements the usecases.ScheduleStore interface with the table cron_jobs,
+// so the servers sharing the DB share the schedule, whichever of them fires it.
+type ScheduleStore struct {
+	conn conn
+}
+
+// Add stores the CronJob and returns the id it was stored with.
+func (s *ScheduleStore) Add(cj usecases.CronJob) (uint64, error) {
+	if cj.At.IsZero() {
+		return 0, errors.New("ScheduleStore can't store a CronJob without a time")
+	}
+	b, err := json.Marshal(cj.Job)
+	if err != nil {
+		return 0, errors.Wrap(err, "ScheduleStore couldn't encode job descriptor")
+	}
+	var id int64
+	err = s.conn.queryer().QueryRow("INSERT INTO cron_jobs (at, descriptor) VALUES ($1, $2) RETURNING id",
+		timeValue(cj.At), string(b)).Scan(&id)
+	if err != nil {
+		return 0, errors.Wrap(err, "ScheduleStore couldn't insert CronJob")
+	}
+	return uint64(id), nil
+}
+
+// Remove deletes the CronJob with the given id, removing an unknown id does nothing.
+func (s *ScheduleStore) Remove(id uint64) error {
+	_, err := s.conn.queryer().Exec("DELETE FROM cron_jobs WHERE id = $1", id)
+	return errors.Wrapf(err, "ScheduleStore couldn't delete CronJob %d", id)
+}
+
+// List returns all the stored CronJobs, in the order they were added.
+func (s *ScheduleStore) List() ([]usecases.CronJob, error) {
+	rows, err := s.conn.queryer().Query("SELECT id, at, descriptor FROM cron_jobs ORDER BY id")
+	if err != nil {
+		return nil, errors.Wrap(err, "ScheduleStore couldn't list CronJobs")
+	}
+	defer rows.Close()
+	cjs := []usecases.CronJob{}
+	for rows.Next() {
+		var cj usecases.CronJob
+		var at sql.NullInt64
+		var b []byte
+		if err = rows.Scan(&cj.ID, &at, &b); err != nil {
+			return nil, errors.Wrap(err, "ScheduleStore couldn't read CronJob")
+		}
+		if err = json.Unmarshal(b, &cj.Job); err != nil {
+			return nil, errors.Wrapf(err, "ScheduleStore couldn't decode job descriptor of CronJob %d", cj.ID)
+		}
+		cj.At = timeOf(at)
+		cjs = append(cjs, cj)
+	}
+	return cjs, errors.Wrap(rows.Err(), "ScheduleStore couldn't list CronJobs")
+}
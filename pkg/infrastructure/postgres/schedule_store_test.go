@@ -0,0 +1,34 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+func TestScheduleStoreSharedByServers(t *testing.T) {
+	dsn := testDatabase(t)
+	// two servers sharing the database
+	a, b := testDBOf(t, dsn).ScheduleStore(), testDBOf(t, dsn).ScheduleStore()
+	at := time.Date(2030, 1, 2, 8, 30, 0, 0, time.UTC)
+	first, _ := a.Add(usecases.CronJob{At: at, Job: usecases.JobDescriptor{Type: "cab_request", RequestID: 1, Payload: []byte("{}")}})
+	second, err := b.Add(usecases.CronJob{At: at.Add(time.Hour), Job: usecases.JobDescriptor{Type: "cab_request", RequestID: 2, Payload: []byte("{}")}})
+	if err != nil || first == second {
+		t.Fatalf("Add() => got: (%d, %d, %v), expected two ids", first, second, err)
+	}
+	if err = b.Remove(first); err != nil {
+		t.Fatalf("Remove() => got: %v, expected: nil", err)
+	}
+	if err = b.Remove(first); err != nil {
+		t.Errorf("Remove() of a removed CronJob => got: %v, expected: nil", err)
+	}
+	if _, err = a.Add(usecases.CronJob{Job: usecases.JobDescriptor{Type: "cab_request"}}); err == nil {
+		t.Errorf("Add() without a time => got: nil, expected an error")
+	}
+
+	cjs, err := a.List()
+	if err != nil || len(cjs) != 1 || cjs[0].ID != second || !cjs[0].At.Equal(at.Add(time.Hour)) || cjs[0].Job.RequestID != 2 {
+		t.Errorf("List() => got: (%+v, %v), expected only the second CronJob", cjs, err)
+	}
+}
@@ -0,0 +1,611 @@
+// package repotest has the conformance tests of the domain repositories, and of the stores
+// of the use cases which are kept next to them. Every implementation of a repository runs
+// them from its own tests, so that all of them behave the same to the use cases:
+//
+//	func TestRequestRepositoryConformance(t *testing.T) {
+//		repotest.RequestRepository(t, func(t *testing.T) domain.RequestRepository {
+//			return NewRequestRepository()
+//		})
+//	}
+//
+// The repositories are created empty for every test by the given constructor.
+package repotest
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// concurrentStores is how many users or requests are stored at the same time to check that
+// every one of them gets its own id.
+const concurrentStores = 20
+
+var testTime = time.Date(2018, time.March, 9, 8, 0, 0, 0, time.UTC)
+
+// UserRepository runs the conformance tests of a domain.UserRepository.
+func UserRepository(t *testing.T, newRepo func(*testing.T) domain.UserRepository) {
+	email := domain.UserAddress{AddrType: "email", Value: "roy@example.com"}
+	work := domain.UserAddress{AddrType: "email", Value: "roy@work.example.com"}
+	home := domain.Location{Name: "home", Latitude: "12.9352", Longitude: "77.6245"}
+
+	t.Run("store and find", func(t *testing.T) {
+		m := newRepo(t)
+		roy := domain.NewUser("roy")
+		roy.AddAddress(email)
+		roy.AddPendingAddress(work, testTime.Add(time.Hour))
+		roy.SavePlace(home)
+		id, err := m.Store(roy)
+		if err != nil || id == 0 {
+			t.Fatalf("Store() => got: (%d, %v), expected a new id", id, err)
+		}
+		expected := *roy
+		expected.UserID = id
+
+		u, err := m.FindByID(id)
+		if err != nil || !reflect.DeepEqual(*u, expected) {
+			t.Errorf("FindByID(%d) => got: (%+v, %v), expected: %+v", id, u, err, expected)
+		}
+		u, err = m.FindByAddress(email)
+		if err != nil || !reflect.DeepEqual(*u, expected) {
+			t.Errorf("FindByAddress(%v) => got: (%+v, %v), expected: %+v", email, u, err, expected)
+		}
+		if _, err = m.FindByID(id + 1); errors.Cause(err) != domain.ErrNotFound {
+			t.Errorf("FindByID(%d) => got: %v, expected: %v", id+1, err, domain.ErrNotFound)
+		}
+		// a user is not found by an address they are yet to confirm
+		if _, err = m.FindByAddress(work); errors.Cause(err) != domain.ErrNotFound {
+			t.Errorf("FindByAddress(%v) of a pending address => got: %v, expected: %v", work, err, domain.ErrNotFound)
+		}
+	})
+
+	t.Run("address belongs to one user", func(t *testing.T) {
+		m := newRepo(t)
+		roy := domain.NewUser("roy")
+		roy.AddAddress(email)
+		m.Store(roy)
+		nick := domain.NewUser("nick")
+		nick.AddAddress(email)
+		if _, err := m.Store(nick); errors.Cause(err) != domain.ErrAddressTaken {
+			t.Errorf("Store() of a user with a taken address => got: %v, expected: %v", err, domain.ErrAddressTaken)
+		}
+
+		nickID, _ := m.Store(domain.NewUser("nick"))
+		u, _ := m.FindByID(nickID)
+		u.AddAddress(email)
+		if err := m.Update(u); errors.Cause(err) != domain.ErrAddressTaken {
+			t.Errorf("Update() of a user with a taken address => got: %v, expected: %v", err, domain.ErrAddressTaken)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		m := newRepo(t)
+		roy := domain.NewUser("roy")
+		roy.AddAddress(email)
+		code, _ := roy.AddPendingAddress(work, testTime.Add(time.Hour))
+		id, _ := m.Store(roy)
+
+		u, _ := m.FindByID(id)
+		u.Name = "anirban"
+		if err := u.ConfirmAddress(work, code, testTime); err != nil {
+			t.Fatalf("ConfirmAddress() of the stored code => got: %v, expected: nil", err)
+		}
+		u.Addresses = []domain.UserAddress{work}
+		u.SavePlace(home)
+		if err := m.Update(u); err != nil {
+			t.Fatalf("Update() => got: %v, expected: nil", err)
+		}
+		found, err := m.FindByAddress(work)
+		if err != nil || !reflect.DeepEqual(found, u) {
+			t.Errorf("FindByAddress(%v) after Update => got: (%+v, %v), expected: %+v", work, found, err, u)
+		}
+		// the address the user no longer has is free for another user
+		if _, err = m.FindByAddress(email); errors.Cause(err) != domain.ErrNotFound {
+			t.Errorf("FindByAddress(%v) of a removed address => got: %v, expected: %v", email, err, domain.ErrNotFound)
+		}
+		nick := domain.NewUser("nick")
+		nick.AddAddress(email)
+		if _, err = m.Store(nick); err != nil {
+			t.Errorf("Store() of a user with a removed address => got: %v, expected: nil", err)
+		}
+
+		if err = m.Update(&domain.User{UserID: id + 99, Name: "ghost"}); errors.Cause(err) != domain.ErrNotFound {
+			t.Errorf("Update() of an unstored user => got: %v, expected: %v", err, domain.ErrNotFound)
+		}
+	})
+
+	t.Run("found user is a copy", func(t *testing.T) {
+		m := newRepo(t)
+		roy := domain.NewUser("roy")
+		roy.AddAddress(email)
+		id, _ := m.Store(roy)
+		roy.Name = "changed"
+
+		u, _ := m.FindByID(id)
+		u.Addresses[0] = work
+		u.SavePlace(home)
+		stored, _ := m.FindByID(id)
+		if stored.Name != "roy" || !stored.HasAddress(email) || len(stored.Places) != 0 {
+			t.Errorf("FindByID(%d) => got: %+v, expected the stored user not to change without Update", id, stored)
+		}
+	})
+
+	t.Run("concurrent stores", func(t *testing.T) {
+		m := newRepo(t)
+		ids := storeConcurrently(t, func(i int) (uint64, error) {
+			u := domain.NewUser("roy")
+			u.AddAddress(domain.UserAddress{AddrType: "email", Value: fmt.Sprintf("roy%d@example.com", i)})
+			return m.Store(u)
+		})
+		for _, id := range ids {
+			if _, err := m.FindByID(id); err != nil {
+				t.Errorf("FindByID(%d) => got: %v, expected the stored user", id, err)
+			}
+		}
+	})
+}
+
+// RequestRepository runs the conformance tests of a domain.RequestRepository.
+func RequestRepository(t *testing.T, newRepo func(*testing.T) domain.RequestRepository) {
+	t.Run("store and find", func(t *testing.T) {
+		m := newRepo(t)
+		r := testRequest(7, testTime.Add(2*time.Hour))
+		id, err := m.Store(r)
+		if err != nil || id == 0 {
+			t.Fatalf("Store() => got: (%d, %v), expected a new id", id, err)
+		}
+		expected := *r
+		expected.SetID(id)
+
+		found, err := m.FindByID(id)
+		if err != nil || !requestsEqual(found, &expected) {
+			t.Errorf("FindByID(%d) => got: (%+v, %v), expected: %+v", id, found, err, expected)
+		}
+		if _, err = m.FindByID(id + 1); errors.Cause(err) != domain.ErrNotFound {
+			t.Errorf("FindByID(%d) => got: %v, expected: %v", id+1, err, domain.ErrNotFound)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		m := newRepo(t)
+		r := testRequest(7, testTime.Add(2*time.Hour))
+		id, _ := m.Store(r)
+
+		found, _ := m.FindByID(id)
+		found.SetStatus(domain.RequestScheduled, testTime.Add(time.Second))
+		found.TriggerTime = testTime.Add(time.Hour)
+		if err := m.Update(found); err != nil {
+			t.Fatalf("Update() => got: %v, expected: nil", err)
+		}
+		updated, err := m.FindByID(id)
+		if err != nil || !requestsEqual(updated, found) {
+			t.Errorf("FindByID(%d) after Update => got: (%+v, %v), expected: %+v", id, updated, err, found)
+		}
+		if len(r.History) != 1 {
+			t.Errorf("Update() => got history of the stored request: %v, expected it not to change", r.History)
+		}
+
+		unstored := testRequest(7, testTime)
+		unstored.SetID(id + 99)
+		if err = m.Update(unstored); errors.Cause(err) != domain.ErrNotFound {
+			t.Errorf("Update() of an unstored request => got: %v, expected: %v", err, domain.ErrNotFound)
+		}
+	})
+
+	t.Run("update of a changed request", func(t *testing.T) {
+		m := newRepo(t)
+		id, _ := m.Store(testRequest(7, testTime.Add(2*time.Hour)))
+		first, _ := m.FindByID(id)
+		second, _ := m.FindByID(id)
+
+		first.SetStatus(domain.RequestScheduled, testTime.Add(time.Second))
+		if err := m.Update(first); err != nil {
+			t.Fatalf("Update() => got: %v, expected: nil", err)
+		}
+		second.Cancel()
+		if err := m.Update(second); errors.Cause(err) != domain.ErrConflict {
+			t.Errorf("Update() of a request changed since it was read => got: %v, expected: %v", err, domain.ErrConflict)
+		}
+		stored, _ := m.FindByID(id)
+		if stored.Status != domain.RequestScheduled {
+			t.Errorf("FindByID(%d) after a conflict => got status: %s, expected: %s", id, stored.Status, domain.RequestScheduled)
+		}
+
+		// the request read again can be updated, and the updated request again
+		stored.Cancel()
+		if err := m.Update(stored); err != nil {
+			t.Errorf("Update() of the request read again => got: %v, expected: nil", err)
+		}
+		stored.BookingTime = testTime.Add(time.Hour)
+		if err := m.Update(stored); err != nil {
+			t.Errorf("Update() of the updated request => got: %v, expected: nil", err)
+		}
+	})
+
+	t.Run("concurrent updates", func(t *testing.T) {
+		m := newRepo(t)
+		id, _ := m.Store(testRequest(7, testTime.Add(2*time.Hour)))
+		var wg sync.WaitGroup
+		errs := make([]error, concurrentStores)
+		for i := 0; i < concurrentStores; i++ {
+			r, _ := m.FindByID(id)
+			wg.Add(1)
+			go func(i int, r *domain.Request) {
+				defer wg.Done()
+				r.TriggerTime = testTime.Add(time.Duration(i) * time.Minute)
+				errs[i] = m.Update(r)
+			}(i, r)
+		}
+		wg.Wait()
+
+		updated := 0
+		for i, err := range errs {
+			if err == nil {
+				updated++
+			} else if errors.Cause(err) != domain.ErrConflict {
+				t.Errorf("Update() %d of %d at the same time => got: %v, expected: nil or %v", i+1, concurrentStores, err, domain.ErrConflict)
+			}
+		}
+		if updated != 1 {
+			t.Errorf("Update() of the same version %d times at the same time => got %d updates, expected: 1", concurrentStores, updated)
+		}
+	})
+
+	t.Run("find by user and list", func(t *testing.T) {
+		m := newRepo(t)
+		var ids []uint64
+		for i, userID := range []uint64{7, 8, 7, 7} {
+			r := testRequest(userID, testTime.Add(time.Duration(i+1)*time.Hour))
+			if i == 2 {
+				r.SetStatus(domain.RequestScheduled, testTime)
+			}
+			id, _ := m.Store(r)
+			ids = append(ids, id)
+		}
+
+		testCases := []struct {
+			name        string
+			filter      domain.RequestFilter
+			expectedIDs []uint64
+		}{
+			{"every request", domain.RequestFilter{}, ids},
+			{"requests of a user", domain.RequestFilter{UserID: 7}, []uint64{ids[0], ids[2], ids[3]}},
+			{"requests of a user without requests", domain.RequestFilter{UserID: 9}, nil},
+			{"requests in a status", domain.RequestFilter{Statuses: []domain.RequestStatus{domain.RequestScheduled}}, []uint64{ids[2]}},
+			{"requests in one of the statuses", domain.RequestFilter{UserID: 7, Statuses: []domain.RequestStatus{domain.RequestPending, domain.RequestNotified}}, []uint64{ids[0], ids[3]}},
+			{"requests reaching in a range", domain.RequestFilter{ReachingAfter: testTime.Add(2 * time.Hour), ReachingBefore: testTime.Add(4 * time.Hour)}, []uint64{ids[1], ids[2]}},
+			{"first requests", domain.RequestFilter{UserID: 7, Limit: 2}, []uint64{ids[0], ids[2]}},
+		}
+
+		for i, _ := range testCases {
+			tc := testCases[i]
+			t.Run(tc.name, func(t *testing.T) {
+				rs, err := m.List(tc.filter)
+				if got := requestIDs(rs); err != nil || !reflect.DeepEqual(got, tc.expectedIDs) {
+					t.Errorf("%s: List(%+v) => got: (%v, %v), expected: %v", tc.name, tc.filter, got, err, tc.expectedIDs)
+				}
+			})
+		}
+
+		rs, err := m.FindByUserID(7)
+		if got := requestIDs(rs); err != nil || !reflect.DeepEqual(got, []uint64{ids[0], ids[2], ids[3]}) {
+			t.Errorf("FindByUserID(7) => got: (%v, %v), expected: %v", got, err, []uint64{ids[0], ids[2], ids[3]})
+		}
+	})
+
+	t.Run("concurrent stores", func(t *testing.T) {
+		m := newRepo(t)
+		ids := storeConcurrently(t, func(i int) (uint64, error) {
+			return m.Store(testRequest(7, testTime.Add(time.Hour)))
+		})
+		if rs, err := m.FindByUserID(7); err != nil || len(rs) != len(ids) {
+			t.Errorf("FindByUserID(7) => got: (%d requests, %v), expected: %d requests", len(rs), err, len(ids))
+		}
+	})
+}
+
+// CabBookingResponseRepository runs the conformance tests of a
+// domain.CabBookingResponseRepository. The user and the request of the booking responses
+// are stored with the repositories returned by newRepos, which may be nil for a repository
+// which doesn't need them stored.
+func CabBookingResponseRepository(t *testing.T, newRepo func(*testing.T) (domain.CabBookingResponseRepository, domain.UserRepository, domain.RequestRepository)) {
+	t.Run("store and find", func(t *testing.T) {
+		m, users, requests := newRepo(t)
+		ur := storeUserRequest(t, users, requests, testUser("roy", 7), 11)
+		cbr := testBookingResponse(ur, testTime)
+		id, err := m.Store(cbr)
+		if err != nil || id == 0 {
+			t.Fatalf("Store() => got: (%d, %v), expected a new id", id, err)
+		}
+		expected := *cbr
+		expected.BookingID = id
+
+		found, err := m.FindByID(id)
+		if err != nil || !bookingResponsesEqual(found, &expected) {
+			t.Errorf("FindByID(%d) => got: (%+v, %v), expected: %+v", id, found, err, expected)
+		}
+		if _, err = m.FindByID(id + 1); errors.Cause(err) != domain.ErrNotFound {
+			t.Errorf("FindByID(%d) => got: %v, expected: %v", id+1, err, domain.ErrNotFound)
+		}
+	})
+
+	t.Run("find by user, by request and list", func(t *testing.T) {
+		m, users, requests := newRepo(t)
+		roy, nick := testUser("roy", 7), testUser("nick", 8)
+		first := storeUserRequest(t, users, requests, roy, 11)
+		second := storeUserRequest(t, users, requests, roy, 12)
+		other := storeUserRequest(t, users, requests, nick, 13)
+		var ids []uint64
+		for i, ur := range []*domain.UserRequest{first, first, other, second} {
+			id, err := m.Store(testBookingResponse(ur, testTime.Add(time.Duration(i)*time.Hour)))
+			if err != nil {
+				t.Fatalf("Store() => got: %v, expected: nil", err)
+			}
+			ids = append(ids, id)
+		}
+
+		testCases := []struct {
+			name        string
+			filter      domain.CabBookingResponseFilter
+			expectedIDs []uint64
+		}{
+			{"every response", domain.CabBookingResponseFilter{}, ids},
+			{"responses of a user", domain.CabBookingResponseFilter{UserID: roy.UserID}, []uint64{ids[0], ids[1], ids[3]}},
+			{"responses of a request", domain.CabBookingResponseFilter{RequestID: first.Request.ID()}, []uint64{ids[0], ids[1]}},
+			{"responses of a request of another user", domain.CabBookingResponseFilter{UserID: nick.UserID, RequestID: first.Request.ID()}, nil},
+			{"responses computed in a range", domain.CabBookingResponseFilter{ComputedAfter: testTime.Add(time.Hour), ComputedBefore: testTime.Add(3 * time.Hour)}, []uint64{ids[1], ids[2]}},
+			{"first responses", domain.CabBookingResponseFilter{UserID: roy.UserID, Limit: 2}, []uint64{ids[0], ids[1]}},
+		}
+
+		for i, _ := range testCases {
+			tc := testCases[i]
+			t.Run(tc.name, func(t *testing.T) {
+				cs, err := m.List(tc.filter)
+				if got := bookingIDs(cs); err != nil || !reflect.DeepEqual(got, tc.expectedIDs) {
+					t.Errorf("%s: List(%+v) => got: (%v, %v), expected: %v", tc.name, tc.filter, got, err, tc.expectedIDs)
+				}
+			})
+		}
+
+		cs, err := m.FindByUserID(nick.UserID)
+		if got := bookingIDs(cs); err != nil || !reflect.DeepEqual(got, []uint64{ids[2]}) {
+			t.Errorf("FindByUserID(%d) => got: (%v, %v), expected: %v", nick.UserID, got, err, []uint64{ids[2]})
+		}
+		cs, err = m.FindByRequestID(second.Request.ID())
+		if got := bookingIDs(cs); err != nil || !reflect.DeepEqual(got, []uint64{ids[3]}) {
+			t.Errorf("FindByRequestID(%d) => got: (%v, %v), expected: %v", second.Request.ID(), got, err, []uint64{ids[3]})
+		}
+		if len(cs) == 1 && (cs[0].User.Name != "roy" || !requestsEqual(cs[0].Request, second.Request)) {
+			t.Errorf("FindByRequestID(%d) => got: (%+v, %+v), expected the user and request of the response", second.Request.ID(), cs[0].User, cs[0].Request)
+		}
+	})
+
+	t.Run("concurrent stores", func(t *testing.T) {
+		m, users, requests := newRepo(t)
+		ur := storeUserRequest(t, users, requests, testUser("roy", 7), 11)
+		storeConcurrently(t, func(i int) (uint64, error) {
+			return m.Store(testBookingResponse(ur, testTime.Add(time.Duration(i)*time.Minute)))
+		})
+	})
+}
+
+// IdempotencyStore runs the conformance tests of a usecases.IdempotencyStore.
+func IdempotencyStore(t *testing.T, newStore func(*testing.T) usecases.IdempotencyStore) {
+	rec := usecases.IdempotencyRecord{Scope: "email:roy@example.com", Key: "k1", PayloadHash: "h1", ExpiresAt: testTime.Add(time.Hour)}
+
+	t.Run("claim, complete and expire", func(t *testing.T) {
+		m := newStore(t)
+		stored, claimed, err := m.Claim(rec, testTime)
+		if err != nil || !claimed || stored != rec {
+			t.Fatalf("Claim() => got: (%v, %t, %v), expected the key to be claimed", stored, claimed, err)
+		}
+		other := rec
+		other.PayloadHash, other.ExpiresAt = "h2", testTime.Add(2*time.Hour)
+		stored, claimed, err = m.Claim(other, testTime.Add(time.Minute))
+		if err != nil || claimed || stored != rec {
+			t.Errorf("Claim() of a claimed key => got: (%v, %t, %v), expected the pending record of h1", stored, claimed, err)
+		}
+
+		if err = m.Complete(rec.Scope, rec.Key, 7); err != nil {
+			t.Errorf("Complete() => got: %v, expected: nil", err)
+		}
+		stored, claimed, _ = m.Claim(other, testTime.Add(time.Minute))
+		if claimed || stored.RequestID != 7 || stored.PayloadHash != "h1" {
+			t.Errorf("Claim() of a completed key => got: (%v, %t), expected the record of request 7", stored, claimed)
+		}
+
+		// the key expired, so it can be claimed again
+		stored, claimed, _ = m.Claim(other, testTime.Add(time.Hour))
+		if !claimed || stored != other {
+			t.Errorf("Claim() of an expired key => got: (%v, %t), expected the key to be claimed again", stored, claimed)
+		}
+	})
+
+	t.Run("release", func(t *testing.T) {
+		m := newStore(t)
+		m.Claim(rec, testTime)
+		if err := m.Release(rec.Scope, rec.Key); err != nil {
+			t.Errorf("Release() => got: %v, expected: nil", err)
+		}
+		if _, claimed, _ := m.Claim(rec, testTime); !claimed {
+			t.Errorf("Claim() of a released key => got: false, expected the key to be claimed")
+		}
+		if err := m.Complete(rec.Scope, "k2", 1); err == nil {
+			t.Errorf("Complete() of an unknown key => got: nil, expected an error")
+		}
+		if err := m.Release(rec.Scope, "k2"); err == nil {
+			t.Errorf("Release() of an unknown key => got: nil, expected an error")
+		}
+	})
+
+	t.Run("keys of another scope", func(t *testing.T) {
+		m := newStore(t)
+		m.Claim(rec, testTime)
+		other := rec
+		other.Scope = "email:nick@example.com"
+		if _, claimed, err := m.Claim(other, testTime); err != nil || !claimed {
+			t.Errorf("Claim() of the key in another scope => got: (%t, %v), expected the key to be claimed", claimed, err)
+		}
+		if err := m.Complete(other.Scope, other.Key, 8); err != nil {
+			t.Errorf("Complete() => got: %v, expected: nil", err)
+		}
+		if stored, _, _ := m.Claim(rec, testTime); stored.RequestID != 0 {
+			t.Errorf("Claim() => got: %v, expected the pending record of its own scope", stored)
+		}
+	})
+}
+
+// storeConcurrently calls store concurrentStores times at the same time and returns the ids
+// it returned, after checking that every one of them is different.
+func storeConcurrently(t *testing.T, store func(int) (uint64, error)) []uint64 {
+	t.Helper()
+	var wg sync.WaitGroup
+	ids := make([]uint64, concurrentStores)
+	errs := make([]error, concurrentStores)
+	for i := 0; i < concurrentStores; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], errs[i] = store(i)
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[uint64]bool)
+	for i, id := range ids {
+		if errs[i] != nil || id == 0 || seen[id] {
+			t.Errorf("Store() %d of %d at the same time => got: (%d, %v), expected a new id", i+1, concurrentStores, id, errs[i])
+		}
+		seen[id] = true
+	}
+	return ids
+}
+
+// storeUserRequest stores the user, unless they are stored already, and a request of theirs
+// with the repositories which are not nil and returns them. Without the repositories the
+// user and the request keep the ids they were given.
+func storeUserRequest(t *testing.T, users domain.UserRepository, requests domain.RequestRepository, u *domain.User, reqID uint64) *domain.UserRequest {
+	t.Helper()
+	if users != nil {
+		if _, err := users.FindByID(u.UserID); err != nil {
+			id, err := users.Store(u)
+			if err != nil {
+				t.Fatalf("UserRepository.Store() => got: %v, expected: nil", err)
+			}
+			u.UserID = id
+		}
+	}
+	r := testRequest(u.UserID, testTime.Add(2*time.Hour))
+	r.SetID(reqID)
+	if requests != nil {
+		id, err := requests.Store(r)
+		if err != nil {
+			t.Fatalf("RequestRepository.Store() => got: %v, expected: nil", err)
+		}
+		r.SetID(id)
+	}
+	return domain.NewUserRequest(u, r)
+}
+
+// testUser returns a user with the name and an email address of their own, whose id is the
+// given one until they are stored.
+func testUser(name string, id uint64) *domain.User {
+	u := domain.NewUser(name)
+	u.UserID = id
+	u.AddAddress(domain.UserAddress{AddrType: "email", Value: name + "@example.com"})
+	return u
+}
+
+// testBookingResponse returns a booking response of the user request computed at
+// computedAt, with the inputs of its strategy.
+func testBookingResponse(ur *domain.UserRequest, computedAt time.Time) *domain.CabBookingResponse {
+	cbr := domain.NewCabBookingResponse(ur, computedAt.Add(50*time.Minute))
+	cbr.Strategy = "heuristic"
+	cbr.ComputedAt = computedAt
+	cbr.Inputs = domain.BookingInputs{
+		TravelTime: []time.Duration{40 * time.Minute, 55 * time.Minute},
+		BestCase:   []time.Time{computedAt.Add(time.Hour)},
+		WorstCase:  []time.Time{computedAt.Add(45 * time.Minute)},
+	}
+	return cbr
+}
+
+func testRequest(userID uint64, reachingTime time.Time) *domain.Request {
+	r := &domain.Request{
+		Token:            "5a1f3c9e0b7d2468",
+		UserID:           userID,
+		Source:           domain.Location{Name: "home", Latitude: "12.9352", Longitude: "77.6245"},
+		Destination:      domain.Location{Latitude: "13.1986", Longitude: "77.7066"},
+		ReachingTime:     reachingTime,
+		Cab:              "uber",
+		CabType:          "uberGo",
+		NotificationAddr: domain.UserAddress{AddrType: "email", Value: "roy@example.com"},
+	}
+	r.SetStatus(domain.RequestPending, testTime)
+	return r
+}
+
+// requestsEqual returns if the requests are the same, their times may be in different
+// locations.
+func requestsEqual(a, b *domain.Request) bool {
+	return reflect.DeepEqual(inUTC(*a), inUTC(*b))
+}
+
+func inUTC(r domain.Request) domain.Request {
+	r.ReachingTime = r.ReachingTime.UTC()
+	r.TriggerTime = r.TriggerTime.UTC()
+	r.BookingTime = r.BookingTime.UTC()
+	history := make([]domain.RequestEvent, 0, len(r.History))
+	for _, e := range r.History {
+		history = append(history, domain.RequestEvent{Status: e.Status, At: e.At.UTC()})
+	}
+	r.History = history
+	return r
+}
+
+// bookingResponsesEqual returns if the booking responses are the same, with the same ids of
+// their user and request, their times may be in different locations.
+func bookingResponsesEqual(a, b *domain.CabBookingResponse) bool {
+	if a.BookingID != b.BookingID || a.Strategy != b.Strategy ||
+		!a.BestBookingTime.Equal(b.BestBookingTime) || !a.ComputedAt.Equal(b.ComputedAt) ||
+		a.User.UserID != b.User.UserID || a.Request.ID() != b.Request.ID() {
+		return false
+	}
+	return reflect.DeepEqual(a.Inputs.TravelTime, b.Inputs.TravelTime) &&
+		timesEqual(a.Inputs.BestCase, b.Inputs.BestCase) && timesEqual(a.Inputs.WorstCase, b.Inputs.WorstCase)
+}
+
+func timesEqual(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func bookingIDs(cs []*domain.CabBookingResponse) []uint64 {
+	var ids []uint64
+	for _, c := range cs {
+		ids = append(ids, c.BookingID)
+	}
+	return ids
+}
+
+func requestIDs(rs []*domain.Request) []uint64 {
+	var ids []uint64
+	for _, r := range rs {
+		ids = append(ids, r.ID())
+	}
+	return ids
+}
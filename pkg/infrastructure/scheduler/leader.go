@@ -0,0 +1,104 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// HolderKey is the logging key of the holder of a lease.
+const HolderKey = "holder"
+
+// Elector runs a function only while it holds a usecases.Lease, so that of several instances
+// of the server only one, the leader, fires the CronJobs. It renews the lease every third of
+// its ttl. When a renewal fails or the lease was taken over, the function's context is
+// cancelled, and the Elector keeps trying to acquire the lease again. An instance which dies
+// stops renewing, so another one takes over once the lease expires.
+type Elector struct {
+	lease  usecases.Lease
+	holder string
+	ttl    time.Duration
+	logger domain.Logger
+}
+
+// Run tries to acquire the lease until ctx is done and calls lead with a context which is
+// cancelled when the lease is lost. The lease is released when ctx is done.
+func (e *Elector) Run(ctx context.Context, lead func(context.Context)) {
+	interval := e.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer func() {
+		if err := e.lease.Release(e.holder); err != nil {
+			e.logger.Error("Elector couldn't release lease", domain.NewField(domain.ErrorKey, err))
+		}
+	}()
+
+	// stepDown is set while leading, it cancels lead's context and waits for it to return
+	var stepDown func()
+	defer func() {
+		if stepDown != nil {
+			stepDown()
+		}
+	}()
+
+	for {
+		ok, err := e.lease.Acquire(e.holder, e.ttl)
+		if err != nil {
+			e.logger.Warn("Elector couldn't acquire lease", domain.NewField(domain.ErrorKey, err))
+		}
+		switch {
+		case ok && stepDown == nil:
+			e.logger.Info("Elector became the leader")
+			stepDown = e.startLeading(ctx, lead)
+		case !ok && stepDown != nil:
+			e.logger.Warn("Elector lost the lease, stepping down")
+			stepDown()
+			stepDown = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// startLeading calls lead in a new goroutine and returns the function which stops it.
+func (e *Elector) startLeading(ctx context.Context, lead func(context.Context)) func() {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lead(leaderCtx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// DefaultHolder returns a holder name which is unique among the processes of a host.
+func DefaultHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// NewElector is a constructor which takes the Lease, the name of the holder, the ttl of the
+// lease and a Logger and returns a pointer to a new Elector.
+func NewElector(l usecases.Lease, holder string, ttl time.Duration, logger domain.Logger) *Elector {
+	e := Elector{
+		lease:  l,
+		holder: holder,
+		ttl:    ttl,
+		logger: logger.With(domain.NewField(HolderKey, holder)),
+	}
+	return &e
+}
@@ -0,0 +1,91 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// MockLease implements the usecases.Lease interface in memory, leases don't expire.
+type MockLease struct {
+	mu     sync.Mutex
+	holder string
+}
+
+func (l *MockLease) Acquire(holder string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder == "" {
+		l.holder = holder
+	}
+	return l.holder == holder, nil
+}
+
+func (l *MockLease) Release(holder string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder == holder {
+		l.holder = ""
+	}
+	return nil
+}
+
+func (l *MockLease) Steal(holder string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.holder = holder
+}
+
+func TestElectorFailsOver(t *testing.T) {
+	l := &MockLease{}
+	leading := make(chan string, 4)
+	stepped := make(chan string, 4)
+	lead := func(name string) func(context.Context) {
+		return func(ctx context.Context) {
+			leading <- name
+			<-ctx.Done()
+			stepped <- name
+		}
+	}
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	go NewElector(l, "a", 30*time.Millisecond, &MockLogger{}).Run(ctxA, lead("a"))
+	if got := <-leading; got != "a" {
+		t.Fatalf("leader => got: %s, expected: a", got)
+	}
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	go NewElector(l, "b", 30*time.Millisecond, &MockLogger{}).Run(ctxB, lead("b"))
+	select {
+	case got := <-leading:
+		t.Fatalf("second leader => got: %s, expected none while a holds the lease", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// a shuts down and releases the lease, b takes over
+	cancelA()
+	if got := <-stepped; got != "a" {
+		t.Errorf("stepped down => got: %s, expected: a", got)
+	}
+	select {
+	case got := <-leading:
+		if got != "b" {
+			t.Errorf("leader after failover => got: %s, expected: b", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("b never became the leader")
+	}
+
+	// b loses the lease to someone else and steps down
+	l.Steal("c")
+	select {
+	case got := <-stepped:
+		if got != "b" {
+			t.Errorf("stepped down => got: %s, expected: b", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("b never stepped down after losing the lease")
+	}
+}
@@ -0,0 +1,353 @@
+// package scheduler has an implementation of the usecases.CronEngine interface which keeps
+// its CronJobs in a usecases.ScheduleStore, so that the schedule survives a restart.
+//
+// When several instances of the server share a ScheduleStore, only one of them should fire
+// the CronJobs. The Elector runs the Scheduler of the instance which holds a usecases.Lease.
+// The other instances only write the CronJobs they add or cancel to the ScheduleStore, and the
+// running Scheduler reloads the shared schedule every ReloadInterval to pick them up.
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// RetryDelay is how long a CronJob waits before it is fired again when its job couldn't be
+// added to the AppEngine.
+var RetryDelay = 5 * time.Second
+
+// ReloadInterval is how often a running Scheduler reloads its schedule from the ScheduleStore,
+// to fire the CronJobs which other instances added, and not the ones they cancelled.
+var ReloadInterval = time.Second
+
+// CronIDKey is the logging key of the id of a CronJob.
+const CronIDKey = "cron_id"
+
+// entry is a CronJob in the Scheduler's min heap.
+type entry struct {
+	cj    usecases.CronJob
+	at    time.Time
+	index int
+}
+
+// entryHeap is a min heap of entries ordered by the time they are fired at.
+type entryHeap []*entry
+
+func (h entryHeap) Len() int { return len(h) }
+
+func (h entryHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].cj.ID < h[j].cj.ID
+	}
+	return h[i].at.Before(h[j].at)
+}
+
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *entryHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*h = old[:n-1]
+	return e
+}
+
+// Scheduler implements the usecases.CronEngine interface. It keeps the CronJobs in a min
+// heap ordered by their time, and a single timer set to the earliest one. Every CronJob is
+// written to the ScheduleStore before Add returns, and removed from it only after its job was
+// added to the AppEngine of its type, so a CronJob is fired at least once.
+type Scheduler struct {
+	store   usecases.ScheduleStore
+	codec   *usecases.JobCodec
+	engines map[string]usecases.AppEngine
+	catchUp usecases.CatchUpPolicy
+	logger  domain.Logger
+
+	mu      sync.Mutex
+	entries entryHeap
+	byID    map[uint64]*entry
+	wake    chan struct{}
+}
+
+// Add schedules the job to be added to the AppEngine of its type at the given time and
+// returns the id of the CronJob.
+func (s *Scheduler) Add(at time.Time, job usecases.Job) (uint64, error) {
+	if _, ok := s.engines[job.Type()]; !ok {
+		return 0, errors.Errorf("Scheduler has no AppEngine for job type %s", job.Type())
+	}
+	d, err := s.codec.Encode(job)
+	if err != nil {
+		return 0, errors.Wrap(err, "Scheduler couldn't encode job")
+	}
+	cj := usecases.CronJob{At: at, Job: d}
+	cj.ID, err = s.store.Add(cj)
+	if err != nil {
+		return 0, errors.Wrap(err, "Scheduler couldn't store CronJob")
+	}
+
+	s.mu.Lock()
+	s.push(cj)
+	s.mu.Unlock()
+	s.notify()
+	return cj.ID, nil
+}
+
+// Cancel removes the CronJob with the given id from the schedule. The CronJob is looked up
+// in the ScheduleStore, so that it may have been added by another instance.
+func (s *Scheduler) Cancel(id uint64) error {
+	return s.cancel(func(cj usecases.CronJob) bool {
+		return cj.ID == id
+	}, errors.Errorf("Scheduler has no CronJob with id %d", id))
+}
+
+// CancelRequest removes all the CronJobs of the request from the schedule.
+func (s *Scheduler) CancelRequest(reqID uint64) error {
+	return s.cancel(func(cj usecases.CronJob) bool {
+		return cj.Job.RequestID == reqID
+	}, nil)
+}
+
+// cancel removes the CronJobs which match from the ScheduleStore and the heap, or returns
+// notFound when none did.
+func (s *Scheduler) cancel(match func(usecases.CronJob) bool, notFound error) error {
+	cjs, err := s.store.List()
+	if err != nil {
+		return errors.Wrap(err, "Scheduler couldn't load CronJobs from ScheduleStore")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := false
+	for _, cj := range cjs {
+		if !match(cj) {
+			continue
+		}
+		found = true
+		if err = s.store.Remove(cj.ID); err != nil {
+			return errors.Wrapf(err, "Scheduler couldn't remove CronJob %d from ScheduleStore", cj.ID)
+		}
+		s.drop(cj.ID)
+	}
+	if !found {
+		return notFound
+	}
+	return nil
+}
+
+// Pending returns the scheduled CronJobs, earliest first.
+func (s *Scheduler) Pending() []usecases.CronJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make(entryHeap, len(s.entries))
+	copy(entries, s.entries)
+	sort.Slice(entries, entries.Less)
+	cjs := make([]usecases.CronJob, 0, len(entries))
+	for _, e := range entries {
+		cjs = append(cjs, e.cj)
+	}
+	return cjs
+}
+
+// Run fires the CronJobs when they are due until ctx is done. It first loads the schedule
+// again from the ScheduleStore, so that an instance which becomes the leader fires the
+// CronJobs the other instances added to a shared ScheduleStore.
+func (s *Scheduler) Run(ctx context.Context) {
+	if err := s.load(false); err != nil {
+		s.logger.Error("Scheduler couldn't reload its schedule", domain.NewField(domain.ErrorKey, err))
+	}
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	reload := time.NewTicker(ReloadInterval)
+	defer reload.Stop()
+	for {
+		for _, cj := range s.due(time.Now()) {
+			s.fire(cj)
+		}
+
+		s.mu.Lock()
+		wait := time.Hour
+		if len(s.entries) > 0 {
+			wait = time.Until(s.entries[0].at)
+		}
+		s.mu.Unlock()
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		case <-timer.C:
+		case <-reload.C:
+			if err := s.load(false); err != nil {
+				s.logger.Error("Scheduler couldn't reload its schedule", domain.NewField(domain.ErrorKey, err))
+			}
+		}
+	}
+}
+
+// due pops the CronJobs which are due at now.
+func (s *Scheduler) due(now time.Time) []usecases.CronJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var cjs []usecases.CronJob
+	for len(s.entries) > 0 && !s.entries[0].at.After(now) {
+		e := heap.Pop(&s.entries).(*entry)
+		delete(s.byID, e.cj.ID)
+		cjs = append(cjs, e.cj)
+	}
+	return cjs
+}
+
+// fire adds the CronJob's job to the AppEngine of its type and removes the CronJob from the
+// ScheduleStore. A CronJob whose job couldn't be added is fired again after RetryDelay.
+func (s *Scheduler) fire(cj usecases.CronJob) {
+	logger := s.logger.With(
+		domain.NewField(CronIDKey, cj.ID),
+		domain.NewField(domain.JobTypeKey, cj.Job.Type),
+		domain.NewField(domain.RequestIDKey, cj.Job.RequestID),
+	)
+	job, err := s.codec.Decode(cj.Job)
+	if err != nil {
+		// a CronJob which can't be decoded never will be, keeping it only blocks a restart
+		logger.Error("Scheduler dropped CronJob which couldn't be decoded", domain.NewField(domain.ErrorKey, err))
+		s.forget(cj.ID, logger)
+		return
+	}
+	err = s.engines[cj.Job.Type].AddJob(job)
+	if err != nil {
+		logger.Warn("Scheduler couldn't add job to AppEngine, will fire again", domain.NewField(domain.ErrorKey, err))
+		s.mu.Lock()
+		s.pushAt(cj, time.Now().Add(RetryDelay))
+		s.mu.Unlock()
+		return
+	}
+	logger.Debug("Scheduler fired CronJob", domain.NewField("due", cj.At))
+	s.forget(cj.ID, logger)
+}
+
+func (s *Scheduler) forget(id uint64, logger domain.Logger) {
+	if err := s.store.Remove(id); err != nil {
+		logger.Error("Scheduler couldn't remove CronJob from ScheduleStore", domain.NewField(domain.ErrorKey, err))
+	}
+}
+
+func (s *Scheduler) push(cj usecases.CronJob) {
+	if _, ok := s.byID[cj.ID]; ok {
+		// already loaded from the ScheduleStore
+		return
+	}
+	s.pushAt(cj, cj.At)
+}
+
+func (s *Scheduler) pushAt(cj usecases.CronJob, at time.Time) {
+	e := &entry{cj: cj, at: at}
+	heap.Push(&s.entries, e)
+	s.byID[cj.ID] = e
+}
+
+// drop removes the CronJob from the heap, if it is there.
+func (s *Scheduler) drop(id uint64) {
+	e, ok := s.byID[id]
+	if !ok {
+		return
+	}
+	heap.Remove(&s.entries, e.index)
+	delete(s.byID, id)
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// load brings the schedule in line with the CronJobs in the ScheduleStore. The CronJobs which
+// are no longer stored, as another instance cancelled them, are dropped, and the ones which
+// are new are added. With catchUp, the ones which are overdue, as they became due while the
+// Scheduler was not running, are kept or dropped according to the CatchUpPolicy. Without,
+// overdue CronJobs are the ones another instance didn't get to fire, and they are all kept.
+// CronJobs already in the heap keep their time, which may have been put off by a retry.
+func (s *Scheduler) load(catchUp bool) error {
+	cjs, err := s.store.List()
+	if err != nil {
+		return errors.Wrap(err, "Scheduler couldn't load CronJobs from ScheduleStore")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := make(map[uint64]bool, len(cjs))
+	for _, cj := range cjs {
+		stored[cj.ID] = true
+	}
+	for id := range s.byID {
+		if !stored[id] {
+			s.drop(id)
+		}
+	}
+	now := time.Now()
+	var overdue, dropped int
+	for _, cj := range cjs {
+		if catchUp && cj.At.Before(now) {
+			overdue++
+			if !s.catchUp.ShouldFire(cj.At, now) {
+				dropped++
+				s.forget(cj.ID, s.logger.With(domain.NewField(CronIDKey, cj.ID)))
+				continue
+			}
+		}
+		s.push(cj)
+	}
+	if overdue > 0 {
+		s.logger.Warn("Scheduler found overdue CronJobs",
+			domain.NewField("overdue", overdue),
+			domain.NewField("dropped", dropped),
+		)
+	}
+	return nil
+}
+
+// NewScheduler is a constructor which takes the ScheduleStore, the JobCodec, the AppEngines
+// by job type, the CatchUpPolicy and a Logger and returns a pointer to a new Scheduler. The
+// CronJobs found in the ScheduleStore are loaded, the ones which became due while the
+// Scheduler was not running are kept or dropped according to the CatchUpPolicy.
+func NewScheduler(store usecases.ScheduleStore, codec *usecases.JobCodec, engines map[string]usecases.AppEngine, catchUp usecases.CatchUpPolicy, logger domain.Logger) (*Scheduler, error) {
+	s := Scheduler{
+		store:   store,
+		codec:   codec,
+		engines: engines,
+		catchUp: catchUp,
+		logger:  logger,
+		byID:    make(map[uint64]*entry),
+		wake:    make(chan struct{}, 1),
+	}
+	err := s.load(true)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
@@ -0,0 +1,313 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/jobstore"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// MockLogger implements the domain.Logger interface and drops every line.
+type MockLogger struct{}
+
+func (l *MockLogger) Debug(m string, fields ...domain.Field)    {}
+func (l *MockLogger) Info(m string, fields ...domain.Field)     {}
+func (l *MockLogger) Warn(m string, fields ...domain.Field)     {}
+func (l *MockLogger) Error(m string, fields ...domain.Field)    {}
+func (l *MockLogger) With(fields ...domain.Field) domain.Logger { return l }
+
+// MockScheduleStore implements the usecases.ScheduleStore interface in memory.
+type MockScheduleStore struct {
+	mu     sync.Mutex
+	lastID uint64
+	cjs    map[uint64]usecases.CronJob
+}
+
+func NewMockScheduleStore(cjs ...usecases.CronJob) *MockScheduleStore {
+	s := &MockScheduleStore{cjs: make(map[uint64]usecases.CronJob)}
+	for _, cj := range cjs {
+		s.Add(cj)
+	}
+	return s
+}
+
+func (s *MockScheduleStore) Add(cj usecases.CronJob) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	cj.ID = s.lastID
+	s.cjs[cj.ID] = cj
+	return cj.ID, nil
+}
+
+func (s *MockScheduleStore) Remove(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cjs, id)
+	return nil
+}
+
+func (s *MockScheduleStore) List() ([]usecases.CronJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var cjs []usecases.CronJob
+	for _, cj := range s.cjs {
+		cjs = append(cjs, cj)
+	}
+	sort.Slice(cjs, func(i, j int) bool { return cjs[i].ID < cjs[j].ID })
+	return cjs, nil
+}
+
+func (s *MockScheduleStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.cjs)
+}
+
+// MockAppEngine records the request ids of the jobs added to it, the first fail calls
+// return an error.
+type MockAppEngine struct {
+	mu    sync.Mutex
+	fail  int
+	added chan uint64
+}
+
+func (a *MockAppEngine) AddJob(j usecases.Job) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.fail > 0 {
+		a.fail--
+		return errors.New("job queue is full")
+	}
+	a.added <- j.RequestID()
+	return nil
+}
+
+func testNotificationJob(reqID uint64) *usecases.NotificationJob {
+	r := &domain.Request{
+		Source:           domain.Location{Latitude: "77.134134", Longitude: "45.1341324"},
+		Destination:      domain.Location{Latitude: "77.234134", Longitude: "45.5641324"},
+		ReachingTime:     time.Date(2018, time.March, 9, 10, 0, 0, 0, time.UTC),
+		Cab:              "uber",
+		CabType:          "uberGo",
+		NotificationAddr: domain.UserAddress{AddrType: "email", Value: "anirban.nick@gmail.com"},
+	}
+	r.SetID(reqID)
+	ur := domain.NewUserRequest(domain.NewUser("roy"), r)
+	cbr := domain.NewCabBookingResponse(ur, time.Date(2018, time.March, 9, 9, 10, 0, 0, time.UTC))
+	return usecases.NewNotificationJob(cbr, nil)
+}
+
+func testCronJob(t *testing.T, codec *usecases.JobCodec, reqID uint64, at time.Time) usecases.CronJob {
+	t.Helper()
+	d, err := codec.Encode(testNotificationJob(reqID))
+	if err != nil {
+		t.Fatalf("Encode() => got: %v, expected: nil", err)
+	}
+	return usecases.CronJob{At: at, Job: d}
+}
+
+func testScheduler(t *testing.T, store usecases.ScheduleStore, a usecases.AppEngine, catchUp usecases.CatchUpPolicy) *Scheduler {
+	t.Helper()
+	codec := usecases.NewJobCodec(nil, nil, nil, nil, nil, nil)
+	engines := map[string]usecases.AppEngine{usecases.NotificationJobType: a}
+	s, err := NewScheduler(store, codec, engines, catchUp, &MockLogger{})
+	if err != nil {
+		t.Fatalf("NewScheduler() => got: %v, expected: nil", err)
+	}
+	return s
+}
+
+func expectFired(t *testing.T, a *MockAppEngine, reqID uint64) {
+	t.Helper()
+	select {
+	case got := <-a.added:
+		if got != reqID {
+			t.Errorf("fired job => got request: %d, expected: %d", got, reqID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("job of request %d was never fired", reqID)
+	}
+}
+
+func TestSchedulerFiresInTimeOrder(t *testing.T) {
+	store := NewMockScheduleStore()
+	a := &MockAppEngine{added: make(chan uint64, 3)}
+	s := testScheduler(t, store, a, usecases.CatchUpPolicy{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	now := time.Now()
+	s.Add(now.Add(200*time.Millisecond), testNotificationJob(2))
+	s.Add(now.Add(50*time.Millisecond), testNotificationJob(1))
+	expectFired(t, a, 1)
+	expectFired(t, a, 2)
+
+	time.Sleep(20 * time.Millisecond)
+	if store.Len() != 0 {
+		t.Errorf("ScheduleStore after firing => got %d CronJobs, expected: 0", store.Len())
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	store := NewMockScheduleStore()
+	a := &MockAppEngine{added: make(chan uint64, 3)}
+	s := testScheduler(t, store, a, usecases.CatchUpPolicy{})
+
+	at := time.Now().Add(100 * time.Millisecond)
+	id, _ := s.Add(at, testNotificationJob(1))
+	s.Add(at, testNotificationJob(2))
+	s.Add(at, testNotificationJob(2))
+	s.Add(at.Add(50*time.Millisecond), testNotificationJob(3))
+
+	if err := s.Cancel(id); err != nil {
+		t.Errorf("Cancel() => got: %v, expected: nil", err)
+	}
+	if err := s.Cancel(id); err == nil {
+		t.Errorf("Cancel() of a cancelled CronJob => got: nil, expected an error")
+	}
+	if err := s.CancelRequest(2); err != nil {
+		t.Errorf("CancelRequest() => got: %v, expected: nil", err)
+	}
+	if pending := s.Pending(); len(pending) != 1 || pending[0].Job.RequestID != 3 {
+		t.Errorf("Pending() => got: %+v, expected only the CronJob of request 3", pending)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	expectFired(t, a, 3)
+	time.Sleep(20 * time.Millisecond)
+	if store.Len() != 0 {
+		t.Errorf("ScheduleStore after cancelling => got %d CronJobs, expected: 0", store.Len())
+	}
+}
+
+func TestSchedulerCatchUp(t *testing.T) {
+	codec := usecases.NewJobCodec(nil, nil, nil, nil, nil, nil)
+	now := time.Now()
+
+	testCases := []struct {
+		name     string
+		policy   usecases.CatchUpPolicy
+		expected []uint64
+	}{
+		{name: "fire all", policy: usecases.CatchUpPolicy{Mode: usecases.CatchUpFireAll}, expected: []uint64{1, 2, 3}},
+		{name: "skip", policy: usecases.CatchUpPolicy{Mode: usecases.CatchUpSkip}, expected: []uint64{3}},
+		{name: "within window", policy: usecases.CatchUpPolicy{Mode: usecases.CatchUpWithinWindow, Window: time.Hour}, expected: []uint64{2, 3}},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			// CronJobs left over from before a restart
+			store := NewMockScheduleStore(
+				testCronJob(t, codec, 1, now.Add(-3*time.Hour)),
+				testCronJob(t, codec, 2, now.Add(-time.Minute)),
+				testCronJob(t, codec, 3, now.Add(time.Hour)),
+			)
+			s := testScheduler(t, store, &MockAppEngine{}, tc.policy)
+
+			var got []uint64
+			for _, cj := range s.Pending() {
+				got = append(got, cj.Job.RequestID)
+			}
+			if len(got) != len(tc.expected) {
+				t.Fatalf("Pending() after restart => got requests: %v, expected: %v", got, tc.expected)
+			}
+			for i := range got {
+				if got[i] != tc.expected[i] {
+					t.Errorf("Pending() after restart => got requests: %v, expected: %v", got, tc.expected)
+				}
+			}
+			if store.Len() != len(tc.expected) {
+				t.Errorf("ScheduleStore after restart => got %d CronJobs, expected: %d", store.Len(), len(tc.expected))
+			}
+		})
+	}
+}
+
+func TestSchedulerRetriesWhenAppEngineFails(t *testing.T) {
+	defer func(d time.Duration) { RetryDelay = d }(RetryDelay)
+	RetryDelay = 20 * time.Millisecond
+
+	store := NewMockScheduleStore()
+	a := &MockAppEngine{fail: 2, added: make(chan uint64, 1)}
+	s := testScheduler(t, store, a, usecases.CatchUpPolicy{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	s.Add(time.Now(), testNotificationJob(7))
+	expectFired(t, a, 7)
+}
+
+func TestSchedulerRejectsUnknownJobType(t *testing.T) {
+	s := testScheduler(t, NewMockScheduleStore(), &MockAppEngine{}, usecases.CatchUpPolicy{})
+	_, err := s.Add(time.Now(), &usecases.CabRequestJob{})
+	if err == nil {
+		t.Errorf("Add() of a job without an AppEngine => got: nil, expected an error")
+	}
+}
+
+func TestSchedulerReloadsSharedScheduleWhenRun(t *testing.T) {
+	store := NewMockScheduleStore()
+	leader := testScheduler(t, store, &MockAppEngine{}, usecases.CatchUpPolicy{})
+	a := &MockAppEngine{added: make(chan uint64, 1)}
+	standby := testScheduler(t, store, a, usecases.CatchUpPolicy{Mode: usecases.CatchUpSkip})
+
+	// the CronJob is added through the leader, which dies before it is due
+	leader.Add(time.Now().Add(20*time.Millisecond), testNotificationJob(4))
+	time.Sleep(40 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go standby.Run(ctx)
+	expectFired(t, a, 4)
+}
+
+func TestSchedulerFiresCronJobsOfSharedFileScheduleStore(t *testing.T) {
+	defer func(d time.Duration) { ReloadInterval = d }(ReloadInterval)
+	ReloadInterval = 20 * time.Millisecond
+
+	// two instances of the server with the same schedule file
+	path := filepath.Join(t.TempDir(), "schedule.log")
+	leaderStore, err := jobstore.OpenFileScheduleStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileScheduleStore() => got: %v, expected: nil", err)
+	}
+	defer leaderStore.Close()
+	followerStore, err := jobstore.OpenFileScheduleStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileScheduleStore() => got: %v, expected: nil", err)
+	}
+	defer followerStore.Close()
+	a := &MockAppEngine{added: make(chan uint64, 3)}
+	leader := testScheduler(t, leaderStore, a, usecases.CatchUpPolicy{})
+	follower := testScheduler(t, followerStore, &MockAppEngine{}, usecases.CatchUpPolicy{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go leader.Run(ctx)
+
+	now := time.Now()
+	id, _ := leader.Add(now.Add(150*time.Millisecond), testNotificationJob(1))
+	follower.Add(now.Add(200*time.Millisecond), testNotificationJob(2))
+	if err = follower.Cancel(id); err != nil {
+		t.Errorf("Cancel() of the leader's CronJob => got: %v, expected: nil", err)
+	}
+	expectFired(t, a, 2)
+	select {
+	case got := <-a.added:
+		t.Errorf("fired job => got request: %d, expected none", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
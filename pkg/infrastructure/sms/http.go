@@ -0,0 +1,127 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// DefaultTimeout bounds the post of a message to the gateway, which queues it and answers
+// before it is delivered.
+const DefaultTimeout = 10 * time.Second
+
+var (
+	// ErrUnauthorized is returned when the gateway rejects the credentials.
+	ErrUnauthorized = errors.New("sms gateway request unauthorized")
+	// ErrRateLimited is returned when the account sent too many messages.
+	ErrRateLimited = errors.New("sms gateway rate limit exceeded")
+	// ErrRejected is returned when the gateway rejects the message, like for a number it
+	// can't send to.
+	ErrRejected = errors.New("sms rejected by gateway")
+)
+
+// HTTPConfig holds the account of an SMS gateway. The messages are posted to URL, like
+// https://api.twilio.com/2010-04-01/Accounts/<account sid>/Messages.json, from the number or
+// sender id From, both must be set. A gateway which wants basic auth gets Username and
+// Password, the account sid and auth token with Twilio. Timeout replaces DefaultTimeout and
+// Client, if it is set, replaces http.DefaultClient.
+type HTTPConfig struct {
+	URL      string
+	From     string
+	Username string
+	Password string
+
+	Timeout time.Duration
+	Client  *http.Client
+}
+
+// HTTPProvider implements the Provider interface with the HTTP API of an SMS gateway which
+// takes the messages as forms, like Twilio.
+type HTTPProvider struct {
+	url      string
+	from     string
+	username string
+	password string
+	timeout  time.Duration
+	client   *http.Client
+}
+
+// errorResponse is the body of the responses of the gateway to the messages it rejects.
+type errorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// SendSMS posts the message to the gateway as the form fields To, From and Body.
+func (p *HTTPProvider) SendSMS(ctx context.Context, to, body string) error {
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("From", p.from)
+	form.Set("Body", body)
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return domain.NewPermanentError(errors.Wrap(err, "couldn't make sms request"))
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.username != "" {
+		req.SetBasicAuth(p.username, p.password)
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "sms request failed")
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return nil
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return domain.NewPermanentError(errors.Wrap(ErrUnauthorized, "sms request failed"))
+	case res.StatusCode == http.StatusTooManyRequests:
+		return errors.Wrap(ErrRateLimited, "sms request failed")
+	case res.StatusCode >= 500:
+		return errors.Errorf("sms request failed with HTTP status %d", res.StatusCode)
+	}
+	var e errorResponse
+	json.NewDecoder(io.LimitReader(res.Body, 1<<16)).Decode(&e)
+	return domain.NewPermanentError(errors.Wrapf(ErrRejected, "HTTP status %d, code %d: %s", res.StatusCode, e.Code, e.Message))
+}
+
+// NewHTTPProvider is a constructor which takes the HTTPConfig of the HTTPProvider and
+// returns a pointer to a new HTTPProvider, or an error if the HTTPConfig has no URL or no
+// From.
+func NewHTTPProvider(c HTTPConfig) (*HTTPProvider, error) {
+	if c.URL == "" {
+		return nil, errors.New("sms provider needs the url of the gateway")
+	}
+	if c.From == "" {
+		return nil, errors.New("sms provider needs the number messages are sent from")
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	p := HTTPProvider{
+		url:      c.URL,
+		from:     c.From,
+		username: c.Username,
+		password: c.Password,
+		timeout:  c.Timeout,
+		client:   c.Client,
+	}
+	return &p, nil
+}
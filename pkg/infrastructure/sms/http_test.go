@@ -0,0 +1,119 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// stubGateway is a local stand-in of a Twilio-style SMS gateway. It takes the messages of
+// the account "AC123" with the token "token", from +15005550006 to numbers which are not
+// +15005550001, and answers with status when it is set.
+type stubGateway struct {
+	mu       sync.Mutex
+	messages []url.Values
+	status   int
+}
+
+func (s *stubGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if user, pass, _ := r.BasicAuth(); user != "AC123" || pass != "token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"code": 20003, "message": "Authenticate", "status": 401}`)
+		return
+	}
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	r.ParseForm()
+	if r.PostForm.Get("To") == "+15005550001" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"code": 21211, "message": "The 'To' number +15005550001 is not a valid phone number.", "status": 400}`)
+		return
+	}
+	s.messages = append(s.messages, r.PostForm)
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, `{"sid": "SM%d", "status": "queued"}`, len(s.messages))
+}
+
+func testHTTPProvider(t *testing.T, s *stubGateway, password string) *HTTPProvider {
+	t.Helper()
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	p, err := NewHTTPProvider(HTTPConfig{
+		URL:      srv.URL + "/2010-04-01/Accounts/AC123/Messages.json",
+		From:     "+15005550006",
+		Username: "AC123",
+		Password: password,
+		Client:   srv.Client(),
+	})
+	if err != nil {
+		t.Fatalf("NewHTTPProvider() => got: %v, expected: nil", err)
+	}
+	return p
+}
+
+func TestHTTPProviderSendSMS(t *testing.T) {
+	s := &stubGateway{}
+	p := testHTTPProvider(t, s, "token")
+	if err := p.SendSMS(context.Background(), "+919876543210", "Time to book your uberGo"); err != nil {
+		t.Fatalf("SendSMS() => got: %v, expected: nil", err)
+	}
+	if len(s.messages) != 1 {
+		t.Fatalf("SendSMS() => got: %d messages, expected: 1", len(s.messages))
+	}
+	m := s.messages[0]
+	if m.Get("To") != "+919876543210" || m.Get("From") != "+15005550006" || m.Get("Body") != "Time to book your uberGo" {
+		t.Errorf("SendSMS() => got: %v, expected the number, sender and body", m)
+	}
+
+	testCases := []struct {
+		to        string
+		status    int
+		expected  error
+		permanent bool
+	}{
+		{"+15005550001", 0, ErrRejected, true},
+		{"+919876543210", http.StatusTooManyRequests, ErrRateLimited, false},
+	}
+	for i, _ := range testCases {
+		s.status = testCases[i].status
+		err := p.SendSMS(context.Background(), testCases[i].to, "Time to book your uberGo")
+		if errors.Cause(err) != testCases[i].expected || domain.IsPermanent(err) != testCases[i].permanent {
+			t.Errorf("case %d: SendSMS() => got: %v, expected: %v, permanent %v", i, err, testCases[i].expected, testCases[i].permanent)
+		}
+	}
+	s.status = http.StatusServiceUnavailable
+	if err := p.SendSMS(context.Background(), "+919876543210", "Time to book your uberGo"); err == nil || domain.IsPermanent(err) {
+		t.Errorf("SendSMS() answered with 503 => got: %v, expected an error which isn't permanent", err)
+	}
+
+	p = testHTTPProvider(t, &stubGateway{}, "wrong")
+	if err := p.SendSMS(context.Background(), "+919876543210", "Time to book your uberGo"); errors.Cause(err) != ErrUnauthorized || !domain.IsPermanent(err) {
+		t.Errorf("SendSMS() with a wrong token => got: %v, expected: permanent %v", err, ErrUnauthorized)
+	}
+}
+
+func TestNewHTTPProvider(t *testing.T) {
+	testCases := []HTTPConfig{
+		{From: "+15005550006"},
+		{URL: "https://api.twilio.com/2010-04-01/Accounts/AC123/Messages.json"},
+	}
+	for i, _ := range testCases {
+		if _, err := NewHTTPProvider(testCases[i]); err == nil {
+			t.Errorf("case %d: NewHTTPProvider(%+v) => got: nil, expected an error", i, testCases[i])
+		}
+	}
+}
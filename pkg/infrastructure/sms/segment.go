@@ -0,0 +1,44 @@
+package sms
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// GSM7Limit is how many characters of the GSM 7-bit alphabet one SMS segment holds.
+	GSM7Limit = 160
+	// UCS2Limit is how many UTF-16 code units one SMS segment holds, the encoding of a
+	// message with a character outside the GSM 7-bit alphabet.
+	UCS2Limit = 70
+)
+
+// gsm7 is the GSM 7-bit default alphabet, without its escape to gsm7Ext, the extension
+// table whose characters take two septets.
+const (
+	gsm7    = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Ext = "\f^{}\\[~]|€"
+)
+
+// Length returns the length of the message in the encoding it is sent in, and the limit of
+// one segment of that encoding. The encoding is GSM 7-bit if all the characters of the
+// message are in its alphabet and UCS-2 otherwise.
+func Length(msg string) (n, limit int) {
+	for _, r := range msg {
+		switch {
+		case strings.ContainsRune(gsm7, r):
+			n++
+		case strings.ContainsRune(gsm7Ext, r):
+			n += 2
+		default:
+			return len(utf16.Encode([]rune(msg))), UCS2Limit
+		}
+	}
+	return n, GSM7Limit
+}
+
+// FitsSegment returns if the message is sent as one SMS segment.
+func FitsSegment(msg string) bool {
+	n, limit := Length(msg)
+	return n <= limit
+}
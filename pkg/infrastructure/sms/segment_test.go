@@ -0,0 +1,49 @@
+package sms
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLength(t *testing.T) {
+	testCases := []struct {
+		msg   string
+		n     int
+		limit int
+	}{
+		{"Book your uberGo at 6:43 PM", 27, GSM7Limit},
+		// the characters of the extension table take two
+		{"{uberGo} ~ 100€", 19, GSM7Limit},
+		{"Café Ørsted", 11, GSM7Limit},
+		// a character outside the alphabet makes it UCS-2
+		{"Book at कोरमंगला", 16, UCS2Limit},
+		// a character outside the basic plane takes two code units
+		{"Book 🚕", 7, UCS2Limit},
+	}
+
+	for i, _ := range testCases {
+		n, limit := Length(testCases[i].msg)
+		if n != testCases[i].n || limit != testCases[i].limit {
+			t.Errorf("case %d: Length(%q) => got: %d, %d, expected: %d, %d", i, testCases[i].msg, n, limit, testCases[i].n, testCases[i].limit)
+		}
+	}
+}
+
+func TestFitsSegment(t *testing.T) {
+	testCases := []struct {
+		msg      string
+		expected bool
+	}{
+		{strings.Repeat("a", 160), true},
+		{strings.Repeat("a", 161), false},
+		{strings.Repeat("a", 159) + "€", false},
+		{strings.Repeat("क", 70), true},
+		{strings.Repeat("क", 71), false},
+	}
+
+	for i, _ := range testCases {
+		if got := FitsSegment(testCases[i].msg); got != testCases[i].expected {
+			t.Errorf("case %d: FitsSegment() of %d characters => got: %v, expected: %v", i, len([]rune(testCases[i].msg)), got, testCases[i].expected)
+		}
+	}
+}
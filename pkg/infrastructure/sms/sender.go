@@ -0,0 +1,107 @@
+// package sms has an implementation of the domain.NotificationService interface which texts
+// the booking time of a request to the phone number of its notification address.
+//
+// The messages are sent by a Provider, like HTTPProvider which posts them to the HTTP API
+// of an SMS gateway the way Twilio takes them. A message is kept within one SMS segment, a
+// destination whose name is too long is shortened or given by its coordinates instead.
+package sms
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// AddrType is the type of the notification addresses the Sender sends to.
+const AddrType = "sms"
+
+// timeLayout is the layout of the times of a message.
+const timeLayout = "Mon 2 Jan 3:04 PM MST"
+
+// Provider sends a text message to a phone number in E.164 format. Its errors which are
+// not worth retrying, like a rejected number, are domain permanent errors.
+type Provider interface {
+	SendSMS(ctx context.Context, to, body string) error
+}
+
+// Config gives a Sender the Provider it texts through, which must be set, and the Location
+// the times of its messages are written in, UTC if it is nil. A message has no room for the
+// zone of the user, so Location is best the zone of the city the app serves.
+type Config struct {
+	Provider Provider
+	Location *time.Location
+}
+
+// Sender implements the domain.NotificationService interface by texting the booking
+// responses through a Provider.
+type Sender struct {
+	provider Provider
+	location *time.Location
+}
+
+// Send texts the booking time of the booking response to the phone number of its
+// notification address.
+func (s *Sender) Send(ctx context.Context, c *domain.CabBookingResponse) error {
+	if c.NotificationAddr.AddrType != AddrType {
+		return domain.NewPermanentError(errors.Errorf("sms sender can't send to address type %q", c.NotificationAddr.AddrType))
+	}
+	return s.provider.SendSMS(ctx, c.NotificationAddr.Value, compose(c, s.location))
+}
+
+// SendConfirmation texts the code which confirms the phone number to it.
+func (s *Sender) SendConfirmation(ctx context.Context, a domain.UserAddress, code string) error {
+	if a.AddrType != AddrType {
+		return domain.NewPermanentError(errors.Errorf("sms sender can't send to address type %q", a.AddrType))
+	}
+	return s.provider.SendSMS(ctx, a.Value, "uberNow: your confirmation code is "+code)
+}
+
+// compose returns the message of the booking response, with its times in loc, which fits
+// in one segment. The name of the destination is shortened until it fits, and replaced by
+// its coordinates if it can't be.
+func compose(c *domain.CabBookingResponse, loc *time.Location) string {
+	bookAt := c.BestBookingTime.In(loc).Format(timeLayout)
+	reachBy := c.Request.ReachingTime.In(loc).Format(timeLayout)
+	text := func(destination string) string {
+		return fmt.Sprintf("uberNow: book your %s %s at %s to reach %s by %s", c.Request.Cab, c.Request.CabType, bookAt, destination, reachBy)
+	}
+
+	d := c.Request.Destination
+	name := []rune(strings.TrimSpace(d.Name))
+	for n := len(name); n > 0; n-- {
+		destination := string(name[:n])
+		if n < len(name) {
+			destination = strings.TrimSpace(destination) + "..."
+		}
+		if msg := text(destination); FitsSegment(msg) {
+			return msg
+		}
+	}
+	msg := []rune(text(d.Latitude + "," + d.Longitude))
+	// only a cab type which is too long is left to cut
+	for !FitsSegment(string(msg)) {
+		msg = msg[:len(msg)-1]
+	}
+	return string(msg)
+}
+
+// NewSender is a constructor which takes the Config of the Sender and returns a pointer to
+// a new Sender, or an error if the Config has no Provider.
+func NewSender(c Config) (*Sender, error) {
+	if c.Provider == nil {
+		return nil, errors.New("sms sender needs a provider")
+	}
+	if c.Location == nil {
+		c.Location = time.UTC
+	}
+	s := Sender{
+		provider: c.Provider,
+		location: c.Location,
+	}
+	return &s, nil
+}
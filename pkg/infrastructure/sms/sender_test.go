@@ -0,0 +1,98 @@
+package sms
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+func testBookingResponse(destination string) *domain.CabBookingResponse {
+	r := &domain.Request{
+		Source:           domain.Location{Name: "Koramangala", Latitude: "12.927880", Longitude: "77.627600"},
+		Destination:      domain.Location{Name: destination, Latitude: "13.035542", Longitude: "77.597100"},
+		ReachingTime:     time.Date(2018, time.March, 9, 14, 30, 0, 0, time.UTC),
+		Cab:              "uber",
+		CabType:          "uberGo",
+		NotificationAddr: domain.UserAddress{AddrType: AddrType, Value: "+919876543210"},
+	}
+	ur := domain.NewUserRequest(domain.NewUser("Anirban Roy"), r)
+	return domain.NewCabBookingResponse(ur, time.Date(2018, time.March, 9, 13, 13, 0, 0, time.UTC))
+}
+
+func TestSenderSend(t *testing.T) {
+	s := &stubGateway{}
+	sender, err := NewSender(Config{Provider: testHTTPProvider(t, s, "token"), Location: time.FixedZone("IST", 5*60*60+30*60)})
+	if err != nil {
+		t.Fatalf("NewSender() => got: %v, expected: nil", err)
+	}
+	if err = sender.Send(context.Background(), testBookingResponse("Hebbal")); err != nil {
+		t.Fatalf("Send() => got: %v, expected: nil", err)
+	}
+	if len(s.messages) != 1 {
+		t.Fatalf("Send() => got: %d messages, expected: 1", len(s.messages))
+	}
+	expected := "uberNow: book your uber uberGo at Fri 9 Mar 6:43 PM IST to reach Hebbal by Fri 9 Mar 8:00 PM IST"
+	if m := s.messages[0]; m.Get("Body") != expected || m.Get("To") != "+919876543210" {
+		t.Errorf("Send() => got: %v, expected: %q to +919876543210", m, expected)
+	}
+
+	c := testBookingResponse("Hebbal")
+	c.NotificationAddr = domain.UserAddress{AddrType: "email", Value: "anirban.nick@gmail.com"}
+	if err = sender.Send(context.Background(), c); !domain.IsPermanent(err) || len(s.messages) != 1 {
+		t.Errorf("Send() to an email address => got: %v, expected a permanent error", err)
+	}
+	if _, err = NewSender(Config{}); err == nil {
+		t.Errorf("NewSender() without provider => got: nil, expected an error")
+	}
+}
+
+func TestSenderSendConfirmation(t *testing.T) {
+	s := &stubGateway{}
+	sender, err := NewSender(Config{Provider: testHTTPProvider(t, s, "token")})
+	if err != nil {
+		t.Fatalf("NewSender() => got: %v, expected: nil", err)
+	}
+	addr := domain.UserAddress{AddrType: AddrType, Value: "+919876543210"}
+	if err = sender.SendConfirmation(context.Background(), addr, "0123abcd"); err != nil {
+		t.Fatalf("SendConfirmation() => got: %v, expected: nil", err)
+	}
+	expected := "uberNow: your confirmation code is 0123abcd"
+	if len(s.messages) != 1 || s.messages[0].Get("Body") != expected || s.messages[0].Get("To") != "+919876543210" {
+		t.Errorf("SendConfirmation() => got: %v, expected: %q to +919876543210", s.messages, expected)
+	}
+	addr = domain.UserAddress{AddrType: "email", Value: "anirban.nick@gmail.com"}
+	if err = sender.SendConfirmation(context.Background(), addr, "0123abcd"); !domain.IsPermanent(err) || len(s.messages) != 1 {
+		t.Errorf("SendConfirmation() to an email address => got: %v, expected a permanent error", err)
+	}
+}
+
+func TestCompose(t *testing.T) {
+	long := "Manyata Embassy Business Park, Outer Ring Road, Nagavara, Bengaluru, Karnataka 560045"
+	testCases := []struct {
+		name        string
+		destination string
+		contains    string
+	}{
+		{"short name", "Hebbal", "to reach Hebbal by"},
+		{"long name is shortened", long, "to reach Manyata Embassy Business Park, Outer Ring"},
+		{"name outside gsm alphabet is replaced by coordinates", "हेब्बाल", "to reach 13.035542,77.597100 by"},
+		{"no name", "", "to reach 13.035542,77.597100 by"},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			msg := compose(testBookingResponse(tc.destination), time.UTC)
+			if !FitsSegment(msg) {
+				n, limit := Length(msg)
+				t.Errorf("compose() => got: %q of length %d, expected at most %d", msg, n, limit)
+			}
+			if !strings.Contains(msg, tc.contains) || !strings.Contains(msg, "Fri 9 Mar 1:13 PM UTC") {
+				t.Errorf("compose() => got: %q, expected it to contain %q and the booking time", msg, tc.contains)
+			}
+		})
+	}
+}
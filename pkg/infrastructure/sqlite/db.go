@@ -0,0 +1,163 @@
+// package sqlite has implementations of the domain repositories which keep what they store
+// in a SQLite database file, for a deployment with a single server. The schema of the
+// database is migrated to the version the server knows when it is opened.
+//
+// A DB has a single connection, SQLite writes one transaction at a time anyway. So the
+// repositories wait for a transaction in progress, and see what it stored once it commits.
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// busyTimeout is how long a statement waits for another process which writes the database.
+const busyTimeout = 5 * time.Second
+
+// queryer runs statements on a *sql.DB or in a *sql.Tx.
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// conn is what the repositories run their statements on, the database or a transaction in
+// progress.
+type conn struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func (c conn) queryer() queryer {
+	if c.tx != nil {
+		return c.tx
+	}
+	return c.db
+}
+
+// atomic runs fn so that the statements it runs are kept only if it returns nil, in a
+// transaction of its own, or in a savepoint of the transaction in progress.
+func (c conn) atomic(fn func(queryer) error) error {
+	if c.tx == nil {
+		return transact(c.db, func(tx *sql.Tx) error { return fn(tx) })
+	}
+	if _, err := c.tx.Exec("SAVEPOINT atomic"); err != nil {
+		return errors.Wrap(err, "couldn't create savepoint")
+	}
+	if err := fn(c.tx); err != nil {
+		if _, rbErr := c.tx.Exec("ROLLBACK TO atomic"); rbErr != nil {
+			return errors.Wrapf(err, "couldn't roll back to savepoint (%v)", rbErr)
+		}
+		c.tx.Exec("RELEASE atomic")
+		return err
+	}
+	_, err := c.tx.Exec("RELEASE atomic")
+	return errors.Wrap(err, "couldn't release savepoint")
+}
+
+// transact runs fn in a transaction of db, which is committed if fn returns nil and rolled
+// back otherwise.
+func transact(db *sql.DB, fn func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "couldn't begin transaction")
+	}
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "couldn't commit transaction")
+}
+
+// DB is a SQLite database with the repositories of the domain. It implements the
+// usecases.Transactor interface.
+type DB struct {
+	db *sql.DB
+}
+
+// Transact runs fn in a transaction with the repositories and the IdempotencyStore of the
+// DB.
+func (d *DB) Transact(fn func(usecases.Repositories) error) error {
+	return transact(d.db, func(tx *sql.Tx) error {
+		c := conn{db: d.db, tx: tx}
+		return fn(usecases.Repositories{
+			Users:           &UserRepository{conn: c},
+			Requests:        &RequestRepository{conn: c},
+			IdempotencyKeys: &IdempotencyStore{conn: c},
+		})
+	})
+}
+
+// UserRepository returns the domain.UserRepository of the DB.
+func (d *DB) UserRepository() *UserRepository {
+	return &UserRepository{conn: conn{db: d.db}}
+}
+
+// RequestRepository returns the domain.RequestRepository of the DB.
+func (d *DB) RequestRepository() *RequestRepository {
+	return &RequestRepository{conn: conn{db: d.db}}
+}
+
+// IdempotencyStore returns the usecases.IdempotencyStore of the DB, its Transact claims the
+// idempotency keys in the transaction of their request.
+func (d *DB) IdempotencyStore() *IdempotencyStore {
+	return &IdempotencyStore{conn: conn{db: d.db}}
+}
+
+// CabBookingResponseRepository returns the domain.CabBookingResponseRepository of the DB.
+func (d *DB) CabBookingResponseRepository() *CabBookingResponseRepository {
+	return &CabBookingResponseRepository{conn: conn{db: d.db}}
+}
+
+// Close closes the database file.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// Open is a constructor which opens the SQLite database file at path, creating it if it
+// doesn't exist, migrates its schema and returns a pointer to the DB.
+func Open(path string) (*DB, error) {
+	dsn := fmt.Sprintf("file:%s?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=%d", path, busyTimeout/time.Millisecond)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't open database %s", path)
+	}
+	db.SetMaxOpenConns(1)
+	// the connection is kept, an in-memory database is gone with it
+	db.SetConnMaxLifetime(0)
+	db.SetMaxIdleConns(1)
+	if err = migrate(db, migrations); err != nil {
+		db.Close()
+		return nil, errors.Wrapf(err, "couldn't migrate database %s", path)
+	}
+	return &DB{db: db}, nil
+}
+
+// isConstraintError returns if err is the violation of a unique or primary key constraint.
+func isConstraintError(err error) bool {
+	e, ok := errors.Cause(err).(sqlite3.Error)
+	return ok && (e.ExtendedCode == sqlite3.ErrConstraintUnique || e.ExtendedCode == sqlite3.ErrConstraintPrimaryKey)
+}
+
+// timeValue is the column value of t, the nanoseconds since the Unix epoch, or NULL for the
+// zero time.
+func timeValue(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UnixNano()
+}
+
+// timeOf returns the time of a column value written by timeValue, in UTC.
+func timeOf(v sql.NullInt64) time.Time {
+	if !v.Valid {
+		return time.Time{}
+	}
+	return time.Unix(0, v.Int64).UTC()
+}
@@ -0,0 +1,181 @@
+package sqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/repotest"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+func testDB(t *testing.T) *DB {
+	t.Helper()
+	d, err := Open(filepath.Join(t.TempDir(), "ubernow.db"))
+	if err != nil {
+		t.Fatalf("Open() => got: %v, expected: nil", err)
+	}
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func TestUserRepositoryConformance(t *testing.T) {
+	repotest.UserRepository(t, func(t *testing.T) domain.UserRepository {
+		return testDB(t).UserRepository()
+	})
+}
+
+func TestRequestRepositoryConformance(t *testing.T) {
+	repotest.RequestRepository(t, func(t *testing.T) domain.RequestRepository {
+		return testDB(t).RequestRepository()
+	})
+}
+
+func TestIdempotencyStoreConformance(t *testing.T) {
+	repotest.IdempotencyStore(t, func(t *testing.T) usecases.IdempotencyStore {
+		return testDB(t).IdempotencyStore()
+	})
+}
+
+func TestCabBookingResponseRepositoryConformance(t *testing.T) {
+	repotest.CabBookingResponseRepository(t, func(t *testing.T) (domain.CabBookingResponseRepository, domain.UserRepository, domain.RequestRepository) {
+		d := testDB(t)
+		return d.CabBookingResponseRepository(), d.UserRepository(), d.RequestRepository()
+	})
+}
+
+func TestOpenKeepsData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ubernow.db")
+	d, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() => got: %v, expected: nil", err)
+	}
+	r := &domain.Request{UserID: 7, ReachingTime: time.Date(2018, time.March, 9, 10, 0, 0, 0, time.UTC)}
+	r.SetStatus(domain.RequestPending, time.Date(2018, time.March, 9, 8, 0, 0, 0, time.UTC))
+	id, _ := d.RequestRepository().Store(r)
+	d.Close()
+
+	// opening it again applies no migration twice and finds what was stored
+	d, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() again => got: %v, expected: nil", err)
+	}
+	defer d.Close()
+	found, err := d.RequestRepository().FindByID(id)
+	if err != nil || !found.ReachingTime.Equal(r.ReachingTime) || len(found.History) != 1 {
+		t.Errorf("FindByID(%d) after reopening => got: (%+v, %v), expected the stored request", id, found, err)
+	}
+	var versions int
+	d.db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&versions)
+	if versions != len(migrations) {
+		t.Errorf("schema_migrations => got %d versions, expected: %d", versions, len(migrations))
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	d := testDB(t)
+	// a new migration is applied on top of the ones applied before
+	next := append(migrations[:len(migrations):len(migrations)], "CREATE TABLE extra (id INTEGER)")
+	if err := migrate(d.db, next); err != nil {
+		t.Fatalf("migrate() of a new migration => got: %v, expected: nil", err)
+	}
+	if _, err := d.db.Exec("INSERT INTO extra (id) VALUES (1)"); err != nil {
+		t.Errorf("insert into the migrated table => got: %v, expected: nil", err)
+	}
+
+	// a migration which fails leaves the schema at the version before it
+	broken := append(next[:len(next):len(next)], "CREATE TABLE broken (id INTEGER); NOT SQL")
+	if err := migrate(d.db, broken); err == nil {
+		t.Errorf("migrate() of a broken migration => got: nil, expected an error")
+	}
+	if _, err := d.db.Exec("SELECT * FROM broken"); err == nil {
+		t.Errorf("table of the broken migration => got it created, expected it rolled back")
+	}
+
+	// a server which knows fewer migrations than the database has refuses it
+	if err := migrate(d.db, migrations); err == nil {
+		t.Errorf("migrate() of a newer schema => got: nil, expected an error")
+	}
+}
+
+func TestTransact(t *testing.T) {
+	d := testDB(t)
+	email := domain.UserAddress{AddrType: "email", Value: "roy@example.com"}
+	now := time.Date(2018, time.March, 9, 8, 0, 0, 0, time.UTC)
+	key := usecases.IdempotencyRecord{Scope: "email:roy@example.com", Key: "k1", ExpiresAt: now.Add(time.Hour)}
+
+	err := d.Transact(func(repos usecases.Repositories) error {
+		if _, claimed, err := repos.IdempotencyKeys.Claim(key, now); err != nil || !claimed {
+			t.Errorf("Claim() => got: (%t, %v), expected the key to be claimed", claimed, err)
+		}
+		u := domain.NewUser("roy")
+		u.AddAddress(email)
+		id, err := repos.Users.Store(u)
+		if err != nil {
+			return err
+		}
+		if _, err = repos.Requests.Store(&domain.Request{UserID: id}); err != nil {
+			return err
+		}
+		return errors.New("queue is full")
+	})
+	if err == nil || err.Error() != "queue is full" {
+		t.Errorf("Transact() => got: %v, expected the error of the function", err)
+	}
+	if _, err = d.UserRepository().FindByAddress(email); errors.Cause(err) != domain.ErrNotFound {
+		t.Errorf("FindByAddress() after a rollback => got: %v, expected: %v", err, domain.ErrNotFound)
+	}
+	if rs, _ := d.RequestRepository().List(domain.RequestFilter{}); len(rs) != 0 {
+		t.Errorf("List() after a rollback => got: %v, expected no requests", rs)
+	}
+	if _, claimed, err := d.IdempotencyStore().Claim(key, now); err != nil || !claimed {
+		t.Errorf("Claim() after a rollback => got: (%t, %v), expected the key to be claimed", claimed, err)
+	}
+
+	var userID uint64
+	err = d.Transact(func(repos usecases.Repositories) error {
+		taken := domain.NewUser("nick")
+		taken.AddAddress(email)
+		repos.Users.Store(taken)
+		// the failed store of a user with a taken address leaves nothing behind
+		u := domain.NewUser("roy")
+		u.AddAddress(email)
+		if _, err := repos.Users.Store(u); errors.Cause(err) != domain.ErrAddressTaken {
+			t.Errorf("Store() of a user with a taken address => got: %v, expected: %v", err, domain.ErrAddressTaken)
+		}
+		found, err := repos.Users.FindByAddress(email)
+		if err != nil {
+			return err
+		}
+		userID = found.UserID
+		_, err = repos.Requests.Store(&domain.Request{UserID: userID})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Transact() => got: %v, expected: nil", err)
+	}
+	var users int
+	d.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&users)
+	rs, _ := d.RequestRepository().FindByUserID(userID)
+	if users != 1 || len(rs) != 1 {
+		t.Errorf("Transact() committed => got: (%d users, %d requests), expected: (1, 1)", users, len(rs))
+	}
+}
+
+func TestTimeValue(t *testing.T) {
+	at := time.Date(2018, time.March, 9, 10, 0, 0, 5, time.FixedZone("IST", 19800))
+	if v := timeValue(time.Time{}); v != nil {
+		t.Errorf("timeValue() of the zero time => got: %v, expected: nil", v)
+	}
+	got := timeOf(sql.NullInt64{Int64: timeValue(at).(int64), Valid: true})
+	if !got.Equal(at) || got.Location() != time.UTC {
+		t.Errorf("timeOf(timeValue(%s)) => got: %s, expected the same time in UTC", at, got)
+	}
+	if got := timeOf(sql.NullInt64{}); !got.IsZero() {
+		t.Errorf("timeOf(NULL) => got: %s, expected the zero time", got)
+	}
+}
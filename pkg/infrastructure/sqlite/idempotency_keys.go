@@ -0,0 +1,72 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// IdempotencyStore implements the usecases.IdempotencyStore interface with the table
+// idempotency_keys. The expired keys of a scope are removed as a key of the scope is
+// claimed.
+type IdempotencyStore struct {
+	conn conn
+}
+
+func (m *IdempotencyStore) Claim(rec usecases.IdempotencyRecord, now time.Time) (usecases.IdempotencyRecord, bool, error) {
+	stored := rec
+	claimed := false
+	err := m.conn.atomic(func(q queryer) error {
+		_, err := q.Exec("DELETE FROM idempotency_keys WHERE scope = ? AND expires_at <= ?", rec.Scope, timeValue(now))
+		if err != nil {
+			return errors.Wrap(err, "couldn't delete expired idempotency keys")
+		}
+		res, err := q.Exec(`INSERT INTO idempotency_keys (scope, idempotency_key, payload_hash, expires_at)
+			VALUES (?, ?, ?, ?) ON CONFLICT (scope, idempotency_key) DO NOTHING`,
+			rec.Scope, rec.Key, rec.PayloadHash, timeValue(rec.ExpiresAt))
+		if err != nil {
+			return errors.Wrap(err, "couldn't insert idempotency key")
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 1 {
+			claimed = true
+			return errors.Wrap(err, "couldn't insert idempotency key")
+		}
+		var requestID, expiresAt sql.NullInt64
+		err = q.QueryRow("SELECT payload_hash, request_id, expires_at FROM idempotency_keys WHERE scope = ? AND idempotency_key = ?",
+			rec.Scope, rec.Key).Scan(&stored.PayloadHash, &requestID, &expiresAt)
+		if err != nil {
+			return errors.Wrap(err, "couldn't read idempotency key")
+		}
+		stored.RequestID, stored.ExpiresAt = uint64(requestID.Int64), timeOf(expiresAt)
+		return nil
+	})
+	if err != nil {
+		return usecases.IdempotencyRecord{}, false, errors.Wrapf(err, "couldn't claim idempotency key %q of %s", rec.Key, rec.Scope)
+	}
+	return stored, claimed, nil
+}
+
+func (m *IdempotencyStore) Complete(scope, key string, requestID uint64) error {
+	res, err := m.conn.queryer().Exec("UPDATE idempotency_keys SET request_id = ? WHERE scope = ? AND idempotency_key = ?", requestID, scope, key)
+	return keyChanged(res, err, scope, key)
+}
+
+func (m *IdempotencyStore) Release(scope, key string) error {
+	res, err := m.conn.queryer().Exec("DELETE FROM idempotency_keys WHERE scope = ? AND idempotency_key = ?", scope, key)
+	return keyChanged(res, err, scope, key)
+}
+
+// keyChanged returns the error of a statement which changes the row of the idempotency key,
+// and an error if there is no such row.
+func keyChanged(res sql.Result, err error, scope, key string) error {
+	if err != nil {
+		return errors.Wrapf(err, "couldn't change idempotency key %q of %s", key, scope)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return errors.Errorf("idempotency key %q of %s not found", key, scope)
+	}
+	return nil
+}
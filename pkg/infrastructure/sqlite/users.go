@@ -0,0 +1,171 @@
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// UserRepository implements the domain.UserRepository interface with the tables users,
+// user_addresses, pending_addresses and user_places. A user is only found by the addresses
+// of user_addresses, the confirmed ones.
+type UserRepository struct {
+	conn conn
+}
+
+func (m *UserRepository) FindByID(id uint64) (*domain.User, error) {
+	return findUser(m.conn.queryer(), id)
+}
+
+func (m *UserRepository) FindByAddress(a domain.UserAddress) (*domain.User, error) {
+	q := m.conn.queryer()
+	var id uint64
+	err := q.QueryRow("SELECT user_id FROM user_addresses WHERE addr_type = ? AND value = ?", a.AddrType, a.Value).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, errors.Wrapf(domain.ErrNotFound, "user of %s address %s", a.AddrType, a.Value)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't find user of %s address %s", a.AddrType, a.Value)
+	}
+	return findUser(q, id)
+}
+
+// Store stores the user under a new id and returns the id.
+func (m *UserRepository) Store(u *domain.User) (uint64, error) {
+	var id uint64
+	err := m.conn.atomic(func(q queryer) error {
+		res, err := q.Exec("INSERT INTO users (name) VALUES (?)", u.Name)
+		if err != nil {
+			return errors.Wrap(err, "couldn't insert user")
+		}
+		lastID, err := res.LastInsertId()
+		if err != nil {
+			return errors.Wrap(err, "couldn't read id of user")
+		}
+		id = uint64(lastID)
+		return insertUserDetails(q, id, u)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Update replaces the stored user, it returns ErrNotFound if the user wasn't stored.
+func (m *UserRepository) Update(u *domain.User) error {
+	return m.conn.atomic(func(q queryer) error {
+		res, err := q.Exec("UPDATE users SET name = ? WHERE id = ?", u.Name, u.UserID)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't update user %d", u.UserID)
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return errors.Wrapf(domain.ErrNotFound, "user %d", u.UserID)
+		}
+		if _, err = q.Exec("DELETE FROM user_addresses WHERE user_id = ?", u.UserID); err != nil {
+			return errors.Wrapf(err, "couldn't delete addresses of user %d", u.UserID)
+		}
+		if _, err = q.Exec("DELETE FROM pending_addresses WHERE user_id = ?", u.UserID); err != nil {
+			return errors.Wrapf(err, "couldn't delete pending addresses of user %d", u.UserID)
+		}
+		if _, err = q.Exec("DELETE FROM user_places WHERE user_id = ?", u.UserID); err != nil {
+			return errors.Wrapf(err, "couldn't delete places of user %d", u.UserID)
+		}
+		return insertUserDetails(q, u.UserID, u)
+	})
+}
+
+// insertUserDetails inserts the addresses, the pending addresses and the places of the user
+// with the id, it returns ErrAddressTaken if an address belongs to another user.
+func insertUserDetails(q queryer, id uint64, u *domain.User) error {
+	for i, a := range u.Addresses {
+		_, err := q.Exec("INSERT INTO user_addresses (user_id, position, addr_type, value) VALUES (?, ?, ?, ?)", id, i, a.AddrType, a.Value)
+		if isConstraintError(err) {
+			return errors.Wrapf(domain.ErrAddressTaken, "%s address %s", a.AddrType, a.Value)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "couldn't insert address of user %d", id)
+		}
+	}
+	for i, p := range u.Pending {
+		_, err := q.Exec("INSERT INTO pending_addresses (user_id, position, addr_type, value, code, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+			id, i, p.Address.AddrType, p.Address.Value, p.Code, timeValue(p.ExpiresAt))
+		if err != nil {
+			return errors.Wrapf(err, "couldn't insert pending address of user %d", id)
+		}
+	}
+	for i, p := range u.Places {
+		_, err := q.Exec("INSERT INTO user_places (user_id, position, name, latitude, longitude) VALUES (?, ?, ?, ?, ?)", id, i, p.Name, p.Latitude, p.Longitude)
+		if err != nil {
+			return errors.Wrapf(err, "couldn't insert place of user %d", id)
+		}
+	}
+	return nil
+}
+
+// findUser reads the user with the id and their addresses, pending addresses and places.
+func findUser(q queryer, id uint64) (*domain.User, error) {
+	u := domain.User{UserID: id}
+	err := q.QueryRow("SELECT name FROM users WHERE id = ?", id).Scan(&u.Name)
+	if err == sql.ErrNoRows {
+		return nil, errors.Wrapf(domain.ErrNotFound, "user %d", id)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't find user %d", id)
+	}
+
+	rows, err := q.Query("SELECT addr_type, value FROM user_addresses WHERE user_id = ? ORDER BY position", id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't find addresses of user %d", id)
+	}
+	for rows.Next() {
+		var a domain.UserAddress
+		if err = rows.Scan(&a.AddrType, &a.Value); err != nil {
+			rows.Close()
+			return nil, errors.Wrapf(err, "couldn't read address of user %d", id)
+		}
+		u.Addresses = append(u.Addresses, a)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "couldn't read addresses of user %d", id)
+	}
+
+	rows, err = q.Query("SELECT addr_type, value, code, expires_at FROM pending_addresses WHERE user_id = ? ORDER BY position", id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't find pending addresses of user %d", id)
+	}
+	for rows.Next() {
+		var p domain.PendingAddress
+		var expiresAt sql.NullInt64
+		if err = rows.Scan(&p.Address.AddrType, &p.Address.Value, &p.Code, &expiresAt); err != nil {
+			rows.Close()
+			return nil, errors.Wrapf(err, "couldn't read pending address of user %d", id)
+		}
+		p.ExpiresAt = timeOf(expiresAt)
+		u.Pending = append(u.Pending, p)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "couldn't read pending addresses of user %d", id)
+	}
+
+	rows, err = q.Query("SELECT name, latitude, longitude FROM user_places WHERE user_id = ? ORDER BY position", id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't find places of user %d", id)
+	}
+	for rows.Next() {
+		var p domain.Location
+		if err = rows.Scan(&p.Name, &p.Latitude, &p.Longitude); err != nil {
+			rows.Close()
+			return nil, errors.Wrapf(err, "couldn't read place of user %d", id)
+		}
+		u.Places = append(u.Places, p)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "couldn't read places of user %d", id)
+	}
+	return &u, nil
+}
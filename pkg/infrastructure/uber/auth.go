@@ -0,0 +1,37 @@
+package uber
+
+import (
+	"context"
+	"strings"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/oauth"
+)
+
+// credentials authorize the requests to the API, with a server token, or with an access
+// token of the OAuth client credentials grant from tokens.
+type credentials struct {
+	serverToken string
+	tokens      *oauth.TokenSource
+}
+
+// authorization returns the value of the Authorization header of a request.
+func (c *credentials) authorization(ctx context.Context) (string, error) {
+	if c.serverToken != "" {
+		return "Token " + c.serverToken, nil
+	}
+	token, err := c.tokens.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "Bearer " + token, nil
+}
+
+// reject drops the access token the API rejected, the next request fetches a new one. It
+// returns if there was an access token to drop.
+func (c *credentials) reject(authorization string) bool {
+	if c.serverToken != "" {
+		return false
+	}
+	c.tokens.Reject(strings.TrimPrefix(authorization, "Bearer "))
+	return true
+}
@@ -0,0 +1,270 @@
+// package uber has an implementation of the domain.CabService interface with the time
+// estimates of the Uber API, how long a cab of a product takes to reach the source.
+//
+// The requests are authorized with a server token, or with an access token of the OAuth
+// client credentials grant. The rate limit the API reports in the headers of its responses
+// is kept, once it is used up the requests fail without being made until it is reset. The
+// DefaultCabTypes and the cab types of the products of the CabService are those of the cab
+// uber in the catalog of the cabs the requests are validated against.
+package uber
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/oauth"
+)
+
+const (
+	// Name is the name of the cab of the requests for Uber cabs.
+	Name = "uber"
+	// DefaultBaseURL is the endpoint of the Uber API.
+	DefaultBaseURL = "https://api.uber.com/v1.2"
+	// DefaultTokenURL is the token endpoint of the OAuth client credentials grant.
+	DefaultTokenURL = "https://login.uber.com/oauth/v2/token"
+	// DefaultScope is the scope of the access tokens of the client credentials grant.
+	DefaultScope = "estimates.time"
+	// DefaultTimeout bounds each call to the Uber API, a time estimate and a token fetch get
+	// it each.
+	DefaultTimeout = 10 * time.Second
+)
+
+// DefaultCabTypes are the cab types a CabService offers without products, they are matched
+// with the display names of the products around the source.
+var DefaultCabTypes = []string{"uberGo", "uberBlack", "uberShare", "uberX"}
+
+var (
+	// ErrUnauthorized is returned when the API rejects the server token, or the client id
+	// and secret.
+	ErrUnauthorized = errors.New("uber api request unauthorized")
+	// ErrRateLimited is returned once the rate limit of the API is used up, until it is reset.
+	ErrRateLimited = errors.New("uber api rate limit exceeded")
+	// ErrNoCabs is returned when no cab of the product is around the source right now.
+	ErrNoCabs = errors.New("no uber cabs available")
+)
+
+// Config holds the credentials of an Uber developer application. A ServerToken is used as it
+// is, without one the CabService fetches access tokens of the client credentials grant of
+// ClientID and ClientSecret. The product ids of Uber differ from city to city, Products maps
+// the cab types, like uberGo, to those of the city, and a cab type it doesn't map is matched
+// with the display names of the products around the source. BaseURL, TokenURL, Scope and
+// Timeout replace their defaults, and Client replaces http.DefaultClient.
+type Config struct {
+	ServerToken  string
+	ClientID     string
+	ClientSecret string
+	Products     map[string]string
+
+	BaseURL  string
+	TokenURL string
+	Scope    string
+	Timeout  time.Duration
+	Client   *http.Client
+}
+
+// CabService implements the domain.CabService interface with the time estimates of the
+// Uber API.
+type CabService struct {
+	baseURL     string
+	products    map[string]string
+	timeout     time.Duration
+	client      *http.Client
+	credentials *credentials
+	now         func() time.Time
+
+	mu        sync.Mutex
+	remaining int
+	resetAt   time.Time
+}
+
+// estimatesResponse is the response of the time estimates endpoint.
+type estimatesResponse struct {
+	Times []struct {
+		ProductID   string `json:"product_id"`
+		DisplayName string `json:"display_name"`
+		Estimate    int64  `json:"estimate"`
+	} `json:"times"`
+}
+
+// EtaNow returns how long a cab of the cab type of the request takes to reach its source.
+func (c *CabService) EtaNow(ctx context.Context, cr *domain.CabRequest) (time.Duration, error) {
+	productID := c.products[cr.CabType]
+	q := url.Values{}
+	q.Set("start_latitude", cr.Source.Latitude)
+	q.Set("start_longitude", cr.Source.Longitude)
+	if productID != "" {
+		q.Set("product_id", productID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	var res *http.Response
+	// an access token which was rejected is fetched again once
+	for attempt := 0; ; attempt++ {
+		if err := c.checkRateLimit(); err != nil {
+			return 0, err
+		}
+		auth, err := c.credentials.authorization(ctx)
+		if err != nil {
+			return 0, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/estimates/time?"+q.Encode(), nil)
+		if err != nil {
+			return 0, domain.NewPermanentError(errors.Wrap(err, "couldn't make time estimates request"))
+		}
+		req.Header.Set("Authorization", auth)
+		req.Header.Set("Accept-Language", "en_US")
+		if res, err = c.client.Do(req); err != nil {
+			return 0, errors.Wrap(err, "time estimates request failed")
+		}
+		c.keepRateLimit(res)
+		if res.StatusCode == http.StatusUnauthorized && attempt == 0 && c.credentials.reject(auth) {
+			res.Body.Close()
+			continue
+		}
+		break
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized:
+		return 0, domain.NewPermanentError(errors.Wrap(ErrUnauthorized, "time estimates request failed"))
+	case res.StatusCode == http.StatusTooManyRequests:
+		return 0, errors.Wrap(ErrRateLimited, "time estimates request failed")
+	case res.StatusCode >= 500:
+		return 0, errors.Errorf("time estimates request failed with HTTP status %d", res.StatusCode)
+	case res.StatusCode != http.StatusOK:
+		return 0, domain.NewPermanentError(errors.Errorf("time estimates request failed with HTTP status %d", res.StatusCode))
+	}
+	var e estimatesResponse
+	if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
+		return 0, errors.Wrap(err, "couldn't decode time estimates response")
+	}
+	for _, t := range e.Times {
+		if (productID != "" && t.ProductID == productID) || (productID == "" && strings.EqualFold(t.DisplayName, cr.CabType)) {
+			return time.Duration(t.Estimate) * time.Second, nil
+		}
+	}
+	return 0, errors.Wrapf(ErrNoCabs, "cab type %s", cr.CabType)
+}
+
+// checkRateLimit returns ErrRateLimited if the rate limit is used up until it is reset.
+func (c *CabService) checkRateLimit() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.remaining == 0 && c.now().Before(c.resetAt) {
+		return errors.Wrapf(ErrRateLimited, "until %s", c.resetAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// keepRateLimit keeps the rate limit of the headers of a response, X-Rate-Limit-Remaining
+// and X-Rate-Limit-Reset, the Unix time at which it is reset.
+func (c *CabService) keepRateLimit(res *http.Response) {
+	remaining, err := strconv.Atoi(res.Header.Get("X-Rate-Limit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(res.Header.Get("X-Rate-Limit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remaining, c.resetAt = remaining, time.Unix(reset, 0)
+}
+
+// CabTypes returns the DefaultCabTypes and the cab types of the products of the CabService
+// in alphabetical order.
+func (c *CabService) CabTypes() []string {
+	types := append([]string(nil), DefaultCabTypes...)
+	for t := range c.products {
+		if !isDefaultCabType(t) {
+			types = append(types, t)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// isDefaultCabType returns if the cab type is one of the DefaultCabTypes.
+func isDefaultCabType(cabType string) bool {
+	for _, t := range DefaultCabTypes {
+		if t == cabType {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseProducts parses the products of a Config from a list of cabType=productID pairs
+// separated by commas.
+func ParseProducts(s string) (map[string]string, error) {
+	products := make(map[string]string)
+	if s == "" {
+		return products, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, errors.Errorf("product %q, expected cabType=productID", pair)
+		}
+		products[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return products, nil
+}
+
+// NewCabService is a constructor which takes the Config of the CabService and returns a
+// pointer to a new CabService, or an error if the Config has no server token nor client
+// credentials.
+func NewCabService(c Config) (*CabService, error) {
+	if c.ServerToken == "" && (c.ClientID == "" || c.ClientSecret == "") {
+		return nil, errors.New("uber cab service needs a server token, or a client id and secret")
+	}
+	if c.BaseURL == "" {
+		c.BaseURL = DefaultBaseURL
+	}
+	if c.TokenURL == "" {
+		c.TokenURL = DefaultTokenURL
+	}
+	if c.Scope == "" {
+		c.Scope = DefaultScope
+	}
+	if c.Timeout == 0 {
+		c.Timeout = DefaultTimeout
+	}
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	s := CabService{
+		baseURL:  strings.TrimRight(c.BaseURL, "/"),
+		products: c.Products,
+		timeout:  c.Timeout,
+		client:   c.Client,
+		credentials: &credentials{
+			serverToken: c.ServerToken,
+			tokens: oauth.NewTokenSource(oauth.Config{
+				ClientID:     c.ClientID,
+				ClientSecret: c.ClientSecret,
+				TokenURL:     c.TokenURL,
+				Scope:        c.Scope,
+				Style:        oauth.FormStyle,
+				Unauthorized: ErrUnauthorized,
+				Client:       c.Client,
+			}),
+		},
+		now:       time.Now,
+		remaining: -1,
+	}
+	return &s, nil
+}
@@ -0,0 +1,179 @@
+package uber
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/infrastructure/cabtest"
+)
+
+const estimates = `{
+  "times": [
+    {"localized_display_name": "uberGO", "estimate": 540, "display_name": "uberGO", "product_id": "a1111c8c-c720-46c3-8534-2fcdd730040d"},
+    {"localized_display_name": "uberX", "estimate": 420, "display_name": "uberX", "product_id": "d4abaae7-f4d6-4152-91cc-77523e8165a4"}
+  ]
+}`
+
+// stubAPI is a local stand-in of the Uber API with its time estimates and token endpoints.
+// It accepts the server token "server-token" next to the access tokens of its cabtest.API,
+// and answers with the rate limit of remaining and reset, unless remaining is negative.
+type stubAPI struct {
+	cabtest.API
+	remaining int
+	reset     time.Time
+}
+
+func newStubAPI(remaining int, reset time.Time) *stubAPI {
+	s := &stubAPI{remaining: remaining, reset: reset}
+	s.TokenPath = "/oauth/v2/token"
+	s.Unauthorized = `{"message": "Invalid OAuth 2.0 credentials provided.", "code": "unauthorized"}`
+	s.Authorized = func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Token server-token" || s.HasToken(r)
+	}
+	s.Handler = func(w http.ResponseWriter, r *http.Request) {
+		if s.remaining >= 0 {
+			w.Header().Set("X-Rate-Limit-Limit", "2000")
+			w.Header().Set("X-Rate-Limit-Remaining", strconv.Itoa(s.remaining))
+			w.Header().Set("X-Rate-Limit-Reset", strconv.FormatInt(s.reset.Unix(), 10))
+		}
+		fmt.Fprint(w, estimates)
+	}
+	return s
+}
+
+func testCabService(t *testing.T, s *stubAPI, c Config) *CabService {
+	t.Helper()
+	srv := s.Serve(t)
+	c.BaseURL, c.TokenURL, c.Client = srv.URL+"/v1.2", srv.URL+"/oauth/v2/token", srv.Client()
+	cs, err := NewCabService(c)
+	if err != nil {
+		t.Fatalf("NewCabService() => got: %v, expected: nil", err)
+	}
+	return cs
+}
+
+func TestCabServiceEtaNow(t *testing.T) {
+	products := map[string]string{"uberGo": "a1111c8c-c720-46c3-8534-2fcdd730040d"}
+	testCases := []struct {
+		cabType   string
+		productID string
+		expected  time.Duration
+	}{
+		{"uberGo", "a1111c8c-c720-46c3-8534-2fcdd730040d", 9 * time.Minute},
+		// a cab type without a product id is matched by display name
+		{"uberX", "", 7 * time.Minute},
+	}
+
+	for i, _ := range testCases {
+		s := newStubAPI(-1, time.Time{})
+		cs := testCabService(t, s, Config{ServerToken: "server-token", Products: products})
+		eta, err := cs.EtaNow(context.Background(), cabtest.Request(Name, testCases[i].cabType))
+		if err != nil {
+			t.Fatalf("case %d: EtaNow() => got: %v, expected: nil", i, err)
+		}
+		if eta != testCases[i].expected {
+			t.Errorf("case %d: EtaNow() => got: %v, expected: %v", i, eta, testCases[i].expected)
+		}
+		q := s.Queries[0]
+		if q.Get("product_id") != testCases[i].productID || q.Get("start_latitude") != "12.927880" || q.Get("start_longitude") != "77.627600" {
+			t.Errorf("case %d: EtaNow() => got: query %v, expected the source and product %q", i, q, testCases[i].productID)
+		}
+	}
+
+	s := newStubAPI(-1, time.Time{})
+	cs := testCabService(t, s, Config{ServerToken: "server-token"})
+	if _, err := cs.EtaNow(context.Background(), cabtest.Request(Name, "uberBlack")); errors.Cause(err) != ErrNoCabs || domain.IsPermanent(err) {
+		t.Errorf("EtaNow() of a product which isn't around => got: %v, expected: %v which isn't permanent", err, ErrNoCabs)
+	}
+}
+
+func TestCabServiceAccessTokens(t *testing.T) {
+	s := newStubAPI(-1, time.Time{})
+	cs := testCabService(t, s, Config{ClientID: "client", ClientSecret: "secret"})
+
+	for i := 0; i < 2; i++ {
+		if _, err := cs.EtaNow(context.Background(), cabtest.Request(Name, "uberX")); err != nil {
+			t.Fatalf("EtaNow() => got: %v, expected: nil", err)
+		}
+	}
+	if s.Tokens != 1 {
+		t.Errorf("EtaNow() twice => got: %d tokens fetched, expected: 1", s.Tokens)
+	}
+
+	// a rejected token is fetched again
+	s.Expire = true
+	if _, err := cs.EtaNow(context.Background(), cabtest.Request(Name, "uberX")); err != nil {
+		t.Fatalf("EtaNow() with an expired token => got: %v, expected: nil", err)
+	}
+	if s.Tokens != 2 || s.Auths[len(s.Auths)-1] != "Bearer token-2" {
+		t.Errorf("EtaNow() with an expired token => got: %d tokens fetched and %s, expected a second token", s.Tokens, s.Auths[len(s.Auths)-1])
+	}
+
+	cs = testCabService(t, newStubAPI(-1, time.Time{}), Config{ClientID: "client", ClientSecret: "wrong"})
+	if _, err := cs.EtaNow(context.Background(), cabtest.Request(Name, "uberX")); errors.Cause(err) != ErrUnauthorized || !domain.IsPermanent(err) {
+		t.Errorf("EtaNow() with a wrong secret => got: %v, expected: permanent %v", err, ErrUnauthorized)
+	}
+	cs = testCabService(t, newStubAPI(-1, time.Time{}), Config{ServerToken: "wrong"})
+	if _, err := cs.EtaNow(context.Background(), cabtest.Request(Name, "uberX")); errors.Cause(err) != ErrUnauthorized || !domain.IsPermanent(err) {
+		t.Errorf("EtaNow() with a wrong server token => got: %v, expected: permanent %v", err, ErrUnauthorized)
+	}
+}
+
+func TestCabServiceRateLimit(t *testing.T) {
+	now := time.Date(2018, time.March, 9, 18, 0, 0, 0, time.UTC)
+	s := newStubAPI(0, now.Add(time.Hour))
+	cs := testCabService(t, s, Config{ServerToken: "server-token"})
+	cs.now = func() time.Time { return now }
+
+	// the last request of the rate limit is answered
+	if _, err := cs.EtaNow(context.Background(), cabtest.Request(Name, "uberX")); err != nil {
+		t.Fatalf("EtaNow() => got: %v, expected: nil", err)
+	}
+	// the next ones fail until it is reset, without being made
+	_, err := cs.EtaNow(context.Background(), cabtest.Request(Name, "uberX"))
+	if errors.Cause(err) != ErrRateLimited || domain.IsPermanent(err) || len(s.Queries) != 1 {
+		t.Errorf("EtaNow() with the rate limit used up => got: %v after %d requests, expected: %v after 1", err, len(s.Queries), ErrRateLimited)
+	}
+	now = now.Add(time.Hour)
+	s.remaining = 1999
+	if _, err = cs.EtaNow(context.Background(), cabtest.Request(Name, "uberX")); err != nil {
+		t.Errorf("EtaNow() after the rate limit is reset => got: %v, expected: nil", err)
+	}
+
+	s.Status = http.StatusTooManyRequests
+	if _, err = cs.EtaNow(context.Background(), cabtest.Request(Name, "uberX")); errors.Cause(err) != ErrRateLimited {
+		t.Errorf("EtaNow() answered with 429 => got: %v, expected: %v", err, ErrRateLimited)
+	}
+}
+
+func TestParseProducts(t *testing.T) {
+	products, err := ParseProducts("uberGo=a1111c8c, uberX=d4abaae7")
+	if err != nil || len(products) != 2 || products["uberGo"] != "a1111c8c" || products["uberX"] != "d4abaae7" {
+		t.Errorf("ParseProducts() => got: %v, %v, expected two products", products, err)
+	}
+	if _, err = ParseProducts("uberGo"); err == nil {
+		t.Errorf("ParseProducts() without product id => got: nil, expected an error")
+	}
+	if _, err = NewCabService(Config{ClientID: "client"}); err == nil {
+		t.Errorf("NewCabService() without credentials => got: nil, expected an error")
+	}
+}
+
+func TestCabServiceCabTypes(t *testing.T) {
+	cs, err := NewCabService(Config{ServerToken: "server-token", Products: map[string]string{"uberPool": "26546650", "uberGo": "a1111c8c"}})
+	if err != nil {
+		t.Fatalf("NewCabService() => got: %v, expected: nil", err)
+	}
+	expected := []string{"uberBlack", "uberGo", "uberPool", "uberShare", "uberX"}
+	if types := cs.CabTypes(); !reflect.DeepEqual(types, expected) {
+		t.Errorf("CabTypes() => got: %v, expected: %v", types, expected)
+	}
+}
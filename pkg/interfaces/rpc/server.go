@@ -0,0 +1,254 @@
+// package rpc has the gRPC delivery mechanism of the application, the UberNow service of
+// package ubernowpb over the use cases of the UserInteractor. It is served alongside the
+// REST API of package web and shares its interactors.
+package rpc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/interfaces/rpc/ubernowpb"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// UserRequestService exposes the use cases the Server serves, it is implemented by
+// usecases.UserInteractor.
+type UserRequestService interface {
+	CreateUserRequest(usecases.UserRequestDTO) (*domain.UserRequest, error)
+	GetUserRequest(uint64, string) (*domain.Request, error)
+	CancelUserRequest(uint64, string) (*domain.Request, error)
+	WatchUserRequest(uint64, string) (*domain.Request, <-chan usecases.RequestUpdate, func(), error)
+}
+
+// Server implements the ubernowpb.UberNowServer interface.
+type Server struct {
+	ubernowpb.UnimplementedUberNowServer
+	service UserRequestService
+	logger  domain.Logger
+	closing chan struct{}
+	once    sync.Once
+}
+
+func (s *Server) CreateRequest(ctx context.Context, req *ubernowpb.CreateRequestRequest) (*ubernowpb.Request, error) {
+	var reachingTime time.Time
+	if req.GetReachingTime() != nil {
+		if err := req.GetReachingTime().CheckValid(); err != nil {
+			return nil, s.status(domain.NewValidationError("reaching_time", "%s", err))
+		}
+		reachingTime = req.GetReachingTime().AsTime()
+	}
+	dto, err := usecases.NewUserRequestDTO(
+		req.GetName(),
+		newLocation(req.GetSource()),
+		newLocation(req.GetDestination()),
+		reachingTime,
+		req.GetCab(),
+		req.GetCabType(),
+		domain.UserAddress{AddrType: req.GetNotificationAddr().GetType(), Value: req.GetNotificationAddr().GetValue()},
+	)
+	if err == nil {
+		err = dto.SetIdempotencyKey(req.GetIdempotencyKey())
+	}
+	if err != nil {
+		return nil, s.status(err)
+	}
+	ur, err := s.service.CreateUserRequest(dto)
+	if err != nil {
+		return nil, s.status(err)
+	}
+	s.logger.Info("created request",
+		domain.NewField(domain.RequestIDKey, ur.Request.ID()),
+		domain.NewField("user_id", ur.User.UserID),
+	)
+	resp := newRequest(ur.Request)
+	// the token is only given to who made the request
+	resp.Token = ur.Request.Token
+	return resp, nil
+}
+
+func (s *Server) GetRequest(ctx context.Context, req *ubernowpb.GetRequestRequest) (*ubernowpb.Request, error) {
+	r, err := s.service.GetUserRequest(req.GetId(), req.GetToken())
+	if err != nil {
+		return nil, s.status(err)
+	}
+	return newRequest(r), nil
+}
+
+func (s *Server) CancelRequest(ctx context.Context, req *ubernowpb.CancelRequestRequest) (*ubernowpb.Request, error) {
+	r, err := s.service.CancelUserRequest(req.GetId(), req.GetToken())
+	if err != nil {
+		return nil, s.status(err)
+	}
+	s.logger.Info("cancelled request", domain.NewField(domain.RequestIDKey, req.GetId()))
+	return newRequest(r), nil
+}
+
+// WatchRequest sends the request as it is and then its updates, until it is finished. An
+// update which is not ahead of the last one sent is skipped, it was already sent as part of
+// the request as it was when the watch started.
+func (s *Server) WatchRequest(req *ubernowpb.WatchRequestRequest, stream ubernowpb.UberNow_WatchRequestServer) error {
+	r, updates, stop, err := s.service.WatchUserRequest(req.GetId(), req.GetToken())
+	if err != nil {
+		return s.status(err)
+	}
+	defer stop()
+
+	if err = stream.Send(&ubernowpb.RequestUpdate{Request: newRequest(r)}); err != nil {
+		return err
+	}
+	last := r.Status
+	for !r.Finished() {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-s.closing:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case u := <-updates:
+			if statusOrder[u.Request.Status] <= statusOrder[last] {
+				continue
+			}
+			r, last = u.Request, u.Request.Status
+			if err = stream.Send(newRequestUpdate(u)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close ends the WatchRequest streams which are open, so that a graceful stop of the
+// grpc.Server doesn't wait for requests which may take hours to finish.
+func (s *Server) Close() {
+	s.once.Do(func() {
+		close(s.closing)
+	})
+}
+
+// status maps err to the status returned to the client. Invalid input is INVALID_ARGUMENT
+// with a BadRequest detail of the invalid fields. Everything which is not the client's
+// fault is INTERNAL, whose details are logged but not returned.
+func (s *Server) status(err error) error {
+	cause := errors.Cause(err)
+	var violations []*errdetails.BadRequest_FieldViolation
+	switch v := cause.(type) {
+	case *domain.ValidationError:
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: v.Field, Description: v.Reason})
+	case domain.ValidationErrors:
+		for _, e := range v {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{Field: e.Field, Description: e.Reason})
+		}
+	}
+	if len(violations) > 0 {
+		st, detailErr := status.New(codes.InvalidArgument, cause.Error()).WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+		if detailErr != nil {
+			return status.Error(codes.InvalidArgument, cause.Error())
+		}
+		return st.Err()
+	}
+
+	switch cause {
+	case domain.ErrNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case domain.ErrRequestFinished:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case usecases.ErrIdempotencyKeyReused:
+		return status.Error(codes.InvalidArgument, cause.Error())
+	case usecases.ErrIdempotencyKeyInUse, domain.ErrConflict:
+		return status.Error(codes.Aborted, cause.Error())
+	case usecases.ErrQueueFull:
+		return status.Error(codes.ResourceExhausted, "too many requests are being processed, try again later")
+	default:
+		s.logger.Error("request failed", domain.NewField(domain.ErrorKey, err))
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+// statusOrder orders the statuses by how far a request got, so that updates which are
+// behind the last one sent are skipped.
+var statusOrder = map[domain.RequestStatus]int{
+	domain.RequestPending:          1,
+	domain.RequestScheduled:        2,
+	domain.RequestBookingTimeFound: 3,
+	domain.RequestNotified:         4,
+	domain.RequestCancelled:        5,
+}
+
+var statuses = map[domain.RequestStatus]ubernowpb.RequestStatus{
+	domain.RequestPending:          ubernowpb.RequestStatus_REQUEST_STATUS_PENDING,
+	domain.RequestScheduled:        ubernowpb.RequestStatus_REQUEST_STATUS_SCHEDULED,
+	domain.RequestBookingTimeFound: ubernowpb.RequestStatus_REQUEST_STATUS_BOOKING_TIME_FOUND,
+	domain.RequestNotified:         ubernowpb.RequestStatus_REQUEST_STATUS_NOTIFIED,
+	domain.RequestCancelled:        ubernowpb.RequestStatus_REQUEST_STATUS_CANCELLED,
+}
+
+func newLocation(l *ubernowpb.Location) domain.Location {
+	return domain.Location{Name: l.GetName(), Latitude: l.GetLatitude(), Longitude: l.GetLongitude()}
+}
+
+// timestamp returns nil for a zero time, the times which are not found yet are not set.
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func newRequest(r *domain.Request) *ubernowpb.Request {
+	history := make([]*ubernowpb.RequestEvent, 0, len(r.History))
+	for _, e := range r.History {
+		history = append(history, &ubernowpb.RequestEvent{Status: statuses[e.Status], At: timestamp(e.At)})
+	}
+	return &ubernowpb.Request{
+		Id:     r.ID(),
+		UserId: r.UserID,
+		Source: &ubernowpb.Location{
+			Name:      r.Source.Name,
+			Latitude:  r.Source.Latitude,
+			Longitude: r.Source.Longitude,
+		},
+		Destination: &ubernowpb.Location{
+			Name:      r.Destination.Name,
+			Latitude:  r.Destination.Latitude,
+			Longitude: r.Destination.Longitude,
+		},
+		ReachingTime:     timestamp(r.ReachingTime),
+		Cab:              r.Cab,
+		CabType:          r.CabType,
+		NotificationAddr: &ubernowpb.Address{Type: r.NotificationAddr.AddrType, Value: r.NotificationAddr.Value},
+		Status:           statuses[r.Status],
+		TriggerTime:      timestamp(r.TriggerTime),
+		BookingTime:      timestamp(r.BookingTime),
+		History:          history,
+	}
+}
+
+func newRequestUpdate(u usecases.RequestUpdate) *ubernowpb.RequestUpdate {
+	update := ubernowpb.RequestUpdate{Request: newRequest(u.Request)}
+	if u.Response != nil {
+		update.BookingResponse = &ubernowpb.CabBookingResponse{
+			BookingId:       u.Response.BookingID,
+			RequestId:       u.Request.ID(),
+			BestBookingTime: timestamp(u.Response.BestBookingTime),
+		}
+	}
+	return &update
+}
+
+// NewServer is a constructor which takes the UserRequestService and a Logger and returns a
+// pointer to a new Server, to be registered with ubernowpb.RegisterUberNowServer.
+func NewServer(us UserRequestService, logger domain.Logger) *Server {
+	s := Server{
+		service: us,
+		logger:  logger,
+		closing: make(chan struct{}),
+	}
+	return &s
+}
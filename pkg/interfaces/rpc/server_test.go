@@ -0,0 +1,302 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/interfaces/rpc/ubernowpb"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// MockLogger implements the domain.Logger interface and drops every line.
+type MockLogger struct{}
+
+func (l *MockLogger) Debug(m string, fields ...domain.Field)    {}
+func (l *MockLogger) Info(m string, fields ...domain.Field)     {}
+func (l *MockLogger) Warn(m string, fields ...domain.Field)     {}
+func (l *MockLogger) Error(m string, fields ...domain.Field)    {}
+func (l *MockLogger) With(fields ...domain.Field) domain.Logger { return l }
+
+// testToken is the token of request 1.
+const testToken = "9f86d081884c7d65"
+
+// MockUserRequestService implements the UserRequestService interface, it knows request 1
+// of user 7, whose token is testToken, returns createErr from CreateUserRequest and sends the updates of request 1
+// from its updates channel.
+type MockUserRequestService struct {
+	createErr error
+	updates   chan usecases.RequestUpdate
+}
+
+func testRequest() *domain.Request {
+	r := &domain.Request{
+		Token:            testToken,
+		UserID:           7,
+		Source:           domain.Location{Latitude: "77.134134", Longitude: "45.1341324"},
+		Destination:      domain.Location{Latitude: "77.234134", Longitude: "45.5641324"},
+		ReachingTime:     time.Date(2018, time.March, 9, 10, 0, 0, 0, time.UTC),
+		Cab:              "uber",
+		CabType:          "uberGo",
+		NotificationAddr: domain.UserAddress{AddrType: "email", Value: "anirban.nick@gmail.com"},
+	}
+	r.SetStatus(domain.RequestPending, time.Date(2018, time.March, 9, 8, 0, 0, 0, time.UTC))
+	r.SetID(1)
+	return r
+}
+
+func (s *MockUserRequestService) CreateUserRequest(dto usecases.UserRequestDTO) (*domain.UserRequest, error) {
+	if s.createErr != nil {
+		return nil, s.createErr
+	}
+	u := domain.NewUser("roy")
+	u.UserID = 7
+	return domain.NewUserRequest(u, testRequest()), nil
+}
+
+func (s *MockUserRequestService) GetUserRequest(id uint64, token string) (*domain.Request, error) {
+	if id != 1 {
+		return nil, errors.Wrap(domain.ErrNotFound, "GetUserRequest")
+	}
+	r := testRequest()
+	if err := r.Authorize(token); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *MockUserRequestService) CancelUserRequest(id uint64, token string) (*domain.Request, error) {
+	r, err := s.GetUserRequest(id, token)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.Cancel(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *MockUserRequestService) WatchUserRequest(id uint64, token string) (*domain.Request, <-chan usecases.RequestUpdate, func(), error) {
+	r, err := s.GetUserRequest(id, token)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return r, s.updates, func() {}, nil
+}
+
+// testClient serves a Server of the service over an in-memory connection and returns a
+// client of it.
+func testClient(t *testing.T, s UserRequestService) (ubernowpb.UberNowClient, *Server) {
+	t.Helper()
+	conn, srv := testConn(t, s)
+	return ubernowpb.NewUberNowClient(conn), srv
+}
+
+// testConn returns a connection to a Server of the service, which serves it until the test
+// is done.
+func testConn(t *testing.T, s UserRequestService) (*grpc.ClientConn, *Server) {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := NewServer(s, &MockLogger{})
+	gs := grpc.NewServer()
+	ubernowpb.RegisterUberNowServer(gs, srv)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc.NewClient() => got: %v, expected: nil", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, srv
+}
+
+func testCreateRequest() *ubernowpb.CreateRequestRequest {
+	return &ubernowpb.CreateRequestRequest{
+		Name:             "roy",
+		Source:           &ubernowpb.Location{Latitude: "77.134134", Longitude: "45.1341324"},
+		Destination:      &ubernowpb.Location{Latitude: "77.234134", Longitude: "45.5641324"},
+		ReachingTime:     timestamppb.New(time.Now().Add(5 * time.Hour)),
+		Cab:              "uber",
+		CabType:          "uberGo",
+		NotificationAddr: &ubernowpb.Address{Type: "email", Value: "anirban.nick@gmail.com"},
+	}
+}
+
+func TestServer(t *testing.T) {
+	missing := testCreateRequest()
+	missing.Source = nil
+	ctx := context.Background()
+
+	testCases := []struct {
+		name         string
+		createErr    error
+		call         func(ubernowpb.UberNowClient) error
+		expectedCode codes.Code
+	}{
+		{"create request", nil, func(c ubernowpb.UberNowClient) error {
+			r, err := c.CreateRequest(ctx, testCreateRequest())
+			if err == nil && (r.Id != 1 || r.Token != testToken || r.Status != ubernowpb.RequestStatus_REQUEST_STATUS_PENDING || r.TriggerTime != nil) {
+				t.Errorf("CreateRequest() => got: %v, expected pending request 1 with its token", r)
+			}
+			return err
+		}, codes.OK},
+		{"create with missing source", nil, func(c ubernowpb.UberNowClient) error {
+			_, err := c.CreateRequest(ctx, missing)
+			return err
+		}, codes.InvalidArgument},
+		{"create with invalid input", domain.NewValidationError("cab", "requested cab: ola not avaialable"), func(c ubernowpb.UberNowClient) error {
+			_, err := c.CreateRequest(ctx, testCreateRequest())
+			return err
+		}, codes.InvalidArgument},
+		{"create with full queue", errors.Wrap(usecases.ErrQueueFull, "TrafficAppEngine"), func(c ubernowpb.UberNowClient) error {
+			_, err := c.CreateRequest(ctx, testCreateRequest())
+			return err
+		}, codes.ResourceExhausted},
+		{"create with reused idempotency key", errors.Wrap(usecases.ErrIdempotencyKeyReused, "CreateUserRequest"), func(c ubernowpb.UberNowClient) error {
+			_, err := c.CreateRequest(ctx, testCreateRequest())
+			return err
+		}, codes.InvalidArgument},
+		{"create with idempotency key in use", errors.Wrap(usecases.ErrIdempotencyKeyInUse, "CreateUserRequest"), func(c ubernowpb.UberNowClient) error {
+			_, err := c.CreateRequest(ctx, testCreateRequest())
+			return err
+		}, codes.Aborted},
+		{"create with repository failure", errors.New("disk on fire"), func(c ubernowpb.UberNowClient) error {
+			_, err := c.CreateRequest(ctx, testCreateRequest())
+			return err
+		}, codes.Internal},
+		{"get request", nil, func(c ubernowpb.UberNowClient) error {
+			r, err := c.GetRequest(ctx, &ubernowpb.GetRequestRequest{Id: 1, Token: testToken})
+			if err == nil && (len(r.History) != 1 || r.History[0].Status != ubernowpb.RequestStatus_REQUEST_STATUS_PENDING) {
+				t.Errorf("GetRequest() => got history: %v, expected the pending event", r.History)
+			}
+			if err == nil && r.Token != "" {
+				t.Errorf("GetRequest() => got token: %q, expected none", r.Token)
+			}
+			return err
+		}, codes.OK},
+		{"get request without its token", nil, func(c ubernowpb.UberNowClient) error {
+			_, err := c.GetRequest(ctx, &ubernowpb.GetRequestRequest{Id: 1, Token: "guessed"})
+			return err
+		}, codes.NotFound},
+		{"get unknown request", nil, func(c ubernowpb.UberNowClient) error {
+			_, err := c.GetRequest(ctx, &ubernowpb.GetRequestRequest{Id: 2})
+			return err
+		}, codes.NotFound},
+		{"cancel request", nil, func(c ubernowpb.UberNowClient) error {
+			r, err := c.CancelRequest(ctx, &ubernowpb.CancelRequestRequest{Id: 1, Token: testToken})
+			if err == nil && r.Status != ubernowpb.RequestStatus_REQUEST_STATUS_CANCELLED {
+				t.Errorf("CancelRequest() => got: %v, expected cancelled request", r)
+			}
+			return err
+		}, codes.OK},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := testClient(t, &MockUserRequestService{createErr: tc.createErr})
+			err := tc.call(c)
+			if status.Code(err) != tc.expectedCode {
+				t.Errorf("%s => got: %v, expected code: %s", tc.name, err, tc.expectedCode)
+			}
+		})
+	}
+}
+
+func TestServerDoesNotListUserRequests(t *testing.T) {
+	conn, _ := testConn(t, &MockUserRequestService{})
+	// the requests of a user were listed by the id of the user alone, without a token
+	err := conn.Invoke(context.Background(), "/ubernow.v1.UberNow/ListUserRequests", &ubernowpb.GetRequestRequest{Id: 7}, &ubernowpb.Request{})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("ListUserRequests => got: %v, expected code: %s", err, codes.Unimplemented)
+	}
+}
+
+func TestServerReportsInvalidFields(t *testing.T) {
+	c, _ := testClient(t, &MockUserRequestService{})
+	req := testCreateRequest()
+	req.Name = ""
+	req.CabType = ""
+	_, err := c.CreateRequest(context.Background(), req)
+
+	var fields []string
+	for _, d := range status.Convert(err).Details() {
+		if br, ok := d.(*errdetails.BadRequest); ok {
+			for _, v := range br.FieldViolations {
+				fields = append(fields, v.Field)
+			}
+		}
+	}
+	if len(fields) != 2 || fields[0] != "name" || fields[1] != "cab_type" {
+		t.Errorf("CreateRequest() with invalid fields => got violations of %v, expected [name cab_type]", fields)
+	}
+}
+
+func TestServerWatchRequest(t *testing.T) {
+	updates := make(chan usecases.RequestUpdate, 4)
+	c, _ := testClient(t, &MockUserRequestService{updates: updates})
+	stream, err := c.WatchRequest(context.Background(), &ubernowpb.WatchRequestRequest{Id: 1, Token: testToken})
+	if err != nil {
+		t.Fatalf("WatchRequest() => got: %v, expected: nil", err)
+	}
+
+	bookingTime := time.Date(2018, time.March, 9, 9, 10, 0, 0, time.UTC)
+	resp := &domain.CabBookingResponse{BookingID: 9, BestBookingTime: bookingTime}
+	update := func(s domain.RequestStatus, resp *domain.CabBookingResponse) usecases.RequestUpdate {
+		r := testRequest()
+		r.Status = s
+		return usecases.RequestUpdate{Request: r, Response: resp}
+	}
+	// the pending update is behind the request as it was sent first, so it is skipped
+	updates <- update(domain.RequestPending, nil)
+	updates <- update(domain.RequestScheduled, nil)
+	updates <- update(domain.RequestBookingTimeFound, resp)
+	updates <- update(domain.RequestNotified, resp)
+
+	expected := []ubernowpb.RequestStatus{
+		ubernowpb.RequestStatus_REQUEST_STATUS_PENDING,
+		ubernowpb.RequestStatus_REQUEST_STATUS_SCHEDULED,
+		ubernowpb.RequestStatus_REQUEST_STATUS_BOOKING_TIME_FOUND,
+		ubernowpb.RequestStatus_REQUEST_STATUS_NOTIFIED,
+	}
+	for _, s := range expected {
+		u, err := stream.Recv()
+		if err != nil || u.Request.Status != s {
+			t.Fatalf("Recv() => got: (%v, %v), expected an update to %s", u, err, s)
+		}
+		if s == ubernowpb.RequestStatus_REQUEST_STATUS_BOOKING_TIME_FOUND && !u.BookingResponse.BestBookingTime.AsTime().Equal(bookingTime) {
+			t.Errorf("Recv() => got: %v, expected the booking response", u)
+		}
+	}
+	if _, err := stream.Recv(); err == nil {
+		t.Errorf("Recv() after the request is notified => got: nil, expected the stream to end")
+	}
+}
+
+func TestServerCloseEndsWatches(t *testing.T) {
+	c, srv := testClient(t, &MockUserRequestService{updates: make(chan usecases.RequestUpdate)})
+	stream, _ := c.WatchRequest(context.Background(), &ubernowpb.WatchRequestRequest{Id: 1, Token: testToken})
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv() => got: %v, expected the request", err)
+	}
+	srv.Close()
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("Recv() after Close() => got: %v, expected code: %s", err, codes.Unavailable)
+	}
+}
@@ -0,0 +1,5 @@
+// package ubernowpb has the protobuf messages and the gRPC service of the uberNow API, which
+// are generated from ubernow.proto.
+package ubernowpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ubernow.proto
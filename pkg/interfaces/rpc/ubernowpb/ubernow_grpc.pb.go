@@ -0,0 +1,273 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: ubernow.proto
+
+package ubernowpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	UberNow_CreateRequest_FullMethodName = "/ubernow.v1.UberNow/CreateRequest"
+	UberNow_GetRequest_FullMethodName    = "/ubernow.v1.UberNow/GetRequest"
+	UberNow_CancelRequest_FullMethodName = "/ubernow.v1.UberNow/CancelRequest"
+	UberNow_WatchRequest_FullMethodName  = "/ubernow.v1.UberNow/WatchRequest"
+)
+
+// UberNowClient is the client API for UberNow service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// UberNow takes requests to be notified of when to book a cab, so that the user reaches the
+// destination at the reaching time.
+type UberNowClient interface {
+	// CreateRequest creates a request and starts processing it. Invalid input is
+	// INVALID_ARGUMENT with a google.rpc.BadRequest detail naming the invalid fields.
+	//
+	// A request with an idempotency key is created once, sending it again with the same key
+	// returns the request created the first time. Reusing the key for another request is
+	// INVALID_ARGUMENT, and a key whose request is still being created is ABORTED.
+	//
+	// The created request has its token, which the other calls of the request need.
+	CreateRequest(ctx context.Context, in *CreateRequestRequest, opts ...grpc.CallOption) (*Request, error)
+	// GetRequest returns a request with its status and the times found for it. A request
+	// whose token is not given is NOT_FOUND, like a request which doesn't exist.
+	GetRequest(ctx context.Context, in *GetRequestRequest, opts ...grpc.CallOption) (*Request, error)
+	// CancelRequest cancels a request, the user is not notified. A request which was already
+	// notified or cancelled is FAILED_PRECONDITION.
+	CancelRequest(ctx context.Context, in *CancelRequestRequest, opts ...grpc.CallOption) (*Request, error)
+	// WatchRequest sends the request as it is, and then every change of its status as it
+	// happens, until the request is notified or cancelled.
+	WatchRequest(ctx context.Context, in *WatchRequestRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RequestUpdate], error)
+}
+
+type uberNowClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUberNowClient(cc grpc.ClientConnInterface) UberNowClient {
+	return &uberNowClient{cc}
+}
+
+func (c *uberNowClient) CreateRequest(ctx context.Context, in *CreateRequestRequest, opts ...grpc.CallOption) (*Request, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Request)
+	err := c.cc.Invoke(ctx, UberNow_CreateRequest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uberNowClient) GetRequest(ctx context.Context, in *GetRequestRequest, opts ...grpc.CallOption) (*Request, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Request)
+	err := c.cc.Invoke(ctx, UberNow_GetRequest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uberNowClient) CancelRequest(ctx context.Context, in *CancelRequestRequest, opts ...grpc.CallOption) (*Request, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Request)
+	err := c.cc.Invoke(ctx, UberNow_CancelRequest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uberNowClient) WatchRequest(ctx context.Context, in *WatchRequestRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RequestUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &UberNow_ServiceDesc.Streams[0], UberNow_WatchRequest_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequestRequest, RequestUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UberNow_WatchRequestClient = grpc.ServerStreamingClient[RequestUpdate]
+
+// UberNowServer is the server API for UberNow service.
+// All implementations must embed UnimplementedUberNowServer
+// for forward compatibility.
+//
+// UberNow takes requests to be notified of when to book a cab, so that the user reaches the
+// destination at the reaching time.
+type UberNowServer interface {
+	// CreateRequest creates a request and starts processing it. Invalid input is
+	// INVALID_ARGUMENT with a google.rpc.BadRequest detail naming the invalid fields.
+	//
+	// A request with an idempotency key is created once, sending it again with the same key
+	// returns the request created the first time. Reusing the key for another request is
+	// INVALID_ARGUMENT, and a key whose request is still being created is ABORTED.
+	//
+	// The created request has its token, which the other calls of the request need.
+	CreateRequest(context.Context, *CreateRequestRequest) (*Request, error)
+	// GetRequest returns a request with its status and the times found for it. A request
+	// whose token is not given is NOT_FOUND, like a request which doesn't exist.
+	GetRequest(context.Context, *GetRequestRequest) (*Request, error)
+	// CancelRequest cancels a request, the user is not notified. A request which was already
+	// notified or cancelled is FAILED_PRECONDITION.
+	CancelRequest(context.Context, *CancelRequestRequest) (*Request, error)
+	// WatchRequest sends the request as it is, and then every change of its status as it
+	// happens, until the request is notified or cancelled.
+	WatchRequest(*WatchRequestRequest, grpc.ServerStreamingServer[RequestUpdate]) error
+	mustEmbedUnimplementedUberNowServer()
+}
+
+// UnimplementedUberNowServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedUberNowServer struct{}
+
+func (UnimplementedUberNowServer) CreateRequest(context.Context, *CreateRequestRequest) (*Request, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateRequest not implemented")
+}
+func (UnimplementedUberNowServer) GetRequest(context.Context, *GetRequestRequest) (*Request, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRequest not implemented")
+}
+func (UnimplementedUberNowServer) CancelRequest(context.Context, *CancelRequestRequest) (*Request, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelRequest not implemented")
+}
+func (UnimplementedUberNowServer) WatchRequest(*WatchRequestRequest, grpc.ServerStreamingServer[RequestUpdate]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchRequest not implemented")
+}
+func (UnimplementedUberNowServer) mustEmbedUnimplementedUberNowServer() {}
+func (UnimplementedUberNowServer) testEmbeddedByValue()                 {}
+
+// UnsafeUberNowServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UberNowServer will
+// result in compilation errors.
+type UnsafeUberNowServer interface {
+	mustEmbedUnimplementedUberNowServer()
+}
+
+func RegisterUberNowServer(s grpc.ServiceRegistrar, srv UberNowServer) {
+	// If the following call pancis, it indicates UnimplementedUberNowServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&UberNow_ServiceDesc, srv)
+}
+
+func _UberNow_CreateRequest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRequestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UberNowServer).CreateRequest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UberNow_CreateRequest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UberNowServer).CreateRequest(ctx, req.(*CreateRequestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UberNow_GetRequest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UberNowServer).GetRequest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UberNow_GetRequest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UberNowServer).GetRequest(ctx, req.(*GetRequestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UberNow_CancelRequest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelRequestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UberNowServer).CancelRequest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UberNow_CancelRequest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UberNowServer).CancelRequest(ctx, req.(*CancelRequestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UberNow_WatchRequest_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequestRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UberNowServer).WatchRequest(m, &grpc.GenericServerStream[WatchRequestRequest, RequestUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UberNow_WatchRequestServer = grpc.ServerStreamingServer[RequestUpdate]
+
+// UberNow_ServiceDesc is the grpc.ServiceDesc for UberNow service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var UberNow_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ubernow.v1.UberNow",
+	HandlerType: (*UberNowServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateRequest",
+			Handler:    _UberNow_CreateRequest_Handler,
+		},
+		{
+			MethodName: "GetRequest",
+			Handler:    _UberNow_GetRequest_Handler,
+		},
+		{
+			MethodName: "CancelRequest",
+			Handler:    _UberNow_CancelRequest_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchRequest",
+			Handler:       _UberNow_WatchRequest_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "ubernow.proto",
+}
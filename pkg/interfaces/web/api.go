@@ -0,0 +1,223 @@
+// package web has the HTTP delivery mechanisms of the application, a JSON REST API and an
+// HTML frontend over the use cases of the UserInteractor. The frontend is served by UI.
+//
+// The API has these endpoints:
+//
+//	POST /api/requests                         create a request
+//	GET  /api/requests/{id}                    get a request, its status and booking time
+//	POST /api/requests/{id}/cancel             cancel a request
+//	POST /api/users/{id}/addresses/confirm     confirm an address of a user
+//	GET  /api/deadletters                      list the jobs which failed for good
+//
+// A request belongs to the user who confirmed its notification address. A request notified
+// at an address no one confirmed creates a new user, and the address is sent the code which
+// confirms it for the user. Confirming takes the code with the address, as in
+// {"type": "email", "value": "roy@example.com", "code": "..."}.
+//
+// A request is created with a token, which is only returned by POST /api/requests. Reading
+// and cancelling the request need it in an "Authorization: Bearer <token>" header, without
+// it the request is not found.
+//
+// A request created with an Idempotency-Key header is created once, sending it again with
+// the same key returns the request created the first time.
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// UserRequestService exposes the use cases the API serves, it is implemented by
+// usecases.UserInteractor.
+type UserRequestService interface {
+	CreateUserRequest(usecases.UserRequestDTO) (*domain.UserRequest, error)
+	GetUserRequest(uint64, string) (*domain.Request, error)
+	CancelUserRequest(uint64, string) (*domain.Request, error)
+	ConfirmUserAddress(uint64, domain.UserAddress, string) (*domain.User, error)
+	CabCatalog() domain.CabCatalog
+}
+
+// DeadLetterService exposes the dead letters the API lists, it is implemented by
+// usecases.DeadLetterInteractor.
+type DeadLetterService interface {
+	ListDeadLetters() ([]usecases.DeadLetter, error)
+}
+
+// API is the http.Handler of the JSON REST API.
+type API struct {
+	service     UserRequestService
+	deadLetters DeadLetterService
+	logger      domain.Logger
+	mux         *http.ServeMux
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mux.ServeHTTP(w, r)
+}
+
+// requests serves POST /api/requests.
+func (a *API) requests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		a.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	dto, err := decodeUserRequestJSON(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err == nil {
+		err = dto.SetIdempotencyKey(r.Header.Get("Idempotency-Key"))
+	}
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+	ur, err := a.service.CreateUserRequest(dto)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+	a.logger.Info("created request",
+		domain.NewField(domain.RequestIDKey, ur.Request.ID()),
+		domain.NewField("user_id", ur.User.UserID),
+	)
+	w.Header().Set("Location", "/api/requests/"+strconv.FormatUint(ur.Request.ID(), 10))
+	resp := newRequestResponse(ur.Request)
+	// the token is only given to who made the request
+	resp.Token = ur.Request.Token
+	a.writeJSON(w, http.StatusCreated, resp)
+}
+
+// request serves GET /api/requests/{id} and POST /api/requests/{id}/cancel.
+func (a *API) request(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/requests/")
+	parts := strings.Split(rest, "/")
+	id, ok := parseID(parts[0])
+	if !ok || len(parts) > 2 {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		if r.Method != http.MethodGet {
+			a.methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		req, err := a.service.GetUserRequest(id, bearerToken(r))
+		if err != nil {
+			a.writeError(w, err)
+			return
+		}
+		a.writeJSON(w, http.StatusOK, newRequestResponse(req))
+	case parts[1] == "cancel":
+		if r.Method != http.MethodPost {
+			a.methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		req, err := a.service.CancelUserRequest(id, bearerToken(r))
+		if err != nil {
+			a.writeError(w, err)
+			return
+		}
+		a.logger.Info("cancelled request", domain.NewField(domain.RequestIDKey, id))
+		a.writeJSON(w, http.StatusOK, newRequestResponse(req))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// user serves POST /api/users/{id}/addresses/confirm.
+func (a *API) user(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/users/")
+	parts := strings.Split(rest, "/")
+	id, ok := parseID(parts[0])
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(parts) == 3 && parts[1] == "addresses" && parts[2] == "confirm":
+		if r.Method != http.MethodPost {
+			a.methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		var in addressConfirmation
+		if err := decodeJSON(http.MaxBytesReader(w, r.Body, maxBodyBytes), &in); err != nil {
+			a.writeError(w, err)
+			return
+		}
+		u, err := a.service.ConfirmUserAddress(id, domain.UserAddress{AddrType: in.Type, Value: in.Value}, in.Code)
+		if err != nil {
+			a.writeError(w, err)
+			return
+		}
+		a.logger.Info("confirmed user address", domain.NewField("user_id", id))
+		a.writeJSON(w, http.StatusOK, newUserResponse(u))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// listDeadLetters serves GET /api/deadletters.
+func (a *API) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		a.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	dls, err := a.deadLetters.ListDeadLetters()
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+	resp := deadLettersResponse{DeadLetters: make([]deadLetterResponse, 0, len(dls))}
+	for _, dl := range dls {
+		resp.DeadLetters = append(resp.DeadLetters, deadLetterResponse{
+			ID:        dl.ID,
+			JobType:   dl.JobType,
+			RequestID: dl.RequestID,
+			Attempts:  dl.Attempts,
+			LastError: dl.LastError,
+			FailedAt:  dl.FailedAt,
+		})
+	}
+	a.writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *API) methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	a.writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+}
+
+// bearerToken returns the token of the Authorization header, or "" if there is none.
+func bearerToken(r *http.Request) string {
+	const prefix = "Bearer "
+	h := r.Header.Get("Authorization")
+	if len(h) < len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return ""
+	}
+	return strings.TrimSpace(h[len(prefix):])
+}
+
+func parseID(s string) (uint64, bool) {
+	id, err := strconv.ParseUint(s, 10, 64)
+	return id, err == nil && id > 0
+}
+
+// NewAPI is a constructor which takes the UserRequestService, the DeadLetterService and a
+// Logger and returns a pointer to a new API.
+func NewAPI(s UserRequestService, d DeadLetterService, logger domain.Logger) *API {
+	a := API{
+		service:     s,
+		deadLetters: d,
+		logger:      logger,
+		mux:         http.NewServeMux(),
+	}
+	a.mux.HandleFunc("/api/requests", a.requests)
+	a.mux.HandleFunc("/api/requests/", a.request)
+	a.mux.HandleFunc("/api/users/", a.user)
+	a.mux.HandleFunc("/api/deadletters", a.listDeadLetters)
+	return &a
+}
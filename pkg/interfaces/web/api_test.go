@@ -0,0 +1,267 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// MockLogger implements the domain.Logger interface and drops every line.
+type MockLogger struct{}
+
+func (l *MockLogger) Debug(m string, fields ...domain.Field)    {}
+func (l *MockLogger) Info(m string, fields ...domain.Field)     {}
+func (l *MockLogger) Warn(m string, fields ...domain.Field)     {}
+func (l *MockLogger) Error(m string, fields ...domain.Field)    {}
+func (l *MockLogger) With(fields ...domain.Field) domain.Logger { return l }
+
+// testToken is the token of request 1.
+const testToken = "9f86d081884c7d65"
+
+// MockUserRequestService implements the UserRequestService interface, it knows request 1
+// of user 7, whose token is testToken, and returns createErr from CreateUserRequest. The address taken@example.com
+// belongs to another user.
+type MockUserRequestService struct {
+	createErr error
+	// cabs is the catalog of the service, the uber cabs if it is nil
+	cabs domain.CabCatalog
+}
+
+func testRequest() *domain.Request {
+	r := &domain.Request{
+		Token:            testToken,
+		UserID:           7,
+		Source:           domain.Location{Latitude: "77.134134", Longitude: "45.1341324"},
+		Destination:      domain.Location{Latitude: "77.234134", Longitude: "45.5641324"},
+		ReachingTime:     time.Date(2018, time.March, 9, 10, 0, 0, 0, time.UTC),
+		Cab:              "uber",
+		CabType:          "uberGo",
+		NotificationAddr: domain.UserAddress{AddrType: "email", Value: "anirban.nick@gmail.com"},
+		Status:           domain.RequestBookingTimeFound,
+		BookingTime:      time.Date(2018, time.March, 9, 9, 10, 0, 0, time.UTC),
+		History: []domain.RequestEvent{
+			{Status: domain.RequestPending, At: time.Date(2018, time.March, 9, 8, 0, 0, 0, time.UTC)},
+			{Status: domain.RequestScheduled, At: time.Date(2018, time.March, 9, 8, 0, 1, 0, time.UTC)},
+			{Status: domain.RequestBookingTimeFound, At: time.Date(2018, time.March, 9, 8, 50, 0, 0, time.UTC)},
+		},
+	}
+	r.SetID(1)
+	return r
+}
+
+func (s *MockUserRequestService) CreateUserRequest(dto usecases.UserRequestDTO) (*domain.UserRequest, error) {
+	if s.createErr != nil {
+		return nil, s.createErr
+	}
+	u := domain.NewUser("roy")
+	u.UserID = 7
+	return domain.NewUserRequest(u, testRequest()), nil
+}
+
+func (s *MockUserRequestService) GetUserRequest(id uint64, token string) (*domain.Request, error) {
+	if id != 1 {
+		return nil, errors.Wrap(domain.ErrNotFound, "GetUserRequest")
+	}
+	r := testRequest()
+	if err := r.Authorize(token); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *MockUserRequestService) CancelUserRequest(id uint64, token string) (*domain.Request, error) {
+	r, err := s.GetUserRequest(id, token)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.Cancel(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func testUser() *domain.User {
+	u := domain.NewUser("roy")
+	u.UserID = 7
+	u.AddAddress(domain.UserAddress{AddrType: "email", Value: "anirban.nick@gmail.com"})
+	return u
+}
+
+func (s *MockUserRequestService) ConfirmUserAddress(id uint64, addr domain.UserAddress, code string) (*domain.User, error) {
+	if id != 7 {
+		return nil, errors.Wrap(domain.ErrNotFound, "ConfirmUserAddress")
+	}
+	if code != "0123abcd" {
+		return nil, errors.Wrap(domain.NewValidationError("code", "is not the code sent to the address"), "ConfirmUserAddress")
+	}
+	if addr.Value == "taken@example.com" {
+		return nil, errors.Wrap(domain.ErrAddressTaken, "ConfirmUserAddress")
+	}
+	u := testUser()
+	u.AddAddress(addr)
+	return u, nil
+}
+
+func (s *MockUserRequestService) CabCatalog() domain.CabCatalog {
+	if s.cabs != nil {
+		return s.cabs
+	}
+	return domain.CabCatalog{{Name: "uber", Types: []string{"uberGo", "uberX"}}}
+}
+
+// MockDeadLetterService implements the DeadLetterService interface, it returns err or a
+// dead letter of request 1.
+type MockDeadLetterService struct {
+	err error
+}
+
+func (d *MockDeadLetterService) ListDeadLetters() ([]usecases.DeadLetter, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	dl := usecases.DeadLetter{
+		ID:        3,
+		JobType:   usecases.NotificationJobType,
+		RequestID: 1,
+		Attempts:  5,
+		LastError: "smtp server unreachable",
+		FailedAt:  time.Date(2018, time.March, 9, 9, 11, 0, 0, time.UTC),
+	}
+	return []usecases.DeadLetter{dl}, nil
+}
+
+const validBody = `{
+	"name": "roy",
+	"source": {"latitude": "77.134134", "longitude": "45.1341324"},
+	"destination": {"latitude": "77.234134", "longitude": "45.5641324"},
+	"reaching_time": "2018-03-09T10:00:00Z",
+	"cab": "uber",
+	"cab_type": "uberGo",
+	"notification_addr": {"type": "email", "value": "anirban.nick@gmail.com"}
+}`
+
+func TestAPI(t *testing.T) {
+	testCases := []struct {
+		name           string
+		createErr      error
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"create request", nil, "POST", "/api/requests", validBody, http.StatusCreated, `"status":"booking_time_found"`},
+		{"create with malformed JSON", nil, "POST", "/api/requests", `{"name":`, http.StatusBadRequest, `"error":`},
+		{"create with unknown field", nil, "POST", "/api/requests", `{"nmae":"roy"}`, http.StatusBadRequest, `"error":`},
+		{"create with missing fields", nil, "POST", "/api/requests", `{"name":"roy"}`, http.StatusUnprocessableEntity, `"errors":[{"field":"source.latitude"`},
+		{"create with invalid input", domain.NewValidationError("cab", "requested cab: ola not avaialable"), "POST", "/api/requests", validBody, http.StatusUnprocessableEntity, `"field":"cab"`},
+		{"create with wrapped invalid input", errors.Wrap(domain.NewValidationError("source", "not valid"), "CreateUserRequest"), "POST", "/api/requests", validBody, http.StatusUnprocessableEntity, `"field":"source"`},
+		{"create with full queue", errors.Wrap(usecases.ErrQueueFull, "TrafficAppEngine"), "POST", "/api/requests", validBody, http.StatusServiceUnavailable, `"error":`},
+		{"create with repository failure", errors.New("disk on fire"), "POST", "/api/requests", validBody, http.StatusInternalServerError, `"error":"internal error"`},
+		{"create with GET", nil, "GET", "/api/requests", "", http.StatusMethodNotAllowed, `"error":`},
+		{"create with reused idempotency key", errors.Wrap(usecases.ErrIdempotencyKeyReused, "CreateUserRequest"), "POST", "/api/requests", validBody, http.StatusUnprocessableEntity, `"field":"idempotency_key"`},
+		{"create with idempotency key in use", errors.Wrap(usecases.ErrIdempotencyKeyInUse, "CreateUserRequest"), "POST", "/api/requests", validBody, http.StatusConflict, `"error":`},
+		{"get request", nil, "GET", "/api/requests/1", "", http.StatusOK, `"booking_time":"2018-03-09T09:10:00Z"`},
+		{"get request history", nil, "GET", "/api/requests/1", "", http.StatusOK, `"history":[{"status":"pending","at":"2018-03-09T08:00:00Z"},{"status":"scheduled"`},
+		{"get unknown request", nil, "GET", "/api/requests/2", "", http.StatusNotFound, `"error":"not found"`},
+		{"get request with bad id", nil, "GET", "/api/requests/abc", "", http.StatusNotFound, ""},
+		{"cancel request", nil, "POST", "/api/requests/1/cancel", "", http.StatusOK, `"status":"cancelled"`},
+		{"cancel with GET", nil, "GET", "/api/requests/1/cancel", "", http.StatusMethodNotAllowed, ""},
+		{"list user requests without credentials", nil, "GET", "/api/users/7/requests", "", http.StatusNotFound, ""},
+		{"confirm user address", nil, "POST", "/api/users/7/addresses/confirm", `{"type":"email","value":"roy@example.com","code":"0123abcd"}`, http.StatusOK, `{"type":"email","value":"roy@example.com"}`},
+		{"confirm address with wrong code", nil, "POST", "/api/users/7/addresses/confirm", `{"type":"email","value":"roy@example.com","code":"guess"}`, http.StatusUnprocessableEntity, `"field":"code"`},
+		{"confirm address of another user", nil, "POST", "/api/users/7/addresses/confirm", `{"type":"email","value":"taken@example.com","code":"0123abcd"}`, http.StatusConflict, `"error":"address belongs to another user"`},
+		{"confirm address of unknown user", nil, "POST", "/api/users/8/addresses/confirm", `{"type":"email","value":"roy@example.com","code":"0123abcd"}`, http.StatusNotFound, ""},
+		{"confirm address with unknown field", nil, "POST", "/api/users/7/addresses/confirm", `{"kind":"email"}`, http.StatusBadRequest, ""},
+		{"confirm address with GET", nil, "GET", "/api/users/7/addresses/confirm", "", http.StatusMethodNotAllowed, ""},
+		{"get user is gone", nil, "GET", "/api/users/7", "", http.StatusNotFound, ""},
+		{"save user address is gone", nil, "POST", "/api/users/7/addresses", `{"type":"email","value":"roy@example.com"}`, http.StatusNotFound, ""},
+		{"save user place is gone", nil, "POST", "/api/users/7/places", `{"name":"home","latitude":"12.9352","longitude":"77.6245"}`, http.StatusNotFound, ""},
+		{"unknown user path", nil, "GET", "/api/users/7/cabs", "", http.StatusNotFound, ""},
+		{"list dead letters", nil, "GET", "/api/deadletters", "", http.StatusOK, `"dead_letters":[{"id":3,"job_type":"notification","request_id":1,"attempts":5`},
+		{"list dead letters with POST", nil, "POST", "/api/deadletters", "", http.StatusMethodNotAllowed, ""},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			api := NewAPI(&MockUserRequestService{createErr: tc.createErr}, &MockDeadLetterService{}, &MockLogger{})
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			rec := httptest.NewRecorder()
+			api.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus || !strings.Contains(rec.Body.String(), tc.expectedBody) {
+				t.Errorf("%s %s => got: (%d, %s), expected: (%d, containing %s)", tc.method, tc.path, rec.Code, rec.Body.String(), tc.expectedStatus, tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestAPIRejectsLongIdempotencyKey(t *testing.T) {
+	api := NewAPI(&MockUserRequestService{}, &MockDeadLetterService{}, &MockLogger{})
+	req := httptest.NewRequest("POST", "/api/requests", strings.NewReader(validBody))
+	req.Header.Set("Idempotency-Key", strings.Repeat("k", 256))
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), `"field":"idempotency_key"`) {
+		t.Errorf("POST /api/requests with a long Idempotency-Key => got: (%d, %s), expected: (%d, an error of idempotency_key)", rec.Code, rec.Body.String(), http.StatusUnprocessableEntity)
+	}
+}
+
+func TestAPICreateSetsLocation(t *testing.T) {
+	api := NewAPI(&MockUserRequestService{}, &MockDeadLetterService{}, &MockLogger{})
+	rec := httptest.NewRecorder()
+	api.ServeHTTP(rec, httptest.NewRequest("POST", "/api/requests", strings.NewReader(validBody)))
+
+	if loc := rec.Header().Get("Location"); loc != "/api/requests/1" {
+		t.Errorf("Location => got: %s, expected: /api/requests/1", loc)
+	}
+	var resp requestResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.ID != 1 || resp.UserID != 7 || resp.Token != testToken {
+		t.Errorf("response => got: (%+v, %v), expected request 1 of user 7 with its token", resp, err)
+	}
+}
+
+func TestAPINeedsRequestToken(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		authorization  string
+		expectedStatus int
+	}{
+		{name: "get without token", method: "GET", path: "/api/requests/1", authorization: "", expectedStatus: http.StatusNotFound},
+		{name: "get with another token", method: "GET", path: "/api/requests/1", authorization: "Bearer 0000", expectedStatus: http.StatusNotFound},
+		{name: "get with token but no scheme", method: "GET", path: "/api/requests/1", authorization: testToken, expectedStatus: http.StatusNotFound},
+		{name: "get with token", method: "GET", path: "/api/requests/1", authorization: "bearer " + testToken, expectedStatus: http.StatusOK},
+		{name: "cancel without token", method: "POST", path: "/api/requests/1/cancel", authorization: "", expectedStatus: http.StatusNotFound},
+		{name: "cancel with another token", method: "POST", path: "/api/requests/1/cancel", authorization: "Bearer 0000", expectedStatus: http.StatusNotFound},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		api := NewAPI(&MockUserRequestService{}, &MockDeadLetterService{}, &MockLogger{})
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.authorization != "" {
+			req.Header.Set("Authorization", tc.authorization)
+		}
+		rec := httptest.NewRecorder()
+		api.ServeHTTP(rec, req)
+		if rec.Code != tc.expectedStatus {
+			t.Errorf("%s: %s %s => got: %d, expected: %d", tc.name, tc.method, tc.path, rec.Code, tc.expectedStatus)
+		}
+		if strings.Contains(rec.Body.String(), testToken) {
+			t.Errorf("%s: %s %s => got the token in the response, expected it only when the request is created", tc.name, tc.method, tc.path)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package web
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// errMalformedInput is the cause of the errors returned for input which can't be decoded at
+// all, like broken JSON or an unknown field, as opposed to a domain.ValidationError for a
+// field whose value is not valid.
+var errMalformedInput = errors.New("malformed input")
+
+// addressConfirmation is the body of POST /api/users/{id}/addresses/confirm, an address
+// and the code which was sent to it.
+type addressConfirmation struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	Code  string `json:"code"`
+}
+
+// decodeJSON decodes the JSON read from r into v. Unknown fields and anything but a single
+// JSON object are errMalformedInput, values of the wrong JSON type are a ValidationError of
+// their field.
+func decodeJSON(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		if t, ok := err.(*json.UnmarshalTypeError); ok && t.Field != "" {
+			return errors.Wrap(domain.NewValidationError(t.Field, "must be a %s", t.Type), "decodeJSON got invalid input")
+		}
+		return errors.Wrap(errMalformedInput, err.Error())
+	}
+	if dec.More() {
+		return errors.Wrap(errMalformedInput, "more than one JSON value")
+	}
+	return nil
+}
+
+// decodeUserRequestJSON decodes a UserRequestInput from the JSON read from r with
+// decodeJSON and returns its UserRequestDTO.
+func decodeUserRequestJSON(r io.Reader) (usecases.UserRequestDTO, error) {
+	var in usecases.UserRequestInput
+	if err := decodeJSON(r, &in); err != nil {
+		return usecases.UserRequestDTO{}, err
+	}
+	return in.DTO()
+}
+
+// userRequestInputOfForm returns the UserRequestInput of the values of a form. The form has
+// the fields name, source_name, source_latitude, source_longitude, destination_name,
+// destination_latitude, destination_longitude, reaching_time, cab, cab_type,
+// notification_type and notification_value. The reaching time can also be given as the
+// value of an HTML datetime-local input.
+func userRequestInputOfForm(form url.Values) usecases.UserRequestInput {
+	return usecases.UserRequestInput{
+		Name: form.Get("name"),
+		Source: usecases.LocationInput{
+			Name:      form.Get("source_name"),
+			Latitude:  form.Get("source_latitude"),
+			Longitude: form.Get("source_longitude"),
+		},
+		Destination: usecases.LocationInput{
+			Name:      form.Get("destination_name"),
+			Latitude:  form.Get("destination_latitude"),
+			Longitude: form.Get("destination_longitude"),
+		},
+		ReachingTime: form.Get("reaching_time"),
+		Cab:          form.Get("cab"),
+		CabType:      form.Get("cab_type"),
+		NotificationAddr: usecases.AddressInput{
+			Type:  form.Get("notification_type"),
+			Value: form.Get("notification_value"),
+		},
+	}
+}
@@ -0,0 +1,72 @@
+package web
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+func TestDecodeUserRequestJSON(t *testing.T) {
+	valid := `{
+		"name": "roy",
+		"source": {"name": "home", "latitude": "77.134134", "longitude": "45.1341324"},
+		"destination": {"latitude": "77.234134", "longitude": "45.5641324"},
+		"reaching_time": "2018-03-09T10:00:00Z",
+		"cab": "uber",
+		"cab_type": "uberGo",
+		"notification_addr": {"type": "email", "value": "anirban.nick@gmail.com"}
+	}`
+	testCases := []struct {
+		name          string
+		body          string
+		expectedField string
+		malformed     bool
+	}{
+		{name: "valid request", body: valid},
+		{name: "invalid request", body: `{"name": "roy", "cab": "uber"}`, expectedField: "source.latitude"},
+		{name: "wrong JSON type", body: `{"name": 7}`, expectedField: "name"},
+		{name: "broken JSON", body: `{"name":`, malformed: true},
+		{name: "unknown field", body: `{"nmae": "roy"}`, malformed: true},
+		{name: "two JSON values", body: valid + valid, malformed: true},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := decodeUserRequestJSON(strings.NewReader(tc.body))
+			var field string
+			switch v := errors.Cause(err).(type) {
+			case *domain.ValidationError:
+				field = v.Field
+			case domain.ValidationErrors:
+				field = v[0].Field
+			}
+			if (errors.Cause(err) == errMalformedInput) != tc.malformed || field != tc.expectedField ||
+				(err != nil && !tc.malformed && tc.expectedField == "") {
+				t.Errorf("%s: decodeUserRequestJSON() => got: %v, expected: malformed %v, field %q", tc.name, err, tc.malformed, tc.expectedField)
+			}
+		})
+	}
+}
+
+func TestUserRequestInputOfForm(t *testing.T) {
+	form := testForm()
+	form.Set("source_name", "home")
+	expected := usecases.UserRequestInput{
+		Name:             form.Get("name"),
+		Source:           usecases.LocationInput{Name: "home", Latitude: form.Get("source_latitude"), Longitude: form.Get("source_longitude")},
+		Destination:      usecases.LocationInput{Latitude: form.Get("destination_latitude"), Longitude: form.Get("destination_longitude")},
+		ReachingTime:     form.Get("reaching_time"),
+		Cab:              form.Get("cab"),
+		CabType:          form.Get("cab_type"),
+		NotificationAddr: usecases.AddressInput{Type: form.Get("notification_type"), Value: form.Get("notification_value")},
+	}
+	if in := userRequestInputOfForm(form); !reflect.DeepEqual(in, expected) {
+		t.Errorf("userRequestInputOfForm() => got: %+v, expected: %+v", in, expected)
+	}
+}
@@ -0,0 +1,177 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+// maxBodyBytes is the largest request body the API reads.
+const maxBodyBytes = 1 << 20
+
+type location struct {
+	Name      string `json:"name,omitempty"`
+	Latitude  string `json:"latitude"`
+	Longitude string `json:"longitude"`
+}
+
+func newLocation(l domain.Location) location {
+	return location{Name: l.Name, Latitude: l.Latitude, Longitude: l.Longitude}
+}
+
+type address struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// requestResponse is how a request is returned by the API. Its Token is only set when the
+// request is created.
+type requestResponse struct {
+	ID               uint64     `json:"id"`
+	Token            string     `json:"token,omitempty"`
+	UserID           uint64     `json:"user_id"`
+	Source           location   `json:"source"`
+	Destination      location   `json:"destination"`
+	ReachingTime     time.Time  `json:"reaching_time"`
+	Cab              string     `json:"cab"`
+	CabType          string     `json:"cab_type"`
+	NotificationAddr address    `json:"notification_addr"`
+	Status           string     `json:"status"`
+	TriggerTime      *time.Time `json:"trigger_time,omitempty"`
+	BookingTime      *time.Time `json:"booking_time,omitempty"`
+	History          []event    `json:"history"`
+}
+
+// event is a change of the status of a request.
+type event struct {
+	Status string    `json:"status"`
+	At     time.Time `json:"at"`
+}
+
+func newRequestResponse(r *domain.Request) requestResponse {
+	resp := requestResponse{
+		ID:               r.ID(),
+		UserID:           r.UserID,
+		Source:           newLocation(r.Source),
+		Destination:      newLocation(r.Destination),
+		ReachingTime:     r.ReachingTime,
+		Cab:              r.Cab,
+		CabType:          r.CabType,
+		NotificationAddr: address{Type: r.NotificationAddr.AddrType, Value: r.NotificationAddr.Value},
+		Status:           string(r.Status),
+		History:          make([]event, 0, len(r.History)),
+	}
+	for _, e := range r.History {
+		resp.History = append(resp.History, event{Status: string(e.Status), At: e.At})
+	}
+	if !r.TriggerTime.IsZero() {
+		t := r.TriggerTime
+		resp.TriggerTime = &t
+	}
+	if !r.BookingTime.IsZero() {
+		t := r.BookingTime
+		resp.BookingTime = &t
+	}
+	return resp
+}
+
+// userResponse is how a user is returned by the API.
+type userResponse struct {
+	ID        uint64     `json:"id"`
+	Name      string     `json:"name"`
+	Addresses []address  `json:"addresses"`
+	Places    []location `json:"places"`
+}
+
+func newUserResponse(u *domain.User) userResponse {
+	resp := userResponse{
+		ID:        u.UserID,
+		Name:      u.Name,
+		Addresses: make([]address, 0, len(u.Addresses)),
+		Places:    make([]location, 0, len(u.Places)),
+	}
+	for _, a := range u.Addresses {
+		resp.Addresses = append(resp.Addresses, address{Type: a.AddrType, Value: a.Value})
+	}
+	for _, p := range u.Places {
+		resp.Places = append(resp.Places, newLocation(p))
+	}
+	return resp
+}
+
+// deadLetterResponse is how a dead letter is returned by the API, without its job.
+type deadLetterResponse struct {
+	ID        uint64    `json:"id"`
+	JobType   string    `json:"job_type"`
+	RequestID uint64    `json:"request_id"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	FailedAt  time.Time `json:"failed_at"`
+}
+
+type deadLettersResponse struct {
+	DeadLetters []deadLetterResponse `json:"dead_letters"`
+}
+
+type errorResponse struct {
+	Error  string       `json:"error"`
+	Field  string       `json:"field,omitempty"`
+	Errors []fieldError `json:"errors,omitempty"`
+}
+
+type fieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+func (a *API) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		a.logger.Warn("couldn't write response", domain.NewField(domain.ErrorKey, err))
+	}
+}
+
+// writeError maps err to the status code of the response. Invalid input is a 4xx, the
+// caller has to change it. A full job queue is a 503 and an idempotency key whose request
+// is being created is a 409, the caller can try again later.
+// Everything else is a 500 whose details are logged but not returned.
+func (a *API) writeError(w http.ResponseWriter, err error) {
+	cause := errors.Cause(err)
+	switch v := cause.(type) {
+	case *domain.ValidationError:
+		a.writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: v.Reason, Field: v.Field})
+		return
+	case domain.ValidationErrors:
+		resp := errorResponse{Error: "invalid input"}
+		for _, e := range v {
+			resp.Errors = append(resp.Errors, fieldError{Field: e.Field, Error: e.Reason})
+		}
+		a.writeJSON(w, http.StatusUnprocessableEntity, resp)
+		return
+	}
+	switch cause {
+	case errMalformedInput:
+		a.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+	case domain.ErrNotFound:
+		a.writeJSON(w, http.StatusNotFound, errorResponse{Error: "not found"})
+	case domain.ErrRequestFinished, domain.ErrAddressTaken, domain.ErrConflict:
+		a.writeJSON(w, http.StatusConflict, errorResponse{Error: cause.Error()})
+	case usecases.ErrIdempotencyKeyReused:
+		a.writeJSON(w, http.StatusUnprocessableEntity, errorResponse{Error: cause.Error(), Field: "idempotency_key"})
+	case usecases.ErrIdempotencyKeyInUse:
+		w.Header().Set("Retry-After", "1")
+		a.writeJSON(w, http.StatusConflict, errorResponse{Error: cause.Error()})
+	case usecases.ErrQueueFull:
+		w.Header().Set("Retry-After", "30")
+		a.writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: "too many requests are being processed, try again later"})
+	default:
+		a.logger.Error("request failed", domain.NewField(domain.ErrorKey, err))
+		a.writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal error"})
+	}
+}
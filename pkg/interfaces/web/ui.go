@@ -0,0 +1,390 @@
+package web
+
+import (
+	"bytes"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+//go:embed ui/templates ui/static
+var uiAssets embed.FS
+
+// UI is the http.Handler of the HTML frontend. It serves server-rendered pages which work
+// without JavaScript:
+//
+//	GET  /                        the request form
+//	POST /requests                create a request and redirect to its status page
+//	GET  /requests/{id}           the status page of a request
+//	POST /requests/{id}/cancel    cancel a request and redirect to its status page
+//	GET  /static/                 the stylesheet
+//
+// The status page of a request is only found with the token of the request in its URL,
+// /requests/{id}?token={token}, which is where the form redirects to. The cancel button
+// sends the token along. Forms which are sent from the pages of another site are
+// forbidden, see sameOrigin.
+type UI struct {
+	service UserRequestService
+	logger  domain.Logger
+	pages   map[string]*template.Template
+	mux     *http.ServeMux
+}
+
+// formPage is the data of the request form, Values and Errors are keyed by the names of the
+// form fields, Error is shown above the form.
+type formPage struct {
+	Values url.Values
+	Errors map[string]string
+	Error  string
+	Cabs   interface{}
+}
+
+// step is one stage of the lifecycle of a request on its status page.
+type step struct {
+	Name string
+	Done bool
+	Time time.Time
+}
+
+type statusPage struct {
+	Request     *domain.Request
+	Token       string
+	Steps       []step
+	Cancellable bool
+	Refresh     bool
+}
+
+type errorPage struct {
+	Title   string
+	Message string
+}
+
+func (u *UI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && !sameOrigin(r) {
+		u.renderError(w, http.StatusForbidden, "Forbidden", "The form was sent from another site.")
+		return
+	}
+	u.mux.ServeHTTP(w, r)
+}
+
+// sameOrigin reports whether the request was not sent by a page of another site, which
+// could make the browser of a user create or cancel requests. Browsers tell where a request
+// comes from in Sec-Fetch-Site, older ones only in Origin. A request with neither is not
+// sent by a browser, like one of curl, so it isn't forged by a site.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return true
+	case "":
+	default:
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	o, err := url.Parse(origin)
+	return err == nil && o.Host == r.Host
+}
+
+// form serves GET /.
+func (u *UI) form(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		u.renderError(w, http.StatusNotFound, "Not found", "There is no such page.")
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet)
+		u.renderError(w, http.StatusMethodNotAllowed, "Method not allowed", "The form is sent to /requests.")
+		return
+	}
+	values := url.Values{}
+	values.Set("idempotency_key", newIdempotencyKey())
+	u.render(w, http.StatusOK, "form", formPage{Values: values, Cabs: u.service.CabCatalog()})
+}
+
+// create serves POST /requests.
+func (u *UI) create(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		u.renderError(w, http.StatusMethodNotAllowed, "Method not allowed", "Requests are made with the form.")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	if err := r.ParseForm(); err != nil {
+		u.renderError(w, http.StatusBadRequest, "Bad request", "The form couldn't be read, please send it again.")
+		return
+	}
+	form := r.PostForm
+	cabs := u.service.CabCatalog()
+	if form.Get("cab") == "" {
+		form.Set("cab", cabOf(cabs, form.Get("cab_type")))
+	}
+
+	page := formPage{Values: form, Errors: make(map[string]string), Cabs: cabs}
+	dto, err := userRequestInputOfForm(form).DTO()
+	if err == nil {
+		// the key of the form makes a form which is sent twice, like on a double click,
+		// create one request
+		err = dto.SetIdempotencyKey(form.Get("idempotency_key"))
+	}
+	if err == nil {
+		var ur *domain.UserRequest
+		ur, err = u.service.CreateUserRequest(dto)
+		if err == nil {
+			u.logger.Info("created request",
+				domain.NewField(domain.RequestIDKey, ur.Request.ID()),
+				domain.NewField("user_id", ur.User.UserID),
+			)
+			http.Redirect(w, r, requestPath(ur.Request.ID(), ur.Request.Token), http.StatusSeeOther)
+			return
+		}
+	}
+
+	status := http.StatusUnprocessableEntity
+	switch v := errors.Cause(err).(type) {
+	case *domain.ValidationError:
+		page.addError(v)
+	case domain.ValidationErrors:
+		for _, e := range v {
+			page.addError(e)
+		}
+	default:
+		switch errors.Cause(err) {
+		case usecases.ErrQueueFull:
+			status = http.StatusServiceUnavailable
+			w.Header().Set("Retry-After", "30")
+			page.Error = "Too many requests are being processed right now, please try again in a minute."
+		case usecases.ErrIdempotencyKeyInUse:
+			status = http.StatusConflict
+			page.Error = "This form was just sent and the request is being made, please check your email in a moment."
+		case usecases.ErrIdempotencyKeyReused:
+			// the form was sent before with other values, like after going back to it
+			status = http.StatusConflict
+			form.Set("idempotency_key", newIdempotencyKey())
+			page.Error = "This form was already sent, please check the values and send it again to make another request."
+		default:
+			u.logger.Error("request failed", domain.NewField(domain.ErrorKey, err))
+			u.renderError(w, http.StatusInternalServerError, "Something went wrong", "Your request couldn't be made, please try again.")
+			return
+		}
+	}
+	u.render(w, status, "form", page)
+}
+
+// newIdempotencyKey returns a random key for a form, so that the form creates one request
+// however many times it is sent.
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// addError shows the ValidationError next to the form field it belongs to, or above the
+// form if there is no such field.
+func (p *formPage) addError(v *domain.ValidationError) {
+	field := formField(v.Field)
+	if field == "" {
+		p.Error = v.Error()
+		return
+	}
+	if _, ok := p.Errors[field]; !ok {
+		p.Errors[field] = v.Reason
+	}
+}
+
+// formField returns the name of the form field of a ValidationError's field, the
+// ValidationErrors name the fields of the JSON input or of the domain.Request.
+func formField(field string) string {
+	switch field {
+	case "name", "reaching_time", "cab_type",
+		"source.latitude", "source.longitude",
+		"destination.latitude", "destination.longitude":
+		return strings.Replace(field, ".", "_", 1)
+	case "source", "destination":
+		return field + "_latitude"
+	case "cab":
+		return "cab_type"
+	case "notification_addr", "notification_addr.value":
+		return "notification_value"
+	}
+	return ""
+}
+
+// cabOf returns the cab of the catalog which offers the cab type, the form only asks for the
+// cab type.
+func cabOf(cabs domain.CabCatalog, cabType string) string {
+	for _, c := range cabs {
+		for _, t := range c.Types {
+			if t == cabType {
+				return c.Name
+			}
+		}
+	}
+	return ""
+}
+
+// request serves GET /requests/{id} and POST /requests/{id}/cancel.
+func (u *UI) request(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/requests/"), "/")
+	id, ok := parseID(parts[0])
+	if !ok || len(parts) > 2 || (len(parts) == 2 && parts[1] != "cancel") {
+		u.renderError(w, http.StatusNotFound, "Not found", "There is no such page.")
+		return
+	}
+
+	if len(parts) == 2 {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			u.renderError(w, http.StatusMethodNotAllowed, "Method not allowed", "Requests are cancelled with the button on their page.")
+			return
+		}
+		token := r.PostFormValue("token")
+		_, err := u.service.CancelUserRequest(id, token)
+		// a request which is already finished shows it on its page
+		if err != nil && errors.Cause(err) != domain.ErrRequestFinished {
+			u.renderServiceError(w, err)
+			return
+		}
+		if err == nil {
+			u.logger.Info("cancelled request", domain.NewField(domain.RequestIDKey, id))
+		}
+		http.Redirect(w, r, requestPath(id, token), http.StatusSeeOther)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet)
+		u.renderError(w, http.StatusMethodNotAllowed, "Method not allowed", "The page of a request can only be read.")
+		return
+	}
+	token := r.URL.Query().Get("token")
+	req, err := u.service.GetUserRequest(id, token)
+	if err != nil {
+		u.renderServiceError(w, err)
+		return
+	}
+	// the URL of the page has the token, it is not sent along to the pages linked from it
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	page := newStatusPage(req)
+	page.Token = token
+	u.render(w, http.StatusOK, "status", page)
+}
+
+// newStatusPage returns the status page of the request. The stages a cancelled request
+// went through are still shown, they are known from the times found for it.
+func newStatusPage(r *domain.Request) statusPage {
+	return statusPage{
+		Request: r,
+		Steps: []step{
+			{Name: "Request received", Done: true},
+			{Name: "Cab request scheduled", Done: !r.TriggerTime.IsZero(), Time: r.TriggerTime},
+			{Name: "Booking time found", Done: !r.BookingTime.IsZero(), Time: r.BookingTime},
+			{Name: "Email sent", Done: r.Status == domain.RequestNotified},
+		},
+		Cancellable: !r.Finished(),
+		Refresh:     !r.Finished(),
+	}
+}
+
+// requestPath returns the URL of the status page of the request.
+func requestPath(id uint64, token string) string {
+	return "/requests/" + strconv.FormatUint(id, 10) + "?" + url.Values{"token": {token}}.Encode()
+}
+
+func (u *UI) renderServiceError(w http.ResponseWriter, err error) {
+	if errors.Cause(err) == domain.ErrNotFound {
+		u.renderError(w, http.StatusNotFound, "Request not found", "There is no such request.")
+		return
+	}
+	u.logger.Error("request failed", domain.NewField(domain.ErrorKey, err))
+	u.renderError(w, http.StatusInternalServerError, "Something went wrong", "Please try again.")
+}
+
+func (u *UI) renderError(w http.ResponseWriter, status int, title, message string) {
+	u.render(w, status, "error", errorPage{Title: title, Message: message})
+}
+
+// render executes the page into a buffer first, so that a failing template doesn't send a
+// half written page with a 200.
+func (u *UI) render(w http.ResponseWriter, status int, page string, data interface{}) {
+	var buf bytes.Buffer
+	if err := u.pages[page].ExecuteTemplate(&buf, "layout", data); err != nil {
+		u.logger.Error("couldn't render page", domain.NewField("page", page), domain.NewField(domain.ErrorKey, err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := buf.WriteTo(w); err != nil {
+		u.logger.Warn("couldn't write response", domain.NewField(domain.ErrorKey, err))
+	}
+}
+
+var statusTexts = map[domain.RequestStatus]string{
+	domain.RequestPending:          "Checking the traffic on your route",
+	domain.RequestScheduled:        "Waiting to check the cabs around you",
+	domain.RequestBookingTimeFound: "Booking time found, sending the email",
+	domain.RequestNotified:         "Email sent, book your cab at the time it gives",
+	domain.RequestCancelled:        "Cancelled",
+}
+
+var uiFuncs = template.FuncMap{
+	"statusText": func(s domain.RequestStatus) string {
+		if t, ok := statusTexts[s]; ok {
+			return t
+		}
+		return string(s)
+	},
+	"when": func(t time.Time) string {
+		return t.Local().Format("Mon, 02 Jan 2006 15:04 MST")
+	},
+	"place": func(l domain.Location) string {
+		if l.Name != "" {
+			return l.Name + " (" + l.Latitude + ", " + l.Longitude + ")"
+		}
+		return l.Latitude + ", " + l.Longitude
+	},
+}
+
+// parsePages parses every page together with the layout it is rendered in. The templates
+// are embedded in the binary, so a template which doesn't parse is a bug and panics.
+func parsePages() map[string]*template.Template {
+	pages := make(map[string]*template.Template)
+	for _, page := range []string{"form", "status", "error"} {
+		pages[page] = template.Must(template.New(page).Funcs(uiFuncs).ParseFS(uiAssets, "ui/templates/layout.html", "ui/templates/"+page+".html"))
+	}
+	return pages
+}
+
+// NewUI is a constructor which takes the UserRequestService and a Logger and returns a
+// pointer to a new UI.
+func NewUI(s UserRequestService, logger domain.Logger) *UI {
+	static, err := fs.Sub(uiAssets, "ui/static")
+	if err != nil {
+		panic(err)
+	}
+	u := UI{
+		service: s,
+		logger:  logger,
+		pages:   parsePages(),
+		mux:     http.NewServeMux(),
+	}
+	u.mux.HandleFunc("/", u.form)
+	u.mux.HandleFunc("/requests", u.create)
+	u.mux.HandleFunc("/requests/", u.request)
+	u.mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(static))))
+	return &u
+}
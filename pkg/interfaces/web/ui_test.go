@@ -0,0 +1,158 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+	"github.com/anirbanroydas/ubernow-go/pkg/usecases"
+)
+
+func testForm() url.Values {
+	return url.Values{
+		"name":                  {"roy"},
+		"source_latitude":       {"77.134134"},
+		"source_longitude":      {"45.1341324"},
+		"destination_latitude":  {"77.234134"},
+		"destination_longitude": {"45.5641324"},
+		"reaching_time":         {time.Now().Add(5 * time.Hour).Format("2006-01-02T15:04")},
+		"cab_type":              {"uberGo"},
+		"notification_type":     {"email"},
+		"notification_value":    {"anirban.nick@gmail.com"},
+	}
+}
+
+func TestUI(t *testing.T) {
+	missing := testForm()
+	missing.Del("source_latitude")
+	missing.Set("notification_value", "")
+	testCases := []struct {
+		name             string
+		createErr        error
+		method           string
+		path             string
+		form             url.Values
+		expectedStatus   int
+		expectedLocation string
+		expectedBody     string
+	}{
+		{"request form", nil, "GET", "/", nil, http.StatusOK, "", `<option value="uberGo">uberGo</option>`},
+		{"request form key", nil, "GET", "/", nil, http.StatusOK, "", `<input type="hidden" name="idempotency_key" value="`},
+		{"unknown page", nil, "GET", "/about", nil, http.StatusNotFound, "", "There is no such page."},
+		{"create request", nil, "POST", "/requests", testForm(), http.StatusSeeOther, "/requests/1?token=" + testToken, ""},
+		{"create with missing fields", nil, "POST", "/requests", missing, http.StatusUnprocessableEntity, "", `<p class="error">is required</p>`},
+		{"create with invalid input", domain.NewValidationError("cab", "requested cab: ola not avaialable"), "POST", "/requests", testForm(), http.StatusUnprocessableEntity, "", "requested cab: ola not avaialable"},
+		{"create with full queue", errors.Wrap(usecases.ErrQueueFull, "TrafficAppEngine"), "POST", "/requests", testForm(), http.StatusServiceUnavailable, "", "please try again in a minute"},
+		{"create with repository failure", errors.New("disk on fire"), "POST", "/requests", testForm(), http.StatusInternalServerError, "", "Something went wrong"},
+		{"create sent twice at once", errors.Wrap(usecases.ErrIdempotencyKeyInUse, "CreateUserRequest"), "POST", "/requests", testForm(), http.StatusConflict, "", "the request is being made"},
+		{"create sent again with other values", errors.Wrap(usecases.ErrIdempotencyKeyReused, "CreateUserRequest"), "POST", "/requests", testForm(), http.StatusConflict, "", "This form was already sent"},
+		{"status page", nil, "GET", "/requests/1?token=" + testToken, nil, http.StatusOK, "", `<li class="done">
+		Booking time found`},
+		{"status page cancel form", nil, "GET", "/requests/1?token=" + testToken, nil, http.StatusOK, "", `<input type="hidden" name="token" value="` + testToken + `">`},
+		{"status page without token", nil, "GET", "/requests/1", nil, http.StatusNotFound, "", "There is no such request."},
+		{"status page of unknown request", nil, "GET", "/requests/2", nil, http.StatusNotFound, "", "There is no such request."},
+		{"cancel request", nil, "POST", "/requests/1/cancel", url.Values{"token": {testToken}}, http.StatusSeeOther, "/requests/1?token=" + testToken, ""},
+		{"cancel without token", nil, "POST", "/requests/1/cancel", url.Values{}, http.StatusNotFound, "", ""},
+		{"cancel unknown request", nil, "POST", "/requests/2/cancel", url.Values{}, http.StatusNotFound, "", ""},
+		{"cancel with GET", nil, "GET", "/requests/1/cancel", nil, http.StatusMethodNotAllowed, "", ""},
+		{"stylesheet", nil, "GET", "/static/style.css", nil, http.StatusOK, "", "font-family"},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			ui := NewUI(&MockUserRequestService{createErr: tc.createErr}, &MockLogger{})
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.form.Encode()))
+			if tc.form != nil {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			rec := httptest.NewRecorder()
+			ui.ServeHTTP(rec, req)
+
+			if rec.Code != tc.expectedStatus || rec.Header().Get("Location") != tc.expectedLocation || !strings.Contains(rec.Body.String(), tc.expectedBody) {
+				t.Errorf("%s %s => got: (%d, %q, %s), expected: (%d, %q, containing %s)", tc.method, tc.path, rec.Code, rec.Header().Get("Location"), rec.Body.String(), tc.expectedStatus, tc.expectedLocation, tc.expectedBody)
+			}
+		})
+	}
+}
+
+func TestUIKeepsFormValues(t *testing.T) {
+	ui := NewUI(&MockUserRequestService{}, &MockLogger{})
+	form := testForm()
+	form.Set("source_longitude", "east")
+	req := httptest.NewRequest("POST", "/requests", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	ui.ServeHTTP(rec, req)
+
+	body := rec.Body.String()
+	for _, expected := range []string{`value="roy"`, `value="east"`, `<option value="uberGo" selected>`, "is not a number"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("POST /requests with invalid longitude => got: %s, expected the form to contain %s", body, expected)
+		}
+	}
+}
+
+func TestUIOffersCabsOfCatalog(t *testing.T) {
+	cabs := domain.CabCatalog{{Name: "ola", Types: []string{"olaMini"}}}
+	ui := NewUI(&MockUserRequestService{cabs: cabs}, &MockLogger{})
+	rec := httptest.NewRecorder()
+	ui.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+
+	body := rec.Body.String()
+	if !strings.Contains(body, `<option value="olaMini">olaMini</option>`) || strings.Contains(body, "uberGo") {
+		t.Errorf("GET / with the ola catalog => got: %s, expected the form to offer olaMini and no uber cab", body)
+	}
+	if cab := cabOf(cabs, "olaMini"); cab != "ola" {
+		t.Errorf("cabOf(olaMini) => got: %q, expected: ola", cab)
+	}
+}
+
+func TestUIRejectsCrossOriginForms(t *testing.T) {
+	testCases := []struct {
+		name           string
+		header         http.Header
+		expectedStatus int
+	}{
+		{name: "same site fetch", header: http.Header{"Sec-Fetch-Site": {"same-origin"}}, expectedStatus: http.StatusSeeOther},
+		{name: "cross site fetch", header: http.Header{"Sec-Fetch-Site": {"cross-site"}, "Origin": {"http://example.com"}}, expectedStatus: http.StatusForbidden},
+		{name: "same origin", header: http.Header{"Origin": {"http://example.com"}}, expectedStatus: http.StatusSeeOther},
+		{name: "other origin", header: http.Header{"Origin": {"http://evil.example"}}, expectedStatus: http.StatusForbidden},
+		{name: "opaque origin", header: http.Header{"Origin": {"null"}}, expectedStatus: http.StatusForbidden},
+		{name: "not a browser", header: http.Header{}, expectedStatus: http.StatusSeeOther},
+	}
+
+	ui := NewUI(&MockUserRequestService{}, &MockLogger{})
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			form := url.Values{"token": {testToken}}
+			req := httptest.NewRequest("POST", "http://example.com/requests/1/cancel", strings.NewReader(form.Encode()))
+			req.Header = tc.header
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			ui.ServeHTTP(rec, req)
+			if rec.Code != tc.expectedStatus {
+				t.Errorf("%s: POST /requests/1/cancel => got: %d, expected: %d", tc.name, rec.Code, tc.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestStatusPageOfCancelledRequest(t *testing.T) {
+	r := testRequest()
+	r.TriggerTime = r.BookingTime.Add(-10 * time.Minute)
+	if err := r.Cancel(); err != nil {
+		t.Fatalf("Cancel() => got: %v, expected: nil", err)
+	}
+	p := newStatusPage(r)
+	if p.Cancellable || p.Refresh || !p.Steps[1].Done || !p.Steps[2].Done || p.Steps[3].Done {
+		t.Errorf("newStatusPage() of cancelled request => got: %+v, expected the reached steps without cancel and refresh", p)
+	}
+}
@@ -2,6 +2,7 @@ package usecases
 
 import (
 	// "fmt"
+	"context"
 	"time"
 
 	"github.com/pkg/errors"
@@ -9,14 +10,62 @@ import (
 	"github.com/anirbanroydas/ubernow-go/pkg/domain"
 )
 
+const (
+	// UserRequestJobType is the type of the Job which processes a new domain.UserRequest.
+	UserRequestJobType = "user_request"
+	// CabRequestJobType is the type of the Job which finds the best booking time for a cab.
+	CabRequestJobType = "cab_request"
+	// NotificationJobType is the type of the Job which sends the CabBookingResponse to the user.
+	NotificationJobType = "notification"
+)
+
+var (
+	// UserRequestJobTimeout is the deadline for a single run of a UserRequestJob, it covers
+	// the calls made to the TrafficService and the CabService.
+	UserRequestJobTimeout = 30 * time.Second
+	// CabRequestJobTimeout is the deadline for a single run of a CabRequestJob, which may poll
+	// the CabService a few times before it settles on the best booking time.
+	CabRequestJobTimeout = 2 * time.Minute
+	// NotificationJobTimeout is the deadline for a single run of a NotificationJob.
+	NotificationJobTimeout = 30 * time.Second
+
+	// UrgentRequestWindow is how close the reaching time of a request has to be for its
+	// UserRequestJob to have HighPriority.
+	UrgentRequestWindow = 2 * time.Hour
+	// RelaxedRequestWindow is how far the reaching time of a request has to be for its
+	// UserRequestJob to have LowPriority, such a job can be shed when the TrafficAppEngine
+	// is overloaded and the client can try again later.
+	RelaxedRequestWindow = 6 * time.Hour
+)
+
+// Job is a unit of work which is added to an AppEngine and later done by a Worker.
+// Type and RequestID identify the job, the Worker attaches both of them to the Logger
+// which it passes to DoWork, so every log line emitted by a job carries them.
+// The context passed to DoWork is done when the job's Timeout elapses, when the
+// request is cancelled or when the Worker is stopped.
+// When DoWork returns an error the job is retried as its RetryPolicy says, unless the
+// error is marked permanent with domain.NewPermanentError.
 type Job interface {
-	DoWork() error
+	DoWork(context.Context, domain.Logger) error
+	Type() string
+	RequestID() uint64
+	Timeout() time.Duration
+	RetryPolicy() RetryPolicy
 }
 
 type AppEngine interface {
 	AddJob(Job) error
 }
 
+// requestIDOf returns the id of the domain.Request of a UserRequest, or zero if
+// there is no request attached to it.
+func requestIDOf(ur *domain.UserRequest) uint64 {
+	if ur == nil || ur.Request == nil {
+		return 0
+	}
+	return ur.Request.ID()
+}
+
 // UserRequestJob implements the Job interface.
 type UserRequestJob struct {
 	UserRequest                   *domain.UserRequest
@@ -28,22 +77,22 @@ type UserRequestJob struct {
 	CronEngine                    CronEngine
 }
 
-func (job *UserRequestJob) DoWork() error {
+func (job *UserRequestJob) DoWork(ctx context.Context, logger domain.Logger) error {
 	var err error
 	var baseTravelTime time.Duration
-	baseTravelTime, err = job.TrafficInteractor.GetBaseTravelTime(job.UserRequest.Source, job.UserRequest.Destination, time.Now())
+	baseTravelTime, err = job.TrafficInteractor.GetBaseTravelTime(ctx, job.UserRequest.Source, job.UserRequest.Destination, time.Now())
 	if err != nil {
 		return errors.Wrap(err, "UserRequestJob's DoWork returned error while calling TrafficInteractor.GetBaseTravelTime method")
 	}
 
 	var baseEta time.Duration
-	baseEta, err = job.CabInteractor.GetBaseEta(job.UserRequest.Source, job.UserRequest.Destination, time.Now(), job.UserRequest.Cab, job.UserRequest.CabType)
+	baseEta, err = job.CabInteractor.GetBaseEta(ctx, job.UserRequest.Source, job.UserRequest.Destination, time.Now(), job.UserRequest.Cab, job.UserRequest.CabType)
 	if err != nil {
 		return errors.Wrap(err, "UserRequestJob's DoWork returned error while calling CabInteractor.GetBaseEta method")
 	}
 
 	var tResp *TrafficResponseDTO
-	tResp, err = job.TrafficInteractor.GetTrafficFinalResponse(baseTravelTime, job.UserRequest)
+	tResp, err = job.TrafficInteractor.GetTrafficFinalResponse(ctx, baseTravelTime, job.UserRequest)
 	if err != nil {
 		return errors.Wrap(err, "UserRequestJob's DoWork returned error while calling TrafficInteractor.GetTrafficFinalResponse method")
 	}
@@ -52,22 +101,61 @@ func (job *UserRequestJob) DoWork() error {
 	// First, create cron jobs which will trigger the functions at the specific time
 	// which will then add those jobs to the cab request's job queu, which will be consumed by
 	// cab request specific worker which will then find the final booking time for the cab
+	// don't schedule anything for a request which got cancelled or timed out meanwhile
+	if err = ctx.Err(); err != nil {
+		return errors.Wrap(err, "UserRequestJob's DoWork stopped before scheduling the cab request")
+	}
 	triggerTime := job.TrafficInteractor.GetTriggerTime(baseEta, tResp)
-	err = job.CronEngine.Add(triggerTime, job.CabEngineInteractor.TrafficResponseProcessor(tResp, job.CabInteractor, job.NotificationInteractor, job.NotificationServiceInteractor))
+	err = job.CabEngineInteractor.ScheduleCabRequest(job.CronEngine, triggerTime, tResp, job.CabInteractor, job.NotificationInteractor, job.NotificationServiceInteractor)
 	if err != nil {
-		return errors.Wrap(err, "UserRequestJob's DoWork couldn't perform Cron.Add()")
+		return errors.Wrap(err, "UserRequestJob's DoWork couldn't schedule the cab request")
 	}
+	logStatusError(logger, job.CabEngineInteractor.RequestStatusInteractor.Scheduled(job.RequestID(), triggerTime))
+	logger.Info("scheduled cab request trigger", domain.NewField("trigger_time", triggerTime), domain.NewField("base_eta", baseEta))
 	return nil
 }
 
-func NewUserRequestJob(ur *domain.UserRequest, tsI *TrafficInteractor, cabI *CabInteractor, cabEngI *CabEngineInteractor, n *NotificationInteractor, c CronEngine) *UserRequestJob {
+func (job *UserRequestJob) Type() string {
+	return UserRequestJobType
+}
+
+func (job *UserRequestJob) RequestID() uint64 {
+	return requestIDOf(job.UserRequest)
+}
+
+func (job *UserRequestJob) Timeout() time.Duration {
+	return UserRequestJobTimeout
+}
+
+func (job *UserRequestJob) RetryPolicy() RetryPolicy {
+	return UserRequestJobRetryPolicy
+}
+
+// Priority depends on how soon the user has to reach the destination.
+func (job *UserRequestJob) Priority() JobPriority {
+	if job.UserRequest == nil || job.UserRequest.Request == nil {
+		return NormalPriority
+	}
+	left := time.Until(job.UserRequest.ReachingTime)
+	switch {
+	case left <= UrgentRequestWindow:
+		return HighPriority
+	case left >= RelaxedRequestWindow:
+		return LowPriority
+	default:
+		return NormalPriority
+	}
+}
+
+func NewUserRequestJob(ur *domain.UserRequest, tsI *TrafficInteractor, cabI *CabInteractor, cabEngI *CabEngineInteractor, n *NotificationInteractor, nsI *NotificationServiceInteractor, c CronEngine) *UserRequestJob {
 	job := UserRequestJob{
-		UserRequest:            ur,
-		TrafficInteractor:      tsI,
-		CabInteractor:          cabI,
-		CabEngineInteractor:    cabEngI,
-		NotificationInteractor: n,
-		CronEngine:             c,
+		UserRequest:                   ur,
+		TrafficInteractor:             tsI,
+		CabInteractor:                 cabI,
+		CabEngineInteractor:           cabEngI,
+		NotificationInteractor:        n,
+		NotificationServiceInteractor: nsI,
+		CronEngine:                    c,
 	}
 	return &job
 }
@@ -76,22 +164,14 @@ func NewUserRequestJob(ur *domain.UserRequest, tsI *TrafficInteractor, cabI *Cab
 // UserRequestJob and add that job to a JobQueue which is then consumed by
 // some workers to perform all the traffic_request use cases.
 type TrafficAppEngine struct {
-	JobQueue chan Job
+	*QueueEngine
 }
 
-func (t *TrafficAppEngine) AddJob(j Job) error {
-	select {
-	case t.JobQueue <- j:
-		return nil
-	default:
-		return errors.New("TrafficAppEngine Couldn't add any more jobs to JobQueue")
-	}
-
-}
-
-func NewTrafficAppEngine(maxQueueLength int) *TrafficAppEngine {
+// NewTrafficAppEngine is a constructor which takes the length of the job queue and the
+// OverflowConfig which says what happens once the job queue is full.
+func NewTrafficAppEngine(maxQueueLength int, oc OverflowConfig) *TrafficAppEngine {
 	t := TrafficAppEngine{
-		JobQueue: make(chan Job, maxQueueLength),
+		QueueEngine: NewQueueEngine("TrafficAppEngine", maxQueueLength, oc),
 	}
 
 	return &t
@@ -105,8 +185,8 @@ type CabRequestJob struct {
 	NotificationServiceInteractor *NotificationServiceInteractor
 }
 
-func (job *CabRequestJob) DoWork() error {
-	bResp, err := job.CabInteractor.GetBookingResponse(job.TrafficResponse)
+func (job *CabRequestJob) DoWork(ctx context.Context, logger domain.Logger) error {
+	bResp, err := job.CabInteractor.GetBookingResponse(ctx, job.TrafficResponse)
 	if err != nil {
 		return errors.Wrap(err, "CabRequestJob's DoWork errored while calling GetBookingResponse")
 	}
@@ -121,10 +201,37 @@ func (job *CabRequestJob) DoWork() error {
 	if err != nil {
 		return errors.Wrap(err, "CabRequestJob's DoWork method returned error while calling SendToQueue method of NotificationInteractor")
 	}
+	logStatusError(logger, job.NotificationInteractor.RequestStatusInteractor.BookingTimeFound(job.RequestID(), bResp))
+	logger.Info("found best booking time", domain.NewField("best_booking_time", bResp.BestBookingTime))
 
 	return nil
 }
 
+func (job *CabRequestJob) Type() string {
+	return CabRequestJobType
+}
+
+func (job *CabRequestJob) RequestID() uint64 {
+	if job.TrafficResponse == nil {
+		return 0
+	}
+	return requestIDOf(job.TrafficResponse.UserRequest)
+}
+
+func (job *CabRequestJob) Timeout() time.Duration {
+	return CabRequestJobTimeout
+}
+
+func (job *CabRequestJob) RetryPolicy() RetryPolicy {
+	return CabRequestJobRetryPolicy
+}
+
+// Priority is always high, the cab request is triggered right when the booking time
+// has to be found.
+func (job *CabRequestJob) Priority() JobPriority {
+	return HighPriority
+}
+
 func NewCabRequestJob(t *TrafficResponseDTO, c *CabInteractor, nI *NotificationInteractor, nsI *NotificationServiceInteractor) *CabRequestJob {
 	job := CabRequestJob{
 		TrafficResponse:               t,
@@ -139,21 +246,14 @@ func NewCabRequestJob(t *TrafficResponseDTO, c *CabInteractor, nI *NotificationI
 // CabRequestJob and add that job to a JobQueue which is then consumed by
 // some workers to perform all the traffic_request use cases.
 type CabAppEngine struct {
-	JobQueue chan Job
+	*QueueEngine
 }
 
-func (c *CabAppEngine) AddJob(j Job) error {
-	select {
-	case c.JobQueue <- j:
-		return nil
-	default:
-		return errors.New("CabAppEngine Couldn't add any more jobs to JobQueue")
-	}
-}
-
-func NewCabAppEngine(maxQueueLength int) *CabAppEngine {
+// NewCabAppEngine is a constructor which takes the length of the job queue and the
+// OverflowConfig which says what happens once the job queue is full.
+func NewCabAppEngine(maxQueueLength int, oc OverflowConfig) *CabAppEngine {
 	c := CabAppEngine{
-		JobQueue: make(chan Job, maxQueueLength),
+		QueueEngine: NewQueueEngine("CabAppEngine", maxQueueLength, oc),
 	}
 
 	return &c
@@ -165,15 +265,49 @@ type NotificationJob struct {
 	NotificationServiceInteractor *NotificationServiceInteractor
 }
 
-func (job *NotificationJob) DoWork() error {
-	err := job.NotificationServiceInteractor.Send(job.CabBookingResponse)
+func (job *NotificationJob) DoWork(ctx context.Context, logger domain.Logger) error {
+	// the request may have been cancelled while the job waited in a queue which outlived
+	// the process, so the RequestCanceller doesn't know about it
+	cancelled, err := job.NotificationServiceInteractor.RequestStatusInteractor.Cancelled(job.RequestID())
+	logStatusError(logger, err)
+	if cancelled {
+		logger.Info("skipped notification of cancelled request")
+		return nil
+	}
+	err = job.NotificationServiceInteractor.Send(ctx, job.CabBookingResponse)
 	if err != nil {
 		return errors.Wrap(err, "NotificationJob's DoWork method returned error while calling Send method of NotificationServiceInteractor")
 	}
+	logStatusError(logger, job.NotificationServiceInteractor.RequestStatusInteractor.Notified(job.RequestID(), job.CabBookingResponse))
+	logger.Info("sent notification")
 
 	return nil
 }
 
+func (job *NotificationJob) Type() string {
+	return NotificationJobType
+}
+
+func (job *NotificationJob) RequestID() uint64 {
+	if job.CabBookingResponse == nil {
+		return 0
+	}
+	return requestIDOf(job.CabBookingResponse.UserRequest)
+}
+
+func (job *NotificationJob) Timeout() time.Duration {
+	return NotificationJobTimeout
+}
+
+func (job *NotificationJob) RetryPolicy() RetryPolicy {
+	return NotificationJobRetryPolicy
+}
+
+// Priority is always high, a late notification is as bad as a lost one.
+func (job *NotificationJob) Priority() JobPriority {
+	return HighPriority
+}
+
 func NewNotificationJob(c *domain.CabBookingResponse, n *NotificationServiceInteractor) *NotificationJob {
 	job := NotificationJob{
 		CabBookingResponse:            c,
@@ -186,21 +320,14 @@ func NewNotificationJob(c *domain.CabBookingResponse, n *NotificationServiceInte
 // CabRequestJob and add that job to a JobQueue which is then consumed by
 // some workers to perform all the traffic_request use cases.
 type NotificationAppEngine struct {
-	JobQueue chan Job
-}
-
-func (n *NotificationAppEngine) AddJob(j Job) error {
-	select {
-	case n.JobQueue <- j:
-		return nil
-	default:
-		return errors.New("NotificationAppEngine Couldn't add any more jobs to JobQueue")
-	}
+	*QueueEngine
 }
 
-func NewNotificationAppEngine(maxQueueLength int) *NotificationAppEngine {
+// NewNotificationAppEngine is a constructor which takes the length of the job queue and the
+// OverflowConfig which says what happens once the job queue is full.
+func NewNotificationAppEngine(maxQueueLength int, oc OverflowConfig) *NotificationAppEngine {
 	n := NotificationAppEngine{
-		JobQueue: make(chan Job, maxQueueLength),
+		QueueEngine: NewQueueEngine("NotificationAppEngine", maxQueueLength, oc),
 	}
 
 	return &n
@@ -12,7 +12,15 @@ import (
 
 type MockCronEngine struct{}
 
-func (c *MockCronEngine) Add(triggerTime time.Time, cJob CronJob) error {
+func (c *MockCronEngine) Add(triggerTime time.Time, job Job) (uint64, error) {
+	return 1, nil
+}
+
+func (c *MockCronEngine) Cancel(id uint64) error {
+	return nil
+}
+
+func (c *MockCronEngine) CancelRequest(reqID uint64) error {
 	return nil
 }
 
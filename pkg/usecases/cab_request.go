@@ -1,7 +1,8 @@
 package usecases
 
 import (
-	"fmt"
+	"context"
+	"sort"
 	"time"
 
 	"github.com/pkg/errors"
@@ -12,21 +13,73 @@ import (
 type CabInteractor struct {
 	CabService domain.CabService
 	Strategy   BestBookingTimeFinder
+	// BookingResponses is optional, without it the booking responses are not kept.
+	BookingResponses domain.CabBookingResponseRepository
+}
+
+// CabCataloger is implemented by the CabServices which know the cabs and the cab types they
+// find the etas of, the requests are validated against their Catalog.
+type CabCataloger interface {
+	Catalog() domain.CabCatalog
+}
+
+// CabTypeLister is implemented by the CabServices of a single cab which know its cab types,
+// like those of uber, ola and lyft.
+type CabTypeLister interface {
+	CabTypes() []string
+}
+
+// CabServices implements the domain.CabService interface with the CabService of the cab of
+// each request, they are keyed by the name of the cab, like uber.
+type CabServices map[string]domain.CabService
+
+// Catalog returns the cabs of the CabServices in alphabetical order, with the cab types of
+// those which are CabTypeListers. A cab service which doesn't list its cab types has none.
+func (c CabServices) Catalog() domain.CabCatalog {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	cabs := make(domain.CabCatalog, 0, len(names))
+	for _, name := range names {
+		cab := domain.Cab{Name: name}
+		if l, ok := c[name].(CabTypeLister); ok {
+			cab.Types = l.CabTypes()
+		}
+		cabs = append(cabs, cab)
+	}
+	return cabs
+}
+
+func (c CabServices) EtaNow(ctx context.Context, cr *domain.CabRequest) (time.Duration, error) {
+	cs, ok := c[cr.Cab]
+	if !ok {
+		return 0, domain.NewPermanentError(errors.Errorf("no cab service for cab %q", cr.Cab))
+	}
+	return cs.EtaNow(ctx, cr)
 }
 
 type CabEngineInteractor struct {
-	AppEngine AppEngine
-	Logger    domain.Logger
+	AppEngine               AppEngine
+	Logger                  domain.Logger
+	RequestStatusInteractor *RequestStatusInteractor
 }
 
 type BestBookingTimeFinder interface {
-	FindBest(*TrafficResponseDTO) (time.Time, error)
+	FindBest(context.Context, *TrafficResponseDTO) (time.Time, error)
+	// Name names the strategy in the booking responses it computes.
+	Name() string
 }
 
 type HeuristicBestTimeStrategy struct {
 }
 
-func (h *HeuristicBestTimeStrategy) FindBest(tr *TrafficResponseDTO) (time.Time, error) {
+func (h *HeuristicBestTimeStrategy) Name() string {
+	return "heuristic"
+}
+
+func (h *HeuristicBestTimeStrategy) FindBest(ctx context.Context, tr *TrafficResponseDTO) (time.Time, error) {
 	var bestTime time.Time
 	// only considering bestCase response
 	// TODO: Implement this algo
@@ -45,12 +98,12 @@ func (h *HeuristicBestTimeStrategy) FindBest(tr *TrafficResponseDTO) (time.Time,
 	return bestTime, nil
 }
 
-func (c *CabInteractor) GetBaseEta(source, destination domain.Location, bookingTime time.Time, cab, cabType string) (time.Duration, error) {
+func (c *CabInteractor) GetBaseEta(ctx context.Context, source, destination domain.Location, bookingTime time.Time, cab, cabType string) (time.Duration, error) {
 	var baseEta time.Duration
 	// step 0: create new cab request
 	cabReq := domain.NewCabRequest(source, destination, bookingTime, cab, cabType)
 	// step 1: poll traffic service
-	eta, err := c.CabService.EtaNow(cabReq)
+	eta, err := c.CabService.EtaNow(ctx, cabReq)
 	if err != nil {
 		return baseEta, errors.Wrap(err, "GetBaseEta failed in fetching EtaNow from CabService")
 	}
@@ -59,27 +112,76 @@ func (c *CabInteractor) GetBaseEta(source, destination domain.Location, bookingT
 	return baseEta, nil
 }
 
-func (c *CabInteractor) GetBookingResponse(tr *TrafficResponseDTO) (*domain.CabBookingResponse, error) {
+// GetBookingResponse finds the best booking time of the traffic response and returns the
+// CabBookingResponse of it, which is stored in the BookingResponses if they are kept. A
+// request which already has a stored booking response, because its CabRequestJob failed
+// after storing it and is retried, gets that one back and nothing is stored twice.
+func (c *CabInteractor) GetBookingResponse(ctx context.Context, tr *TrafficResponseDTO) (*domain.CabBookingResponse, error) {
 	var cResp *domain.CabBookingResponse
+	stored, err := c.storedBookingResponse(tr.UserRequest)
+	if err != nil || stored != nil {
+		return stored, err
+	}
 	// Use the strategy which is associated with this CabServiceIndicator to find the BestTime
 	// possible
-	bestBookingTime, err := c.Strategy.FindBest(tr)
+	bestBookingTime, err := c.Strategy.FindBest(ctx, tr)
 	if err != nil {
 		return cResp, errors.Wrap(err, "CabInteractor's GetBookingResponse returned error while calling its Strategy's FindBest method")
 	}
 
-	// create the CabBookingResponse object
+	// create the CabBookingResponse object along with what it was computed from
 	cResp = domain.NewCabBookingResponse(tr.UserRequest, bestBookingTime)
+	cResp.Strategy = c.Strategy.Name()
+	cResp.ComputedAt = time.Now()
+	cResp.Inputs = domain.BookingInputs{TravelTime: tr.TravelTime, BestCase: tr.BestCase, WorstCase: tr.WorstCase}
+	if c.BookingResponses == nil {
+		return cResp, nil
+	}
+	id, err := c.BookingResponses.Store(cResp)
+	if err != nil {
+		return nil, errors.Wrap(err, "CabInteractor's GetBookingResponse couldn't store the booking response")
+	}
+	cResp.BookingID = id
 	return cResp, nil
 }
 
-func (c *CabEngineInteractor) TrafficResponseProcessor(tr *TrafficResponseDTO, cs *CabInteractor, nI *NotificationInteractor, nsI *NotificationServiceInteractor) CronJob {
-	return func() {
-		err := c.sendQueue(tr, cs, nI, nsI)
-		if err != nil {
-			c.Logger.LogError(fmt.Sprintf("CabEngineInteractor.sendToQueue Error:: %v", err))
-		}
+// storedBookingResponse returns the first booking response stored for the request of the
+// UserRequest, with the UserRequest attached, or nil if none is stored or they are not kept.
+func (c *CabInteractor) storedBookingResponse(ur *domain.UserRequest) (*domain.CabBookingResponse, error) {
+	reqID := requestIDOf(ur)
+	if c.BookingResponses == nil || reqID == 0 {
+		return nil, nil
 	}
+	stored, err := c.BookingResponses.FindByRequestID(reqID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "CabInteractor's GetBookingResponse couldn't find the booking responses of request %d", reqID)
+	}
+	if len(stored) == 0 {
+		return nil, nil
+	}
+	cResp := stored[0]
+	cResp.UserRequest = ur
+	return cResp, nil
+}
+
+// ScheduleCabRequest schedules a CabRequestJob for the traffic response on the CronEngine
+// at the trigger time. A trigger time which has already passed is not scheduled, the job
+// is sent to the AppEngine right away.
+func (c *CabEngineInteractor) ScheduleCabRequest(cron CronEngine, triggerTime time.Time, tr *TrafficResponseDTO, cs *CabInteractor, nI *NotificationInteractor, nsI *NotificationServiceInteractor) error {
+	if !triggerTime.After(time.Now()) {
+		return c.sendQueue(tr, cs, nI, nsI)
+	}
+
+	id, err := cron.Add(triggerTime, NewCabRequestJob(tr, cs, nI, nsI))
+	if err != nil {
+		return errors.Wrap(err, "ScheduleCabRequest couldn't add the cab request job to the CronEngine")
+	}
+	c.Logger.Debug("scheduled cab request job",
+		domain.NewField(domain.JobTypeKey, CabRequestJobType),
+		domain.NewField(domain.RequestIDKey, requestIDOf(tr.UserRequest)),
+		domain.NewField("cron_id", id),
+	)
+	return nil
 }
 
 func (c *CabEngineInteractor) sendQueue(tr *TrafficResponseDTO, cs *CabInteractor, nI *NotificationInteractor, nsI *NotificationServiceInteractor) error {
@@ -95,10 +197,11 @@ func (c *CabEngineInteractor) sendQueue(tr *TrafficResponseDTO, cs *CabInteracto
 	return nil
 }
 
-func NewCabEngineInteractor(a AppEngine, l domain.Logger) *CabEngineInteractor {
+func NewCabEngineInteractor(a AppEngine, l domain.Logger, s *RequestStatusInteractor) *CabEngineInteractor {
 	c := CabEngineInteractor{
-		AppEngine: a,
-		Logger:    l,
+		AppEngine:               a,
+		Logger:                  l,
+		RequestStatusInteractor: s,
 	}
 	return &c
 }
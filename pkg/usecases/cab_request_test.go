@@ -3,24 +3,72 @@ package usecases
 import (
 	// "fmt"
 	// "reflect"
+	"context"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/anirbanroydas/ubernow-go/pkg/domain"
 )
 
 type MockCabService struct{}
 
-func (c *MockCabService) EtaNow(cr *domain.CabRequest) (time.Duration, error) {
+func (c *MockCabService) EtaNow(ctx context.Context, cr *domain.CabRequest) (time.Duration, error) {
 	return time.Duration(7 * time.Minute), nil
 }
 
 type MockBookingTimeFinder struct{}
 
-func (s *MockBookingTimeFinder) FindBest(tr *TrafficResponseDTO) (time.Time, error) {
+func (s *MockBookingTimeFinder) FindBest(ctx context.Context, tr *TrafficResponseDTO) (time.Time, error) {
 	return time.Now().Add(5 * time.Hour), nil
 }
 
+func (s *MockBookingTimeFinder) Name() string {
+	return "mock"
+}
+
+// MockBookingResponseRepo implements the domain.CabBookingResponseRepository interface and
+// keeps the booking responses it stores in a slice, or fails to store them.
+type MockBookingResponseRepo struct {
+	stored []*domain.CabBookingResponse
+	err    error
+}
+
+func (m *MockBookingResponseRepo) FindByID(id uint64) (*domain.CabBookingResponse, error) {
+	if id == 0 || id > uint64(len(m.stored)) {
+		return nil, domain.ErrNotFound
+	}
+	return m.stored[id-1], nil
+}
+
+func (m *MockBookingResponseRepo) FindByUserID(userID uint64) ([]*domain.CabBookingResponse, error) {
+	return m.List(domain.CabBookingResponseFilter{UserID: userID})
+}
+
+func (m *MockBookingResponseRepo) FindByRequestID(reqID uint64) ([]*domain.CabBookingResponse, error) {
+	return m.List(domain.CabBookingResponseFilter{RequestID: reqID})
+}
+
+func (m *MockBookingResponseRepo) List(f domain.CabBookingResponseFilter) ([]*domain.CabBookingResponse, error) {
+	var cs []*domain.CabBookingResponse
+	for _, c := range m.stored {
+		if f.Match(c) {
+			cs = append(cs, c)
+		}
+	}
+	return cs, nil
+}
+
+func (m *MockBookingResponseRepo) Store(c *domain.CabBookingResponse) (uint64, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	m.stored = append(m.stored, c)
+	return uint64(len(m.stored)), nil
+}
+
 func testCabInteractor(t *testing.T) *CabInteractor {
 	t.Helper()
 
@@ -34,5 +82,124 @@ func testCabEngineInteractor(t *testing.T) *CabEngineInteractor {
 
 	a := &MockAppEngine{}
 	l := &MockLogger{}
-	return NewCabEngineInteractor(a, l)
+	return NewCabEngineInteractor(a, l, nil)
+}
+
+func TestGetBookingResponse(t *testing.T) {
+	ur := testUserRequest(t)
+	tr := &TrafficResponseDTO{
+		UserRequest: ur,
+		TravelTime:  []time.Duration{40 * time.Minute, 55 * time.Minute},
+		BestCase:    []time.Time{time.Date(2018, time.March, 9, 9, 20, 0, 0, time.UTC)},
+		WorstCase:   []time.Time{time.Date(2018, time.March, 9, 9, 5, 0, 0, time.UTC)},
+	}
+	testCases := []struct {
+		repo      *MockBookingResponseRepo
+		bookingID uint64
+		fails     bool
+	}{
+		// without a repository the booking response isn't kept
+		{nil, 0, false},
+		{&MockBookingResponseRepo{}, 1, false},
+		{&MockBookingResponseRepo{err: errors.New("disk full")}, 0, true},
+	}
+
+	for i, _ := range testCases {
+		c := testCabInteractor(t)
+		if testCases[i].repo != nil {
+			c.BookingResponses = testCases[i].repo
+		}
+		before := time.Now()
+		cResp, err := c.GetBookingResponse(context.Background(), tr)
+		if testCases[i].fails {
+			if err == nil {
+				t.Errorf("case %d: GetBookingResponse() with a failing repository => got: nil, expected an error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: GetBookingResponse() => got: %v, expected: nil", i, err)
+		}
+		if cResp.BookingID != testCases[i].bookingID {
+			t.Errorf("case %d: GetBookingResponse() => got: booking id %d, expected: %d", i, cResp.BookingID, testCases[i].bookingID)
+		}
+		if cResp.Strategy != "mock" || cResp.ComputedAt.Before(before) {
+			t.Errorf("case %d: GetBookingResponse() => got: strategy %q computed at %v, expected: mock computed after %v", i, cResp.Strategy, cResp.ComputedAt, before)
+		}
+		if len(cResp.Inputs.TravelTime) != 2 || len(cResp.Inputs.BestCase) != 1 || len(cResp.Inputs.WorstCase) != 1 {
+			t.Errorf("case %d: GetBookingResponse() => got: inputs %+v, expected the times of the traffic response", i, cResp.Inputs)
+		}
+		if repo := testCases[i].repo; repo != nil {
+			if stored, err := repo.FindByUserID(ur.User.UserID); err != nil || len(stored) != 1 || stored[0] != cResp {
+				t.Errorf("case %d: FindByUserID() after GetBookingResponse() => got: %v, %v, expected the booking response", i, stored, err)
+			}
+		}
+	}
+}
+
+func TestCabRequestJobRetriedStoresBookingResponseOnce(t *testing.T) {
+	tr := &TrafficResponseDTO{UserRequest: testUserRequest(t)}
+	c := testCabInteractor(t)
+	repo := &MockBookingResponseRepo{}
+	c.BookingResponses = repo
+	nI := testNotificationInteractor(t)
+	// the booking response is stored, but its notification can't be queued
+	nI.AppEngine = &MockBadAppEngine{}
+	job := NewCabRequestJob(tr, c, nI, testNotificationServiceInteractor(t))
+
+	if err := job.DoWork(context.Background(), &MockLogger{}); err == nil {
+		t.Fatalf("DoWork() with a failing AppEngine => got: nil, expected an error")
+	}
+	nI.AppEngine = &MockAppEngine{}
+	if err := job.DoWork(context.Background(), &MockLogger{}); err != nil {
+		t.Fatalf("DoWork() retried => got: %v, expected: nil", err)
+	}
+	if len(repo.stored) != 1 {
+		t.Errorf("DoWork() retried => got %d booking responses stored, expected: 1", len(repo.stored))
+	}
+
+	cResp, err := c.GetBookingResponse(context.Background(), tr)
+	if err != nil || cResp.BookingID != 1 || cResp.UserRequest != tr.UserRequest {
+		t.Errorf("GetBookingResponse() of a request with a stored booking response => got: (%v, %v), expected booking 1 of the request", cResp, err)
+	}
+}
+
+// MockCabTypeLister is a MockCabService which lists its cab types.
+type MockCabTypeLister struct {
+	MockCabService
+	types []string
+}
+
+func (m *MockCabTypeLister) CabTypes() []string {
+	return m.types
+}
+
+func TestCabServicesCatalog(t *testing.T) {
+	cs := CabServices{
+		"uber": &MockCabTypeLister{types: []string{"uberGo", "uberX"}},
+		"ola":  &MockCabTypeLister{types: []string{"olaMini"}},
+		"lyft": &MockCabService{},
+	}
+	expected := domain.CabCatalog{
+		{Name: "lyft"},
+		{Name: "ola", Types: []string{"olaMini"}},
+		{Name: "uber", Types: []string{"uberGo", "uberX"}},
+	}
+
+	if cabs := cs.Catalog(); !reflect.DeepEqual(cabs, expected) {
+		t.Errorf("Catalog() => got: %+v, expected: %+v", cabs, expected)
+	}
+}
+
+func TestCabServicesEtaNow(t *testing.T) {
+	cs := CabServices{"uber": &MockCabService{}}
+
+	eta, err := cs.EtaNow(context.Background(), &domain.CabRequest{Cab: "uber", CabType: "uberGo"})
+	if err != nil || eta != 7*time.Minute {
+		t.Errorf("EtaNow() of uber => got: %v, %v, expected: 7m0s, nil", eta, err)
+	}
+	_, err = cs.EtaNow(context.Background(), &domain.CabRequest{Cab: "ola", CabType: "olaMini"})
+	if !domain.IsPermanent(err) {
+		t.Errorf("EtaNow() of a cab without service => got: %v, expected a permanent error", err)
+	}
 }
@@ -1,12 +1,66 @@
 package usecases
 
 import (
-	// "fmt"
 	"time"
 )
 
+// CronEngine schedules jobs to be added to the AppEngine of their job type at a given time.
+// Add returns the id of the CronJob which can be used to Cancel it, CancelRequest cancels
+// all the CronJobs of a request.
 type CronEngine interface {
-	Add(time.Time, CronJob) error
+	Add(time.Time, Job) (uint64, error)
+	Cancel(uint64) error
+	CancelRequest(uint64) error
 }
 
-type CronJob func()
+// CronJob is a trigger scheduled on a CronEngine. When At comes, the job described by Job
+// is added to the AppEngine of its type. It only holds the serializable JobDescriptor, so
+// that the schedule can be persisted and reloaded after a restart.
+type CronJob struct {
+	ID  uint64
+	At  time.Time
+	Job JobDescriptor
+}
+
+// ScheduleStore exposes the interface to persist the CronJobs of a CronEngine.
+type ScheduleStore interface {
+	Add(CronJob) (uint64, error)
+	Remove(uint64) error
+	List() ([]CronJob, error)
+}
+
+// CatchUpMode says what a CronEngine does with the CronJobs which became due while it
+// was not running.
+type CatchUpMode int
+
+const (
+	// CatchUpFireAll fires all the overdue CronJobs right away.
+	CatchUpFireAll CatchUpMode = iota
+	// CatchUpSkip drops all the overdue CronJobs.
+	CatchUpSkip
+	// CatchUpWithinWindow fires the CronJobs which are overdue by at most
+	// CatchUpPolicy.Window and drops the others.
+	CatchUpWithinWindow
+)
+
+// CatchUpPolicy configures how a CronEngine handles the CronJobs which became due while
+// it was not running.
+type CatchUpPolicy struct {
+	Mode   CatchUpMode
+	Window time.Duration
+}
+
+// ShouldFire returns if a CronJob which was due at `at` is fired when it is found at `now`.
+func (p CatchUpPolicy) ShouldFire(at, now time.Time) bool {
+	if !at.Before(now) {
+		return true
+	}
+	switch p.Mode {
+	case CatchUpSkip:
+		return false
+	case CatchUpWithinWindow:
+		return now.Sub(at) <= p.Window
+	default:
+		return true
+	}
+}
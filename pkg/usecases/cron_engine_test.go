@@ -0,0 +1,34 @@
+package usecases
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCatchUpPolicyShouldFire(t *testing.T) {
+	now := time.Date(2018, time.March, 9, 9, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name     string
+		policy   CatchUpPolicy
+		at       time.Time
+		expected bool
+	}{
+		{name: "fire all, not due yet", policy: CatchUpPolicy{Mode: CatchUpFireAll}, at: now.Add(time.Minute), expected: true},
+		{name: "fire all, overdue", policy: CatchUpPolicy{Mode: CatchUpFireAll}, at: now.Add(-time.Hour), expected: true},
+		{name: "skip, due now", policy: CatchUpPolicy{Mode: CatchUpSkip}, at: now, expected: true},
+		{name: "skip, overdue", policy: CatchUpPolicy{Mode: CatchUpSkip}, at: now.Add(-time.Second), expected: false},
+		{name: "window, overdue within", policy: CatchUpPolicy{Mode: CatchUpWithinWindow, Window: 10 * time.Minute}, at: now.Add(-10 * time.Minute), expected: true},
+		{name: "window, overdue beyond", policy: CatchUpPolicy{Mode: CatchUpWithinWindow, Window: 10 * time.Minute}, at: now.Add(-11 * time.Minute), expected: false},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.policy.ShouldFire(tc.at, now)
+			if got != tc.expected {
+				t.Errorf("ShouldFire(%v, %v) => got: %v, expected: %v", tc.at, now, got, tc.expected)
+			}
+		})
+	}
+}
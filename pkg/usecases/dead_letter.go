@@ -0,0 +1,101 @@
+package usecases
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DeadLetter is a job which ran out of attempts, along with why and when it failed for the
+// last time. Dead letters are kept in a DeadLetterStore until someone replays or drops them.
+type DeadLetter struct {
+	ID        uint64
+	Job       Job
+	JobType   string
+	RequestID uint64
+	Attempts  int
+	LastError string
+	FailedAt  time.Time
+}
+
+// DeadLetterStore exposes the interface to store, list and remove dead letters.
+type DeadLetterStore interface {
+	Add(DeadLetter) (uint64, error)
+	FindByID(uint64) (DeadLetter, error)
+	List() ([]DeadLetter, error)
+	Remove(uint64) error
+}
+
+// NewDeadLetter is a constructor which takes the job which failed, the number of attempts
+// made and the last error and returns a new DeadLetter.
+func NewDeadLetter(job Job, attempts int, err error) DeadLetter {
+	dl := DeadLetter{
+		Job:       job,
+		JobType:   job.Type(),
+		RequestID: job.RequestID(),
+		Attempts:  attempts,
+		FailedAt:  time.Now(),
+	}
+	if err != nil {
+		dl.LastError = err.Error()
+	}
+	return dl
+}
+
+// DeadLetterInteractor has the use cases to inspect the dead letters and to replay them,
+// i.e. to put a dead letter's job back on the AppEngine of its job type with a fresh
+// set of attempts.
+type DeadLetterInteractor struct {
+	DeadLetterStore DeadLetterStore
+	AppEngines      map[string]AppEngine
+}
+
+// ListDeadLetters returns all the dead letters in the DeadLetterStore.
+func (d *DeadLetterInteractor) ListDeadLetters() ([]DeadLetter, error) {
+	dls, err := d.DeadLetterStore.List()
+	if err != nil {
+		return dls, errors.Wrap(err, "ListDeadLetters couldn't list the DeadLetterStore")
+	}
+	return dls, nil
+}
+
+// Replay takes the id of a dead letter and adds its job to the AppEngine of its job type.
+// The dead letter is removed from the store only once the job was added.
+func (d *DeadLetterInteractor) Replay(id uint64) error {
+	dl, err := d.DeadLetterStore.FindByID(id)
+	if err != nil {
+		return errors.Wrapf(err, "Replay couldn't find dead letter %d", id)
+	}
+	a, ok := d.AppEngines[dl.JobType]
+	if !ok {
+		return errors.Errorf("Replay has no AppEngine for job type: %s", dl.JobType)
+	}
+	err = a.AddJob(dl.Job)
+	if err != nil {
+		return errors.Wrapf(err, "Replay couldn't add the job of dead letter %d to AppEngine", id)
+	}
+	err = d.DeadLetterStore.Remove(id)
+	if err != nil {
+		return errors.Wrapf(err, "Replay added the job but couldn't remove dead letter %d", id)
+	}
+	return nil
+}
+
+// Drop removes a dead letter without replaying it.
+func (d *DeadLetterInteractor) Drop(id uint64) error {
+	err := d.DeadLetterStore.Remove(id)
+	if err != nil {
+		return errors.Wrapf(err, "Drop couldn't remove dead letter %d", id)
+	}
+	return nil
+}
+
+// NewDeadLetterInteractor is a constructor which takes the DeadLetterStore and the AppEngines
+// keyed by the job type they process and returns a pointer to a new DeadLetterInteractor.
+func NewDeadLetterInteractor(dls DeadLetterStore, appEngines map[string]AppEngine) *DeadLetterInteractor {
+	d := DeadLetterInteractor{
+		DeadLetterStore: dls,
+		AppEngines:      appEngines,
+	}
+	return &d
+}
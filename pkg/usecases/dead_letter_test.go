@@ -0,0 +1,56 @@
+package usecases
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// MockRecordingAppEngine implements the AppEngine interface and records the jobs added to it.
+type MockRecordingAppEngine struct {
+	jobs []Job
+}
+
+func (a *MockRecordingAppEngine) AddJob(j Job) error {
+	a.jobs = append(a.jobs, j)
+	return nil
+}
+
+func TestDeadLetterInteractorReplay(t *testing.T) {
+	dls := &MockDeadLetterStore{}
+	job := &MockJob{}
+	id, _ := dls.Add(NewDeadLetter(job, 3, errors.New("some error")))
+	engine := &MockRecordingAppEngine{}
+	d := NewDeadLetterInteractor(dls, map[string]AppEngine{"mock": engine})
+
+	err := d.Replay(id)
+	if err != nil || len(engine.jobs) != 1 || engine.jobs[0] != job {
+		t.Fatalf("Replay(%d) => got: (%v, %v), expected the job to be added to its AppEngine", id, engine.jobs, err)
+	}
+	if all, _ := d.ListDeadLetters(); len(all) != 0 {
+		t.Errorf("Replay(%d) => got dead letters: %v, expected it to be removed", id, all)
+	}
+
+	// a dead letter whose job type has no AppEngine stays in the store
+	id, _ = dls.Add(NewDeadLetter(job, 3, errors.New("some error")))
+	d.AppEngines = map[string]AppEngine{}
+	err = d.Replay(id)
+	if err == nil {
+		t.Errorf("Replay(%d) without AppEngine => got: nil, expected: error", id)
+	}
+	if all, _ := d.ListDeadLetters(); len(all) != 1 {
+		t.Errorf("Replay(%d) without AppEngine => got dead letters: %v, expected it to be kept", id, all)
+	}
+
+	// replaying with a failing AppEngine keeps the dead letter as well
+	d.AppEngines = map[string]AppEngine{"mock": &MockBadAppEngine{}}
+	err = d.Replay(id)
+	if err == nil {
+		t.Errorf("Replay(%d) with failing AppEngine => got: nil, expected: error", id)
+	}
+
+	err = d.Drop(id)
+	if err != nil {
+		t.Errorf("Drop(%d) => got: %v, expected: nil", id, err)
+	}
+}
@@ -0,0 +1,99 @@
+package usecases
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// maxIdempotencyKeyLen is the longest idempotency key which is accepted.
+const maxIdempotencyKeyLen = 255
+
+// ErrIdempotencyKeyReused is the cause of the error returned by CreateUserRequest for an
+// idempotency key which was used before for a request with a different payload.
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+
+// ErrIdempotencyKeyInUse is the cause of the error returned by CreateUserRequest for an
+// idempotency key whose request is still being created, the client can try again shortly.
+var ErrIdempotencyKeyInUse = errors.New("a request with the idempotency key is being created")
+
+// IdempotencyRecord is what is remembered of an idempotency key: the hash of the payload it
+// was first used with and the request created for it, until it expires. RequestID is zero
+// while the request is being created. A key is scoped to the notification address of the
+// request, the user it is made for, so that the keys of different users never collide.
+type IdempotencyRecord struct {
+	Scope       string
+	Key         string
+	PayloadHash string
+	RequestID   uint64
+	ExpiresAt   time.Time
+}
+
+// IdempotencyStore exposes the interface to keep the idempotency keys. Claim stores the
+// record if there is no record of its scope and key which expires after now, and returns
+// true. It returns the stored record and false otherwise, the check and the store are done
+// at once so that two requests with the same key can't both claim it. Complete records the
+// id of the request created for a claimed key, and Release removes a claimed key whose
+// request couldn't be created.
+type IdempotencyStore interface {
+	Claim(rec IdempotencyRecord, now time.Time) (IdempotencyRecord, bool, error)
+	Complete(scope, key string, requestID uint64) error
+	Release(scope, key string) error
+}
+
+// IdempotencyKeys remembers the request created for each idempotency key for Retention, so
+// that a client which retries the creation of a request with the same key gets the request
+// created the first time instead of a new one. A Transactor which keeps the keys replaces
+// the Store with the one of its transaction, see Repositories.
+type IdempotencyKeys struct {
+	Store     IdempotencyStore
+	Retention time.Duration
+}
+
+// NewIdempotencyKeys is a constructor which takes the IdempotencyStore and how long the keys
+// are kept and returns a pointer to a new IdempotencyKeys.
+func NewIdempotencyKeys(s IdempotencyStore, retention time.Duration) *IdempotencyKeys {
+	k := IdempotencyKeys{
+		Store:     s,
+		Retention: retention,
+	}
+	return &k
+}
+
+// record returns the IdempotencyRecord of the key of the request, which is claimed at now.
+func (k *IdempotencyKeys) record(dto UserRequestDTO, now time.Time) IdempotencyRecord {
+	return IdempotencyRecord{
+		Scope:       dto.notificationAddr.AddrType + ":" + dto.notificationAddr.Value,
+		Key:         dto.idempotencyKey,
+		PayloadHash: dto.payloadHash(),
+		ExpiresAt:   now.Add(k.Retention),
+	}
+}
+
+// SetIdempotencyKey sets the key which identifies the request to CreateUserRequest across
+// the retries of a client. An empty key is no key.
+func (dto *UserRequestDTO) SetIdempotencyKey(key string) error {
+	if len(key) > maxIdempotencyKeyLen {
+		return domain.NewValidationError("idempotency_key", "is longer than %d characters", maxIdempotencyKeyLen)
+	}
+	dto.idempotencyKey = key
+	return nil
+}
+
+// payloadHash returns the hash of the input of the request, without its idempotency key.
+func (dto UserRequestDTO) payloadHash() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%q\n", dto.name)
+	for _, l := range []domain.Location{dto.source, dto.destination} {
+		fmt.Fprintf(h, "%q %q %q\n", l.Name, l.Latitude, l.Longitude)
+	}
+	fmt.Fprintf(h, "%s\n", dto.reachingTime.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(h, "%q %q\n", dto.cab, dto.cabType)
+	fmt.Fprintf(h, "%q %q\n", dto.notificationAddr.AddrType, dto.notificationAddr.Value)
+	return hex.EncodeToString(h.Sum(nil))
+}
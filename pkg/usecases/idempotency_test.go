@@ -0,0 +1,150 @@
+package usecases
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// MockIdempotencyStore implements the IdempotencyStore interface with a map whose records
+// never expire, keyed by the scope and the key.
+type MockIdempotencyStore struct {
+	records map[string]IdempotencyRecord
+}
+
+func (s *MockIdempotencyStore) Claim(rec IdempotencyRecord, now time.Time) (IdempotencyRecord, bool, error) {
+	if stored, ok := s.records[rec.Scope+" "+rec.Key]; ok {
+		return stored, false, nil
+	}
+	s.records[rec.Scope+" "+rec.Key] = rec
+	return rec, true, nil
+}
+
+func (s *MockIdempotencyStore) Complete(scope, key string, requestID uint64) error {
+	rec := s.records[scope+" "+key]
+	rec.RequestID = requestID
+	s.records[scope+" "+key] = rec
+	return nil
+}
+
+func (s *MockIdempotencyStore) Release(scope, key string) error {
+	delete(s.records, scope+" "+key)
+	return nil
+}
+
+// testScope is the scope of the idempotency keys of testUserRequestDTO.
+const testScope = "email:anirba.nick@gmail.com"
+
+func testIdempotentInteractor(t *testing.T) (*UserInteractor, *MockMapRequestRepo, *MockIdempotencyStore) {
+	t.Helper()
+	interactor := testUserInteractor(t)
+	reqRepo := &MockMapRequestRepo{requests: make(map[uint64]domain.Request)}
+	interactor.RequestRepository = reqRepo
+	store := &MockIdempotencyStore{records: make(map[string]IdempotencyRecord)}
+	interactor.IdempotencyKeys = NewIdempotencyKeys(store, time.Hour)
+	return interactor, reqRepo, store
+}
+
+func testKeyedDTO(t *testing.T, key string) UserRequestDTO {
+	t.Helper()
+	dto := testUserRequestDTO(t)
+	if err := dto.SetIdempotencyKey(key); err != nil {
+		t.Fatalf("SetIdempotencyKey() => got: %v, expected: nil", err)
+	}
+	return dto
+}
+
+func TestCreateUserRequestWithIdempotencyKey(t *testing.T) {
+	interactor, reqRepo, _ := testIdempotentInteractor(t)
+	dto := testKeyedDTO(t, "key-1")
+
+	first, err := interactor.CreateUserRequest(dto)
+	if err != nil {
+		t.Fatalf("CreateUserRequest() => got: %v, expected: nil", err)
+	}
+	retry, err := interactor.CreateUserRequest(dto)
+	if err != nil || retry.Request.ID() != first.Request.ID() || retry.Request.UserID != first.User.UserID || retry.User.Name != "roy" {
+		t.Errorf("CreateUserRequest() retried => got: (%v, %v), expected request %d", retry, err, first.Request.ID())
+	}
+	if len(reqRepo.requests) != 1 {
+		t.Errorf("CreateUserRequest() retried => got %d stored requests, expected: 1", len(reqRepo.requests))
+	}
+
+	other := testKeyedDTO(t, "key-1")
+	other.cabType = "uberX"
+	_, err = interactor.CreateUserRequest(other)
+	if errors.Cause(err) != ErrIdempotencyKeyReused {
+		t.Errorf("CreateUserRequest() of another request with the key => got: %v, expected: %v", err, ErrIdempotencyKeyReused)
+	}
+
+	_, err = interactor.CreateUserRequest(testUserRequestDTO(t))
+	if err != nil || len(reqRepo.requests) != 2 {
+		t.Errorf("CreateUserRequest() without a key => got: (%d stored requests, %v), expected: (2, nil)", len(reqRepo.requests), err)
+	}
+}
+
+func TestCreateUserRequestReleasesKeyOnFailure(t *testing.T) {
+	interactor, reqRepo, store := testIdempotentInteractor(t)
+	dto := testKeyedDTO(t, "key-1")
+
+	interactor.AppEngine = &MockBadAppEngine{}
+	if _, err := interactor.CreateUserRequest(dto); err == nil {
+		t.Fatalf("CreateUserRequest() with a failing AppEngine => got: nil, expected an error")
+	}
+	if _, ok := store.records[testScope+" key-1"]; ok {
+		t.Errorf("CreateUserRequest() with a failing AppEngine => got the key kept, expected it released")
+	}
+
+	interactor.AppEngine = &MockAppEngine{}
+	ur, err := interactor.CreateUserRequest(dto)
+	if err != nil || store.records[testScope+" key-1"].RequestID != ur.Request.ID() {
+		t.Errorf("CreateUserRequest() retried => got: (%v, %v), expected the key completed with the request", store.records[testScope+" key-1"], err)
+	}
+	if len(reqRepo.requests) != 2 {
+		t.Errorf("CreateUserRequest() retried => got %d stored requests, expected the failed one and the retry", len(reqRepo.requests))
+	}
+}
+
+func TestCreateUserRequestWithKeyInUse(t *testing.T) {
+	interactor, _, store := testIdempotentInteractor(t)
+	dto := testKeyedDTO(t, "key-1")
+	store.Claim(IdempotencyRecord{Scope: testScope, Key: "key-1", PayloadHash: dto.payloadHash()}, time.Now())
+
+	_, err := interactor.CreateUserRequest(dto)
+	if errors.Cause(err) != ErrIdempotencyKeyInUse {
+		t.Errorf("CreateUserRequest() with a key in use => got: %v, expected: %v", err, ErrIdempotencyKeyInUse)
+	}
+}
+
+func TestCreateUserRequestScopesKeyToAddress(t *testing.T) {
+	interactor, reqRepo, _ := testIdempotentInteractor(t)
+	first, err := interactor.CreateUserRequest(testKeyedDTO(t, "key-1"))
+	if err != nil {
+		t.Fatalf("CreateUserRequest() => got: %v, expected: nil", err)
+	}
+	other := testKeyedDTO(t, "key-1")
+	other.notificationAddr.Value = "nick@example.com"
+	ur, err := interactor.CreateUserRequest(other)
+	if err != nil || ur.Request.ID() == first.Request.ID() || len(reqRepo.requests) != 2 {
+		t.Errorf("CreateUserRequest() of another user with the key => got: (%v, %v), expected a new request", ur, err)
+	}
+}
+
+func TestSetIdempotencyKey(t *testing.T) {
+	dto := testUserRequestDTO(t)
+	hash := dto.payloadHash()
+	if err := dto.SetIdempotencyKey(strings.Repeat("k", maxIdempotencyKeyLen+1)); !domain.IsValidation(err) {
+		t.Errorf("SetIdempotencyKey() of a long key => got: %v, expected a validation error", err)
+	}
+	if err := dto.SetIdempotencyKey("key-1"); err != nil || dto.payloadHash() != hash {
+		t.Errorf("SetIdempotencyKey() => got: %v, expected the payload hash not to change", err)
+	}
+	dto.reachingTime = dto.reachingTime.Add(time.Minute)
+	if dto.payloadHash() == hash {
+		t.Errorf("payloadHash() of another reaching time => got: %s, expected another hash", hash)
+	}
+}
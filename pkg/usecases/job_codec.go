@@ -0,0 +1,202 @@
+package usecases
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// JobDescriptor is the serializable form of a Job. Jobs hold pointers to the interactors
+// which do their work, so only the data of a job is written down, the JobCodec puts the
+// interactors back when it turns a JobDescriptor into a Job again.
+type JobDescriptor struct {
+	Type      string          `json:"type"`
+	RequestID uint64          `json:"request_id"`
+	Attempts  int             `json:"attempts,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// userRequestRecord is the serializable form of a domain.UserRequest.
+type userRequestRecord struct {
+	RequestID        uint64             `json:"request_id"`
+	UserID           uint64             `json:"user_id"`
+	Name             string             `json:"name"`
+	Source           domain.Location    `json:"source"`
+	Destination      domain.Location    `json:"destination"`
+	ReachingTime     time.Time          `json:"reaching_time"`
+	Cab              string             `json:"cab"`
+	CabType          string             `json:"cab_type"`
+	NotificationAddr domain.UserAddress `json:"notification_addr"`
+}
+
+// trafficResponseRecord is the serializable form of a TrafficResponseDTO.
+type trafficResponseRecord struct {
+	UserRequest userRequestRecord `json:"user_request"`
+	TravelTime  []time.Duration   `json:"travel_time"`
+	BestCase    []time.Time       `json:"best_case"`
+	WorstCase   []time.Time       `json:"worst_case"`
+}
+
+// bookingResponseRecord is the serializable form of a domain.CabBookingResponse.
+type bookingResponseRecord struct {
+	BookingID       uint64            `json:"booking_id"`
+	UserRequest     userRequestRecord `json:"user_request"`
+	BestBookingTime time.Time         `json:"best_booking_time"`
+}
+
+func newUserRequestRecord(ur *domain.UserRequest) (userRequestRecord, error) {
+	var rec userRequestRecord
+	if ur == nil || ur.User == nil || ur.Request == nil {
+		return rec, errors.New("user request has no user or request")
+	}
+	rec = userRequestRecord{
+		RequestID:        ur.Request.ID(),
+		UserID:           ur.User.UserID,
+		Name:             ur.Name,
+		Source:           ur.Source,
+		Destination:      ur.Destination,
+		ReachingTime:     ur.ReachingTime,
+		Cab:              ur.Cab,
+		CabType:          ur.CabType,
+		NotificationAddr: ur.NotificationAddr,
+	}
+	return rec, nil
+}
+
+func (rec userRequestRecord) userRequest() *domain.UserRequest {
+	u := domain.NewUser(rec.Name)
+	u.UserID = rec.UserID
+	r := &domain.Request{
+		UserID:           rec.UserID,
+		Source:           rec.Source,
+		Destination:      rec.Destination,
+		ReachingTime:     rec.ReachingTime,
+		Cab:              rec.Cab,
+		CabType:          rec.CabType,
+		NotificationAddr: rec.NotificationAddr,
+	}
+	r.SetID(rec.RequestID)
+	return domain.NewUserRequest(u, r)
+}
+
+// JobCodec turns jobs into JobDescriptors and back. It holds the interactors which are
+// injected into the jobs it decodes. The fields can be set after the JobCodec is handed to a
+// durable AppEngine, as long as they are all set before the first job is decoded, which is
+// what makes it possible to wire the AppEngines and the interactors which use them.
+type JobCodec struct {
+	TrafficInteractor             *TrafficInteractor
+	CabInteractor                 *CabInteractor
+	CabEngineInteractor           *CabEngineInteractor
+	NotificationInteractor        *NotificationInteractor
+	NotificationServiceInteractor *NotificationServiceInteractor
+	CronEngine                    CronEngine
+}
+
+// Encode returns the JobDescriptor of one of the application's jobs, including the number
+// of attempts already made if the job is a RetriedJob.
+func (c *JobCodec) Encode(job Job) (JobDescriptor, error) {
+	var d JobDescriptor
+	attempt, _ := attemptOf(job)
+	original := innermostJob(job)
+
+	var payload interface{}
+	var err error
+	switch j := original.(type) {
+	case *UserRequestJob:
+		payload, err = newUserRequestRecord(j.UserRequest)
+	case *CabRequestJob:
+		if j.TrafficResponse == nil {
+			return d, errors.New("JobCodec can't encode CabRequestJob without TrafficResponse")
+		}
+		var rec trafficResponseRecord
+		rec.UserRequest, err = newUserRequestRecord(j.TrafficResponse.UserRequest)
+		rec.TravelTime = j.TrafficResponse.TravelTime
+		rec.BestCase = j.TrafficResponse.BestCase
+		rec.WorstCase = j.TrafficResponse.WorstCase
+		payload = rec
+	case *NotificationJob:
+		if j.CabBookingResponse == nil {
+			return d, errors.New("JobCodec can't encode NotificationJob without CabBookingResponse")
+		}
+		var rec bookingResponseRecord
+		rec.UserRequest, err = newUserRequestRecord(j.CabBookingResponse.UserRequest)
+		rec.BookingID = j.CabBookingResponse.BookingID
+		rec.BestBookingTime = j.CabBookingResponse.BestBookingTime
+		payload = rec
+	default:
+		return d, errors.Errorf("JobCodec can't encode job of type: %s", job.Type())
+	}
+	if err != nil {
+		return d, errors.Wrapf(err, "JobCodec couldn't encode %s job", job.Type())
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return d, errors.Wrapf(err, "JobCodec couldn't marshal %s job", job.Type())
+	}
+	d = JobDescriptor{
+		Type:      original.Type(),
+		RequestID: original.RequestID(),
+		Attempts:  attempt - 1,
+		Payload:   raw,
+	}
+	return d, nil
+}
+
+// Decode builds the job described by the JobDescriptor, wrapped in a RetriedJob if it
+// had failed before.
+func (c *JobCodec) Decode(d JobDescriptor) (Job, error) {
+	var job Job
+	switch d.Type {
+	case UserRequestJobType:
+		var rec userRequestRecord
+		if err := json.Unmarshal(d.Payload, &rec); err != nil {
+			return job, errors.Wrap(err, "JobCodec couldn't unmarshal user_request job")
+		}
+		job = NewUserRequestJob(rec.userRequest(), c.TrafficInteractor, c.CabInteractor, c.CabEngineInteractor, c.NotificationInteractor, c.NotificationServiceInteractor, c.CronEngine)
+	case CabRequestJobType:
+		var rec trafficResponseRecord
+		if err := json.Unmarshal(d.Payload, &rec); err != nil {
+			return job, errors.Wrap(err, "JobCodec couldn't unmarshal cab_request job")
+		}
+		tr := &TrafficResponseDTO{
+			UserRequest: rec.UserRequest.userRequest(),
+			TravelTime:  rec.TravelTime,
+			BestCase:    rec.BestCase,
+			WorstCase:   rec.WorstCase,
+		}
+		job = NewCabRequestJob(tr, c.CabInteractor, c.NotificationInteractor, c.NotificationServiceInteractor)
+	case NotificationJobType:
+		var rec bookingResponseRecord
+		if err := json.Unmarshal(d.Payload, &rec); err != nil {
+			return job, errors.Wrap(err, "JobCodec couldn't unmarshal notification job")
+		}
+		cbr := domain.NewCabBookingResponse(rec.UserRequest.userRequest(), rec.BestBookingTime)
+		cbr.BookingID = rec.BookingID
+		job = NewNotificationJob(cbr, c.NotificationServiceInteractor)
+	default:
+		return job, errors.Errorf("JobCodec can't decode job of type: %s", d.Type)
+	}
+
+	if d.Attempts > 0 {
+		return &RetriedJob{Job: job, Attempts: d.Attempts}, nil
+	}
+	return job, nil
+}
+
+// NewJobCodec is a constructor which takes the interactors injected into decoded jobs and
+// returns a pointer to a new JobCodec.
+func NewJobCodec(trI *TrafficInteractor, cabI *CabInteractor, cabEngI *CabEngineInteractor, nI *NotificationInteractor, nsI *NotificationServiceInteractor, c CronEngine) *JobCodec {
+	jc := JobCodec{
+		TrafficInteractor:             trI,
+		CabInteractor:                 cabI,
+		CabEngineInteractor:           cabEngI,
+		NotificationInteractor:        nI,
+		NotificationServiceInteractor: nsI,
+		CronEngine:                    c,
+	}
+	return &jc
+}
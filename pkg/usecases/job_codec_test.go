@@ -0,0 +1,88 @@
+package usecases
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+func testUserRequest(t *testing.T) *domain.UserRequest {
+	t.Helper()
+
+	r := &domain.Request{
+		UserID:           123,
+		Source:           domain.Location{Name: "home", Latitude: "77.134134", Longitude: "45.1341324"},
+		Destination:      domain.Location{Name: "office", Latitude: "77.234134", Longitude: "45.5641324"},
+		ReachingTime:     time.Date(2018, time.March, 9, 10, 0, 0, 0, time.UTC),
+		Cab:              "uber",
+		CabType:          "uberGo",
+		NotificationAddr: domain.UserAddress{AddrType: "email", Value: "anirban.nick@gmail.com"},
+	}
+	r.SetID(456)
+	u := domain.NewUser("roy")
+	u.UserID = 123
+	return domain.NewUserRequest(u, r)
+}
+
+func TestJobCodecRoundTrip(t *testing.T) {
+	trI := testTrafficInteractor(t)
+	cabI := testCabInteractor(t)
+	cabEngI := testCabEngineInteractor(t)
+	nI := testNotificationInteractor(t)
+	nsI := testNotificationServiceInteractor(t)
+	c := &MockCronEngine{}
+	codec := NewJobCodec(trI, cabI, cabEngI, nI, nsI, c)
+
+	ur := testUserRequest(t)
+	tr := &TrafficResponseDTO{
+		UserRequest: ur,
+		TravelTime:  []time.Duration{45 * time.Minute},
+		BestCase:    []time.Time{time.Date(2018, time.March, 9, 9, 0, 0, 0, time.UTC)},
+		WorstCase:   []time.Time{time.Date(2018, time.March, 9, 8, 45, 0, 0, time.UTC)},
+	}
+	cbr := domain.NewCabBookingResponse(ur, time.Date(2018, time.March, 9, 8, 40, 0, 0, time.UTC))
+	cbr.BookingID = 789
+
+	testCases := []struct {
+		name string
+		job  Job
+	}{
+		{
+			name: "user request job",
+			job:  NewUserRequestJob(ur, trI, cabI, cabEngI, nI, nsI, c),
+		},
+		{
+			name: "cab request job",
+			job:  NewCabRequestJob(tr, cabI, nI, nsI),
+		},
+		{
+			name: "notification job",
+			job:  NewNotificationJob(cbr, nsI),
+		},
+		{
+			name: "retried notification job",
+			job:  &RetriedJob{Job: NewNotificationJob(cbr, nsI), Attempts: 3},
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := codec.Encode(tc.job)
+			if err != nil {
+				t.Fatalf("%s: Encode() => got: %v, expected: nil", tc.name, err)
+			}
+			job, err := codec.Decode(d)
+			if err != nil || !reflect.DeepEqual(job, tc.job) {
+				t.Errorf("%s: Decode(Encode()) => got: (%+v, %v), expected: (%+v, nil)", tc.name, job, err, tc.job)
+			}
+		})
+	}
+
+	_, err := codec.Decode(JobDescriptor{Type: "unknown"})
+	if err == nil {
+		t.Errorf("Decode() of unknown job type => got: nil, expected: error")
+	}
+}
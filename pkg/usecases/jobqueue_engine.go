@@ -1,65 +1,416 @@
 package usecases
 
 import (
-	"fmt"
+	"context"
+	"runtime/debug"
+	"sync"
 
-	// "github.com/pkg/errors"
+	"github.com/pkg/errors"
 
 	"github.com/anirbanroydas/ubernow-go/pkg/domain"
 )
 
+// JobCheckpointer saves the jobs which were still queued when a Dispatcher had to give up
+// draining its job queue during shutdown, so that they can be redelivered later instead of
+// being lost.
+type JobCheckpointer interface {
+	Checkpoint([]Job) error
+}
+
+// Acknowledger is implemented by the jobs handed out by a durable AppEngine. Ack is called
+// once the job is done with for good, i.e. it succeeded, its request was cancelled or it was
+// moved to the dead letters. A job which is never acked is delivered again after a restart.
+type Acknowledger interface {
+	Ack() error
+}
+
+// JobWrapper is implemented by jobs which wrap another job to add some behaviour to it,
+// like the jobs of a durable AppEngine which know how to acknowledge themselves.
+type JobWrapper interface {
+	Unwrap() Job
+}
+
+// innermostJob returns the job without the RetriedJob and JobWrapper wrapping.
+func innermostJob(job Job) Job {
+	for {
+		switch j := job.(type) {
+		case *RetriedJob:
+			job = j.Job
+		case JobWrapper:
+			job = j.Unwrap()
+		default:
+			return job
+		}
+	}
+}
+
+// finishesRequest returns if the request of the job is finished once the job is done, which
+// is the case of the NotificationJob, the last job of a request.
+func finishesRequest(job Job) bool {
+	_, ok := innermostJob(job).(*NotificationJob)
+	return ok
+}
+
+// ackJob acknowledges the job if it came from a durable AppEngine.
+func ackJob(job Job, logger domain.Logger) {
+	_, original := attemptOf(job)
+	a, ok := original.(Acknowledger)
+	if !ok {
+		return
+	}
+	err := a.Ack()
+	if err != nil {
+		logger.Error("couldn't acknowledge job, it will be delivered again", domain.NewField(domain.ErrorKey, err))
+	}
+}
+
+// Worker picks jobs from a job queue and does them one at a time. A Worker stops when it is
+// told to quit, when its context is done or, once draining starts, as soon as the job queue
+// is empty.
 type Worker struct {
-	jobQueue chan Job
-	done     chan bool
-	logger   domain.Logger
+	ID        int
+	jobQueue  chan Job
+	quit      chan struct{}
+	quitOnce  sync.Once
+	drain     <-chan struct{}
+	logger    domain.Logger
+	canceller *RequestCanceller
+	retrier   *Retrier
+}
+
+// Start picks jobs from the job queue and does them one by one until the Worker is stopped
+// or ctx is done. Every job gets a context derived from ctx.
+func (w *Worker) Start(ctx context.Context) {
+	for {
+		// stopping takes priority over the jobs which are already queued
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.quit:
+			return
+		default:
+		}
+
+		select {
+		case job := <-w.jobQueue:
+			w.dispatch(ctx, job)
+		case <-w.drain:
+			w.drainQueue(ctx)
+			return
+		case <-w.quit:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
-func (w *Worker) Start() {
+// Stop tells the Worker to return from Start once it is done with its current job.
+func (w *Worker) Stop() {
+	w.quitOnce.Do(func() {
+		close(w.quit)
+	})
+}
+
+// drainQueue does the jobs left in the job queue until it is empty or ctx is done.
+func (w *Worker) drainQueue(ctx context.Context) {
 	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
 		select {
 		case job := <-w.jobQueue:
-			err := job.DoWork()
-			if err != nil {
-				w.logger.LogError(fmt.Sprintf("Worker returned error for job: Error:: %v", err))
-			}
-		case <-w.done:
+			w.dispatch(ctx, job)
+		default:
 			return
 		}
 	}
 }
 
-func NewWorker(jobQueue chan Job, closeChannel chan bool) *Worker {
+// dispatch processes the job, unless ctx is done. select picks at random among the cases which
+// are ready, so a job can be taken off the job queue after ctx was cancelled; the job is then
+// kept for the Dispatcher to checkpoint instead of being started with a cancelled context.
+func (w *Worker) dispatch(ctx context.Context, job Job) {
+	if ctx.Err() == nil {
+		w.process(ctx, job)
+		return
+	}
+	if w.retrier != nil {
+		w.retrier.Interrupted(job)
+		return
+	}
+	select {
+	case w.jobQueue <- job:
+	default:
+		w.logger.Warn("Worker dropped job taken off the job queue after its context was done",
+			domain.NewField(domain.JobTypeKey, job.Type()),
+			domain.NewField(domain.RequestIDKey, job.RequestID()),
+		)
+	}
+}
+
+// process does the work of a single job, the logger handed over to the job and used
+// to report its error is tagged with the job's type, request id and attempt.
+// The job's context is done when its Timeout elapses or when its request is cancelled.
+// A job which fails is handed to the Retrier, unless its request was cancelled. The
+// RequestCanceller forgets the request once it is finished, when the job of a cancelled
+// request is dropped or the NotificationJob is done.
+func (w *Worker) process(ctx context.Context, job Job) {
+	attempt, _ := attemptOf(job)
+	logger := w.logger.With(
+		domain.NewField(domain.JobTypeKey, job.Type()),
+		domain.NewField(domain.RequestIDKey, job.RequestID()),
+		domain.NewField("attempt", attempt),
+	)
+	if w.canceller.IsCancelled(job.RequestID()) {
+		logger.Info("Worker skipped job of cancelled request")
+		ackJob(job, logger)
+		w.canceller.Forget(job.RequestID())
+		return
+	}
+
+	jobCtx, release := w.canceller.Track(ctx, job.RequestID())
+	jobCtx, cancel := context.WithTimeout(jobCtx, job.Timeout())
+	defer cancel()
+
+	err := w.doWork(jobCtx, job, logger)
+	// the job is no longer in progress, its request can be forgotten
+	release()
+	if err == nil {
+		ackJob(job, logger)
+		if finishesRequest(job) {
+			w.canceller.Forget(job.RequestID())
+		}
+		return
+	}
+	switch {
+	case w.canceller.IsCancelled(job.RequestID()):
+		logger.Info("Worker stopped job of cancelled request", domain.NewField(domain.ErrorKey, err))
+		ackJob(job, logger)
+		w.canceller.Forget(job.RequestID())
+	case ctx.Err() != nil && w.retrier != nil:
+		logger.Warn("Worker interrupted job on shutdown", domain.NewField(domain.ErrorKey, err))
+		w.retrier.Interrupted(job)
+	default:
+		logger.Error("Worker returned error for job", domain.NewField(domain.ErrorKey, err))
+		if w.retrier != nil {
+			w.retrier.HandleFailure(job, err, logger)
+		}
+	}
+}
+
+// doWork calls the job's DoWork method and turns a panic in the job into an error, so a
+// single bad job can't bring the Worker, and with it the whole server, down.
+func (w *Worker) doWork(ctx context.Context, job Job, logger domain.Logger) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Worker recovered from panic in job", domain.NewField("stack", string(debug.Stack())))
+			err = errors.Errorf("job panicked: %v", r)
+		}
+	}()
+	return job.DoWork(ctx, logger)
+}
+
+// NewWorker is a constructor which takes the id of the worker, the job queue to pick jobs from,
+// the channel which is closed when draining starts (it can be nil), a logger, the
+// RequestCanceller and the Retrier for failed jobs (it can be nil, then failed jobs are
+// only logged) and returns a pointer to a new Worker.
+func NewWorker(id int, jobQueue chan Job, drain <-chan struct{}, logger domain.Logger, rc *RequestCanceller, r *Retrier) *Worker {
 	w := Worker{
-		jobQueue: jobQueue,
-		done:     closeChannel,
+		ID:        id,
+		jobQueue:  jobQueue,
+		quit:      make(chan struct{}),
+		drain:     drain,
+		logger:    logger.With(domain.NewField(domain.WorkerIDKey, id)),
+		canceller: rc,
+		retrier:   r,
 	}
 
 	return &w
 }
 
+// Dispatcher runs a pool of Workers which all consume the same job queue. The pool can be
+// resized while it is running and shut down gracefully.
+//
+// Failed jobs are retried, or moved to the dead letters, by the Dispatcher's Retrier.
+//
+// On Shutdown the workers first drain the job queue. If the shutdown deadline passes before
+// that is done, the jobs in progress get their contexts cancelled. The jobs still in the
+// queue, the interrupted jobs and the jobs waiting to be retried are handed to the
+// Checkpointer, if there is one.
 type Dispatcher struct {
-	Worker       *Worker
 	JobQueue     chan Job
-	CloseChannel chan bool
+	Checkpointer JobCheckpointer
+	Retrier      *Retrier
+
+	logger    domain.Logger
+	canceller *RequestCanceller
+
+	mu       sync.Mutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+	workers  []*Worker
+	nextID   int
+	wg       sync.WaitGroup
+	running  bool
+	shutdown bool
+	drain    chan struct{}
+	stopped  chan struct{}
 }
 
-func (d *Dispatcher) Run(maxWorkers int) {
-	for i := 1; i <= maxWorkers; i++ {
-		go d.Worker.Start()
+// Run starts maxWorkers workers. The contexts of all the jobs are derived from ctx.
+func (d *Dispatcher) Run(ctx context.Context, maxWorkers int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.running || d.shutdown {
+		return
 	}
+	d.ctx, d.cancel = context.WithCancel(ctx)
+	d.running = true
+	d.resize(maxWorkers)
+}
+
+// Resize grows or shrinks the pool to n workers. Workers which are removed return once
+// they are done with their current job.
+func (d *Dispatcher) Resize(n int) error {
+	if n < 0 {
+		return errors.Errorf("Dispatcher can't be resized to %d workers", n)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.running {
+		return errors.New("Dispatcher can't be resized before Run")
+	}
+	if d.shutdown {
+		return errors.New("Dispatcher can't be resized after Shutdown")
+	}
+	d.resize(n)
+	return nil
+}
+
+// resize must be called with d.mu held.
+func (d *Dispatcher) resize(n int) {
+	for len(d.workers) < n {
+		d.nextID++
+		w := NewWorker(d.nextID, d.JobQueue, d.drain, d.logger, d.canceller, d.Retrier)
+		d.workers = append(d.workers, w)
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			w.Start(d.ctx)
+		}()
+	}
+	for len(d.workers) > n {
+		last := len(d.workers) - 1
+		d.workers[last].Stop()
+		d.workers = d.workers[:last]
+	}
+}
+
+// Size returns the number of workers in the pool.
+func (d *Dispatcher) Size() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.workers)
 }
 
-func (d *Dispatcher) Stop() {
+// Shutdown makes the workers drain the job queue and waits for them to return. If ctx is
+// done before that, the jobs in progress are cancelled and the jobs left in the queue are
+// checkpointed. It returns an error if queued jobs couldn't be checkpointed.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	if d.shutdown {
+		d.mu.Unlock()
+		return errors.New("Dispatcher is already shut down")
+	}
+	d.shutdown = true
+	close(d.drain)
+	d.mu.Unlock()
+
+	finished := make(chan struct{})
 	go func() {
-		d.CloseChannel <- true
+		d.wg.Wait()
+		close(finished)
 	}()
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		d.logger.Warn("Dispatcher shutdown deadline passed, cancelling jobs in progress")
+		d.cancelJobs()
+		<-finished
+	}
+	d.cancelJobs()
+
+	err := d.checkpoint()
+	close(d.stopped)
+	return err
+}
+
+func (d *Dispatcher) cancelJobs() {
+	if d.cancel != nil {
+		d.cancel()
+	}
+}
+
+// checkpoint takes the jobs which are waiting to be retried and the jobs left in the job queue
+// and hands them to the Checkpointer.
+func (d *Dispatcher) checkpoint() error {
+	var jobs []Job
+	if d.Retrier != nil {
+		jobs = append(jobs, d.Retrier.Stop()...)
+	}
+collect:
+	for {
+		select {
+		case j := <-d.JobQueue:
+			jobs = append(jobs, j)
+		default:
+			break collect
+		}
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	if d.Checkpointer == nil {
+		for _, j := range jobs {
+			d.logger.Warn("Dispatcher dropped queued job on shutdown",
+				domain.NewField(domain.JobTypeKey, j.Type()),
+				domain.NewField(domain.RequestIDKey, j.RequestID()),
+			)
+		}
+		return errors.Errorf("Dispatcher dropped %d queued jobs on shutdown, no Checkpointer set", len(jobs))
+	}
+	err := d.Checkpointer.Checkpoint(jobs)
+	if err != nil {
+		return errors.Wrapf(err, "Dispatcher couldn't checkpoint %d queued jobs", len(jobs))
+	}
+	d.logger.Info("Dispatcher checkpointed queued jobs on shutdown", domain.NewField("jobs", len(jobs)))
+	return nil
+}
+
+// Wait blocks until Shutdown has completed.
+func (d *Dispatcher) Wait() {
+	<-d.stopped
 }
 
-func NewDispatcher(jobQueue chan Job, closeChannel chan bool) *Dispatcher {
+// NewDispatcher is a constructor which takes the job queue, a logger, the RequestCanceller
+// shared by all of the workers and the DeadLetterStore for jobs which run out of attempts
+// and returns a pointer to a new Dispatcher. No workers are started until Run is called.
+func NewDispatcher(jobQueue chan Job, logger domain.Logger, rc *RequestCanceller, dls DeadLetterStore) *Dispatcher {
+	r := NewRetrier(jobQueue, dls)
+	r.canceller = rc
 	d := Dispatcher{
-		Worker:       NewWorker(jobQueue, closeChannel),
-		JobQueue:     jobQueue,
-		CloseChannel: closeChannel,
+		JobQueue:  jobQueue,
+		Retrier:   r,
+		logger:    logger,
+		canceller: rc,
+		drain:     make(chan struct{}),
+		stopped:   make(chan struct{}),
 	}
 
 	return &d
@@ -0,0 +1,509 @@
+package usecases
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// logLine is a single line recorded by MockRecordingLogger
+type logLine struct {
+	level  domain.LogLevel
+	msg    string
+	fields []domain.Field
+}
+
+// MockRecordingLogger implements the domain.Logger interface and records every line
+// along with the fields attached via With.
+type MockRecordingLogger struct {
+	mu     *sync.Mutex
+	lines  *[]logLine
+	fields []domain.Field
+}
+
+func (l *MockRecordingLogger) record(level domain.LogLevel, m string, fields []domain.Field) {
+	all := append(append([]domain.Field{}, l.fields...), fields...)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*l.lines = append(*l.lines, logLine{level: level, msg: m, fields: all})
+}
+
+func (l *MockRecordingLogger) Debug(m string, fields ...domain.Field) {
+	l.record(domain.DebugLevel, m, fields)
+}
+
+func (l *MockRecordingLogger) Info(m string, fields ...domain.Field) {
+	l.record(domain.InfoLevel, m, fields)
+}
+
+func (l *MockRecordingLogger) Warn(m string, fields ...domain.Field) {
+	l.record(domain.WarnLevel, m, fields)
+}
+
+func (l *MockRecordingLogger) Error(m string, fields ...domain.Field) {
+	l.record(domain.ErrorLevel, m, fields)
+}
+
+func (l *MockRecordingLogger) With(fields ...domain.Field) domain.Logger {
+	return &MockRecordingLogger{
+		mu:     l.mu,
+		lines:  l.lines,
+		fields: append(append([]domain.Field{}, l.fields...), fields...),
+	}
+}
+
+func newMockRecordingLogger() *MockRecordingLogger {
+	return &MockRecordingLogger{mu: &sync.Mutex{}, lines: &[]logLine{}}
+}
+
+// fieldValue returns the value of the field with the given key or nil.
+func fieldValue(fields []domain.Field, key string) interface{} {
+	for _, f := range fields {
+		if f.Key == key {
+			return f.Value
+		}
+	}
+	return nil
+}
+
+// MockJob implements the Job interface, it logs one info line and returns err.
+// If block is set it waits for its context to be done and returns the context's error,
+// if release is set it waits for release to be closed or its context to be done.
+type MockJob struct {
+	err     error
+	block   bool
+	timeout time.Duration
+	policy  RetryPolicy
+	started chan struct{}
+	release chan struct{}
+	ran     bool
+}
+
+func (j *MockJob) DoWork(ctx context.Context, logger domain.Logger) error {
+	j.ran = true
+	logger.Info("mock job working")
+	if j.started != nil {
+		close(j.started)
+	}
+	if j.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if j.release != nil {
+		select {
+		case <-j.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return j.err
+}
+
+func (j *MockJob) Type() string {
+	return "mock"
+}
+
+func (j *MockJob) RequestID() uint64 {
+	return 42
+}
+
+func (j *MockJob) Timeout() time.Duration {
+	if j.timeout == 0 {
+		return time.Minute
+	}
+	return j.timeout
+}
+
+func (j *MockJob) RetryPolicy() RetryPolicy {
+	return j.policy
+}
+
+func testWorker(t *testing.T, logger domain.Logger, rc *RequestCanceller) *Worker {
+	t.Helper()
+
+	return NewWorker(1, make(chan Job), nil, logger, rc, nil)
+}
+
+func TestWorkerProcess(t *testing.T) {
+	testCases := []struct {
+		name          string
+		job           *MockJob
+		expectedLines int
+	}{
+		{
+			name:          "job without error logs only its own line",
+			job:           &MockJob{},
+			expectedLines: 1,
+		},
+		{
+			name:          "job with error also gets the worker's error line",
+			job:           &MockJob{err: errors.New("some error")},
+			expectedLines: 2,
+		},
+		{
+			name:          "job running past its timeout gets its context done",
+			job:           &MockJob{block: true, timeout: 10 * time.Millisecond},
+			expectedLines: 2,
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			logger := newMockRecordingLogger()
+			w := testWorker(t, logger, NewRequestCanceller())
+			w.process(context.Background(), tc.job)
+
+			lines := *logger.lines
+			if len(lines) != tc.expectedLines {
+				t.Fatalf("%s: process() => got %d log lines, expected: %d", tc.name, len(lines), tc.expectedLines)
+			}
+			for _, l := range lines {
+				if fieldValue(l.fields, domain.JobTypeKey) != "mock" || fieldValue(l.fields, domain.RequestIDKey) != uint64(42) {
+					t.Errorf("%s: log line %q => got fields: %v, expected job_type and request_id", tc.name, l.msg, l.fields)
+				}
+			}
+		})
+	}
+}
+
+func TestWorkerProcessCancelledRequest(t *testing.T) {
+	rc := NewRequestCanceller()
+	w := testWorker(t, newMockRecordingLogger(), rc)
+
+	// jobs of an already cancelled request are skipped
+	skipped := &MockJob{}
+	rc.Cancel(skipped.RequestID())
+	w.process(context.Background(), skipped)
+	if skipped.ran {
+		t.Errorf("process() => job of cancelled request was run, expected it to be skipped")
+	}
+
+	// cancelling the request while the job is in progress interrupts it
+	job := &MockJob{block: true, started: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		w.process(context.Background(), job)
+		close(done)
+	}()
+	select {
+	case <-job.started:
+	case <-done:
+		// the skipped job forgot the request, the cancellation doesn't outlive it
+		t.Fatalf("process() => job of the request was skipped, expected it to be run")
+	}
+	rc.Cancel(job.RequestID())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("process() => job still running after its request was cancelled")
+	}
+}
+
+// MockCancellingNotificationService implements the domain.NotificationService interface,
+// it cancels the request in the RequestCanceller while the notification is being sent.
+type MockCancellingNotificationService struct {
+	MockNotificationService
+	canceller *RequestCanceller
+}
+
+func (n *MockCancellingNotificationService) Send(ctx context.Context, c *domain.CabBookingResponse) error {
+	n.canceller.Cancel(c.UserRequest.Request.ID())
+	return nil
+}
+
+func TestWorkerForgetsFinishedRequests(t *testing.T) {
+	testCases := []struct {
+		name string
+		// process processes a job of a request which is cancelled before or while the job
+		// is in progress
+		process func(w *Worker, rc *RequestCanceller)
+	}{
+		{"job skipped", func(w *Worker, rc *RequestCanceller) {
+			rc.Cancel(42)
+			w.process(context.Background(), &MockJob{})
+		}},
+		{"job stopped", func(w *Worker, rc *RequestCanceller) {
+			job := &MockJob{block: true, started: make(chan struct{})}
+			go func() {
+				<-job.started
+				rc.Cancel(job.RequestID())
+			}()
+			w.process(context.Background(), job)
+		}},
+		{"user notified", func(w *Worker, rc *RequestCanceller) {
+			r := &domain.Request{}
+			r.SetID(42)
+			resp := &domain.CabBookingResponse{UserRequest: &domain.UserRequest{Request: r}}
+			w.process(context.Background(), NewNotificationJob(resp, NewNotificationServiceInteractor(&MockCancellingNotificationService{canceller: rc}, nil)))
+		}},
+		{"job dead-lettered", func(w *Worker, rc *RequestCanceller) {
+			rc.Cancel(42)
+			w.retrier.HandleFailure(&MockJob{policy: RetryPolicy{MaxAttempts: 1}}, errors.New("some error"), newMockRecordingLogger())
+		}},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			rc := NewRequestCanceller()
+			r := NewRetrier(make(chan Job, 1), &MockDeadLetterStore{})
+			r.canceller = rc
+			w := NewWorker(1, make(chan Job, 1), nil, newMockRecordingLogger(), rc, r)
+			tc.process(w, rc)
+
+			rc.mu.Lock()
+			defer rc.mu.Unlock()
+			if len(rc.cancelled) != 0 || len(rc.inFlight) != 0 {
+				t.Errorf("%s: process() => got: (%d cancelled, %d in flight) requests kept, expected: none", tc.name, len(rc.cancelled), len(rc.inFlight))
+			}
+		})
+	}
+}
+
+func TestWorkerStartStopsOnContextDone(t *testing.T) {
+	w := testWorker(t, newMockRecordingLogger(), NewRequestCanceller())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Start(ctx)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Start() => still running after its context was cancelled")
+	}
+}
+
+func TestWorkerDispatchKeepsJobsAfterContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := NewRetrier(make(chan Job, 1), nil)
+	w := NewWorker(1, make(chan Job, 1), nil, newMockRecordingLogger(), NewRequestCanceller(), r)
+	job := &MockJob{}
+	w.dispatch(ctx, job)
+	if kept := r.Stop(); job.ran || len(kept) != 1 || kept[0] != job {
+		t.Errorf("dispatch() with its context done => got: (ran: %t, interrupted: %v), expected: (ran: false, interrupted: [%v])", job.ran, kept, job)
+	}
+
+	w = NewWorker(1, make(chan Job, 1), nil, newMockRecordingLogger(), NewRequestCanceller(), nil)
+	job = &MockJob{}
+	w.dispatch(ctx, job)
+	if job.ran || len(w.jobQueue) != 1 {
+		t.Errorf("dispatch() with its context done and no Retrier => got: (ran: %t, queued: %d), expected: (ran: false, queued: 1)", job.ran, len(w.jobQueue))
+	}
+}
+
+// MockPanicJob implements the Job interface and panics in DoWork.
+type MockPanicJob struct {
+	MockJob
+}
+
+func (j *MockPanicJob) DoWork(ctx context.Context, logger domain.Logger) error {
+	panic("mock job panic")
+}
+
+// MockCheckpointer implements the JobCheckpointer interface and records the jobs.
+type MockCheckpointer struct {
+	jobs []Job
+}
+
+func (c *MockCheckpointer) Checkpoint(jobs []Job) error {
+	c.jobs = append(c.jobs, jobs...)
+	return nil
+}
+
+func TestWorkerProcessRecoversPanic(t *testing.T) {
+	logger := newMockRecordingLogger()
+	w := testWorker(t, logger, NewRequestCanceller())
+	w.process(context.Background(), &MockPanicJob{})
+
+	lines := *logger.lines
+	last := lines[len(lines)-1]
+	if last.level != domain.ErrorLevel || fieldValue(last.fields, domain.WorkerIDKey) != 1 {
+		t.Errorf("process() of panicking job => got last line: %v, expected error line with worker_id", last)
+	}
+}
+
+func TestDispatcherRunsSeparateWorkers(t *testing.T) {
+	jobQueue := make(chan Job, 3)
+	d := NewDispatcher(jobQueue, newMockRecordingLogger(), NewRequestCanceller(), nil)
+	d.Run(context.Background(), 3)
+
+	// every job waits for release, so all three only start if they run on separate workers
+	release := make(chan struct{})
+	jobs := []*MockJob{}
+	for i := 0; i < 3; i++ {
+		j := &MockJob{started: make(chan struct{}), release: release}
+		jobs = append(jobs, j)
+		jobQueue <- j
+	}
+	for _, j := range jobs {
+		select {
+		case <-j.started:
+		case <-time.After(time.Second):
+			t.Fatalf("Run(3) => jobs didn't run concurrently on 3 workers")
+		}
+	}
+	close(release)
+
+	err := d.Shutdown(context.Background())
+	if err != nil {
+		t.Errorf("Shutdown() => got: %v, expected: nil", err)
+	}
+	d.Wait()
+}
+
+func TestDispatcherShutdownDrainsQueue(t *testing.T) {
+	jobQueue := make(chan Job, 5)
+	jobs := []*MockJob{}
+	for i := 0; i < 5; i++ {
+		j := &MockJob{}
+		jobs = append(jobs, j)
+		jobQueue <- j
+	}
+	d := NewDispatcher(jobQueue, newMockRecordingLogger(), NewRequestCanceller(), nil)
+	d.Run(context.Background(), 1)
+
+	err := d.Shutdown(context.Background())
+	if err != nil {
+		t.Fatalf("Shutdown() => got: %v, expected: nil", err)
+	}
+	for i, j := range jobs {
+		if !j.ran {
+			t.Errorf("Shutdown() => queued job %d was not run, expected queue to be drained", i)
+		}
+	}
+}
+
+func TestDispatcherShutdownDeadlineCheckpointsQueue(t *testing.T) {
+	jobQueue := make(chan Job, 3)
+	inFlight := &MockJob{block: true, started: make(chan struct{})}
+	jobQueue <- inFlight
+
+	d := NewDispatcher(jobQueue, newMockRecordingLogger(), NewRequestCanceller(), nil)
+	c := &MockCheckpointer{}
+	d.Checkpointer = c
+	d.Run(context.Background(), 1)
+	<-inFlight.started
+	jobQueue <- &MockJob{}
+	jobQueue <- &MockJob{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := d.Shutdown(ctx)
+	if err != nil {
+		t.Fatalf("Shutdown() => got: %v, expected: nil", err)
+	}
+	// the two queued jobs and the interrupted job in progress
+	if len(c.jobs) != 3 {
+		t.Errorf("Shutdown() past deadline => got %d checkpointed jobs, expected: 3", len(c.jobs))
+	}
+
+	// without a Checkpointer the dropped jobs are reported
+	jobQueue = make(chan Job, 1)
+	d = NewDispatcher(jobQueue, newMockRecordingLogger(), NewRequestCanceller(), nil)
+	jobQueue <- &MockJob{}
+	err = d.Shutdown(context.Background())
+	if err == nil {
+		t.Errorf("Shutdown() without workers and Checkpointer => got: nil, expected: error")
+	}
+}
+
+func TestDispatcherResize(t *testing.T) {
+	d := NewDispatcher(make(chan Job), newMockRecordingLogger(), NewRequestCanceller(), nil)
+	err := d.Resize(2)
+	if err == nil {
+		t.Errorf("Resize(2) before Run => got: nil, expected: error")
+	}
+
+	d.Run(context.Background(), 2)
+	testCases := []struct {
+		name         string
+		size         int
+		expectedSize int
+	}{
+		{
+			name:         "grow pool",
+			size:         4,
+			expectedSize: 4,
+		},
+		{
+			name:         "shrink pool",
+			size:         1,
+			expectedSize: 1,
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err := d.Resize(tc.size)
+			if err != nil || d.Size() != tc.expectedSize {
+				t.Errorf("%s: Resize(%d) => got: (%d, %v), expected: (%d, nil)", tc.name, tc.size, d.Size(), err, tc.expectedSize)
+			}
+		})
+	}
+
+	d.Shutdown(context.Background())
+	err = d.Resize(3)
+	if err == nil {
+		t.Errorf("Resize(3) after Shutdown => got: nil, expected: error")
+	}
+}
+
+// MockAckJob is a MockJob which records whether it was acknowledged.
+type MockAckJob struct {
+	MockJob
+	acked bool
+}
+
+func (j *MockAckJob) Ack() error {
+	j.acked = true
+	return nil
+}
+
+func TestWorkerAcksFinishedJobs(t *testing.T) {
+	dls := &MockDeadLetterStore{}
+	w := NewWorker(1, make(chan Job, 1), nil, newMockRecordingLogger(), NewRequestCanceller(), NewRetrier(make(chan Job, 1), dls))
+	testCases := []struct {
+		name     string
+		job      *MockAckJob
+		expected bool
+	}{
+		{
+			name:     "successful job is acked",
+			job:      &MockAckJob{},
+			expected: true,
+		},
+		{
+			name:     "failed job with attempts left is not acked",
+			job:      &MockAckJob{MockJob: MockJob{err: errors.New("some error"), policy: RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Hour}}},
+			expected: false,
+		},
+		{
+			name:     "failed job moved to the dead letters is acked",
+			job:      &MockAckJob{MockJob: MockJob{err: errors.New("some error"), policy: RetryPolicy{MaxAttempts: 1}}},
+			expected: true,
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			w.process(context.Background(), tc.job)
+			if tc.job.acked != tc.expected {
+				t.Errorf("%s: process() => got acked: %v, expected: %v", tc.name, tc.job.acked, tc.expected)
+			}
+		})
+	}
+	w.retrier.Stop()
+}
@@ -0,0 +1,17 @@
+package usecases
+
+import (
+	"time"
+)
+
+// Lease exposes the interface of a lease which at most one holder has at a time, it is used
+// to elect the one instance of the server which fires the CronJobs.
+//
+// Acquire takes the lease for the holder if it is free or has expired, or renews it if the
+// holder has it already, so that it expires ttl from now. It returns if the holder has the
+// lease. Release gives the lease up if the holder has it, so another holder can take it
+// without waiting for it to expire.
+type Lease interface {
+	Acquire(holder string, ttl time.Duration) (bool, error)
+	Release(holder string) error
+}
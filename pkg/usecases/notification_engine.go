@@ -2,18 +2,44 @@ package usecases
 
 import (
 	// "fmt"
+	"context"
 
 	"github.com/pkg/errors"
 
 	"github.com/anirbanroydas/ubernow-go/pkg/domain"
 )
 
+// NotificationServices implements the domain.NotificationService interface with the
+// NotificationService of the type of the notification address of each booking response,
+// they are keyed by the address type, like email or sms.
+type NotificationServices map[string]domain.NotificationService
+
+func (n NotificationServices) Send(ctx context.Context, c *domain.CabBookingResponse) error {
+	ns, ok := n[c.NotificationAddr.AddrType]
+	if !ok {
+		return domain.NewPermanentError(errors.Errorf("no notification service for address type %q", c.NotificationAddr.AddrType))
+	}
+	return ns.Send(ctx, c)
+}
+
+// SendConfirmation implements the domain.ConfirmationSender interface with the
+// NotificationService of the type of the address, if it sends confirmations.
+func (n NotificationServices) SendConfirmation(ctx context.Context, a domain.UserAddress, code string) error {
+	cs, ok := n[a.AddrType].(domain.ConfirmationSender)
+	if !ok {
+		return domain.NewPermanentError(errors.Errorf("no confirmation sender for address type %q", a.AddrType))
+	}
+	return cs.SendConfirmation(ctx, a, code)
+}
+
 type NotificationInteractor struct {
-	AppEngine AppEngine
+	AppEngine               AppEngine
+	RequestStatusInteractor *RequestStatusInteractor
 }
 
 type NotificationServiceInteractor struct {
-	NotificationService domain.NotificationService
+	NotificationService     domain.NotificationService
+	RequestStatusInteractor *RequestStatusInteractor
 }
 
 func (n *NotificationInteractor) SendQueue(cbResp *domain.CabBookingResponse, nsI *NotificationServiceInteractor) error {
@@ -29,20 +55,22 @@ func (n *NotificationInteractor) SendQueue(cbResp *domain.CabBookingResponse, ns
 	return nil
 }
 
-func (n *NotificationServiceInteractor) Send(c *domain.CabBookingResponse) error {
-	return n.NotificationService.Send(c)
+func (n *NotificationServiceInteractor) Send(ctx context.Context, c *domain.CabBookingResponse) error {
+	return n.NotificationService.Send(ctx, c)
 }
 
-func NewNotificationInteractor(a AppEngine) *NotificationInteractor {
+func NewNotificationInteractor(a AppEngine, s *RequestStatusInteractor) *NotificationInteractor {
 	n := NotificationInteractor{
-		AppEngine: a,
+		AppEngine:               a,
+		RequestStatusInteractor: s,
 	}
 	return &n
 }
 
-func NewNotificationServiceInteractor(ns domain.NotificationService) *NotificationServiceInteractor {
+func NewNotificationServiceInteractor(ns domain.NotificationService, s *RequestStatusInteractor) *NotificationServiceInteractor {
 	n := NotificationServiceInteractor{
-		NotificationService: ns,
+		NotificationService:     ns,
+		RequestStatusInteractor: s,
 	}
 	return &n
 }
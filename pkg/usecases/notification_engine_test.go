@@ -3,6 +3,7 @@ package usecases
 import (
 	// "fmt"
 	// "reflect"
+	"context"
 	"testing"
 
 	"github.com/anirbanroydas/ubernow-go/pkg/domain"
@@ -12,12 +13,24 @@ func testNotificationInteractor(t *testing.T) *NotificationInteractor {
 	t.Helper()
 
 	a := &MockAppEngine{}
-	return NewNotificationInteractor(a)
+	return NewNotificationInteractor(a, nil)
 }
 
 type MockNotificationService struct{}
 
-func (n *MockNotificationService) Send(c *domain.CabBookingResponse) error {
+func (n *MockNotificationService) Send(ctx context.Context, c *domain.CabBookingResponse) error {
+	return nil
+}
+
+func (n *MockNotificationService) SendConfirmation(ctx context.Context, a domain.UserAddress, code string) error {
+	return nil
+}
+
+// MockSendOnlyNotificationService implements the domain.NotificationService interface but
+// doesn't send confirmations.
+type MockSendOnlyNotificationService struct{}
+
+func (n *MockSendOnlyNotificationService) Send(ctx context.Context, c *domain.CabBookingResponse) error {
 	return nil
 }
 
@@ -25,5 +38,33 @@ func testNotificationServiceInteractor(t *testing.T) *NotificationServiceInterac
 	t.Helper()
 
 	ns := &MockNotificationService{}
-	return NewNotificationServiceInteractor(ns)
+	return NewNotificationServiceInteractor(ns, nil)
+}
+
+func TestNotificationServicesSend(t *testing.T) {
+	ns := NotificationServices{"email": &MockNotificationService{}}
+	c := &domain.CabBookingResponse{UserRequest: &domain.UserRequest{Request: &domain.Request{}}}
+
+	c.NotificationAddr = domain.UserAddress{AddrType: "email", Value: "anirban.nick@gmail.com"}
+	if err := ns.Send(context.Background(), c); err != nil {
+		t.Errorf("Send() to email => got: %v, expected: nil", err)
+	}
+	c.NotificationAddr = domain.UserAddress{AddrType: "sms", Value: "+919876543210"}
+	if err := ns.Send(context.Background(), c); !domain.IsPermanent(err) {
+		t.Errorf("Send() to an address type without service => got: %v, expected a permanent error", err)
+	}
+}
+
+func TestNotificationServicesSendConfirmation(t *testing.T) {
+	ns := NotificationServices{"email": &MockNotificationService{}, "sms": &MockSendOnlyNotificationService{}}
+
+	if err := ns.SendConfirmation(context.Background(), domain.UserAddress{AddrType: "email", Value: "anirban.nick@gmail.com"}, "0123abcd"); err != nil {
+		t.Errorf("SendConfirmation() to email => got: %v, expected: nil", err)
+	}
+	if err := ns.SendConfirmation(context.Background(), domain.UserAddress{AddrType: "sms", Value: "+919876543210"}, "0123abcd"); !domain.IsPermanent(err) {
+		t.Errorf("SendConfirmation() to an address type whose service doesn't send confirmations => got: %v, expected a permanent error", err)
+	}
+	if err := ns.SendConfirmation(context.Background(), domain.UserAddress{AddrType: "pigeon", Value: "roy"}, "0123abcd"); !domain.IsPermanent(err) {
+		t.Errorf("SendConfirmation() to an address type without service => got: %v, expected a permanent error", err)
+	}
 }
@@ -0,0 +1,279 @@
+package usecases
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrQueueFull is the cause of the errors returned by a QueueEngine which couldn't take a
+// job because its job queue is full. The job may be accepted when it is added again later.
+var ErrQueueFull = errors.New("job queue is full")
+
+// OverflowPolicy says what a QueueEngine does with a job when its job queue is full.
+type OverflowPolicy int
+
+const (
+	// RejectOnFull returns an error right away, it is the default.
+	RejectOnFull OverflowPolicy = iota
+	// BlockOnFull waits up to OverflowConfig.BlockTimeout for room in the job queue.
+	BlockOnFull
+	// SpillOnFull hands the job to OverflowConfig.Spiller, the spilled jobs are moved back
+	// to the job queue by Refill as soon as there is room.
+	SpillOnFull
+	// ShedOnFull rejects low priority jobs once the job queue is filled beyond
+	// OverflowConfig.ShedThreshold, and blocks like BlockOnFull for the other jobs.
+	ShedOnFull
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case RejectOnFull:
+		return "reject"
+	case BlockOnFull:
+		return "block"
+	case SpillOnFull:
+		return "spill"
+	case ShedOnFull:
+		return "shed"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseOverflowPolicy takes the name of a policy (case insensitive) and returns the matching
+// OverflowPolicy. It returns RejectOnFull and false if the name is not known.
+func ParseOverflowPolicy(name string) (OverflowPolicy, bool) {
+	switch strings.ToLower(name) {
+	case "reject":
+		return RejectOnFull, true
+	case "block":
+		return BlockOnFull, true
+	case "spill":
+		return SpillOnFull, true
+	case "shed":
+		return ShedOnFull, true
+	default:
+		return RejectOnFull, false
+	}
+}
+
+// JobPriority is how important it is that a job gets done, it is used to decide which jobs
+// are shed first when a QueueEngine is overloaded.
+type JobPriority int
+
+const (
+	LowPriority JobPriority = iota
+	NormalPriority
+	HighPriority
+)
+
+// Prioritizer is implemented by jobs which know their own priority. Jobs which don't
+// implement it have NormalPriority.
+type Prioritizer interface {
+	Priority() JobPriority
+}
+
+// priorityOf returns the priority of a job, looking through the jobs which wrap it.
+func priorityOf(job Job) JobPriority {
+	if p, ok := innermostJob(job).(Prioritizer); ok {
+		return p.Priority()
+	}
+	return NormalPriority
+}
+
+// JobSpiller stores the jobs which didn't fit in a job queue, oldest first, until
+// there is room for them again. Peek returns false if it is empty.
+type JobSpiller interface {
+	Spill(Job) error
+	Peek() (Job, bool, error)
+	Pop() error
+	Len() int
+}
+
+// OverflowConfig configures the OverflowPolicy of a QueueEngine, or of a durable AppEngine
+// like the FileQueue of the jobstore package, whose job log is its Spiller.
+type OverflowConfig struct {
+	Policy        OverflowPolicy
+	BlockTimeout  time.Duration
+	Spiller       JobSpiller
+	ShedThreshold float64
+}
+
+// Sheds returns if the job is shed by ShedOnFull from a job queue which holds depth of
+// capacity jobs, that is if it is a low priority job and the job queue is filled beyond the
+// ShedThreshold.
+func (c OverflowConfig) Sheds(j Job, depth, capacity int) bool {
+	if c.Policy != ShedOnFull || priorityOf(j) != LowPriority {
+		return false
+	}
+	threshold := c.ShedThreshold
+	if threshold <= 0 || threshold > 1 {
+		threshold = 1
+	}
+	return float64(depth) >= threshold*float64(capacity)
+}
+
+// QueueStats are the counters of a QueueEngine, so that the queue depth and the rejected
+// jobs are visible.
+type QueueStats struct {
+	Name     string
+	Depth    int
+	Capacity int
+	Spilled  int
+	Accepted uint64
+	Rejected uint64
+	TimedOut uint64
+	Shed     uint64
+}
+
+// QueueEngine implements the AppEngine interface by putting the jobs on a buffered job
+// queue which is consumed by a Dispatcher. What happens when the job queue is full is
+// decided by its OverflowConfig. Its jobs are lost on restart, so the App of the server uses
+// durable job queues instead, which take the same OverflowConfig; QueueEngine is for running
+// the use cases in memory, like in tests.
+type QueueEngine struct {
+	JobQueue chan Job
+
+	name     string
+	overflow OverflowConfig
+	spilled  chan struct{}
+
+	accepted uint64
+	rejected uint64
+	timedOut uint64
+	shed     uint64
+
+	refillOnce sync.Once
+}
+
+func (q *QueueEngine) AddJob(j Job) error {
+	if q.overflow.Sheds(j, len(q.JobQueue), cap(q.JobQueue)) {
+		atomic.AddUint64(&q.shed, 1)
+		atomic.AddUint64(&q.rejected, 1)
+		return errors.Wrapf(ErrQueueFull, "%s shed low priority job, JobQueue is %d/%d full", q.name, len(q.JobQueue), cap(q.JobQueue))
+	}
+
+	select {
+	case q.JobQueue <- j:
+		atomic.AddUint64(&q.accepted, 1)
+		return nil
+	default:
+	}
+
+	switch q.overflow.Policy {
+	case BlockOnFull, ShedOnFull:
+		return q.addBlocking(j)
+	case SpillOnFull:
+		return q.spill(j)
+	default:
+		atomic.AddUint64(&q.rejected, 1)
+		return errors.Wrapf(ErrQueueFull, "%s Couldn't add any more jobs to JobQueue", q.name)
+	}
+}
+
+func (q *QueueEngine) addBlocking(j Job) error {
+	timer := time.NewTimer(q.overflow.BlockTimeout)
+	defer timer.Stop()
+	select {
+	case q.JobQueue <- j:
+		atomic.AddUint64(&q.accepted, 1)
+		return nil
+	case <-timer.C:
+		atomic.AddUint64(&q.timedOut, 1)
+		atomic.AddUint64(&q.rejected, 1)
+		return errors.Wrapf(ErrQueueFull, "%s timed out after %v waiting for room in JobQueue", q.name, q.overflow.BlockTimeout)
+	}
+}
+
+func (q *QueueEngine) spill(j Job) error {
+	if q.overflow.Spiller == nil {
+		atomic.AddUint64(&q.rejected, 1)
+		return errors.Wrapf(ErrQueueFull, "%s JobQueue is full and no Spiller is set", q.name)
+	}
+	err := q.overflow.Spiller.Spill(j)
+	if err != nil {
+		atomic.AddUint64(&q.rejected, 1)
+		return errors.Wrapf(err, "%s couldn't spill job", q.name)
+	}
+	atomic.AddUint64(&q.accepted, 1)
+	select {
+	case q.spilled <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Refill moves the spilled jobs back to the job queue, oldest first, as soon as there is
+// room for them. It blocks until ctx is done, a job is only removed from the Spiller once it
+// is on the job queue, so nothing is lost when ctx is done half way.
+// It returns right away if there is no Spiller, and only one Refill runs per QueueEngine.
+func (q *QueueEngine) Refill(ctx context.Context) error {
+	if q.overflow.Spiller == nil {
+		return nil
+	}
+	started := false
+	q.refillOnce.Do(func() {
+		started = true
+	})
+	if !started {
+		return errors.Errorf("%s is already refilling", q.name)
+	}
+
+	for {
+		job, ok, err := q.overflow.Spiller.Peek()
+		if err != nil {
+			return errors.Wrapf(err, "%s couldn't read spilled job", q.name)
+		}
+		if !ok {
+			select {
+			case <-q.spilled:
+				continue
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		select {
+		case q.JobQueue <- job:
+			err = q.overflow.Spiller.Pop()
+			if err != nil {
+				return errors.Wrapf(err, "%s couldn't remove refilled job from Spiller", q.name)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Stats returns the current counters of the QueueEngine.
+func (q *QueueEngine) Stats() QueueStats {
+	s := QueueStats{
+		Name:     q.name,
+		Depth:    len(q.JobQueue),
+		Capacity: cap(q.JobQueue),
+		Accepted: atomic.LoadUint64(&q.accepted),
+		Rejected: atomic.LoadUint64(&q.rejected),
+		TimedOut: atomic.LoadUint64(&q.timedOut),
+		Shed:     atomic.LoadUint64(&q.shed),
+	}
+	if q.overflow.Spiller != nil {
+		s.Spilled = q.overflow.Spiller.Len()
+	}
+	return s
+}
+
+// NewQueueEngine is a constructor which takes the name used in errors and stats, the length
+// of the job queue and the OverflowConfig and returns a pointer to a new QueueEngine.
+func NewQueueEngine(name string, maxQueueLength int, oc OverflowConfig) *QueueEngine {
+	q := QueueEngine{
+		JobQueue: make(chan Job, maxQueueLength),
+		name:     name,
+		overflow: oc,
+		spilled:  make(chan struct{}, 1),
+	}
+	return &q
+}
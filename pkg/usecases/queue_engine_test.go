@@ -0,0 +1,212 @@
+package usecases
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// MockSpiller implements the JobSpiller interface with a slice.
+type MockSpiller struct {
+	mu   sync.Mutex
+	jobs []Job
+}
+
+func (s *MockSpiller) Spill(j Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, j)
+	return nil
+}
+
+func (s *MockSpiller) Peek() (Job, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.jobs) == 0 {
+		return nil, false, nil
+	}
+	return s.jobs[0], true, nil
+}
+
+func (s *MockSpiller) Pop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = s.jobs[1:]
+	return nil
+}
+
+func (s *MockSpiller) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.jobs)
+}
+
+// MockPriorityJob is a MockJob with a priority.
+type MockPriorityJob struct {
+	MockJob
+	priority JobPriority
+}
+
+func (j *MockPriorityJob) Priority() JobPriority {
+	return j.priority
+}
+
+func TestQueueEngineRejectOnFull(t *testing.T) {
+	q := NewQueueEngine("TestAppEngine", 1, OverflowConfig{})
+	if err := q.AddJob(&MockJob{}); err != nil {
+		t.Fatalf("AddJob() with room => got: %v, expected: nil", err)
+	}
+	if err := q.AddJob(&MockJob{}); errors.Cause(err) != ErrQueueFull {
+		t.Errorf("AddJob() on full queue => got: %v, expected: %v", err, ErrQueueFull)
+	}
+	stats := q.Stats()
+	if stats.Depth != 1 || stats.Capacity != 1 || stats.Accepted != 1 || stats.Rejected != 1 {
+		t.Errorf("Stats() => got: %+v, expected depth 1, capacity 1, 1 accepted and 1 rejected", stats)
+	}
+}
+
+func TestQueueEngineBlockOnFull(t *testing.T) {
+	q := NewQueueEngine("TestAppEngine", 1, OverflowConfig{Policy: BlockOnFull, BlockTimeout: 20 * time.Millisecond})
+	q.AddJob(&MockJob{})
+
+	// nobody takes from the queue, so the second job times out
+	if err := q.AddJob(&MockJob{}); err == nil {
+		t.Errorf("AddJob() on full queue past BlockTimeout => got: nil, expected: error")
+	}
+	if stats := q.Stats(); stats.TimedOut != 1 || stats.Rejected != 1 {
+		t.Errorf("Stats() => got: %+v, expected 1 timed out and 1 rejected", stats)
+	}
+
+	// room frees up while waiting, so the job gets in
+	q.overflow.BlockTimeout = time.Second
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-q.JobQueue
+	}()
+	if err := q.AddJob(&MockJob{}); err != nil {
+		t.Errorf("AddJob() on queue which frees up => got: %v, expected: nil", err)
+	}
+}
+
+func TestQueueEngineShedOnFull(t *testing.T) {
+	q := NewQueueEngine("TestAppEngine", 4, OverflowConfig{Policy: ShedOnFull, BlockTimeout: 10 * time.Millisecond, ShedThreshold: 0.5})
+	q.AddJob(&MockJob{})
+	q.AddJob(&MockJob{})
+
+	testCases := []struct {
+		name        string
+		job         Job
+		expectError bool
+	}{
+		{
+			name:        "low priority job is shed above the threshold",
+			job:         &MockPriorityJob{priority: LowPriority},
+			expectError: true,
+		},
+		{
+			name:        "low priority retried job is shed as well",
+			job:         &RetriedJob{Job: &MockPriorityJob{priority: LowPriority}, Attempts: 1},
+			expectError: true,
+		},
+		{
+			name:        "high priority job is still accepted",
+			job:         &MockPriorityJob{priority: HighPriority},
+			expectError: false,
+		},
+		{
+			name:        "job without priority is accepted as normal priority",
+			job:         &MockJob{},
+			expectError: false,
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			err := q.AddJob(tc.job)
+			if (err != nil) != tc.expectError {
+				t.Errorf("%s: AddJob() => got: %v, expected error: %v", tc.name, err, tc.expectError)
+			}
+		})
+	}
+	if stats := q.Stats(); stats.Shed != 2 {
+		t.Errorf("Stats() => got: %+v, expected 2 shed", stats)
+	}
+}
+
+func TestQueueEngineSpillOnFull(t *testing.T) {
+	spiller := &MockSpiller{}
+	q := NewQueueEngine("TestAppEngine", 1, OverflowConfig{Policy: SpillOnFull, Spiller: spiller})
+	first, second := &MockJob{}, &MockJob{}
+	q.AddJob(first)
+	if err := q.AddJob(second); err != nil {
+		t.Fatalf("AddJob() on full queue with Spiller => got: %v, expected: nil", err)
+	}
+	if stats := q.Stats(); stats.Spilled != 1 || stats.Accepted != 2 {
+		t.Errorf("Stats() => got: %+v, expected 1 spilled and 2 accepted", stats)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- q.Refill(ctx)
+	}()
+	if j := <-q.JobQueue; j != first {
+		t.Errorf("JobQueue => got: %v, expected the first job", j)
+	}
+	select {
+	case j := <-q.JobQueue:
+		if j != second {
+			t.Errorf("JobQueue after Refill => got: %v, expected the spilled job", j)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Refill() => spilled job was not moved back to the queue")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Refill() => got: %v, expected: nil", err)
+	}
+	if spiller.Len() != 0 {
+		t.Errorf("Spiller => got %d jobs, expected it to be empty after Refill", spiller.Len())
+	}
+}
+
+func TestUserRequestJobPriority(t *testing.T) {
+	testCases := []struct {
+		name         string
+		reachingTime time.Time
+		expected     JobPriority
+	}{
+		{
+			name:         "reaching time within the urgent window",
+			reachingTime: time.Now().Add(time.Hour),
+			expected:     HighPriority,
+		},
+		{
+			name:         "reaching time between the windows",
+			reachingTime: time.Now().Add(4 * time.Hour),
+			expected:     NormalPriority,
+		},
+		{
+			name:         "reaching time beyond the relaxed window",
+			reachingTime: time.Now().Add(10 * time.Hour),
+			expected:     LowPriority,
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			ur := domain.NewUserRequest(domain.NewUser("roy"), &domain.Request{ReachingTime: tc.reachingTime})
+			job := &UserRequestJob{UserRequest: ur}
+			if result := job.Priority(); result != tc.expected {
+				t.Errorf("%s: Priority() => got: %v, expected: %v", tc.name, result, tc.expected)
+			}
+		})
+	}
+}
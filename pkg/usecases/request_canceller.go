@@ -0,0 +1,93 @@
+package usecases
+
+import (
+	"context"
+	"sync"
+)
+
+// RequestCanceller keeps track of the contexts of the jobs which are in progress for
+// every request, so that cancelling a request also interrupts the work which is already
+// being done for it, like a call to the TrafficService or the CabService.
+//
+// A cancelled request stays cancelled until it is forgotten, so the jobs of that request
+// which are picked up by a Worker later on are skipped. A request is forgotten once it is
+// finished: its job is dropped as cancelled, its user is notified or its job is moved to the
+// dead letters.
+type RequestCanceller struct {
+	mu        sync.Mutex
+	nextID    uint64
+	inFlight  map[uint64]map[uint64]context.CancelFunc
+	cancelled map[uint64]bool
+}
+
+// Track takes the parent context and the id of a request and returns a context derived
+// from the parent which is cancelled when Cancel is called for the request. The returned
+// release function must be called once the job is done.
+func (rc *RequestCanceller) Track(parent context.Context, reqID uint64) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.cancelled[reqID] {
+		cancel()
+		return ctx, cancel
+	}
+	rc.nextID++
+	id := rc.nextID
+	jobs, ok := rc.inFlight[reqID]
+	if !ok {
+		jobs = make(map[uint64]context.CancelFunc)
+		rc.inFlight[reqID] = jobs
+	}
+	jobs[id] = cancel
+
+	release := func() {
+		cancel()
+		rc.mu.Lock()
+		defer rc.mu.Unlock()
+		delete(rc.inFlight[reqID], id)
+		if len(rc.inFlight[reqID]) == 0 {
+			delete(rc.inFlight, reqID)
+		}
+	}
+	return ctx, release
+}
+
+// Cancel marks the request as cancelled and cancels the contexts of all of its jobs
+// which are in progress.
+func (rc *RequestCanceller) Cancel(reqID uint64) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.cancelled[reqID] = true
+	for _, cancel := range rc.inFlight[reqID] {
+		cancel()
+	}
+}
+
+// IsCancelled returns if Cancel was called for the request.
+func (rc *RequestCanceller) IsCancelled(reqID uint64) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.cancelled[reqID]
+}
+
+// Forget drops everything known about a request, it is called once the request is done
+// for good so the cancelled set doesn't keep growing. A request with a job in progress is
+// kept, the job is stopped as cancelled and the request forgotten then.
+func (rc *RequestCanceller) Forget(reqID uint64) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if len(rc.inFlight[reqID]) > 0 {
+		return
+	}
+	delete(rc.cancelled, reqID)
+}
+
+// NewRequestCanceller is a constructor which returns a pointer to an empty RequestCanceller.
+func NewRequestCanceller() *RequestCanceller {
+	rc := RequestCanceller{
+		inFlight:  make(map[uint64]map[uint64]context.CancelFunc),
+		cancelled: make(map[uint64]bool),
+	}
+	return &rc
+}
@@ -0,0 +1,123 @@
+package usecases
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// RequestStatusInteractor records how far a request got in the RequestRepository, as its
+// jobs move it along, and publishes every change to the RequestWatcher. A request which was
+// cancelled stays cancelled.
+//
+// The methods of a nil RequestStatusInteractor do nothing, so the interactors which record
+// the status can be used without one.
+type RequestStatusInteractor struct {
+	RequestRepository domain.RequestRepository
+	RequestWatcher    *RequestWatcher
+}
+
+// Scheduled records that the cab request of the request is scheduled at triggerTime.
+func (s *RequestStatusInteractor) Scheduled(reqID uint64, triggerTime time.Time) error {
+	return s.update(reqID, nil, func(r *domain.Request) {
+		r.SetStatus(domain.RequestScheduled, time.Now())
+		r.TriggerTime = triggerTime
+	})
+}
+
+// BookingTimeFound records the booking time of the CabBookingResponse found for the request.
+func (s *RequestStatusInteractor) BookingTimeFound(reqID uint64, resp *domain.CabBookingResponse) error {
+	return s.update(reqID, resp, func(r *domain.Request) {
+		r.SetStatus(domain.RequestBookingTimeFound, time.Now())
+		r.BookingTime = resp.BestBookingTime
+	})
+}
+
+// Notified records that the user of the request was notified of the CabBookingResponse.
+func (s *RequestStatusInteractor) Notified(reqID uint64, resp *domain.CabBookingResponse) error {
+	return s.update(reqID, resp, func(r *domain.Request) {
+		r.SetStatus(domain.RequestNotified, time.Now())
+	})
+}
+
+// Cancelled returns if the request was cancelled.
+func (s *RequestStatusInteractor) Cancelled(reqID uint64) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+	r, err := s.RequestRepository.FindByID(reqID)
+	if err != nil {
+		return false, errors.Wrapf(err, "RequestStatusInteractor couldn't find request %d", reqID)
+	}
+	return r.Status == domain.RequestCancelled, nil
+}
+
+func (s *RequestStatusInteractor) update(reqID uint64, resp *domain.CabBookingResponse, change func(*domain.Request)) error {
+	if s == nil {
+		return nil
+	}
+	r, err := updateRequest(s.RequestRepository, reqID, func(r *domain.Request) (bool, error) {
+		if r.Status == domain.RequestCancelled {
+			return false, nil
+		}
+		change(r)
+		return true, nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "RequestStatusInteractor")
+	}
+	if r != nil {
+		s.RequestWatcher.Publish(RequestUpdate{Request: r, Response: resp})
+	}
+	return nil
+}
+
+// maxUpdateAttempts is how many times updateRequest reads, changes and updates a request
+// which keeps being changed by someone else in between.
+const maxUpdateAttempts = 5
+
+// updateRequest reads the request with the id, changes it and updates it in the repo. When
+// the request was changed by someone else in between, another worker or another server,
+// the update fails with domain.ErrConflict and the request is read and changed again, up
+// to maxUpdateAttempts times. It returns the updated request, or nil if change returned
+// false to leave the request as it is.
+func updateRequest(repo domain.RequestRepository, reqID uint64, change func(*domain.Request) (bool, error)) (*domain.Request, error) {
+	var err error
+	for attempt := 1; attempt <= maxUpdateAttempts; attempt++ {
+		var r *domain.Request
+		r, err = repo.FindByID(reqID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't find request %d", reqID)
+		}
+		var ok bool
+		if ok, err = change(r); err != nil || !ok {
+			return nil, err
+		}
+		err = repo.Update(r)
+		if err == nil {
+			return r, nil
+		}
+		if errors.Cause(err) != domain.ErrConflict {
+			break
+		}
+	}
+	return nil, errors.Wrapf(err, "couldn't update request %d", reqID)
+}
+
+// logStatusError logs the error of recording a status. The work of the job is already done
+// when its status is recorded, so failing the job would only do the work twice.
+func logStatusError(logger domain.Logger, err error) {
+	if err != nil {
+		logger.Warn("couldn't record request status", domain.NewField(domain.ErrorKey, err))
+	}
+}
+
+func NewRequestStatusInteractor(reqRepo domain.RequestRepository, w *RequestWatcher) *RequestStatusInteractor {
+	s := RequestStatusInteractor{
+		RequestRepository: reqRepo,
+		RequestWatcher:    w,
+	}
+	return &s
+}
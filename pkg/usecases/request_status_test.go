@@ -0,0 +1,94 @@
+package usecases
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+func TestRequestStatusInteractor(t *testing.T) {
+	reqRepo := &MockMapRequestRepo{requests: make(map[uint64]domain.Request)}
+	w := NewRequestWatcher()
+	s := NewRequestStatusInteractor(reqRepo, w)
+	reqID, _ := reqRepo.Store(&domain.Request{Status: domain.RequestPending})
+	updates, stop := w.Watch(reqID)
+	defer stop()
+	triggerTime := time.Date(2018, time.March, 9, 8, 30, 0, 0, time.UTC)
+	bookingTime := time.Date(2018, time.March, 9, 9, 10, 0, 0, time.UTC)
+	resp := &domain.CabBookingResponse{BestBookingTime: bookingTime}
+
+	steps := []struct {
+		name           string
+		record         func() error
+		expectedStatus domain.RequestStatus
+	}{
+		{"scheduled", func() error { return s.Scheduled(reqID, triggerTime) }, domain.RequestScheduled},
+		{"booking time found", func() error { return s.BookingTimeFound(reqID, resp) }, domain.RequestBookingTimeFound},
+		{"notified", func() error { return s.Notified(reqID, resp) }, domain.RequestNotified},
+	}
+
+	for _, step := range steps {
+		if err := step.record(); err != nil {
+			t.Fatalf("%s => got: %v, expected: nil", step.name, err)
+		}
+		r, _ := reqRepo.FindByID(reqID)
+		if r.Status != step.expectedStatus {
+			t.Errorf("%s => got status: %s, expected: %s", step.name, r.Status, step.expectedStatus)
+		}
+		if u := <-updates; u.Request.Status != step.expectedStatus {
+			t.Errorf("%s => got update: %+v, expected status: %s", step.name, u.Request, step.expectedStatus)
+		}
+	}
+	r, _ := reqRepo.FindByID(reqID)
+	if !r.TriggerTime.Equal(triggerTime) || !r.BookingTime.Equal(bookingTime) {
+		t.Errorf("recorded times => got: (%v, %v), expected: (%v, %v)", r.TriggerTime, r.BookingTime, triggerTime, bookingTime)
+	}
+
+	// a cancelled request stays cancelled
+	cancelledID, _ := reqRepo.Store(&domain.Request{Status: domain.RequestCancelled})
+	s.BookingTimeFound(cancelledID, resp)
+	if cancelled, _ := s.Cancelled(cancelledID); !cancelled {
+		t.Errorf("Cancelled(%d) after recording a booking time => got: false, expected: true", cancelledID)
+	}
+
+	if err := s.Scheduled(99, triggerTime); err == nil {
+		t.Errorf("Scheduled() of unknown request => got: nil, expected an error")
+	}
+
+	var none *RequestStatusInteractor
+	if err := none.Notified(reqID, resp); err != nil {
+		t.Errorf("nil RequestStatusInteractor's Notified() => got: %v, expected: nil", err)
+	}
+}
+
+func TestUpdateRequestRetriesConflicts(t *testing.T) {
+	testCases := []struct {
+		name            string
+		conflicts       int
+		expectedError   error
+		expectedUpdates int
+	}{
+		{"no conflict", 0, nil, 1},
+		{"conflicts which go away", maxUpdateAttempts - 1, nil, maxUpdateAttempts},
+		{"conflicts which don't go away", maxUpdateAttempts, domain.ErrConflict, maxUpdateAttempts},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		reqRepo := &MockConflictRequestRepo{MockMapRequestRepo: &MockMapRequestRepo{requests: make(map[uint64]domain.Request)}, conflicts: tc.conflicts}
+		reqID, _ := reqRepo.Store(&domain.Request{Status: domain.RequestPending})
+		s := NewRequestStatusInteractor(reqRepo, NewRequestWatcher())
+
+		err := s.Scheduled(reqID, time.Now())
+		if errors.Cause(err) != tc.expectedError || reqRepo.updates != tc.expectedUpdates {
+			t.Errorf("%s: Scheduled() => got: (%v, %d updates), expected: (%v, %d updates)", tc.name, err, reqRepo.updates, tc.expectedError, tc.expectedUpdates)
+		}
+		r, _ := reqRepo.FindByID(reqID)
+		if expected := tc.expectedError == nil; (r.Status == domain.RequestScheduled) != expected {
+			t.Errorf("%s: status after Scheduled() => got: %s, expected it scheduled: %t", tc.name, r.Status, expected)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package usecases
+
+import (
+	"sync"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// watchBuffer is the number of updates a watcher can fall behind by before the oldest ones
+// are dropped.
+const watchBuffer = 8
+
+// RequestUpdate is a change of a request's status. Response is the CabBookingResponse of
+// the request, it is set once the booking time is found.
+type RequestUpdate struct {
+	Request  *domain.Request
+	Response *domain.CabBookingResponse
+}
+
+// RequestWatcher passes the status changes of requests on to the watchers of those requests,
+// as they happen.
+//
+// Publish never blocks on a slow watcher. A watcher which falls behind by more than a few
+// updates loses the oldest ones, the latest update always has the current status.
+//
+// The methods of a nil RequestWatcher do nothing, so the interactors which publish updates
+// can be used without one.
+type RequestWatcher struct {
+	mu       sync.Mutex
+	nextID   uint64
+	watchers map[uint64]map[uint64]chan RequestUpdate
+}
+
+// Watch returns a channel of the updates published for the request from now on. The returned
+// stop function must be called once the updates are no longer read, it closes the channel.
+func (w *RequestWatcher) Watch(reqID uint64) (<-chan RequestUpdate, func()) {
+	updates := make(chan RequestUpdate, watchBuffer)
+	if w == nil {
+		return updates, func() {}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.nextID++
+	id := w.nextID
+	watchers, ok := w.watchers[reqID]
+	if !ok {
+		watchers = make(map[uint64]chan RequestUpdate)
+		w.watchers[reqID] = watchers
+	}
+	watchers[id] = updates
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			delete(w.watchers[reqID], id)
+			if len(w.watchers[reqID]) == 0 {
+				delete(w.watchers, reqID)
+			}
+			close(updates)
+		})
+	}
+	return updates, stop
+}
+
+// Publish passes the update on to the watchers of its request.
+func (w *RequestWatcher) Publish(u RequestUpdate) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, updates := range w.watchers[u.Request.ID()] {
+		for {
+			select {
+			case updates <- u:
+			default:
+				// drop the oldest update to make room for the latest one
+				select {
+				case <-updates:
+				default:
+				}
+				continue
+			}
+			break
+		}
+	}
+}
+
+// NewRequestWatcher is a constructor which returns a pointer to a RequestWatcher without watchers.
+func NewRequestWatcher() *RequestWatcher {
+	w := RequestWatcher{
+		watchers: make(map[uint64]map[uint64]chan RequestUpdate),
+	}
+	return &w
+}
@@ -0,0 +1,55 @@
+package usecases
+
+import (
+	"testing"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+func testUpdate(reqID uint64, status domain.RequestStatus) RequestUpdate {
+	r := &domain.Request{Status: status}
+	r.SetID(reqID)
+	return RequestUpdate{Request: r}
+}
+
+func TestRequestWatcher(t *testing.T) {
+	w := NewRequestWatcher()
+	updates, stop := w.Watch(1)
+	others, stopOthers := w.Watch(2)
+	defer stopOthers()
+
+	w.Publish(testUpdate(1, domain.RequestScheduled))
+	if u := <-updates; u.Request.Status != domain.RequestScheduled {
+		t.Errorf("Watch(1) after Publish() => got: %s, expected: %s", u.Request.Status, domain.RequestScheduled)
+	}
+	select {
+	case u := <-others:
+		t.Errorf("Watch(2) after Publish() for request 1 => got: %+v, expected no update", u)
+	default:
+	}
+
+	// a watcher which falls behind keeps the latest updates
+	for i := 0; i < watchBuffer+3; i++ {
+		w.Publish(testUpdate(1, domain.RequestScheduled))
+	}
+	w.Publish(testUpdate(1, domain.RequestNotified))
+	var last RequestUpdate
+	for i := 0; i < watchBuffer; i++ {
+		last = <-updates
+	}
+	if last.Request.Status != domain.RequestNotified {
+		t.Errorf("Watch(1) after falling behind => got last: %s, expected: %s", last.Request.Status, domain.RequestNotified)
+	}
+
+	stop()
+	stop()
+	if _, ok := <-updates; ok {
+		t.Errorf("Watch(1) after stop() => got an open channel, expected it to be closed")
+	}
+	w.Publish(testUpdate(1, domain.RequestCancelled))
+
+	var none *RequestWatcher
+	none.Publish(testUpdate(1, domain.RequestCancelled))
+	_, stop = none.Watch(1)
+	stop()
+}
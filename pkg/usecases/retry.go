@@ -0,0 +1,252 @@
+package usecases
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// RetryPolicy says how often and how fast a failed job is tried again. The delay before
+// attempt n+1 is InitialBackoff * Multiplier^(n-1), moved randomly by up to Jitter (a
+// fraction, like 0.2 for ±20%) so that jobs which failed together don't all come back at
+// the same moment, and then capped at MaxBackoff.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+}
+
+var (
+	// UserRequestJobRetryPolicy is the RetryPolicy of UserRequestJob.
+	UserRequestJobRetryPolicy = RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 2 * time.Second,
+		MaxBackoff:     time.Minute,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+	// CabRequestJobRetryPolicy is the RetryPolicy of CabRequestJob, the booking time gets
+	// stale quickly so it gives up sooner.
+	CabRequestJobRetryPolicy = RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 5 * time.Second,
+		MaxBackoff:     time.Minute,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+	// NotificationJobRetryPolicy is the RetryPolicy of NotificationJob, an email which never
+	// arrives is the worst outcome, so it tries the hardest.
+	NotificationJobRetryPolicy = RetryPolicy{
+		MaxAttempts:    8,
+		InitialBackoff: 10 * time.Second,
+		MaxBackoff:     10 * time.Minute,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+)
+
+// Backoff returns the delay before the attempt which follows the given attempt,
+// attempts are counted from 1.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	// the jitter doesn't take the delay past the cap either
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	return time.Duration(d)
+}
+
+// ShouldRetry returns if a job which failed with err on the given attempt is to be tried again.
+func (p RetryPolicy) ShouldRetry(attempt int, err error) bool {
+	return !domain.IsPermanent(err) && attempt < p.MaxAttempts
+}
+
+// RetriedJob is a Job which already failed Attempts times. The Retrier wraps a job in it
+// before putting it back on the job queue.
+type RetriedJob struct {
+	Job
+	Attempts int
+}
+
+// attemptOf returns the number of the attempt a job picked from the queue is on and the
+// job without the RetriedJob wrapping.
+func attemptOf(job Job) (int, Job) {
+	if r, ok := job.(*RetriedJob); ok {
+		return r.Attempts + 1, r.Job
+	}
+	return 1, job
+}
+
+// Retrier decides what happens to a job which returned an error. If the job's RetryPolicy
+// allows it, the job is put back on the job queue once its backoff has passed, otherwise
+// it is moved to the DeadLetterStore, and its request is forgotten by the RequestCanceller
+// if the Retrier has one.
+type Retrier struct {
+	jobQueue    chan Job
+	deadLetters DeadLetterStore
+	canceller   *RequestCanceller
+
+	mu          sync.Mutex
+	pending     map[*pendingRetry]struct{}
+	interrupted []Job
+	stopped     bool
+}
+
+// pendingRetry is a job waiting for its backoff to pass.
+type pendingRetry struct {
+	job   *RetriedJob
+	timer *time.Timer
+}
+
+// HandleFailure takes a job which failed with err and either schedules it to be retried
+// or moves it to the dead letters.
+func (r *Retrier) HandleFailure(job Job, err error, logger domain.Logger) {
+	attempt, original := attemptOf(job)
+	policy := original.RetryPolicy()
+	if !policy.ShouldRetry(attempt, err) {
+		r.deadLetter(original, attempt, err, logger)
+		return
+	}
+
+	delay := policy.Backoff(attempt)
+	retry := &RetriedJob{Job: original, Attempts: attempt}
+	if !r.schedule(retry, delay, logger) {
+		r.deadLetter(original, attempt, errors.Wrap(err, "Retrier stopped before the job could be retried"), logger)
+		return
+	}
+	logger.Warn("Retrier scheduled failed job to be retried",
+		domain.NewField("attempt", attempt),
+		domain.NewField("retry_in", delay),
+		domain.NewField(domain.ErrorKey, err),
+	)
+}
+
+// schedule puts the job back on the job queue after delay. It returns false if the
+// Retrier is already stopped.
+func (r *Retrier) schedule(job *RetriedJob, delay time.Duration, logger domain.Logger) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return false
+	}
+	p := &pendingRetry{job: job}
+	p.timer = time.AfterFunc(delay, func() {
+		r.requeue(p, logger)
+	})
+	r.pending[p] = struct{}{}
+	return true
+}
+
+func (r *Retrier) requeue(p *pendingRetry, logger domain.Logger) {
+	r.mu.Lock()
+	if _, ok := r.pending[p]; !ok {
+		// Stop already took the job
+		r.mu.Unlock()
+		return
+	}
+	delete(r.pending, p)
+	r.mu.Unlock()
+
+	select {
+	case r.jobQueue <- p.job:
+	default:
+		logger.Warn("Retrier found the job queue full, retrying later")
+		if !r.schedule(p.job, time.Second, logger) {
+			r.deadLetter(p.job.Job, p.job.Attempts, errors.New("Retrier stopped while the job queue was full"), logger)
+		}
+	}
+}
+
+func (r *Retrier) deadLetter(job Job, attempts int, err error, logger domain.Logger) {
+	if r.canceller != nil {
+		// the request is finished, whether or not the dead letter is stored
+		defer r.canceller.Forget(job.RequestID())
+	}
+	if r.deadLetters == nil {
+		logger.Error("Retrier gave up on job, no DeadLetterStore set, job is lost",
+			domain.NewField("attempts", attempts),
+			domain.NewField(domain.ErrorKey, err),
+		)
+		return
+	}
+	id, storeErr := r.deadLetters.Add(NewDeadLetter(job, attempts, err))
+	if storeErr != nil {
+		logger.Error("Retrier couldn't store dead letter, job is lost",
+			domain.NewField("attempts", attempts),
+			domain.NewField(domain.ErrorKey, err),
+			domain.NewField("store_error", storeErr),
+		)
+		return
+	}
+	logger.Error("Retrier gave up on job and moved it to the dead letters",
+		domain.NewField("dead_letter_id", id),
+		domain.NewField("attempts", attempts),
+		domain.NewField(domain.ErrorKey, err),
+	)
+	// the dead letter store has the job now
+	ackJob(job, logger)
+}
+
+// Interrupted takes a job which was stopped half way because its Worker was shutting down.
+// The job didn't really fail, so it doesn't use up an attempt, it is returned by Stop to
+// be checkpointed along with the scheduled retries.
+func (r *Retrier) Interrupted(job Job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interrupted = append(r.interrupted, job)
+}
+
+// Stop cancels all the scheduled retries and returns their jobs along with the interrupted
+// jobs, so they can be checkpointed. Jobs which fail after Stop go to the dead letters
+// right away.
+func (r *Retrier) Stop() []Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped = true
+	jobs := r.interrupted
+	for p := range r.pending {
+		p.timer.Stop()
+		jobs = append(jobs, p.job)
+	}
+	r.pending = make(map[*pendingRetry]struct{})
+	r.interrupted = nil
+	return jobs
+}
+
+// Pending returns the number of jobs waiting for their backoff to pass.
+func (r *Retrier) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending)
+}
+
+// NewRetrier is a constructor which takes the job queue retried jobs are put back on and
+// the DeadLetterStore for jobs which run out of attempts and returns a pointer to a new Retrier.
+func NewRetrier(jobQueue chan Job, dl DeadLetterStore) *Retrier {
+	r := Retrier{
+		jobQueue:    jobQueue,
+		deadLetters: dl,
+		pending:     make(map[*pendingRetry]struct{}),
+	}
+	return &r
+}
@@ -0,0 +1,215 @@
+package usecases
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// MockDeadLetterStore implements the DeadLetterStore interface by keeping dead letters in a slice.
+type MockDeadLetterStore struct {
+	mu          sync.Mutex
+	deadLetters []DeadLetter
+}
+
+func (m *MockDeadLetterStore) Add(dl DeadLetter) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dl.ID = uint64(len(m.deadLetters) + 1)
+	m.deadLetters = append(m.deadLetters, dl)
+	return dl.ID, nil
+}
+
+func (m *MockDeadLetterStore) FindByID(id uint64) (DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, dl := range m.deadLetters {
+		if dl.ID == id {
+			return dl, nil
+		}
+	}
+	return DeadLetter{}, errors.New("dead letter not found")
+}
+
+func (m *MockDeadLetterStore) List() ([]DeadLetter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]DeadLetter{}, m.deadLetters...), nil
+}
+
+func (m *MockDeadLetterStore) Remove(id uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, dl := range m.deadLetters {
+		if dl.ID == id {
+			m.deadLetters = append(m.deadLetters[:i], m.deadLetters[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("dead letter not found")
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+	}
+	testCases := []struct {
+		name     string
+		attempt  int
+		expected time.Duration
+	}{
+		{
+			name:     "first attempt waits the initial backoff",
+			attempt:  1,
+			expected: time.Second,
+		},
+		{
+			name:     "third attempt is multiplied twice",
+			attempt:  3,
+			expected: 4 * time.Second,
+		},
+		{
+			name:     "backoff is capped at max backoff",
+			attempt:  4,
+			expected: 5 * time.Second,
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			result := p.Backoff(tc.attempt)
+			if result != tc.expected {
+				t.Errorf("%s: Backoff(%d) => Got: %v, expected: %v", tc.name, tc.attempt, result, tc.expected)
+			}
+		})
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		result := p.Backoff(1)
+		if result < 500*time.Millisecond || result > 1500*time.Millisecond {
+			t.Fatalf("Backoff(1) with jitter 0.5 => Got: %v, expected within 500ms and 1.5s", result)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		result := p.Backoff(4)
+		if result < 2500*time.Millisecond || result > p.MaxBackoff {
+			t.Fatalf("Backoff(4) with jitter 0.5 => Got: %v, expected within 2.5s and the max backoff of %v", result, p.MaxBackoff)
+		}
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3}
+	someError := errors.New("some error")
+	testCases := []struct {
+		name     string
+		attempt  int
+		err      error
+		expected bool
+	}{
+		{
+			name:     "retryable error with attempts left",
+			attempt:  1,
+			err:      someError,
+			expected: true,
+		},
+		{
+			name:     "retryable error without attempts left",
+			attempt:  3,
+			err:      someError,
+			expected: false,
+		},
+		{
+			name:     "permanent error with attempts left",
+			attempt:  1,
+			err:      errors.Wrap(domain.NewPermanentError(someError), "wrapped"),
+			expected: false,
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			result := p.ShouldRetry(tc.attempt, tc.err)
+			if result != tc.expected {
+				t.Errorf("%s: ShouldRetry(%d, %v) => Got: %v, expected: %v", tc.name, tc.attempt, tc.err, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRetrierHandleFailure(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+	jobQueue := make(chan Job, 1)
+	dls := &MockDeadLetterStore{}
+	r := NewRetrier(jobQueue, dls)
+	logger := newMockRecordingLogger()
+	job := &MockJob{policy: policy}
+
+	// the first failure puts the job back on the queue after its backoff
+	r.HandleFailure(job, errors.New("some error"), logger)
+	var retried Job
+	select {
+	case retried = <-jobQueue:
+	case <-time.After(time.Second):
+		t.Fatalf("HandleFailure() => job was not put back on the queue")
+	}
+	attempt, original := attemptOf(retried)
+	if attempt != 2 || original != job {
+		t.Errorf("HandleFailure() => got retried job on attempt %d, expected the same job on attempt 2", attempt)
+	}
+
+	// the second failure uses up the attempts, the job goes to the dead letters
+	r.HandleFailure(retried, errors.New("some error"), logger)
+	dl, err := dls.FindByID(1)
+	if err != nil || dl.Job != job || dl.Attempts != 2 || dl.LastError != "some error" {
+		t.Errorf("HandleFailure() on last attempt => got: (%v, %v), expected dead letter of the job after 2 attempts", dl, err)
+	}
+
+	// permanent errors go to the dead letters right away
+	r.HandleFailure(&MockJob{policy: policy}, domain.NewPermanentError(errors.New("bad address")), logger)
+	if all, _ := dls.List(); len(all) != 2 || all[1].Attempts != 1 {
+		t.Errorf("HandleFailure() with permanent error => got: %v, expected a second dead letter after 1 attempt", all)
+	}
+}
+
+func TestRetrierStopReturnsPendingJobs(t *testing.T) {
+	r := NewRetrier(make(chan Job, 1), &MockDeadLetterStore{})
+	r.HandleFailure(&MockJob{policy: RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour}}, errors.New("some error"), newMockRecordingLogger())
+	r.Interrupted(&MockJob{})
+	if r.Pending() != 1 {
+		t.Fatalf("Pending() => got: %d, expected: 1", r.Pending())
+	}
+	jobs := r.Stop()
+	if len(jobs) != 2 || r.Pending() != 0 {
+		t.Errorf("Stop() => got %d jobs and %d pending, expected 2 jobs and 0 pending", len(jobs), r.Pending())
+	}
+}
+
+func TestWorkerRetriesFailedJob(t *testing.T) {
+	jobQueue := make(chan Job, 1)
+	dls := &MockDeadLetterStore{}
+	w := NewWorker(1, jobQueue, nil, newMockRecordingLogger(), NewRequestCanceller(), NewRetrier(jobQueue, dls))
+
+	job := &MockJob{err: errors.New("some error"), policy: RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}}
+	w.process(context.Background(), job)
+	select {
+	case retried := <-jobQueue:
+		w.process(context.Background(), retried)
+	case <-time.After(time.Second):
+		t.Fatalf("process() of failing job => job was not retried")
+	}
+	if all, _ := dls.List(); len(all) != 1 || all[0].Attempts != 2 {
+		t.Errorf("process() of job failing twice => got dead letters: %v, expected one after 2 attempts", all)
+	}
+}
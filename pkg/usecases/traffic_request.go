@@ -2,6 +2,7 @@ package usecases
 
 import (
 	// "fmt"
+	"context"
 	"time"
 
 	"github.com/pkg/errors"
@@ -18,9 +19,12 @@ type TrafficResponseDTO struct {
 
 type TrafficInteractor struct {
 	TrafficService domain.TrafficService
+	// BaseTrafficService is optional, with it the base travel time comes from it instead of
+	// the TrafficService, like from a free source whose estimate is good enough.
+	BaseTrafficService domain.TrafficService
 }
 
-func (tr *TrafficInteractor) GetTrafficFinalResponse(baseTravelTime time.Duration, ur *domain.UserRequest) (*TrafficResponseDTO, error) {
+func (tr *TrafficInteractor) GetTrafficFinalResponse(ctx context.Context, baseTravelTime time.Duration, ur *domain.UserRequest) (*TrafficResponseDTO, error) {
 	var tResp *TrafficResponseDTO
 	// TODO: implement the algorithm and find the final set of
 	// best and worst case times to start the journey to reach
@@ -37,16 +41,29 @@ func (tr *TrafficInteractor) GetTrafficFinalResponse(baseTravelTime time.Duratio
 	// reaching a condition
 
 	// step 4: create thet traffic response dto and return
+	// until the polling is implemented the base travel time is the only sample, so the
+	// best and the worst case are to start the journey that long before the reaching time
+	start := ur.ReachingTime.Add(-baseTravelTime)
+	tResp = &TrafficResponseDTO{
+		UserRequest: ur,
+		TravelTime:  []time.Duration{baseTravelTime},
+		BestCase:    []time.Time{start},
+		WorstCase:   []time.Time{start},
+	}
 	return tResp, nil
 
 }
 
-func (tr *TrafficInteractor) GetBaseTravelTime(source, destination domain.Location, t time.Time) (time.Duration, error) {
+func (tr *TrafficInteractor) GetBaseTravelTime(ctx context.Context, source, destination domain.Location, t time.Time) (time.Duration, error) {
 	var baseTravelTime time.Duration
 	// step 0: create new traffic request
 	treq := domain.NewTrafficRequest(source, destination, t)
 	// step 1: poll traffic service
-	tresp, err := tr.TrafficService.TravelTime(treq)
+	ts := tr.TrafficService
+	if tr.BaseTrafficService != nil {
+		ts = tr.BaseTrafficService
+	}
+	tresp, err := ts.TravelTime(ctx, treq)
 	if err != nil {
 		return baseTravelTime, errors.Wrap(err, "GetBaseTravelTime failed in fetching TravelTime from TrafficService")
 	}
@@ -58,9 +75,16 @@ func (tr *TrafficInteractor) GetBaseTravelTime(source, destination domain.Locati
 func (tr *TrafficInteractor) GetTriggerTime(baseEta time.Duration, tResp *TrafficResponseDTO) time.Time {
 	// step 0: sort the tResp.WorstCase and find the smalled time
 	// step 2: return the the difference for step0 and baseEta
-
-	// TODO: // now just return the current time
-	return time.Now()
+	if tResp == nil || len(tResp.WorstCase) == 0 {
+		return time.Now()
+	}
+	earliest := tResp.WorstCase[0]
+	for _, t := range tResp.WorstCase[1:] {
+		if t.Before(earliest) {
+			earliest = t
+		}
+	}
+	return earliest.Add(-baseEta)
 }
 
 func NewTrafficInteractor(ts domain.TrafficService) *TrafficInteractor {
@@ -3,6 +3,7 @@ package usecases
 import (
 	// "fmt"
 	// "reflect"
+	"context"
 	"testing"
 	"time"
 
@@ -11,7 +12,7 @@ import (
 
 type MockTrafficService struct{}
 
-func (t *MockTrafficService) TravelTime(tr *domain.TrafficRequest) (*domain.TrafficResponse, error) {
+func (t *MockTrafficService) TravelTime(ctx context.Context, tr *domain.TrafficRequest) (*domain.TrafficResponse, error) {
 	tResp := domain.TrafficResponse{
 		TrafficRequest: tr,
 		TravelTime:     time.Duration(45 * time.Minute),
@@ -28,3 +29,58 @@ func testTrafficInteractor(t *testing.T) *TrafficInteractor {
 	ts := &MockTrafficService{}
 	return NewTrafficInteractor(ts)
 }
+
+func TestGetTriggerTime(t *testing.T) {
+	interactor := testTrafficInteractor(t)
+	reachingTime := time.Date(2018, time.March, 9, 20, 0, 0, 0, time.UTC)
+	ur := domain.NewUserRequest(domain.NewUser("roy"), &domain.Request{ReachingTime: reachingTime})
+
+	tResp, err := interactor.GetTrafficFinalResponse(context.Background(), 68*time.Minute, ur)
+	if err != nil {
+		t.Fatalf("GetTrafficFinalResponse() => got: %v, expected: nil", err)
+	}
+	// the example of the README, 68 minutes of driving and 9 minutes for the cab to arrive
+	expected := time.Date(2018, time.March, 9, 18, 43, 0, 0, time.UTC)
+	if got := interactor.GetTriggerTime(9*time.Minute, tResp); !got.Equal(expected) {
+		t.Errorf("GetTriggerTime() => got: %v, expected: %v", got, expected)
+	}
+
+	// the earliest worst case wins
+	tResp.WorstCase = append(tResp.WorstCase, reachingTime.Add(-90*time.Minute))
+	expected = reachingTime.Add(-99 * time.Minute)
+	if got := interactor.GetTriggerTime(9*time.Minute, tResp); !got.Equal(expected) {
+		t.Errorf("GetTriggerTime() with several samples => got: %v, expected: %v", got, expected)
+	}
+}
+
+// MockFixedTrafficService implements the domain.TrafficService interface, every journey
+// takes the same travel time.
+type MockFixedTrafficService struct {
+	travelTime time.Duration
+}
+
+func (t *MockFixedTrafficService) TravelTime(ctx context.Context, tr *domain.TrafficRequest) (*domain.TrafficResponse, error) {
+	return &domain.TrafficResponse{TrafficRequest: tr, TravelTime: t.travelTime}, nil
+}
+
+func TestGetBaseTravelTime(t *testing.T) {
+	testCases := []struct {
+		base     domain.TrafficService
+		expected time.Duration
+	}{
+		{nil, 45 * time.Minute},
+		{&MockFixedTrafficService{travelTime: 50 * time.Minute}, 50 * time.Minute},
+	}
+
+	for i, _ := range testCases {
+		interactor := testTrafficInteractor(t)
+		interactor.BaseTrafficService = testCases[i].base
+		got, err := interactor.GetBaseTravelTime(context.Background(), domain.Location{}, domain.Location{}, time.Now())
+		if err != nil {
+			t.Fatalf("case %d: GetBaseTravelTime() => got: %v, expected: nil", i, err)
+		}
+		if got != testCases[i].expected {
+			t.Errorf("case %d: GetBaseTravelTime() => got: %v, expected: %v", i, got, testCases[i].expected)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package usecases
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// Repositories are the repositories whose changes a use case makes together. Jobs is
+// optional, a Transactor which can keep jobs gives the AppEngine which adds them in the
+// transaction, so they are only processed if it commits. Without it the jobs are held until
+// the transaction commits and only then added to the AppEngine of the UserInteractor, they
+// are dropped if it is rolled back. IdempotencyKeys is optional too, a Transactor which can
+// keep the idempotency keys gives the IdempotencyStore of the transaction, so a key is only
+// claimed if its request is stored.
+type Repositories struct {
+	Users           domain.UserRepository
+	Requests        domain.RequestRepository
+	Jobs            AppEngine
+	IdempotencyKeys IdempotencyStore
+}
+
+// Transactor runs a function in a transaction of the repositories. The changes the function
+// makes with the Repositories it is given are committed together if it returns nil and
+// rolled back if it returns an error, in which case its error is returned.
+type Transactor interface {
+	Transact(func(Repositories) error) error
+}
+
+// heldJobs is the AppEngine of a transaction whose Transactor can't keep jobs, it holds the
+// jobs added in the transaction until it commits.
+type heldJobs []Job
+
+func (h *heldJobs) AddJob(job Job) error {
+	*h = append(*h, job)
+	return nil
+}
+
+// transact calls fn with a copy of the UserInteractor whose repositories are those of a
+// transaction of the Transactor, so the changes fn makes are kept only if it returns nil.
+// The jobs fn adds are held until the transaction commits if the Transactor can't keep
+// them, an error adding them afterwards is returned, with the changes of fn kept. Without a
+// Transactor fn is called with the UserInteractor itself and its changes are kept as they
+// are made.
+func (ur *UserInteractor) transact(fn func(*UserInteractor) error) error {
+	if ur.Transactor == nil {
+		return fn(ur)
+	}
+	var held heldJobs
+	err := ur.Transactor.Transact(func(repos Repositories) error {
+		// the jobs of an attempt which is rolled back and tried again are dropped
+		held = nil
+		tx := *ur
+		tx.UserRepository, tx.RequestRepository = repos.Users, repos.Requests
+		tx.AppEngine = &held
+		if repos.Jobs != nil {
+			tx.AppEngine = repos.Jobs
+		}
+		if repos.IdempotencyKeys != nil && ur.IdempotencyKeys != nil {
+			tx.IdempotencyKeys = NewIdempotencyKeys(repos.IdempotencyKeys, ur.IdempotencyKeys.Retention)
+		}
+		return fn(&tx)
+	})
+	if err != nil {
+		return err
+	}
+	for _, job := range held {
+		if err = ur.AppEngine.AddJob(job); err != nil {
+			return errors.Wrap(err, "transact couldn't add the job of the committed transaction")
+		}
+	}
+	return nil
+}
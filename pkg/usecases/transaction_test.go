@@ -0,0 +1,134 @@
+package usecases
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// MockTransactor implements the Transactor interface, it gives the function its repos and
+// counts the transactions which are committed and rolled back. A transaction fails to
+// commit with commitErr if it is set.
+type MockTransactor struct {
+	repos      Repositories
+	commitErr  error
+	committed  int
+	rolledBack int
+}
+
+func (m *MockTransactor) Transact(fn func(Repositories) error) error {
+	if err := fn(m.repos); err != nil {
+		m.rolledBack++
+		return err
+	}
+	if m.commitErr != nil {
+		m.rolledBack++
+		return m.commitErr
+	}
+	m.committed++
+	return nil
+}
+
+func TestCreateUserRequestInTransaction(t *testing.T) {
+	interactor := testUserInteractor(t)
+	// the interactor's own repositories fail, only those of the transaction work
+	interactor.UserRepository = &MockBadUserRepo{}
+	interactor.RequestRepository = &MockBadRequestRepo{}
+	reqRepo := &MockMapRequestRepo{requests: make(map[uint64]domain.Request)}
+	tx := &MockTransactor{repos: Repositories{
+		Users:    &MockMapUserRepo{users: make(map[uint64]domain.User)},
+		Requests: reqRepo,
+	}}
+	interactor.Transactor = tx
+
+	ur, err := interactor.CreateUserRequest(testUserRequestDTO(t))
+	if err != nil || ur.Request.ID() != 1 || tx.committed != 1 {
+		t.Errorf("CreateUserRequest() => got: (%v, %v, %d committed), expected request 1 committed", ur, err, tx.committed)
+	}
+
+	tx.repos.Jobs = &MockBadAppEngine{}
+	if _, err = interactor.CreateUserRequest(testUserRequestDTO(t)); err == nil || tx.rolledBack != 1 {
+		t.Errorf("CreateUserRequest() with a failing AppEngine => got: (%v, %d rolled back), expected the transaction rolled back", err, tx.rolledBack)
+	}
+	// the repositories of the transaction are only used within it
+	if _, ok := interactor.UserRepository.(*MockBadUserRepo); !ok {
+		t.Errorf("CreateUserRequest() => got the interactor's UserRepository replaced, expected it kept")
+	}
+}
+
+func TestCreateUserRequestClaimsKeyInTransaction(t *testing.T) {
+	interactor, _, memory := testIdempotentInteractor(t)
+	keys := &MockIdempotencyStore{records: make(map[string]IdempotencyRecord)}
+	tx := &MockTransactor{repos: Repositories{
+		Users:           &MockMapUserRepo{users: make(map[uint64]domain.User)},
+		Requests:        &MockMapRequestRepo{requests: make(map[uint64]domain.Request)},
+		IdempotencyKeys: keys,
+	}}
+	interactor.Transactor = tx
+
+	dto := testKeyedDTO(t, "key-1")
+	ur, err := interactor.CreateUserRequest(dto)
+	if err != nil || keys.records[testScope+" key-1"].RequestID != ur.Request.ID() || len(memory.records) != 0 {
+		t.Errorf("CreateUserRequest() => got: (%v, %v), expected the key completed in the transaction only", keys.records, err)
+	}
+	retry, err := interactor.CreateUserRequest(dto)
+	if err != nil || retry.Request.ID() != ur.Request.ID() || tx.committed != 2 {
+		t.Errorf("CreateUserRequest() retried => got: (%v, %v), expected request %d", retry, err, ur.Request.ID())
+	}
+}
+
+func TestCreateUserRequestAddsJobInTransaction(t *testing.T) {
+	interactor := testUserInteractor(t)
+	interactor.AppEngine = &MockBadAppEngine{}
+	jobs := NewQueueEngine(UserRequestJobType, 1, OverflowConfig{})
+	interactor.Transactor = &MockTransactor{repos: Repositories{
+		Users:    &MockMapUserRepo{users: make(map[uint64]domain.User)},
+		Requests: &MockMapRequestRepo{requests: make(map[uint64]domain.Request)},
+		Jobs:     jobs,
+	}}
+
+	if _, err := interactor.CreateUserRequest(testUserRequestDTO(t)); err != nil {
+		t.Fatalf("CreateUserRequest() => got: %v, expected: nil", err)
+	}
+	if len(jobs.JobQueue) != 1 {
+		t.Errorf("CreateUserRequest() => got %d jobs added in the transaction, expected: 1", len(jobs.JobQueue))
+	}
+	if _, ok := interactor.AppEngine.(*MockBadAppEngine); !ok {
+		t.Errorf("CreateUserRequest() => got the interactor's AppEngine replaced, expected it kept")
+	}
+}
+
+func TestCreateUserRequestAddsJobAfterCommit(t *testing.T) {
+	testCases := []struct {
+		name         string
+		commitErr    error
+		expectedJobs int
+	}{
+		{"committed", nil, 1},
+		{"commit failed", errors.New("database is locked"), 0},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			interactor := testUserInteractor(t)
+			jobs := NewQueueEngine(UserRequestJobType, 1, OverflowConfig{})
+			interactor.AppEngine = jobs
+			// the repositories of the transaction can't keep jobs, like those of SQLite
+			interactor.Transactor = &MockTransactor{commitErr: tc.commitErr, repos: Repositories{
+				Users:    &MockMapUserRepo{users: make(map[uint64]domain.User)},
+				Requests: &MockMapRequestRepo{requests: make(map[uint64]domain.Request)},
+			}}
+
+			_, err := interactor.CreateUserRequest(testUserRequestDTO(t))
+			if errors.Cause(err) != tc.commitErr {
+				t.Errorf("%s: CreateUserRequest() => got: %v, expected: %v", tc.name, err, tc.commitErr)
+			}
+			if len(jobs.JobQueue) != tc.expectedJobs {
+				t.Errorf("%s: CreateUserRequest() => got %d jobs added, expected: %d", tc.name, len(jobs.JobQueue), tc.expectedJobs)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package usecases
 
 import (
 	// "fmt"
+	"context"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -9,16 +11,8 @@ import (
 	"github.com/anirbanroydas/ubernow-go/pkg/domain"
 )
 
-// UserRequestDTO is DTO which takes in a UserRequest objec
-type UserRequestDTO struct {
-	name             string
-	source           domain.Location
-	destination      domain.Location
-	reachingTime     time.Time
-	cab              string
-	cabType          string
-	notificationAddr domain.UserAddress
-}
+// addressConfirmationTTL is how long the code sent to a pending address of a user confirms it.
+const addressConfirmationTTL = 24 * time.Hour
 
 type UserInteractor struct {
 	UserRepository                domain.UserRepository
@@ -30,42 +24,307 @@ type UserInteractor struct {
 	CabEngineInteractor           *CabEngineInteractor
 	NotificationInteractor        *NotificationInteractor
 	NotificationServiceInteractor *NotificationServiceInteractor
+	RequestCanceller              *RequestCanceller
+	RequestWatcher                *RequestWatcher
+	// IdempotencyKeys is optional, without it the idempotency keys are ignored.
+	IdempotencyKeys *IdempotencyKeys
+	// Transactor is optional, without it the user and the request of a UserRequest which
+	// can't be sent to the AppEngine are stored all the same.
+	Transactor Transactor
+	// ConfirmationSender sends the codes the addresses of the users are confirmed with,
+	// without it the addresses can't be confirmed.
+	ConfirmationSender domain.ConfirmationSender
+	// Cabs is the catalog of the configured cab services the requests are validated
+	// against, without it they are validated against the default cabs of the domain.
+	Cabs domain.CabCatalog
 }
 
 // CreateUserRequest use_case takes a UserRequestDTO object as input and creates a domain level
 // UserTequest object and sends it to an AppEngine which process it from there on, asynchronously.
-// It returns an error if there is a problem in any of the above processes.
+// It returns the created UserRequest, or an error if there is a problem in any of the above
+// processes. Invalid input is reported with a domain.ValidationError.
+//
+// To do it it firest finds the domain level User whose confirmed address is the notification
+// address of the request in the UserRepository, or creates and stores a new one with the
+// address pending if it belongs to no one yet and sends the new user the code to confirm it
+// with, then creates a domain level REquest object of the user and stores it in the
+// RequestRepository and then it creates the domain level UserRequest object and sends it to the AppEngine.
 //
-// To do it it firest cretaes a domain level REquest object and stores it in the RequestRepository,
-// then creates a domain level User Object and stores it in the
-// UserRepository and then it creates the domain level UserRequest object and sends it to the AppEngine.
-func (ur *UserInteractor) CreateUserRequest(ucReq UserRequestDTO) error {
+// A UserRequestDTO with an idempotency key which was used before returns the UserRequest
+// created the first time, nothing is created or sent again. It returns
+// ErrIdempotencyKeyReused if the key was used with a different input, and
+// ErrIdempotencyKeyInUse if the request of the key is still being created. The key is
+// claimed in the transaction of the Transactor if it keeps the keys, so that it is stored
+// together with its request or not at all.
+func (ur *UserInteractor) CreateUserRequest(ucReq UserRequestDTO) (*domain.UserRequest, error) {
 	var err error
-	// step 1:  create  new domoan.Request and save in domain.RequestRepository
-	var r *domain.Request
-	r, err = ur.createAndSaveRequest(ucReq)
+	// step 1: validate the notification address, the user and the idempotency key belong to it
+	ucReq.notificationAddr, err = validateAddress("notification_addr", ucReq.notificationAddr)
+	if err != nil {
+		return nil, errors.Wrap(err, "CreateUserRequest couldn't validate the notification address")
+	}
+	var userRequest *domain.UserRequest
+	// code confirms the notification address of a new user
+	var code string
+	var rec IdempotencyRecord
+	// claimed are the IdempotencyKeys in which the key of the request is claimed
+	var claimed *IdempotencyKeys
+	err = ur.transact(func(tx *UserInteractor) error {
+		var err error
+		claimed, code = nil, ""
+		if ucReq.idempotencyKey != "" && tx.IdempotencyKeys != nil {
+			now := time.Now()
+			rec = tx.IdempotencyKeys.record(ucReq, now)
+			stored, ok, err := tx.IdempotencyKeys.Store.Claim(rec, now)
+			if err != nil {
+				return errors.Wrap(err, "CreateUserRequest couldn't claim the idempotency key")
+			}
+			if !ok {
+				userRequest, err = tx.findIdempotentRequest(stored, rec.PayloadHash)
+				return err
+			}
+			claimed = tx.IdempotencyKeys
+		}
+		userRequest, code, err = tx.createUserRequest(ucReq)
+		if err != nil || claimed == nil {
+			return err
+		}
+		err = claimed.Store.Complete(rec.Scope, rec.Key, userRequest.Request.ID())
+		if claimed != ur.IdempotencyKeys {
+			return errors.Wrap(err, "CreateUserRequest couldn't complete the idempotency key")
+		}
+		// the request is created and on its way even if the key can't be completed outside
+		// of the transaction, failing would only make the client retry into
+		// ErrIdempotencyKeyInUse until the key expires
+		return nil
+	})
+	if err != nil {
+		// a retry with the key creates the request again, the key of a transaction is gone
+		// with it. If a key claimed outside of the transaction can't be released the
+		// retries fail with ErrIdempotencyKeyInUse until it expires.
+		if claimed != nil && claimed == ur.IdempotencyKeys {
+			claimed.Store.Release(rec.Scope, rec.Key)
+		}
+		return nil, err
+	}
+	if code != "" {
+		// the request is created all the same, the next request notified at the address
+		// sends a new code if this one doesn't reach the user
+		ur.sendConfirmation(ucReq.notificationAddr, code)
+	}
+	return userRequest, nil
+}
+
+// findIdempotentRequest returns the UserRequest created for the stored idempotency record,
+// as long as it was created from the same input.
+func (ur *UserInteractor) findIdempotentRequest(rec IdempotencyRecord, hash string) (*domain.UserRequest, error) {
+	if rec.PayloadHash != hash {
+		return nil, errors.Wrapf(ErrIdempotencyKeyReused, "CreateUserRequest got idempotency key %q", rec.Key)
+	}
+	if rec.RequestID == 0 {
+		return nil, errors.Wrapf(ErrIdempotencyKeyInUse, "CreateUserRequest got idempotency key %q", rec.Key)
+	}
+	r, err := ur.RequestRepository.FindByID(rec.RequestID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "CreateUserRequest couldn't find request %d of idempotency key %q", rec.RequestID, rec.Key)
+	}
+	u, err := ur.UserRepository.FindByID(r.UserID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "CreateUserRequest couldn't find user %d of request %d", r.UserID, r.ID())
+	}
+	return domain.NewUserRequest(u, r), nil
+}
+
+// createUserRequest creates the UserRequest of the validated notification address and sends
+// it to the AppEngine, regardless of its idempotency key. It is called in a transaction of
+// the Transactor, whose commit the UserRequest is only processed after, see transact. It
+// also returns the code which confirms the address of a new user.
+func (ur *UserInteractor) createUserRequest(ucReq UserRequestDTO) (*domain.UserRequest, string, error) {
+	// step 2: find or create and save domain.User of the notification address
+	u, code, err := ur.findOrCreateUser(ucReq.name, ucReq.notificationAddr)
 	if err != nil {
-		return errors.Wrap(err, "CreateUserRequest couldn't create and save domain.Request")
+		return nil, "", errors.Wrap(err, "CreateUserRequest couldn't find or create domain.User")
 	}
-	// step 2: create and save domain.User in domain.UserRepository
-	var u *domain.User
-	u, err = ur.createAndSaveUser(ucReq.name)
+	// step 3:  create  new domoan.Request and save in domain.RequestRepository
+	r, err := ur.createAndSaveRequest(ucReq, u.UserID)
 	if err != nil {
-		return errors.Wrap(err, "CreateUserRequest couldn't create and save domain.User")
+		return nil, "", errors.Wrap(err, "CreateUserRequest couldn't create and save domain.Request")
 	}
-	// step 3: create new domain.UserRequest Object
+	// step 4: create new domain.UserRequest Object
 	userRequest := domain.NewUserRequest(u, r)
-	// stpe 4: send the new domain.UserRequest to the app engine to process and return
+	// stpe 5: send the new domain.UserRequest to the app engine to process and return
 	err = ur.sendQueue(userRequest)
 	if err != nil {
-		return errors.Wrap(err, "CreateUserRequest could't send userRequest to AppEngine for processing")
+		return nil, "", errors.Wrap(err, "CreateUserRequest could't send userRequest to AppEngine for processing")
 	}
-	return nil
+	return userRequest, code, nil
+}
+
+// CabCatalog returns the cabs the requests can be made for, the Cabs of the UserInteractor or
+// the default cabs of the domain.
+func (ur *UserInteractor) CabCatalog() domain.CabCatalog {
+	if ur.Cabs != nil {
+		return ur.Cabs
+	}
+	return domain.DefaultCabCatalog()
+}
+
+// GetUserRequest use_case returns the request with the given id, with its status and the
+// booking time found for it. It returns domain.ErrNotFound if there is no such request, or
+// if token is not the token of the request.
+func (ur *UserInteractor) GetUserRequest(reqID uint64, token string) (*domain.Request, error) {
+	r, err := ur.RequestRepository.FindByID(reqID)
+	if err == nil {
+		err = r.Authorize(token)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetUserRequest couldn't find request %d", reqID)
+	}
+	return r, nil
+}
+
+// GetUser use_case returns the user with the given id, with their saved addresses and
+// places. It returns domain.ErrNotFound if there is no such user.
+func (ur *UserInteractor) GetUser(userID uint64) (*domain.User, error) {
+	u, err := ur.UserRepository.FindByID(userID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GetUser couldn't find user %d", userID)
+	}
+	return u, nil
+}
+
+// SaveUserAddress use_case validates the address and saves it as a pending address of the
+// user with the given id, and sends the address the code it is confirmed with by
+// ConfirmUserAddress. A code sent before for the address no longer confirms it. It returns
+// the user and domain.ErrNotFound if there is no such user, nothing is sent for an address
+// the user already confirmed.
+func (ur *UserInteractor) SaveUserAddress(userID uint64, addr domain.UserAddress) (*domain.User, error) {
+	addr, err := validateAddress("address", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "SaveUserAddress couldn't validate the address")
+	}
+	u, err := ur.UserRepository.FindByID(userID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "SaveUserAddress couldn't find user %d", userID)
+	}
+	code, err := u.AddPendingAddress(addr, time.Now().Add(addressConfirmationTTL))
+	if err != nil || code == "" {
+		return u, errors.Wrap(err, "SaveUserAddress couldn't add the pending address")
+	}
+	if err = ur.UserRepository.Update(u); err != nil {
+		return nil, errors.Wrapf(err, "SaveUserAddress couldn't update user %d", userID)
+	}
+	if err = ur.sendConfirmation(addr, code); err != nil {
+		return nil, errors.Wrap(err, "SaveUserAddress couldn't send the confirmation code")
+	}
+	return u, nil
+}
+
+// ConfirmUserAddress use_case confirms the pending address of the user with the given id
+// with the code sent to it, requests notified at it belong to the user from then on. It
+// returns the user, domain.ErrNotFound if there is no such user, a domain.ValidationError
+// if the code is not the code sent to the address or it expired, and
+// domain.ErrAddressTaken if another user confirmed the address first.
+func (ur *UserInteractor) ConfirmUserAddress(userID uint64, addr domain.UserAddress, code string) (*domain.User, error) {
+	addr, err := validateAddress("address", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "ConfirmUserAddress couldn't validate the address")
+	}
+	u, err := ur.UserRepository.FindByID(userID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "ConfirmUserAddress couldn't find user %d", userID)
+	}
+	if err = u.ConfirmAddress(addr, code, time.Now()); err != nil {
+		return nil, errors.Wrap(err, "ConfirmUserAddress couldn't confirm the address")
+	}
+	if err = ur.UserRepository.Update(u); err != nil {
+		return nil, errors.Wrapf(err, "ConfirmUserAddress couldn't update user %d", userID)
+	}
+	return u, nil
+}
+
+// sendConfirmation sends the code which confirms the pending address to it with the
+// ConfirmationSender.
+func (ur *UserInteractor) sendConfirmation(addr domain.UserAddress, code string) error {
+	if ur.ConfirmationSender == nil {
+		return errors.New("sendConfirmation has no ConfirmationSender")
+	}
+	err := ur.ConfirmationSender.SendConfirmation(context.Background(), addr, code)
+	return errors.Wrapf(err, "sendConfirmation couldn't send the code to the %s address %s", addr.AddrType, addr.Value)
+}
+
+// SaveUserPlace use_case saves the place for the user with the given id, it replaces the
+// place the user saved before with the same name. It returns the user, domain.ErrNotFound
+// if there is no such user and domain.ValidationErrors if the place has no name or its
+// coordinates are not valid.
+func (ur *UserInteractor) SaveUserPlace(userID uint64, place domain.Location) (*domain.User, error) {
+	var verrs domain.ValidationErrors
+	if strings.TrimSpace(place.Name) == "" {
+		verrs.Add("place.name", "is required")
+	}
+	validateCoordinates(&verrs, "place", place)
+	if err := verrs.Err(); err != nil {
+		return nil, errors.Wrap(err, "SaveUserPlace got invalid place")
+	}
+	u, err := ur.UserRepository.FindByID(userID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "SaveUserPlace couldn't find user %d", userID)
+	}
+	if err = u.SavePlace(place); err != nil {
+		return nil, errors.Wrap(err, "SaveUserPlace couldn't save place")
+	}
+	if err = ur.UserRepository.Update(u); err != nil {
+		return nil, errors.Wrapf(err, "SaveUserPlace couldn't update user %d", userID)
+	}
+	return u, nil
+}
+
+// CancelUserRequest use_case cancels the request with the given id and returns it. Its
+// scheduled cab request is removed from the CronEngine and its running jobs are cancelled,
+// so the user is not notified. It returns domain.ErrRequestFinished if the request was
+// already notified or cancelled, and domain.ErrNotFound if there is no such request or if
+// token is not the token of the request.
+func (ur *UserInteractor) CancelUserRequest(reqID uint64, token string) (*domain.Request, error) {
+	// step 1: record the cancellation first, the jobs of the request check it
+	r, err := updateRequest(ur.RequestRepository, reqID, func(r *domain.Request) (bool, error) {
+		if err := r.Authorize(token); err != nil {
+			return false, err
+		}
+		return true, errors.Wrap(r.Cancel(), "couldn't cancel request")
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "CancelUserRequest")
+	}
+	// step 2: stop the request's jobs which are scheduled or running
+	if err = ur.CronEngine.CancelRequest(reqID); err != nil {
+		return nil, errors.Wrapf(err, "CancelUserRequest couldn't cancel the scheduled jobs of request %d", reqID)
+	}
+	ur.RequestCanceller.Cancel(reqID)
+	ur.RequestWatcher.Publish(RequestUpdate{Request: r})
+	return r, nil
 }
 
-// createAndSaveRequest is a method of UserInteractor struct which takes in a UserRequestDTO object as input
-// an creates a domain.Request object and stores it in the domain.UserRepository.
-func (ur *UserInteractor) createAndSaveRequest(ucReq UserRequestDTO) (*domain.Request, error) {
+// WatchUserRequest use_case returns the request with the given id and a channel of the
+// updates of its status from then on, until the returned stop function is called. The
+// request is finished with its notified or cancelled update. It returns domain.ErrNotFound
+// if there is no such request, or if token is not the token of the request.
+func (ur *UserInteractor) WatchUserRequest(reqID uint64, token string) (*domain.Request, <-chan RequestUpdate, func(), error) {
+	// watch before reading the request, so no update in between is missed
+	updates, stop := ur.RequestWatcher.Watch(reqID)
+	r, err := ur.RequestRepository.FindByID(reqID)
+	if err == nil {
+		err = r.Authorize(token)
+	}
+	if err != nil {
+		stop()
+		return nil, nil, nil, errors.Wrapf(err, "WatchUserRequest couldn't find request %d", reqID)
+	}
+	return r, updates, stop, nil
+}
+
+// createAndSaveRequest is a method of UserInteractor struct which takes in a UserRequestDTO object and
+// the id of the user as input an creates a domain.Request object and stores it in the domain.UserRepository.
+func (ur *UserInteractor) createAndSaveRequest(ucReq UserRequestDTO, userID uint64) (*domain.Request, error) {
 	// step 1: create a new address validator by using the user's given address type
 	var r *domain.Request
 	uav, err := NewUserAddressValidator(ucReq.notificationAddr.AddrType)
@@ -73,30 +332,51 @@ func (ur *UserInteractor) createAndSaveRequest(ucReq UserRequestDTO) (*domain.Re
 		return r, errors.Wrap(err, "createAndSaveRequest can't create new UserAddressValidator")
 	}
 	// step 2: create new domain.Request
-	r, err = domain.NewRequest(ucReq.source, ucReq.destination, ucReq.reachingTime, ucReq.cab, ucReq.cabType, ucReq.notificationAddr, uav)
+	r, err = domain.NewRequest(ucReq.source, ucReq.destination, ucReq.reachingTime, ucReq.cab, ucReq.cabType, ur.Cabs, ucReq.notificationAddr, uav)
 	if err != nil {
 		return r, errors.Wrap(err, "createAndSaveRequest can't create New domain.request Object")
 	}
+	r.UserID = userID
 	// step 3: save domain.Request object to domain.RequestRepository
-	_, err = ur.RequestRepository.Store(r)
+	var reqID uint64
+	reqID, err = ur.RequestRepository.Store(r)
 	if err != nil {
 		return r, errors.Wrap(err, "createAndSaveRequest couldn't store request to RequestRepository")
 	}
+	// step 4: remember the id given by the repository, it is used to identify the
+	// request across jobs and log lines.
+	r.SetID(reqID)
 	return r, nil
 }
 
-// createAndSaveUser is a method of UserInteractor which takes a name of type string
-// as input and returns a domain.User ojbect along with an error.
-func (ur *UserInteractor) createAndSaveUser(name string) (*domain.User, error) {
-	var u *domain.User
-	// step 1: create new domain.User object
+// findOrCreateUser is a method of UserInteractor which takes a name of type string and a
+// validated address as input and returns the domain.User who confirmed the address, or a
+// new domain.User with the name and the address pending which it stores in the
+// domain.UserRepository, along with the code which confirms the address. The name of a user
+// who is found is kept as it is.
+func (ur *UserInteractor) findOrCreateUser(name string, addr domain.UserAddress) (*domain.User, string, error) {
+	// step 1: find the domain.User who confirmed the address
+	u, err := ur.UserRepository.FindByAddress(addr)
+	if err == nil {
+		return u, "", nil
+	}
+	if errors.Cause(err) != domain.ErrNotFound {
+		return nil, "", errors.Wrap(err, "findOrCreateUser couldn't find user by address in UserRepository")
+	}
+	// step 2: create new domain.User object with the address pending, until the user
+	// confirms it the address is not theirs.
 	u = domain.NewUser(name)
-	// step 2: save domain.User object in domain.UserRepository object.
-	_, err := ur.UserRepository.Store(u)
+	code, err := u.AddPendingAddress(addr, time.Now().Add(addressConfirmationTTL))
 	if err != nil {
-		return u, errors.Wrap(err, "createAndSaveUser couldn't store user to UserRepository")
+		return nil, "", errors.Wrap(err, "findOrCreateUser couldn't add the pending address")
 	}
-	return u, nil
+	// step 3: save domain.User object in domain.UserRepository object
+	userID, err := ur.UserRepository.Store(u)
+	if err != nil {
+		return u, "", errors.Wrap(err, "findOrCreateUser couldn't store user to UserRepository")
+	}
+	u.UserID = userID
+	return u, code, nil
 }
 
 // sendQueue is a method on UserInteractor which takes a pointer to domain.UserRequest
@@ -105,7 +385,7 @@ func (ur *UserInteractor) createAndSaveUser(name string) (*domain.User, error) {
 // about what to do and how to do as there are injected into the UserRequestJob object.
 func (ur *UserInteractor) sendQueue(userRequest *domain.UserRequest) error {
 	// step 1: create a new UserRequestJob which is Job interface
-	job := NewUserRequestJob(userRequest, ur.TrafficInteractor, ur.CabInteractor, ur.CabEngineInteractor, ur.NotificationInteractor, ur.CronEngine)
+	job := NewUserRequestJob(userRequest, ur.TrafficInteractor, ur.CabInteractor, ur.CabEngineInteractor, ur.NotificationInteractor, ur.NotificationServiceInteractor, ur.CronEngine)
 	// step 2: add the new job to AppEngine Queue
 	err := ur.AppEngine.AddJob(job)
 	if err != nil {
@@ -115,7 +395,7 @@ func (ur *UserInteractor) sendQueue(userRequest *domain.UserRequest) error {
 }
 
 // NewUserInteractor is consturctor
-func NewUserInteractor(uRepo domain.UserRepository, reqRepo domain.RequestRepository, c CronEngine, a AppEngine, trI *TrafficInteractor, cabI *CabInteractor, cabEngI *CabEngineInteractor, nI *NotificationInteractor, nsI *NotificationServiceInteractor) *UserInteractor {
+func NewUserInteractor(uRepo domain.UserRepository, reqRepo domain.RequestRepository, c CronEngine, a AppEngine, trI *TrafficInteractor, cabI *CabInteractor, cabEngI *CabEngineInteractor, nI *NotificationInteractor, nsI *NotificationServiceInteractor, rc *RequestCanceller, rw *RequestWatcher) *UserInteractor {
 	u := UserInteractor{
 		UserRepository:                uRepo,
 		RequestRepository:             reqRepo,
@@ -126,6 +406,8 @@ func NewUserInteractor(uRepo domain.UserRepository, reqRepo domain.RequestReposi
 		CabEngineInteractor:           cabEngI,
 		NotificationInteractor:        nI,
 		NotificationServiceInteractor: nsI,
+		RequestCanceller:              rc,
+		RequestWatcher:                rw,
 	}
 	return &u
 }
@@ -0,0 +1,167 @@
+package usecases
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// formTimeLayouts are the layouts a reaching time is parsed with, RFC 3339 and the values of
+// an HTML datetime-local input, which are in the server's local time.
+var formTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+// UserRequestDTO is DTO which takes in a UserRequest objec
+type UserRequestDTO struct {
+	name             string
+	source           domain.Location
+	destination      domain.Location
+	reachingTime     time.Time
+	cab              string
+	cabType          string
+	notificationAddr domain.UserAddress
+	idempotencyKey   string
+}
+
+// NewUserRequestDTO is a constructor which takes the input of a user's request and returns
+// a UserRequestDTO to call CreateUserRequest with. It checks that every field is given and
+// well formed and returns the domain.ValidationErrors of all the fields which are not.
+// Whether the request can be served, like a reaching time far enough ahead or an available
+// cab, is checked by CreateUserRequest.
+func NewUserRequestDTO(name string, source, destination domain.Location, reachingTime time.Time, cab, cabType string, notificationAddr domain.UserAddress) (UserRequestDTO, error) {
+	var verrs domain.ValidationErrors
+	if strings.TrimSpace(name) == "" {
+		verrs.Add("name", "is required")
+	}
+	validateCoordinates(&verrs, "source", source)
+	validateCoordinates(&verrs, "destination", destination)
+	if reachingTime.IsZero() {
+		verrs.Add("reaching_time", "is required")
+	}
+	if cab == "" {
+		verrs.Add("cab", "is required")
+	}
+	if cabType == "" {
+		verrs.Add("cab_type", "is required")
+	}
+	if notificationAddr.AddrType == "" {
+		verrs.Add("notification_addr.type", "is required")
+	}
+	if strings.TrimSpace(notificationAddr.Value) == "" {
+		verrs.Add("notification_addr.value", "is required")
+	}
+	if err := verrs.Err(); err != nil {
+		return UserRequestDTO{}, errors.Wrap(err, "NewUserRequestDTO got invalid input")
+	}
+
+	dto := UserRequestDTO{
+		name:             strings.TrimSpace(name),
+		source:           source,
+		destination:      destination,
+		reachingTime:     reachingTime,
+		cab:              cab,
+		cabType:          cabType,
+		notificationAddr: notificationAddr,
+	}
+	return dto, nil
+}
+
+// validateCoordinates adds a ValidationError for the latitude and longitude of the location
+// l which are missing, not numbers or out of range.
+func validateCoordinates(verrs *domain.ValidationErrors, field string, l domain.Location) {
+	coordinates := []struct {
+		name  string
+		value string
+		max   float64
+	}{
+		{"latitude", l.Latitude, 90},
+		{"longitude", l.Longitude, 180},
+	}
+	for _, c := range coordinates {
+		if c.value == "" {
+			verrs.Add(field+"."+c.name, "is required")
+			continue
+		}
+		v, err := strconv.ParseFloat(c.value, 64)
+		if err != nil || v < -c.max || v > c.max {
+			verrs.Add(field+"."+c.name, "%q is not a number between -%g and %g", c.value, c.max, c.max)
+		}
+	}
+}
+
+// LocationInput is a location as it is given by a user.
+type LocationInput struct {
+	Name      string `json:"name,omitempty"`
+	Latitude  string `json:"latitude"`
+	Longitude string `json:"longitude"`
+}
+
+// AddressInput is a notification address as it is given by a user.
+type AddressInput struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// UserRequestInput is the input of a user's request as it is given to a delivery mechanism,
+// every value is still a string. The delivery mechanisms decode it from their own format,
+// like JSON or a form.
+type UserRequestInput struct {
+	Name             string        `json:"name"`
+	Source           LocationInput `json:"source"`
+	Destination      LocationInput `json:"destination"`
+	ReachingTime     string        `json:"reaching_time"`
+	Cab              string        `json:"cab"`
+	CabType          string        `json:"cab_type"`
+	NotificationAddr AddressInput  `json:"notification_addr"`
+}
+
+// DTO parses the input and returns the UserRequestDTO made by NewUserRequestDTO. The
+// ValidationErrors of the fields which can't be parsed are returned together with the ones
+// returned by NewUserRequestDTO.
+func (in UserRequestInput) DTO() (UserRequestDTO, error) {
+	var verrs domain.ValidationErrors
+	var reachingTime time.Time
+	parsed := true
+	if in.ReachingTime != "" {
+		reachingTime, parsed = parseReachingTime(in.ReachingTime)
+		if !parsed {
+			verrs.Add("reaching_time", "%q is not a time like 2018-03-09T10:00:00+05:30", in.ReachingTime)
+		}
+	}
+
+	dto, err := NewUserRequestDTO(
+		in.Name,
+		domain.Location{Name: in.Source.Name, Latitude: strings.TrimSpace(in.Source.Latitude), Longitude: strings.TrimSpace(in.Source.Longitude)},
+		domain.Location{Name: in.Destination.Name, Latitude: strings.TrimSpace(in.Destination.Latitude), Longitude: strings.TrimSpace(in.Destination.Longitude)},
+		reachingTime,
+		in.Cab,
+		in.CabType,
+		domain.UserAddress{AddrType: in.NotificationAddr.Type, Value: strings.TrimSpace(in.NotificationAddr.Value)},
+	)
+	if err != nil {
+		fieldErrs, _ := errors.Cause(err).(domain.ValidationErrors)
+		for _, v := range fieldErrs {
+			// an unparseable reaching time is already reported
+			if v.Field != "reaching_time" || parsed {
+				verrs = append(verrs, v)
+			}
+		}
+	}
+	if err := verrs.Err(); err != nil {
+		return UserRequestDTO{}, errors.Wrap(err, "UserRequestInput is not valid")
+	}
+	return dto, nil
+}
+
+func parseReachingTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range formTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
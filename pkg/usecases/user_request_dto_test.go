@@ -0,0 +1,119 @@
+package usecases
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/anirbanroydas/ubernow-go/pkg/domain"
+)
+
+// fieldsOf returns the fields of the ValidationErrors which caused err.
+func fieldsOf(err error) []string {
+	var fields []string
+	switch v := errors.Cause(err).(type) {
+	case *domain.ValidationError:
+		fields = append(fields, v.Field)
+	case domain.ValidationErrors:
+		for _, e := range v {
+			fields = append(fields, e.Field)
+		}
+	}
+	return fields
+}
+
+func TestNewUserRequestDTO(t *testing.T) {
+	reachingTime := time.Date(2018, time.March, 9, 10, 0, 0, 0, time.UTC)
+	home := domain.Location{Latitude: "77.134134", Longitude: "45.1341324"}
+	office := domain.Location{Latitude: "77.234134", Longitude: "45.5641324"}
+	email := domain.UserAddress{AddrType: "email", Value: "anirban.nick@gmail.com"}
+
+	dto, err := NewUserRequestDTO(" roy ", home, office, reachingTime, "uber", "uberGo", email)
+	expected := UserRequestDTO{
+		name:             "roy",
+		source:           home,
+		destination:      office,
+		reachingTime:     reachingTime,
+		cab:              "uber",
+		cabType:          "uberGo",
+		notificationAddr: email,
+	}
+	if err != nil || !reflect.DeepEqual(dto, expected) {
+		t.Errorf("NewUserRequestDTO() => got: (%+v, %v), expected: (%+v, nil)", dto, err, expected)
+	}
+
+	_, err = NewUserRequestDTO("", domain.Location{Latitude: "91", Longitude: "45"}, domain.Location{Latitude: "north"}, time.Time{}, "", "", domain.UserAddress{})
+	expectedFields := []string{
+		"name",
+		"source.latitude",
+		"destination.latitude",
+		"destination.longitude",
+		"reaching_time",
+		"cab",
+		"cab_type",
+		"notification_addr.type",
+		"notification_addr.value",
+	}
+	if !domain.IsValidation(err) || !reflect.DeepEqual(fieldsOf(err), expectedFields) {
+		t.Errorf("NewUserRequestDTO() with invalid input => got: %v, expected errors of the fields %v", err, expectedFields)
+	}
+}
+
+func TestUserRequestInputDTO(t *testing.T) {
+	valid := UserRequestInput{
+		Name:             "roy",
+		Source:           LocationInput{Name: "home", Latitude: "77.134134", Longitude: " 45.1341324"},
+		Destination:      LocationInput{Latitude: "77.234134", Longitude: "45.5641324"},
+		ReachingTime:     "2018-03-09T10:00:00Z",
+		Cab:              "uber",
+		CabType:          "uberGo",
+		NotificationAddr: AddressInput{Type: "email", Value: "anirban.nick@gmail.com "},
+	}
+	unparseable := valid
+	unparseable.ReachingTime = "tomorrow"
+	dateTimeLocal := valid
+	dateTimeLocal.ReachingTime = "2018-03-09T10:00"
+	testCases := []struct {
+		name                 string
+		in                   UserRequestInput
+		expectedFields       []string
+		expectedReachingTime time.Time
+	}{
+		{
+			name:                 "valid input",
+			in:                   valid,
+			expectedReachingTime: time.Date(2018, time.March, 9, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:                 "reaching time of an HTML datetime-local input",
+			in:                   dateTimeLocal,
+			expectedReachingTime: time.Date(2018, time.March, 9, 10, 0, 0, 0, time.Local),
+		},
+		{
+			name:           "missing fields",
+			in:             UserRequestInput{Name: "roy", Cab: "uber"},
+			expectedFields: []string{"source.latitude", "source.longitude", "destination.latitude", "destination.longitude", "reaching_time", "cab_type", "notification_addr.type", "notification_addr.value"},
+		},
+		{
+			name:           "unparseable reaching time",
+			in:             unparseable,
+			expectedFields: []string{"reaching_time"},
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			dto, err := tc.in.DTO()
+			if !reflect.DeepEqual(fieldsOf(err), tc.expectedFields) {
+				t.Errorf("%s: DTO() => got: %v, expected errors of the fields %v", tc.name, err, tc.expectedFields)
+			}
+			if err == nil && (dto.source.Name != "home" || dto.source.Longitude != "45.1341324" ||
+				dto.notificationAddr.Value != "anirban.nick@gmail.com" || !dto.reachingTime.Equal(tc.expectedReachingTime)) {
+				t.Errorf("%s: DTO() => got: %+v, expected the parsed input", tc.name, dto)
+			}
+		})
+	}
+}
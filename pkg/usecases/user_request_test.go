@@ -1,6 +1,7 @@
 package usecases
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"testing"
@@ -25,6 +26,14 @@ func (ur *MockUserRepo) FindByID(userID uint64) (*domain.User, error) {
 	return MockUser, nil
 }
 
+func (ur *MockUserRepo) FindByAddress(a domain.UserAddress) (*domain.User, error) {
+	return nil, domain.ErrNotFound
+}
+
+func (ur *MockUserRepo) Update(u *domain.User) error {
+	return nil
+}
+
 // MockBadUserRepo implememts the domain.RequestRepository interface which alwasy returns some non nil error
 type MockBadUserRepo struct{}
 
@@ -39,6 +48,80 @@ func (ur *MockBadUserRepo) FindByID(userID uint64) (*domain.User, error) {
 	return MockUser, errors.New("couldn't find user")
 }
 
+func (ur *MockBadUserRepo) FindByAddress(a domain.UserAddress) (*domain.User, error) {
+	return nil, errors.New("couldn't find user")
+}
+
+func (ur *MockBadUserRepo) Update(u *domain.User) error {
+	return errors.New("couldn't update user")
+}
+
+// MockMapUserRepo implements the domain.UserRepository interface with a map, so the users
+// found by their address can be checked.
+type MockMapUserRepo struct {
+	users map[uint64]domain.User
+}
+
+func (ur *MockMapUserRepo) Store(u *domain.User) (uint64, error) {
+	for _, a := range u.Addresses {
+		if _, err := ur.FindByAddress(a); err == nil {
+			return 0, domain.ErrAddressTaken
+		}
+	}
+	id := uint64(len(ur.users) + 1)
+	stored := *u
+	stored.UserID = id
+	ur.users[id] = stored
+	return id, nil
+}
+
+func (ur *MockMapUserRepo) FindByID(userID uint64) (*domain.User, error) {
+	u, ok := ur.users[userID]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return &u, nil
+}
+
+func (ur *MockMapUserRepo) FindByAddress(a domain.UserAddress) (*domain.User, error) {
+	for _, u := range ur.users {
+		if u.HasAddress(a) {
+			return &u, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (ur *MockMapUserRepo) Update(u *domain.User) error {
+	if _, ok := ur.users[u.UserID]; !ok {
+		return domain.ErrNotFound
+	}
+	for _, a := range u.Addresses {
+		if owner, err := ur.FindByAddress(a); err == nil && owner.UserID != u.UserID {
+			return domain.ErrAddressTaken
+		}
+	}
+	ur.users[u.UserID] = *u
+	return nil
+}
+
+// MockConfirmationSender implements the domain.ConfirmationSender interface, it keeps the
+// last code sent to each address.
+type MockConfirmationSender struct {
+	codes map[domain.UserAddress]string
+	sent  int
+	err   error
+}
+
+func (s *MockConfirmationSender) SendConfirmation(ctx context.Context, a domain.UserAddress, code string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.codes[a] = code
+	s.sent++
+	return nil
+}
+
 // MockRequestRepo implememts the domain.RequestRepository interface which alwasy returns nil error
 type MockRequestRepo struct{}
 
@@ -53,6 +136,18 @@ func (rp *MockRequestRepo) FindByID(reqID uint64) (*domain.Request, error) {
 	return MockUser, nil
 }
 
+func (rp *MockRequestRepo) FindByUserID(userID uint64) ([]*domain.Request, error) {
+	return []*domain.Request{{UserID: userID}}, nil
+}
+
+func (rp *MockRequestRepo) List(f domain.RequestFilter) ([]*domain.Request, error) {
+	return []*domain.Request{{UserID: f.UserID}}, nil
+}
+
+func (rp *MockRequestRepo) Update(r *domain.Request) error {
+	return nil
+}
+
 // MockBadRequestRepo implememts the domain.RequestRepository interface which alwasy returns errors
 type MockBadRequestRepo struct{}
 
@@ -67,15 +162,106 @@ func (rp *MockBadRequestRepo) FindByID(reqID uint64) (*domain.Request, error) {
 	return MockUser, errors.New("couldn't store request to repo")
 }
 
+func (rp *MockBadRequestRepo) FindByUserID(userID uint64) ([]*domain.Request, error) {
+	return nil, errors.New("couldn't find requests in repo")
+}
+
+func (rp *MockBadRequestRepo) List(f domain.RequestFilter) ([]*domain.Request, error) {
+	return nil, errors.New("couldn't list requests in repo")
+}
+
+func (rp *MockBadRequestRepo) Update(r *domain.Request) error {
+	return errors.New("couldn't update request in repo")
+}
+
+// MockMapRequestRepo implements the domain.RequestRepository interface with a map, so the
+// changes to a request can be checked.
+type MockMapRequestRepo struct {
+	requests map[uint64]domain.Request
+}
+
+func (rp *MockMapRequestRepo) Store(r *domain.Request) (uint64, error) {
+	id := uint64(len(rp.requests) + 1)
+	r.SetID(id)
+	rp.requests[id] = *r
+	return id, nil
+}
+
+func (rp *MockMapRequestRepo) FindByID(reqID uint64) (*domain.Request, error) {
+	r, ok := rp.requests[reqID]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return &r, nil
+}
+
+func (rp *MockMapRequestRepo) FindByUserID(userID uint64) ([]*domain.Request, error) {
+	return rp.List(domain.RequestFilter{UserID: userID})
+}
+
+func (rp *MockMapRequestRepo) List(f domain.RequestFilter) ([]*domain.Request, error) {
+	var rs []*domain.Request
+	for id := uint64(1); id <= uint64(len(rp.requests)); id++ {
+		if r := rp.requests[id]; f.Match(&r) {
+			rs = append(rs, &r)
+		}
+	}
+	return rs, nil
+}
+
+func (rp *MockMapRequestRepo) Update(r *domain.Request) error {
+	stored, ok := rp.requests[r.ID()]
+	if !ok {
+		return domain.ErrNotFound
+	}
+	if stored.Version() != r.Version() {
+		return domain.ErrConflict
+	}
+	r.SetVersion(r.Version() + 1)
+	rp.requests[r.ID()] = *r
+	return nil
+}
+
+// MockConflictRequestRepo updates the stored request behind the back of the first
+// conflicts updates, as another server would, so they fail with domain.ErrConflict.
+type MockConflictRequestRepo struct {
+	*MockMapRequestRepo
+	conflicts int
+	updates   int
+}
+
+func (rp *MockConflictRequestRepo) Update(r *domain.Request) error {
+	rp.updates++
+	if rp.conflicts > 0 {
+		rp.conflicts--
+		stored := rp.requests[r.ID()]
+		stored.SetVersion(stored.Version() + 1)
+		rp.requests[r.ID()] = stored
+	}
+	return rp.MockMapRequestRepo.Update(r)
+}
+
 // MockLogger implements the domain.Logger interface
 type MockLogger struct{}
 
-func (l *MockLogger) LogError(m string) {
-	fmt.Println(m)
+func (l *MockLogger) Debug(m string, fields ...domain.Field) {
+	fmt.Println(m, fields)
+}
+
+func (l *MockLogger) Info(m string, fields ...domain.Field) {
+	fmt.Println(m, fields)
+}
+
+func (l *MockLogger) Warn(m string, fields ...domain.Field) {
+	fmt.Println(m, fields)
+}
+
+func (l *MockLogger) Error(m string, fields ...domain.Field) {
+	fmt.Println(m, fields)
 }
 
-func (l *MockLogger) LogInfo(m string) {
-	fmt.Println(m)
+func (l *MockLogger) With(fields ...domain.Field) domain.Logger {
+	return l
 }
 
 func testUserInteractor(t *testing.T) *UserInteractor {
@@ -91,81 +277,69 @@ func testUserInteractor(t *testing.T) *UserInteractor {
 	nI := testNotificationInteractor(t)
 	nsI := testNotificationServiceInteractor(t)
 
-	return NewUserInteractor(uRepo, reqRepo, c, a, trI, cabI, cabEngI, nI, nsI)
+	return NewUserInteractor(uRepo, reqRepo, c, a, trI, cabI, cabEngI, nI, nsI, NewRequestCanceller(), NewRequestWatcher())
 }
 
-func TestCreateAndSaveUser(t *testing.T) {
-	uRoy := domain.NewUser("roy")
-	uEmtpy := domain.NewUser("")
+func TestFindOrCreateUser(t *testing.T) {
+	email := domain.UserAddress{AddrType: "email", Value: "anirba.nick@gmail.com"}
+	other := domain.UserAddress{AddrType: "email", Value: "roy@example.com"}
+	roy := domain.User{UserID: 1, Name: "roy", Addresses: []domain.UserAddress{email}}
 	interactor := testUserInteractor(t)
+	uRepo := &MockMapUserRepo{users: map[uint64]domain.User{1: roy}}
+	interactor.UserRepository = uRepo
 
 	testCases := []struct {
-		name          string
-		userName      string
-		expectedUser  *domain.User
-		expectedError error
+		name         string
+		userName     string
+		addr         domain.UserAddress
+		expectedUser domain.User
+		expectedCode bool
 	}{
 		{
-			name:          "valid name and no error from user repository",
-			userName:      "roy",
-			expectedUser:  uRoy,
-			expectedError: nil,
+			name:         "confirmed address finds the user and keeps their name",
+			userName:     "anirban",
+			addr:         email,
+			expectedUser: roy,
 		},
 		{
-			name:          "empty name and no error from user repository",
-			userName:      "",
-			expectedUser:  uEmtpy,
-			expectedError: nil,
+			name:         "address of no user creates the user with the address pending",
+			userName:     "roy",
+			addr:         other,
+			expectedUser: domain.User{UserID: 2, Name: "roy"},
+			expectedCode: true,
+		},
+		{
+			name:         "pending address creates another user",
+			userName:     "nick",
+			addr:         other,
+			expectedUser: domain.User{UserID: 3, Name: "nick"},
+			expectedCode: true,
 		},
 	}
 
 	for i, _ := range testCases {
 		tc := testCases[i]
 		t.Run(tc.name, func(t *testing.T) {
-			user, err := interactor.createAndSaveUser(tc.userName)
-			if !reflect.DeepEqual(user, tc.expectedUser) ||
-				(err != nil && tc.expectedError == nil) ||
-				(err == nil && tc.expectedError != nil) {
-
-				t.Errorf("%s: createAndSaveUser(%s) => got: (%v, %v) expected: (%v, %v)", tc.name, tc.userName, user, err, tc.expectedUser, tc.expectedError)
+			user, code, err := interactor.findOrCreateUser(tc.userName, tc.addr)
+			if err != nil {
+				t.Fatalf("%s: findOrCreateUser(%s, %v) => got: %v, expected: nil", tc.name, tc.userName, tc.addr, err)
+			}
+			pending := user.Pending
+			got := *user
+			got.Pending = nil
+			if !reflect.DeepEqual(got, tc.expectedUser) || (code != "") != tc.expectedCode {
+				t.Errorf("%s: findOrCreateUser(%s, %v) => got: (%v, %q) expected: (%v, code %v)", tc.name, tc.userName, tc.addr, got, code, tc.expectedUser, tc.expectedCode)
+			}
+			if tc.expectedCode && (len(pending) != 1 || pending[0].Address != tc.addr || pending[0].Code != code) {
+				t.Errorf("%s: findOrCreateUser(%s, %v) => got pending: %v, expected the address pending with code %q", tc.name, tc.userName, tc.addr, pending, code)
 			}
 		})
 	}
 
 	// Mock userepo which returns error
 	interactor.UserRepository = &MockBadUserRepo{}
-
-	testCases = []struct {
-		name          string
-		userName      string
-		expectedUser  *domain.User
-		expectedError error
-	}{
-		{
-			name:          "valid name and some error from user repository",
-			userName:      "roy",
-			expectedUser:  uRoy,
-			expectedError: errors.New("Some User repo store error"),
-		},
-		{
-			name:          "empty name and some error from user repository",
-			userName:      "",
-			expectedUser:  uEmtpy,
-			expectedError: errors.New("Some User repo store error"),
-		},
-	}
-
-	for i, _ := range testCases {
-		tc := testCases[i]
-		t.Run(tc.name, func(t *testing.T) {
-			user, err := interactor.createAndSaveUser(tc.userName)
-			if !reflect.DeepEqual(user, tc.expectedUser) ||
-				(err != nil && tc.expectedError == nil) ||
-				(err == nil && tc.expectedError != nil) {
-
-				t.Errorf("%s: createAndSaveUser(%s) => got: (%v, %v) expected: (%v, %v)", tc.name, tc.userName, user, err, tc.expectedUser, tc.expectedError)
-			}
-		})
+	if _, _, err := interactor.findOrCreateUser("roy", email); err == nil {
+		t.Errorf("findOrCreateUser() with a failing user repository => got: nil, expected an error")
 	}
 }
 
@@ -222,7 +396,14 @@ func TestCreateAndSaveRequest(t *testing.T) {
 	// create a mock UserAddressValidator
 	uav := MockAddressValidator{}
 	// create a valid domain.Request
-	r, _ := domain.NewRequest(uReqDTO.source, uReqDTO.destination, uReqDTO.reachingTime, uReqDTO.cab, uReqDTO.cabType, uReqDTO.notificationAddr, uav)
+	r, _ := domain.NewRequest(uReqDTO.source, uReqDTO.destination, uReqDTO.reachingTime, uReqDTO.cab, uReqDTO.cabType, nil, uReqDTO.notificationAddr, uav)
+	// the same request once MockRequestRepo has stored it and assigned its id
+	storedR := *r
+	storedR.UserID = 123
+	storedR.SetID(456)
+	// the same request when MockBadRequestRepo failed to store it
+	unstoredR := *r
+	unstoredR.UserID = 123
 	someError := errors.New("some error")
 
 	// initialzie the test UserRequestInteractor
@@ -279,7 +460,7 @@ func TestCreateAndSaveRequest(t *testing.T) {
 		{
 			name:            "valid uReqDTO with valid parameters and no error in RequestRepo",
 			uReqDTO:         uReqDTO,
-			expectedRequest: r,
+			expectedRequest: &storedR,
 			expectedError:   nil,
 		},
 	}
@@ -287,12 +468,13 @@ func TestCreateAndSaveRequest(t *testing.T) {
 	for i, _ := range testCases {
 		tc := testCases[i]
 		t.Run(tc.name, func(t *testing.T) {
-			req, err := interactor.createAndSaveRequest(tc.uReqDTO)
-			if !reflect.DeepEqual(req, tc.expectedRequest) ||
+			req, err := interactor.createAndSaveRequest(tc.uReqDTO, 123)
+			if !reflect.DeepEqual(withoutGenerated(req), withoutGenerated(tc.expectedRequest)) ||
+				(req != nil && req.Token == "") ||
 				(err != nil && tc.expectedError == nil) ||
 				(err == nil && tc.expectedError != nil) {
 
-				t.Errorf("%s: createAndSaveRequest(%v) => got: (%v, %v) expected: (%v, %v)", tc.name, tc.uReqDTO, req, err, tc.expectedRequest, tc.expectedError)
+				t.Errorf("%s: createAndSaveRequest(%v, 123) => got: (%v, %v) expected: (%v, %v)", tc.name, tc.uReqDTO, req, err, tc.expectedRequest, tc.expectedError)
 			}
 		})
 	}
@@ -309,7 +491,7 @@ func TestCreateAndSaveRequest(t *testing.T) {
 		{
 			name:            "valid uReqDTO with valid parameters but error in RequestRepo",
 			uReqDTO:         uReqDTO,
-			expectedRequest: r,
+			expectedRequest: &unstoredR,
 			expectedError:   someError,
 		},
 	}
@@ -317,16 +499,70 @@ func TestCreateAndSaveRequest(t *testing.T) {
 	for i, _ := range testCases {
 		tc := testCases[i]
 		t.Run(tc.name, func(t *testing.T) {
-			req, err := interactor.createAndSaveRequest(tc.uReqDTO)
-			if !reflect.DeepEqual(req, tc.expectedRequest) ||
+			req, err := interactor.createAndSaveRequest(tc.uReqDTO, 123)
+			if !reflect.DeepEqual(withoutGenerated(req), withoutGenerated(tc.expectedRequest)) ||
+				(req != nil && req.Token == "") ||
 				(err != nil && tc.expectedError == nil) ||
 				(err == nil && tc.expectedError != nil) {
 
-				t.Errorf("%s: createAndSaveRequest(%v) => got: (%v, %v) expected: (%v, %v)", tc.name, tc.uReqDTO, req, err, tc.expectedRequest, tc.expectedError)
+				t.Errorf("%s: createAndSaveRequest(%v, 123) => got: (%v, %v) expected: (%v, %v)", tc.name, tc.uReqDTO, req, err, tc.expectedRequest, tc.expectedError)
+			}
+		})
+	}
+
+}
+
+func TestCreateAndSaveRequestValidatesCabsOfCatalog(t *testing.T) {
+	uReqDTO := UserRequestDTO{
+		name:         "roy",
+		source:       domain.Location{Latitude: "77.134134", Longitude: "45.1341324"},
+		destination:  domain.Location{Latitude: "77.234134", Longitude: "45.5641324"},
+		reachingTime: time.Now().Add(5 * time.Hour),
+		notificationAddr: domain.UserAddress{
+			AddrType: "email",
+			Value:    "anirba.nick@gmail.com",
+		},
+	}
+	testCases := []struct {
+		name         string
+		cab, cabType string
+		valid        bool
+	}{
+		{name: "cab of the catalog", cab: "ola", cabType: "olaMini", valid: true},
+		{name: "default cab which isn't in the catalog", cab: "uber", cabType: "uberGo", valid: false},
+	}
+
+	interactor := testUserInteractor(t)
+	interactor.Cabs = domain.CabCatalog{{Name: "ola", Types: []string{"olaMini"}}}
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			dto := uReqDTO
+			dto.cab, dto.cabType = tc.cab, tc.cabType
+			_, err := interactor.createAndSaveRequest(dto, 123)
+			if tc.valid && err != nil {
+				t.Errorf("%s: createAndSaveRequest() => got: %v, expected: nil", tc.name, err)
+			}
+			if !tc.valid && !domain.IsValidation(err) {
+				t.Errorf("%s: createAndSaveRequest() => got: %v, expected a validation error", tc.name, err)
 			}
 		})
 	}
+}
 
+// withoutGenerated returns a copy of the request without its Token and whose History has
+// no times, they are random or when the request was created and can't be expected.
+func withoutGenerated(r *domain.Request) *domain.Request {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	c.Token = ""
+	c.History = nil
+	for _, e := range r.History {
+		c.History = append(c.History, domain.RequestEvent{Status: e.Status})
+	}
+	return &c
 }
 
 func TestSendQueue(t *testing.T) {
@@ -356,7 +592,7 @@ func TestSendQueue(t *testing.T) {
 	// create a mock UserAddressValidator
 	uav := MockAddressValidator{}
 	// create a valid domain.Request
-	r, _ := domain.NewRequest(uReqDTO.source, uReqDTO.destination, uReqDTO.reachingTime, uReqDTO.cab, uReqDTO.cabType, uReqDTO.notificationAddr, uav)
+	r, _ := domain.NewRequest(uReqDTO.source, uReqDTO.destination, uReqDTO.reachingTime, uReqDTO.cab, uReqDTO.cabType, nil, uReqDTO.notificationAddr, uav)
 	uReq := domain.NewUserRequest(u, r)
 
 	testCases := []struct {
@@ -407,3 +643,364 @@ func TestSendQueue(t *testing.T) {
 	}
 
 }
+
+func testUserRequestDTO(t *testing.T) UserRequestDTO {
+	t.Helper()
+
+	dto, err := NewUserRequestDTO(
+		"roy",
+		domain.Location{Latitude: "77.134134", Longitude: "45.1341324"},
+		domain.Location{Latitude: "77.234134", Longitude: "45.5641324"},
+		time.Now().Add(5*time.Hour),
+		"uber",
+		"uberGo",
+		domain.UserAddress{AddrType: "email", Value: "anirba.nick@gmail.com"},
+	)
+	if err != nil {
+		t.Fatalf("NewUserRequestDTO() => got: %v, expected: nil", err)
+	}
+	return dto
+}
+
+func TestCreateUserRequest(t *testing.T) {
+	interactor := testUserInteractor(t)
+	reqRepo := &MockMapRequestRepo{requests: make(map[uint64]domain.Request)}
+	interactor.RequestRepository = reqRepo
+
+	ur, err := interactor.CreateUserRequest(testUserRequestDTO(t))
+	if err != nil {
+		t.Fatalf("CreateUserRequest() => got: %v, expected: nil", err)
+	}
+	if ur.User.UserID != 123 || ur.Request.ID() != 1 || ur.Request.UserID != 123 || ur.Request.Status != domain.RequestPending {
+		t.Errorf("CreateUserRequest() => got: (user %d, request %d of user %d, %s), expected: (user 123, request 1 of user 123, pending)", ur.User.UserID, ur.Request.ID(), ur.Request.UserID, ur.Request.Status)
+	}
+
+	invalid := testUserRequestDTO(t)
+	invalid.notificationAddr.AddrType = "pigeon"
+	_, err = interactor.CreateUserRequest(invalid)
+	if !domain.IsValidation(err) {
+		t.Errorf("CreateUserRequest() with invalid address type => got: %v, expected a validation error", err)
+	}
+
+	invalid = testUserRequestDTO(t)
+	invalid.cab = "ola"
+	_, err = interactor.CreateUserRequest(invalid)
+	if !domain.IsValidation(err) {
+		t.Errorf("CreateUserRequest() with invalid cab => got: %v, expected a validation error", err)
+	}
+	if len(reqRepo.requests) != 1 {
+		t.Errorf("CreateUserRequest() with invalid cab => got %d stored requests, expected: 1", len(reqRepo.requests))
+	}
+}
+
+func TestCreateUserRequestFindsUserByAddress(t *testing.T) {
+	interactor := testUserInteractor(t)
+	uRepo := &MockMapUserRepo{users: make(map[uint64]domain.User)}
+	interactor.UserRepository = uRepo
+	interactor.RequestRepository = &MockMapRequestRepo{requests: make(map[uint64]domain.Request)}
+	sender := &MockConfirmationSender{codes: make(map[domain.UserAddress]string)}
+	interactor.ConfirmationSender = sender
+	email := domain.UserAddress{AddrType: "email", Value: "anirba.nick@gmail.com"}
+
+	first, err := interactor.CreateUserRequest(testUserRequestDTO(t))
+	if err != nil {
+		t.Fatalf("CreateUserRequest() => got: %v, expected: nil", err)
+	}
+	code, ok := sender.codes[email]
+	if !ok || len(first.User.Addresses) != 0 {
+		t.Fatalf("CreateUserRequest() of a new address => got: (code sent %v, addresses %v), expected the code sent and the address pending", ok, first.User.Addresses)
+	}
+	if _, err = interactor.ConfirmUserAddress(first.User.UserID, email, code); err != nil {
+		t.Fatalf("ConfirmUserAddress(%d, %v, %q) => got: %v, expected: nil", first.User.UserID, email, code, err)
+	}
+	// the same address written differently belongs to the same user
+	dto := testUserRequestDTO(t)
+	dto.name = "anirban"
+	dto.notificationAddr.Value = " Anirba.Nick@Gmail.com"
+	second, err := interactor.CreateUserRequest(dto)
+	if err != nil || second.User.UserID != first.User.UserID || second.Request.UserID != first.User.UserID {
+		t.Errorf("CreateUserRequest() with the same address => got: (%v, %v), expected a request of user %d", second, err, first.User.UserID)
+	}
+	if len(uRepo.users) != 1 || second.Request.NotificationAddr.Value != "anirba.nick@gmail.com" {
+		t.Errorf("CreateUserRequest() with the same address => got: (%d users, address %v), expected one user and the normalized address", len(uRepo.users), second.Request.NotificationAddr)
+	}
+	if sender.sent != 1 {
+		t.Errorf("CreateUserRequest() with the confirmed address => got %d codes sent, expected: 1", sender.sent)
+	}
+
+	rs, _ := interactor.RequestRepository.FindByUserID(first.User.UserID)
+	if len(rs) != 2 {
+		t.Errorf("FindByUserID(%d) => got %d requests, expected: 2", first.User.UserID, len(rs))
+	}
+
+	// the request of a new address is created even if its code can't be sent
+	sender.err = errors.New("couldn't send")
+	dto = testUserRequestDTO(t)
+	dto.notificationAddr.Value = "roy@example.com"
+	if _, err = interactor.CreateUserRequest(dto); err != nil {
+		t.Errorf("CreateUserRequest() with a failing ConfirmationSender => got: %v, expected: nil", err)
+	}
+}
+
+func TestSaveUserAddress(t *testing.T) {
+	royAddr := domain.UserAddress{AddrType: "email", Value: "roy@example.com"}
+	nickAddr := domain.UserAddress{AddrType: "email", Value: "nick@example.com"}
+	work := domain.UserAddress{AddrType: "email", Value: "roy@work.example.com"}
+	interactor := testUserInteractor(t)
+	interactor.UserRepository = &MockMapUserRepo{users: map[uint64]domain.User{
+		1: {UserID: 1, Name: "roy", Addresses: []domain.UserAddress{royAddr}},
+		2: {UserID: 2, Name: "nick", Addresses: []domain.UserAddress{nickAddr}},
+	}}
+	sender := &MockConfirmationSender{codes: make(map[domain.UserAddress]string)}
+	interactor.ConfirmationSender = sender
+
+	testCases := []struct {
+		name            string
+		userID          uint64
+		addr            domain.UserAddress
+		expectedPending int
+		expectedSent    int
+		expectedError   error
+	}{
+		{
+			name:            "new address is pending normalized and its code sent",
+			userID:          1,
+			addr:            domain.UserAddress{AddrType: "email", Value: "Roy@Work.example.com"},
+			expectedPending: 1,
+			expectedSent:    1,
+		},
+		{
+			name:            "pending address is sent a new code",
+			userID:          1,
+			addr:            work,
+			expectedPending: 1,
+			expectedSent:    2,
+		},
+		{
+			name:            "confirmed address is not sent a code",
+			userID:          1,
+			addr:            royAddr,
+			expectedPending: 1,
+			expectedSent:    2,
+		},
+		{
+			name:            "address of another user is pending until it is confirmed",
+			userID:          1,
+			addr:            nickAddr,
+			expectedPending: 2,
+			expectedSent:    3,
+		},
+		{
+			name:          "unknown user",
+			userID:        99,
+			addr:          domain.UserAddress{AddrType: "email", Value: "roy@home.example.com"},
+			expectedSent:  3,
+			expectedError: domain.ErrNotFound,
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := interactor.SaveUserAddress(tc.userID, tc.addr)
+			if errors.Cause(err) != tc.expectedError || (err == nil && len(u.Pending) != tc.expectedPending) || sender.sent != tc.expectedSent {
+				t.Errorf("%s: SaveUserAddress(%d, %v) => got: (%v, %v, %d sent), expected: (%d pending, %v, %d sent)", tc.name, tc.userID, tc.addr, u, err, sender.sent, tc.expectedPending, tc.expectedError, tc.expectedSent)
+			}
+		})
+	}
+
+	_, err := interactor.SaveUserAddress(2, domain.UserAddress{AddrType: "email", Value: "not an email"})
+	if !domain.IsValidation(err) {
+		t.Errorf("SaveUserAddress() of an invalid address => got: %v, expected a validation error", err)
+	}
+	sender.err = errors.New("couldn't send")
+	if _, err = interactor.SaveUserAddress(2, work); err == nil {
+		t.Errorf("SaveUserAddress() with a failing ConfirmationSender => got: nil, expected an error")
+	}
+	if u, _ := interactor.GetUser(1); u.HasAddress(work) {
+		t.Errorf("GetUser(1) => got: %v, expected the saved address pending", u)
+	}
+}
+
+func TestConfirmUserAddress(t *testing.T) {
+	royAddr := domain.UserAddress{AddrType: "email", Value: "roy@example.com"}
+	nickAddr := domain.UserAddress{AddrType: "email", Value: "nick@example.com"}
+	work := domain.UserAddress{AddrType: "email", Value: "roy@work.example.com"}
+	interactor := testUserInteractor(t)
+	interactor.UserRepository = &MockMapUserRepo{users: map[uint64]domain.User{
+		1: {UserID: 1, Name: "roy", Addresses: []domain.UserAddress{royAddr}},
+		2: {UserID: 2, Name: "nick", Addresses: []domain.UserAddress{nickAddr}},
+	}}
+	sender := &MockConfirmationSender{codes: make(map[domain.UserAddress]string)}
+	interactor.ConfirmationSender = sender
+	interactor.SaveUserAddress(1, work)
+	interactor.SaveUserAddress(1, nickAddr)
+
+	testCases := []struct {
+		name          string
+		userID        uint64
+		addr          domain.UserAddress
+		code          string
+		validation    bool
+		expectedError error
+	}{
+		{
+			name:       "wrong code",
+			userID:     1,
+			addr:       work,
+			code:       "not the code",
+			validation: true,
+		},
+		{
+			name:       "code of another address",
+			userID:     1,
+			addr:       work,
+			code:       sender.codes[nickAddr],
+			validation: true,
+		},
+		{
+			name:   "code sent to the address",
+			userID: 1,
+			addr:   domain.UserAddress{AddrType: "email", Value: "Roy@Work.example.com"},
+			code:   sender.codes[work],
+		},
+		{
+			name:          "address another user confirmed",
+			userID:        1,
+			addr:          nickAddr,
+			code:          sender.codes[nickAddr],
+			expectedError: domain.ErrAddressTaken,
+		},
+		{
+			name:          "unknown user",
+			userID:        99,
+			addr:          work,
+			code:          sender.codes[work],
+			expectedError: domain.ErrNotFound,
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			u, err := interactor.ConfirmUserAddress(tc.userID, tc.addr, tc.code)
+			if tc.validation {
+				if !domain.IsValidation(err) {
+					t.Errorf("%s: ConfirmUserAddress(%d, %v, %q) => got: %v, expected a validation error", tc.name, tc.userID, tc.addr, tc.code, err)
+				}
+				return
+			}
+			if errors.Cause(err) != tc.expectedError || (err == nil && !u.HasAddress(work)) {
+				t.Errorf("%s: ConfirmUserAddress(%d, %v, %q) => got: (%v, %v), expected: (the address confirmed, %v)", tc.name, tc.userID, tc.addr, tc.code, u, err, tc.expectedError)
+			}
+		})
+	}
+
+	if u, _ := interactor.GetUser(1); !u.HasAddress(work) || len(u.Pending) != 1 {
+		t.Errorf("GetUser(1) => got: %v, expected the confirmed address saved and the address of the other user pending", u)
+	}
+}
+
+func TestSaveUserPlace(t *testing.T) {
+	interactor := testUserInteractor(t)
+	interactor.UserRepository = &MockMapUserRepo{users: make(map[uint64]domain.User)}
+	roy, _, _ := interactor.findOrCreateUser("roy", domain.UserAddress{AddrType: "email", Value: "roy@example.com"})
+	home := domain.Location{Name: "home", Latitude: "12.9352", Longitude: "77.6245"}
+
+	u, err := interactor.SaveUserPlace(roy.UserID, home)
+	if err != nil || !reflect.DeepEqual(u.Places, []domain.Location{home}) {
+		t.Errorf("SaveUserPlace(%d, %v) => got: (%v, %v), expected the place saved", roy.UserID, home, u, err)
+	}
+	if _, err = interactor.SaveUserPlace(roy.UserID, domain.Location{Latitude: "91", Longitude: "77.6245"}); !domain.IsValidation(err) {
+		t.Errorf("SaveUserPlace() of a place without name and with an invalid latitude => got: %v, expected a validation error", err)
+	}
+	if _, err = interactor.SaveUserPlace(99, home); errors.Cause(err) != domain.ErrNotFound {
+		t.Errorf("SaveUserPlace() of unknown user => got: %v, expected: %v", err, domain.ErrNotFound)
+	}
+}
+
+func TestCancelUserRequest(t *testing.T) {
+	interactor := testUserInteractor(t)
+	interactor.RequestRepository = &MockMapRequestRepo{requests: make(map[uint64]domain.Request)}
+	ur, _ := interactor.CreateUserRequest(testUserRequestDTO(t))
+	reqID, token := ur.Request.ID(), ur.Request.Token
+
+	testCases := []struct {
+		name          string
+		reqID         uint64
+		token         string
+		expectedError error
+	}{
+		{
+			name:          "request with another token",
+			reqID:         reqID,
+			token:         "guessed",
+			expectedError: domain.ErrNotFound,
+		},
+		{
+			name:          "pending request is cancelled",
+			reqID:         reqID,
+			token:         token,
+			expectedError: nil,
+		},
+		{
+			name:          "cancelled request can't be cancelled again",
+			reqID:         reqID,
+			token:         token,
+			expectedError: domain.ErrRequestFinished,
+		},
+		{
+			name:          "unknown request",
+			reqID:         99,
+			token:         token,
+			expectedError: domain.ErrNotFound,
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := interactor.CancelUserRequest(tc.reqID, tc.token)
+			if errors.Cause(err) != tc.expectedError {
+				t.Errorf("%s: CancelUserRequest(%d) => got: %v, expected: %v", tc.name, tc.reqID, err, tc.expectedError)
+			}
+		})
+	}
+
+	if _, err := interactor.GetUserRequest(reqID, ""); errors.Cause(err) != domain.ErrNotFound {
+		t.Errorf("GetUserRequest() without the token => got: %v, expected: %v", err, domain.ErrNotFound)
+	}
+	r, _ := interactor.GetUserRequest(reqID, token)
+	if r.Status != domain.RequestCancelled {
+		t.Errorf("GetUserRequest() after cancelling => got status: %s, expected: %s", r.Status, domain.RequestCancelled)
+	}
+	if !interactor.RequestCanceller.IsCancelled(reqID) {
+		t.Errorf("RequestCanceller.IsCancelled(%d) after cancelling => got: false, expected: true", reqID)
+	}
+}
+
+func TestWatchUserRequest(t *testing.T) {
+	interactor := testUserInteractor(t)
+	interactor.RequestRepository = &MockMapRequestRepo{requests: make(map[uint64]domain.Request)}
+	ur, _ := interactor.CreateUserRequest(testUserRequestDTO(t))
+	reqID, token := ur.Request.ID(), ur.Request.Token
+
+	r, updates, stop, err := interactor.WatchUserRequest(reqID, token)
+	if err != nil || r.Status != domain.RequestPending {
+		t.Fatalf("WatchUserRequest(%d) => got: (%+v, %v), expected: (pending request, nil)", reqID, r, err)
+	}
+	defer stop()
+	interactor.CancelUserRequest(reqID, token)
+	if u := <-updates; u.Request.Status != domain.RequestCancelled {
+		t.Errorf("WatchUserRequest(%d) after cancelling => got update: %+v, expected status: %s", reqID, u.Request, domain.RequestCancelled)
+	}
+
+	_, _, _, err = interactor.WatchUserRequest(99, token)
+	if errors.Cause(err) != domain.ErrNotFound {
+		t.Errorf("WatchUserRequest(99) => got: %v, expected: %v", err, domain.ErrNotFound)
+	}
+	_, _, _, err = interactor.WatchUserRequest(reqID, "")
+	if errors.Cause(err) != domain.ErrNotFound {
+		t.Errorf("WatchUserRequest(%d) without the token => got: %v, expected: %v", reqID, err, domain.ErrNotFound)
+	}
+}
@@ -12,11 +12,15 @@ import (
 const (
 	// createing a very basic email validator
 	Email string = "^(((([a-zA-Z]|\\d|[!#\\$%&'\\*\\+\\-\\/=\\?\\^_`{\\|}~]|[\\x{00A0}-\\x{D7FF}\\x{F900}-\\x{FDCF}\\x{FDF0}-\\x{FFEF}])+(\\.([a-zA-Z]|\\d|[!#\\$%&'\\*\\+\\-\\/=\\?\\^_`{\\|}~]|[\\x{00A0}-\\x{D7FF}\\x{F900}-\\x{FDCF}\\x{FDF0}-\\x{FFEF}])+)*)|((\\x22)((((\\x20|\\x09)*(\\x0d\\x0a))?(\\x20|\\x09)+)?(([\\x01-\\x08\\x0b\\x0c\\x0e-\\x1f\\x7f]|\\x21|[\\x23-\\x5b]|[\\x5d-\\x7e]|[\\x{00A0}-\\x{D7FF}\\x{F900}-\\x{FDCF}\\x{FDF0}-\\x{FFEF}])|(\\([\\x01-\\x09\\x0b\\x0c\\x0d-\\x7f]|[\\x{00A0}-\\x{D7FF}\\x{F900}-\\x{FDCF}\\x{FDF0}-\\x{FFEF}]))))*(((\\x20|\\x09)*(\\x0d\\x0a))?(\\x20|\\x09)+)?(\\x22)))@((([a-zA-Z]|\\d|[\\x{00A0}-\\x{D7FF}\\x{F900}-\\x{FDCF}\\x{FDF0}-\\x{FFEF}])|(([a-zA-Z]|\\d|[\\x{00A0}-\\x{D7FF}\\x{F900}-\\x{FDCF}\\x{FDF0}-\\x{FFEF}])([a-zA-Z]|\\d|-|\\.|_|~|[\\x{00A0}-\\x{D7FF}\\x{F900}-\\x{FDCF}\\x{FDF0}-\\x{FFEF}])*([a-zA-Z]|\\d|[\\x{00A0}-\\x{D7FF}\\x{F900}-\\x{FDCF}\\x{FDF0}-\\x{FFEF}])))\\.)+(([a-zA-Z]|[\\x{00A0}-\\x{D7FF}\\x{F900}-\\x{FDCF}\\x{FDF0}-\\x{FFEF}])|(([a-zA-Z]|[\\x{00A0}-\\x{D7FF}\\x{F900}-\\x{FDCF}\\x{FDF0}-\\x{FFEF}])([a-zA-Z]|\\d|-|_|~|[\\x{00A0}-\\x{D7FF}\\x{F900}-\\x{FDCF}\\x{FDF0}-\\x{FFEF}])*([a-zA-Z]|[\\x{00A0}-\\x{D7FF}\\x{F900}-\\x{FDCF}\\x{FDF0}-\\x{FFEF}])))\\.?$"
+	// E164 is the format of phone numbers, a + and the country code followed by the
+	// subscriber number, 15 digits at most.
+	E164 string = `^\+[1-9][0-9]{6,14}$`
 )
 
 var (
 	// createing a very basic email validator
 	rxEmail = regexp.MustCompile(Email)
+	rxE164  = regexp.MustCompile(E164)
 )
 
 type EmailAddressValidator struct{}
@@ -36,12 +40,44 @@ func validEmailValue(email string) bool {
 	return true
 }
 
+// PhoneAddressValidator validates the phone numbers of sms addresses, which must be in
+// E.164 format once they are normalized by domain.NormalizeAddress.
+type PhoneAddressValidator struct{}
+
+func (p PhoneAddressValidator) Validate(ua domain.UserAddress) error {
+	if !validPhoneValue(ua.Value) {
+		return errors.New("phone number is not in E.164 format with its country code, like +919876543210")
+	}
+
+	return nil
+}
+
+func validPhoneValue(phone string) bool {
+	return rxE164.MatchString(phone)
+}
+
 func NewUserAddressValidator(addressType string) (domain.UserAddressValidator, error) {
 	var av domain.UserAddressValidator
 	switch addressType {
 	case "email":
 		return EmailAddressValidator{}, nil
+	case "sms":
+		return PhoneAddressValidator{}, nil
 	default:
-		return av, errors.New(fmt.Sprintf("no UserAddressValidotor exists for give addressType: %s", addressType))
+		return av, domain.NewValidationError("notification_addr", "no UserAddressValidotor exists for give addressType: %s", addressType)
+	}
+}
+
+// validateAddress returns the normalized address if the UserAddressValidator of its type
+// accepts it, or a domain.ValidationError of the field the address was given in.
+func validateAddress(field string, a domain.UserAddress) (domain.UserAddress, error) {
+	a = domain.NormalizeAddress(a)
+	uav, err := NewUserAddressValidator(a.AddrType)
+	if err != nil {
+		return a, domain.NewValidationError(field, "no UserAddressValidotor exists for give addressType: %s", a.AddrType)
+	}
+	if err = uav.Validate(a); err != nil {
+		return a, domain.NewValidationError(field, "%s", err)
 	}
+	return a, nil
 }
@@ -72,6 +72,70 @@ func TestValidEmailValue(t *testing.T) {
 	}
 }
 
+func TestValidPhoneValue(t *testing.T) {
+	testCases := []struct {
+		name     string
+		phone    string
+		expected bool
+	}{
+		{
+			name:     "valid indian mobile number",
+			phone:    "+919876543210",
+			expected: true,
+		},
+		{
+			name:     "valid number of 15 digits",
+			phone:    "+861234567890123",
+			expected: true,
+		},
+		{
+			name:     "invalid number without country code",
+			phone:    "9876543210",
+			expected: false,
+		},
+		{
+			name:     "invalid number with country code 0",
+			phone:    "+09876543210",
+			expected: false,
+		},
+		{
+			name:     "invalid number longer than 15 digits",
+			phone:    "+9198765432101234",
+			expected: false,
+		},
+		{
+			name:     "invalid number with letters",
+			phone:    "+91987654321O",
+			expected: false,
+		},
+		{
+			name:     "invalid number which is not normalized",
+			phone:    "+91 98765 43210",
+			expected: false,
+		},
+	}
+
+	for i, _ := range testCases {
+		tc := testCases[i]
+		t.Run(tc.name, func(t *testing.T) {
+			result := validPhoneValue(tc.phone)
+			if result != tc.expected {
+				t.Errorf("%s: validPhoneValue(%s) => Got: %v, expected: %v", tc.name, tc.phone, result, tc.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyPhoneAddress(t *testing.T) {
+	a, err := validateAddress("notification_addr", domain.UserAddress{AddrType: "SMS", Value: "0091 98765-43210"})
+	if err != nil || a != (domain.UserAddress{AddrType: "sms", Value: "+919876543210"}) {
+		t.Errorf("validateAddress() => Got: (%v, %v), expected: ({sms +919876543210}, nil)", a, err)
+	}
+	if _, err = validateAddress("notification_addr", domain.UserAddress{AddrType: "sms", Value: "98765 43210"}); !domain.IsValidation(err) {
+		t.Errorf("validateAddress() without country code => Got: %v, expected a validation error", err)
+	}
+}
+
 func TestNewUserAddressValidator(t *testing.T) {
 	var nilAddressValidator domain.UserAddressValidator
 	testCases := []struct {
@@ -86,6 +150,12 @@ func TestNewUserAddressValidator(t *testing.T) {
 			expectedResult: EmailAddressValidator{},
 			expectedError:  nil,
 		},
+		{
+			name:           "addressType as sms",
+			addressType:    "sms",
+			expectedResult: PhoneAddressValidator{},
+			expectedError:  nil,
+		},
 		{
 			name:           "addressType as phone",
 			addressType:    "phone",